@@ -67,3 +67,44 @@ func BenchmarkPackedAddress_ComparePacked(b *testing.B) {
 	})
 	b.ReportAllocs()
 }
+
+func TestIntegratedAddress(t *testing.T) {
+	var paymentId [monero.PaymentIdSize]byte
+	_, _ = rand.Read(paymentId[:])
+
+	ia, err := NewIntegratedAddress(testAddress, paymentId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ia.IntegratedTypeNetwork() != monero.IntegratedMainNetwork {
+		t.Fatalf("unexpected network %d", ia.IntegratedTypeNetwork())
+	}
+
+	encoded := ia.ToBase58()
+	if len(encoded) != 106 || encoded[0] != '4' {
+		t.Fatalf("unexpected integrated address %s", encoded)
+	}
+
+	decoded := FromBase58Integrated(string(encoded))
+	if decoded == nil {
+		t.Fatal("could not decode integrated address")
+	}
+	if decoded.PaymentId != paymentId || decoded.TypeNetwork != monero.MainNetwork || decoded.Compare(testAddress) != 0 {
+		t.Fatal("integrated address mismatch")
+	}
+	if !bytes.Equal(decoded.Address.ToBase58(), testAddress.ToBase58()) {
+		t.Fatal("standard address mismatch")
+	}
+
+	if FromBase58(string(encoded)) != nil {
+		t.Fatal("integrated address decoded as standard address")
+	}
+	if FromBase58Integrated(string(testAddress.ToBase58())) != nil {
+		t.Fatal("standard address decoded as integrated address")
+	}
+
+	sub := FromRawAddress(monero.SubAddressMainNetwork, testAddress.SpendPub, testAddress.ViewPub)
+	if _, err = NewIntegratedAddress(sub, paymentId); err == nil {
+		t.Fatal("subaddress was integrated")
+	}
+}
@@ -23,6 +23,14 @@ func MakeDestinationMainAddress(accountSpendPub, primaryAddressViewPub curve2551
 	}
 }
 
+// MakeDestinationIntegratedAddress make_carrot_integrated_address_v1
+func MakeDestinationIntegratedAddress(accountSpendPub, primaryAddressViewPub curve25519.PublicKeyBytes, paymentId [monero.PaymentIdSize]byte) DestinationV1 {
+	return DestinationV1{
+		Address:   address.NewPackedAddressWithSubaddressFromBytes(accountSpendPub, primaryAddressViewPub, false),
+		PaymentId: paymentId,
+	}
+}
+
 // MakeDestinationSubaddress make_carrot_subaddress_v1
 func MakeDestinationSubaddress[T curve25519.PointOperations](hasher *blake2b.Digest, accountSpendPub, accountViewPub *curve25519.PublicKey[T], generateAddressSecret types.Hash, i address.SubaddressIndex) (DestinationV1, error) {
 	if i.IsZero() {
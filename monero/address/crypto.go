@@ -1,9 +1,13 @@
 package address
 
 import (
+	"crypto/subtle"
 	"encoding/binary"
+	"errors"
+	"io"
 	"strings"
 
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero"
 	"git.gammaspectra.live/P2Pool/consensus/v5/monero/crypto"
 	"git.gammaspectra.live/P2Pool/consensus/v5/monero/crypto/curve25519"
 	"git.gammaspectra.live/P2Pool/consensus/v5/monero/crypto/ringct"
@@ -109,15 +113,24 @@ func GetDerivation[T curve25519.PointOperations](out *curve25519.PublicKey[T], p
 const hashKeyEncryptedPaymentIdKey = 0x8d
 
 // CalculatePaymentIdEncodingKey Equivalent to device_default::encrypt_payment_id
-func CalculatePaymentIdEncodingKey(k curve25519.PrivateKeyBytes) curve25519.PrivateKeyBytes {
+// derivation is the key derivation of the transaction public key with the receiver view key. The payment id is XOR'd with the first 8 bytes
+func CalculatePaymentIdEncodingKey(derivation curve25519.PublicKeyBytes) curve25519.PrivateKeyBytes {
 	var key curve25519.PrivateKeyBytes
 	h := crypto.NewKeccak256()
-	_, _ = h.Write(k[:])
+	_, _ = h.Write(derivation[:])
 	_, _ = h.Write([]byte{hashKeyEncryptedPaymentIdKey})
 	_, _ = h.Read(key[:])
 	return key
 }
 
+// EncryptPaymentId Encrypts a payment id for the receiver view public key with the transaction key. Decryption is the same operation
+func EncryptPaymentId[T curve25519.PointOperations](paymentId [monero.PaymentIdSize]byte, viewPub *curve25519.PublicKey[T], txKey *curve25519.Scalar) (encrypted [monero.PaymentIdSize]byte) {
+	derivation := GetDerivation(new(curve25519.PublicKey[T]), viewPub, txKey)
+	key := CalculatePaymentIdEncodingKey(derivation.AsBytes())
+	subtle.XORBytes(encrypted[:], paymentId[:], key[:])
+	return encrypted
+}
+
 type SignatureVerifyResult int
 
 const (
@@ -130,6 +143,13 @@ const (
 	ResultSuccessView
 )
 
+const (
+	// MessageSignatureModeSpend Message is signed with the address spend private key
+	MessageSignatureModeSpend = uint8(0)
+	// MessageSignatureModeView Message is signed with the address view private key
+	MessageSignatureModeView = uint8(1)
+)
+
 func GetMessageHash(a Interface, message []byte, mode uint8) types.Hash {
 	return crypto.Keccak256Var(
 		[]byte("MoneroMessageSignature\x00"),
@@ -141,6 +161,38 @@ func GetMessageHash(a Interface, message []byte, mode uint8) types.Hash {
 	)
 }
 
+// SignMessage Signs message with the private key of the address spend or view public key, as wallet2 sign_message does.
+// version selects SigV1 (keccak of message) or SigV2 (hash bound to address and mode) formats
+func SignMessage(a Interface, message []byte, key *curve25519.Scalar, mode, version uint8, randomReader io.Reader) (string, error) {
+	var publicKey *curve25519.PublicKeyBytes
+	switch mode {
+	case MessageSignatureModeSpend:
+		publicKey = a.SpendPublicKey()
+	case MessageSignatureModeView:
+		publicKey = a.ViewPublicKey()
+	default:
+		return "", errors.New("unsupported signature mode")
+	}
+
+	if new(curve25519.ConstantTimePublicKey).ScalarBaseMult(key).AsBytes() != *publicKey {
+		return "", errors.New("private key does not match address public key")
+	}
+
+	var prefix string
+	var hash types.Hash
+	switch version {
+	case 1:
+		prefix, hash = "SigV1", crypto.Keccak256(message)
+	case 2:
+		prefix, hash = "SigV2", GetMessageHash(a, message, mode)
+	default:
+		return "", errors.New("unsupported signature version")
+	}
+
+	sig := crypto.CreateMessageSignature[curve25519.ConstantTimeOperations](hash, key, randomReader)
+	return prefix + string(base58.EncodeMoneroBase58(sig.Bytes())), nil
+}
+
 func VerifyMessage(a Interface, message []byte, signature string) SignatureVerifyResult {
 	var hash types.Hash
 
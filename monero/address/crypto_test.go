@@ -1,6 +1,7 @@
 package address
 
 import (
+	"crypto/rand"
 	"os"
 	"path"
 	"runtime"
@@ -8,6 +9,7 @@ import (
 	"strings"
 	"testing"
 
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero"
 	"git.gammaspectra.live/P2Pool/consensus/v5/monero/crypto"
 	"git.gammaspectra.live/P2Pool/consensus/v5/monero/crypto/curve25519"
 	"git.gammaspectra.live/P2Pool/consensus/v5/types"
@@ -202,3 +204,43 @@ func TestSignature(t *testing.T) {
 		t.Fatalf("unexpected %d", result)
 	}
 }
+
+func TestSignMessage(t *testing.T) {
+	var spendKey, viewKey curve25519.Scalar
+	curve25519.RandomScalar(&spendKey, rand.Reader)
+	curve25519.RandomScalar(&viewKey, rand.Reader)
+
+	a := FromRawAddress(monero.MainNetwork,
+		new(curve25519.ConstantTimePublicKey).ScalarBaseMult(&spendKey).AsBytes(),
+		new(curve25519.ConstantTimePublicKey).ScalarBaseMult(&viewKey).AsBytes(),
+	)
+
+	for _, e := range []struct {
+		Key      *curve25519.Scalar
+		Mode     uint8
+		Expected SignatureVerifyResult
+	}{
+		{&spendKey, MessageSignatureModeSpend, ResultSuccessSpend},
+		{&viewKey, MessageSignatureModeView, ResultSuccessView},
+	} {
+		for _, version := range []uint8{1, 2} {
+			signature, err := SignMessage(a, signatureMessage, e.Key, e.Mode, version, rand.Reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(signature, "SigV"+strconv.Itoa(int(version))) {
+				t.Fatalf("unexpected signature prefix %s", signature)
+			}
+			if result := VerifyMessage(a, signatureMessage, signature); result != e.Expected {
+				t.Fatalf("mode %d version %d: expected %d, got %d", e.Mode, version, e.Expected, result)
+			}
+			if result := VerifyMessage(a, signatureMessage2, signature); result != ResultFail {
+				t.Fatalf("mode %d version %d: unexpected %d for different message", e.Mode, version, result)
+			}
+		}
+	}
+
+	if _, err := SignMessage(a, signatureMessage, &viewKey, MessageSignatureModeSpend, 2, rand.Reader); err == nil {
+		t.Fatal("expected signing with mismatched key to fail")
+	}
+}
@@ -0,0 +1,133 @@
+package address
+
+import (
+	"bytes"
+	"errors"
+
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero"
+	base58 "git.gammaspectra.live/P2Pool/monero-base58"
+)
+
+// IntegratedAddress A standard address with an embedded payment id
+// Address is kept as the standard address, and is used for output derivation. Subaddresses cannot be integrated.
+type IntegratedAddress struct {
+	Address
+	PaymentId [monero.PaymentIdSize]byte
+}
+
+const integratedAddressSize = 1 + 32 + 32 + monero.PaymentIdSize + ChecksumLength
+
+var ErrUnsupportedIntegratedAddress = errors.New("only standard addresses can be integrated")
+
+// integratedNetwork Returns the integrated address type of a standard address type, or zero if not a standard type
+func integratedNetwork(typeNetwork uint8) uint8 {
+	switch typeNetwork {
+	case monero.MainNetwork:
+		return monero.IntegratedMainNetwork
+	case monero.TestNetwork:
+		return monero.IntegratedTestNetwork
+	case monero.StageNetwork:
+		return monero.IntegratedStageNetwork
+	default:
+		return 0
+	}
+}
+
+// standardNetwork Returns the standard address type of an integrated address type, or zero if not an integrated type
+func standardNetwork(typeNetwork uint8) uint8 {
+	switch typeNetwork {
+	case monero.IntegratedMainNetwork:
+		return monero.MainNetwork
+	case monero.IntegratedTestNetwork:
+		return monero.TestNetwork
+	case monero.IntegratedStageNetwork:
+		return monero.StageNetwork
+	default:
+		return 0
+	}
+}
+
+// NewIntegratedAddress Creates an integrated address from a standard address and payment id
+func NewIntegratedAddress(a *Address, paymentId [monero.PaymentIdSize]byte) (*IntegratedAddress, error) {
+	if integratedNetwork(a.TypeNetwork) == 0 {
+		return nil, ErrUnsupportedIntegratedAddress
+	}
+	return &IntegratedAddress{
+		Address:   *FromRawAddress(a.TypeNetwork, a.SpendPub, a.ViewPub),
+		PaymentId: paymentId,
+	}, nil
+}
+
+// IntegratedTypeNetwork Returns the network byte used when encoding the integrated address
+func (a *IntegratedAddress) IntegratedTypeNetwork() uint8 {
+	return integratedNetwork(a.TypeNetwork)
+}
+
+func (a *IntegratedAddress) raw() (raw [integratedAddressSize]byte) {
+	raw[0] = a.IntegratedTypeNetwork()
+	copy(raw[1:], a.SpendPub[:])
+	copy(raw[33:], a.ViewPub[:])
+	copy(raw[65:], a.PaymentId[:])
+	sum := checksumHash(raw[:integratedAddressSize-ChecksumLength])
+	copy(raw[integratedAddressSize-ChecksumLength:], sum[:])
+	return raw
+}
+
+func (a *IntegratedAddress) ToBase58() []byte {
+	raw := a.raw()
+	buf := make([]byte, 0, 106)
+	return base58.EncodeMoneroBase58PreAllocated(buf, raw[:])
+}
+
+func (a *IntegratedAddress) MarshalJSON() ([]byte, error) {
+	raw := a.raw()
+	buf := make([]byte, 1, 106+2)
+	buf[0] = '"'
+	buf = base58.EncodeMoneroBase58PreAllocated(buf, raw[:])
+	return append(buf, '"'), nil
+}
+
+func (a *IntegratedAddress) UnmarshalJSON(b []byte) error {
+	if len(b) < 2 {
+		return errors.New("unsupported length")
+	}
+
+	if addr := FromBase58Integrated(string(b[1 : len(b)-1])); addr != nil {
+		*a = *addr
+		return nil
+	} else {
+		return errors.New("invalid address")
+	}
+}
+
+// FromBase58Integrated Decodes an integrated address, returning nil if invalid
+func FromBase58Integrated(address string) *IntegratedAddress {
+	preAllocatedBuf := make([]byte, 0, integratedAddressSize)
+	raw := base58.DecodeMoneroBase58PreAllocated(preAllocatedBuf, []byte(address))
+
+	if len(raw) != integratedAddressSize {
+		return nil
+	}
+
+	typeNetwork := standardNetwork(raw[0])
+	if typeNetwork == 0 {
+		return nil
+	}
+
+	checksum := checksumHash(raw[:integratedAddressSize-ChecksumLength])
+	if !bytes.Equal(checksum[:], raw[integratedAddressSize-ChecksumLength:]) {
+		return nil
+	}
+
+	a := &IntegratedAddress{
+		Address: Address{
+			TypeNetwork: typeNetwork,
+		},
+	}
+	copy(a.SpendPub[:], raw[1:33])
+	copy(a.ViewPub[:], raw[33:65])
+	copy(a.PaymentId[:], raw[65:])
+	a.verifyChecksum()
+
+	return a
+}
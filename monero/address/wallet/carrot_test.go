@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"git.gammaspectra.live/P2Pool/consensus/v5/monero"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/address"
 	"git.gammaspectra.live/P2Pool/consensus/v5/monero/crypto/curve25519"
 	"git.gammaspectra.live/P2Pool/consensus/v5/types"
 )
@@ -20,3 +21,31 @@ func TestCarrotSpendWallet_Match(t *testing.T) {
 
 	testScan[curve25519.ConstantTimeOperations](t, wallet)
 }
+
+func TestCarrotSpendWallet_SignMessage(t *testing.T) {
+	var masterSecret types.Hash
+	_, _ = rand.Read(masterSecret[:])
+
+	wallet, err := NewCarrotSpendWalletFromMasterSecret[curve25519.ConstantTimeOperations](masterSecret, monero.TestNetwork, 0, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	message := []byte("test_message")
+	for _, version := range []uint8{1, 2} {
+		signature, err := wallet.SignMessage(address.ZeroSubaddressIndex, message, address.MessageSignatureModeView, version, rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result := address.VerifyMessage(wallet.Get(address.ZeroSubaddressIndex), message, signature); result != address.ResultSuccessView {
+			t.Fatalf("version %d: expected %d, got %d", version, address.ResultSuccessView, result)
+		}
+	}
+
+	if _, err = wallet.SignMessage(address.ZeroSubaddressIndex, message, address.MessageSignatureModeSpend, 2, rand.Reader); err != ErrCannotSignMessage {
+		t.Fatalf("expected %s, got %v", ErrCannotSignMessage, err)
+	}
+	if _, err = wallet.SignMessage(address.SubaddressIndex{Account: 0, Offset: 1}, message, address.MessageSignatureModeView, 2, rand.Reader); err != ErrCannotSignMessage {
+		t.Fatalf("expected %s, got %v", ErrCannotSignMessage, err)
+	}
+}
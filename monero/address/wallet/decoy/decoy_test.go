@@ -0,0 +1,218 @@
+package decoy_test
+
+import (
+	"crypto/rand"
+	"errors"
+	unsafeRandom "math/rand/v2"
+	"slices"
+	"testing"
+
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/address/wallet/decoy"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/client"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/client/rpc/daemon"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/crypto/curve25519"
+	"git.gammaspectra.live/P2Pool/consensus/v5/types"
+)
+
+const (
+	testBlocks          = 5000
+	testOutputsPerBlock = 5
+)
+
+// testOutputGetter Serves random outputs, with coinbase outputs of the last MinerRewardUnlockTime blocks locked
+type testOutputGetter struct {
+	outputs map[uint64]client.Output
+}
+
+func (g *testOutputGetter) GetOuts(inputs ...daemon.GetOutsInput) ([]client.Output, error) {
+	result := make([]client.Output, 0, len(inputs))
+	for _, in := range inputs {
+		if in.Amount != 0 || in.Index >= testBlocks*testOutputsPerBlock {
+			return nil, errors.New("output not found")
+		}
+		o, ok := g.outputs[in.Index]
+		if !ok {
+			var key, mask curve25519.Scalar
+			curve25519.RandomScalar(&key, rand.Reader)
+			curve25519.RandomScalar(&mask, rand.Reader)
+			height := in.Index / testOutputsPerBlock
+			o = client.Output{
+				GlobalOutputIndex: in.Index,
+				Height:            height,
+				Key:               types.Hash(new(curve25519.VarTimePublicKey).ScalarBaseMult(&key).AsBytes()),
+				Mask:              types.Hash(new(curve25519.VarTimePublicKey).ScalarBaseMult(&mask).AsBytes()),
+				Unlocked:          !isLockedCoinbase(in.Index),
+			}
+			g.outputs[in.Index] = o
+		}
+		result = append(result, o)
+	}
+	return result, nil
+}
+
+func isLockedCoinbase(index uint64) bool {
+	return index%testOutputsPerBlock == 0 && index/testOutputsPerBlock+monero.MinerRewardUnlockTime >= testBlocks
+}
+
+func testDistribution() *decoy.Distribution {
+	histogram := make([]uint64, testBlocks)
+	for i := range histogram {
+		histogram[i] = testOutputsPerBlock
+	}
+	return decoy.NewDistribution(0, 0, histogram)
+}
+
+func TestNewDistribution(t *testing.T) {
+	d := decoy.NewDistribution(100, 10, []uint64{1, 0, 3})
+	if !slices.Equal(d.Cumulative, []uint64{11, 11, 14}) {
+		t.Fatalf("unexpected cumulative distribution %v", d.Cumulative)
+	}
+	if d.Outputs() != 14 || d.Height() != 103 {
+		t.Fatalf("unexpected outputs %d or height %d", d.Outputs(), d.Height())
+	}
+
+	fromDaemon, err := decoy.NewDistributionFromDaemon(daemon.OutputDistribution{
+		StartHeight:  100,
+		Base:         10,
+		Distribution: []uint64{11, 11, 14},
+	}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(fromDaemon.Cumulative, d.Cumulative) || fromDaemon.StartHeight != d.StartHeight || fromDaemon.Base != d.Base {
+		t.Fatalf("expected %v, got %v", d, fromDaemon)
+	}
+
+	if _, err = decoy.NewDistributionFromDaemon(daemon.OutputDistribution{
+		Base:         10,
+		Distribution: []uint64{11, 9},
+	}, true); !errors.Is(err, decoy.ErrInvalidDistribution) {
+		t.Fatalf("expected %s, got %v", decoy.ErrInvalidDistribution, err)
+	}
+}
+
+func TestPicker(t *testing.T) {
+	d := testDistribution()
+
+	a, err := decoy.NewPicker(d, unsafeRandom.New(unsafeRandom.NewPCG(1, 2)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := decoy.NewPicker(d, unsafeRandom.New(unsafeRandom.NewPCG(1, 2)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := uint64((testBlocks - decoy.SpendableAge) * testOutputsPerBlock); a.SpendableOutputs() != expected {
+		t.Fatalf("expected %d spendable outputs, got %d", expected, a.SpendableOutputs())
+	}
+
+	var picked, recent int
+	for range 10000 {
+		indexA, okA := a.Pick()
+		indexB, okB := b.Pick()
+		if indexA != indexB || okA != okB {
+			t.Fatalf("pickers with the same seed diverged: %d != %d", indexA, indexB)
+		}
+		if !okA {
+			continue
+		}
+		if indexA >= a.SpendableOutputs() {
+			t.Fatalf("picked unspendable output %d", indexA)
+		}
+		picked++
+		// within a day of the most recent spendable output
+		if indexA >= a.SpendableOutputs()-86400/monero.BlockTime*testOutputsPerBlock {
+			recent++
+		}
+	}
+
+	// the gamma distribution favours recent outputs, around half of the picks are within a day
+	if picked == 0 || recent*4 < picked || recent*4 > picked*3 {
+		t.Fatalf("unexpected amount of recent picks %d out of %d", recent, picked)
+	}
+
+	if _, err = decoy.NewPicker(decoy.NewDistribution(0, 0, make([]uint64, decoy.SpendableAge)), unsafeRandom.New(unsafeRandom.NewPCG(1, 2))); !errors.Is(err, decoy.ErrNotEnoughOutputs) {
+		t.Fatalf("expected %s, got %v", decoy.ErrNotEnoughOutputs, err)
+	}
+}
+
+func TestPickerBlockBoundary(t *testing.T) {
+	// two blocks with one output each, followed by empty blocks. Nearly all draws land on output index 1, which equals the
+	// cumulative count of the first block: wallet2 picks that block and never the second one
+	histogram := make([]uint64, 100000)
+	histogram[0], histogram[1] = 1, 1
+
+	p, err := decoy.NewPicker(decoy.NewDistribution(0, 0, histogram), unsafeRandom.New(unsafeRandom.NewPCG(5, 6)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.SpendableOutputs() != 2 {
+		t.Fatalf("expected 2 spendable outputs, got %d", p.SpendableOutputs())
+	}
+
+	var picked int
+	for range 1000 {
+		index, ok := p.Pick()
+		if !ok {
+			continue
+		}
+		if index != 0 {
+			t.Fatalf("expected output 0 from the first block, got %d", index)
+		}
+		picked++
+	}
+	if picked == 0 {
+		t.Fatal("no outputs picked")
+	}
+}
+
+func TestSelector(t *testing.T) {
+	getter := &testOutputGetter{
+		outputs: make(map[uint64]client.Output),
+	}
+
+	const ringSize = 16
+	// a recent output, picked rings will include locked coinbase outputs which must be skipped
+	globalIndex := uint64((testBlocks-decoy.SpendableAge)*testOutputsPerBlock - 3)
+
+	var previous []uint64
+	for range 2 {
+		s, err := decoy.NewSelector[curve25519.VarTimeOperations](testDistribution(), getter, unsafeRandom.New(unsafeRandom.NewPCG(3, 4)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		decoys, err := s.Decoys(globalIndex, ringSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(decoys.Offsets) != ringSize || len(decoys.Ring) != ringSize {
+			t.Fatalf("expected ring size %d, got %d", ringSize, len(decoys.Ring))
+		}
+		if decoys.Offsets[decoys.SignerIndex] != globalIndex {
+			t.Fatalf("expected signer %d, got %d", globalIndex, decoys.Offsets[decoys.SignerIndex])
+		}
+		for i, index := range decoys.Offsets {
+			if i > 0 && index <= decoys.Offsets[i-1] {
+				t.Fatalf("offsets are not unique and ascending: %v", decoys.Offsets)
+			}
+			if isLockedCoinbase(index) {
+				t.Fatalf("locked output %d was selected", index)
+			}
+			if o := getter.outputs[index]; types.Hash(decoys.Ring[i][0].AsBytes()) != o.Key || types.Hash(decoys.Ring[i][1].AsBytes()) != o.Mask {
+				t.Fatalf("ring member %d does not match output", index)
+			}
+		}
+
+		if previous != nil && !slices.Equal(previous, decoys.Offsets) {
+			t.Fatalf("selectors with the same seed diverged: %v != %v", previous, decoys.Offsets)
+		}
+		previous = decoys.Offsets
+
+		if _, err = s.Decoys(uint64((testBlocks-decoy.SpendableAge)*testOutputsPerBlock), ringSize); !errors.Is(err, decoy.ErrOutputNotSpendable) {
+			t.Fatalf("expected %s, got %v", decoy.ErrOutputNotSpendable, err)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+// Package decoy Selects ring members following the gamma distribution over output ages used by monero wallet2
+// Picking is driven by a caller-provided random source, so selection is deterministic when seeded.
+package decoy
+
+import (
+	"errors"
+
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/client/rpc/daemon"
+)
+
+var ErrInvalidDistribution = errors.New("invalid output distribution")
+
+// Distribution Number of RingCT outputs created up to each block
+type Distribution struct {
+	// StartHeight Height of the first block in Cumulative
+	StartHeight uint64
+	// Base Number of RingCT outputs created before StartHeight
+	Base uint64
+	// Cumulative Total number of RingCT outputs created up to and including each block, starting at StartHeight
+	Cumulative []uint64
+}
+
+// NewDistribution Creates a Distribution from a histogram of the number of RingCT outputs created in each block starting at startHeight
+// base is the number of RingCT outputs created before startHeight.
+func NewDistribution(startHeight, base uint64, histogram []uint64) *Distribution {
+	d := &Distribution{
+		StartHeight: startHeight,
+		Base:        base,
+		Cumulative:  make([]uint64, len(histogram)),
+	}
+	total := base
+	for i, n := range histogram {
+		total += n
+		d.Cumulative[i] = total
+	}
+	return d
+}
+
+// NewDistributionFromDaemon Creates a Distribution from a get_output_distribution result for amount zero
+// cumulative must match the value requested from the daemon.
+func NewDistributionFromDaemon(d daemon.OutputDistribution, cumulative bool) (*Distribution, error) {
+	if d.Amount != 0 {
+		return nil, ErrInvalidDistribution
+	}
+	if !cumulative {
+		return NewDistribution(d.StartHeight, d.Base, d.Distribution), nil
+	}
+
+	out := &Distribution{
+		StartHeight: d.StartHeight,
+		Base:        d.Base,
+		Cumulative:  d.Distribution,
+	}
+	if err := out.verify(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Outputs Total number of RingCT outputs in the distribution
+func (d *Distribution) Outputs() uint64 {
+	if len(d.Cumulative) == 0 {
+		return d.Base
+	}
+	return d.Cumulative[len(d.Cumulative)-1]
+}
+
+// Height Height after the last block in the distribution
+func (d *Distribution) Height() uint64 {
+	return d.StartHeight + uint64(len(d.Cumulative))
+}
+
+// blockOutputs Returns the first global output index and number of outputs of the block at index i
+func (d *Distribution) blockOutputs(i int) (first, n uint64) {
+	first = d.Base
+	if i > 0 {
+		first = d.Cumulative[i-1]
+	}
+	return first, d.Cumulative[i] - first
+}
+
+func (d *Distribution) verify() error {
+	previous := d.Base
+	for _, n := range d.Cumulative {
+		if n < previous {
+			return ErrInvalidDistribution
+		}
+		previous = n
+	}
+	return nil
+}
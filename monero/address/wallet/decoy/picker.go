@@ -0,0 +1,128 @@
+package decoy
+
+import (
+	"errors"
+	"math"
+	unsafeRandom "math/rand/v2" //nolint:depguard
+	"slices"
+
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero"
+)
+
+const (
+	// GammaShape Shape of the gamma distribution over the logarithm of output ages in seconds
+	GammaShape = 19.28
+	// GammaScale Scale of the gamma distribution over the logarithm of output ages in seconds
+	GammaScale = 1 / 1.61
+
+	// SpendableAge Number of most recent blocks whose outputs cannot be spent yet, and are never picked
+	SpendableAge = monero.TransactionUnlockTime
+	// DefaultUnlockTime Age in seconds of the most recent spendable outputs, subtracted from picked ages
+	DefaultUnlockTime = SpendableAge * monero.BlockTime
+	// RecentSpendWindow Picked ages below DefaultUnlockTime are replaced by a uniform age within this many seconds
+	RecentSpendWindow = 15 * monero.BlockTime
+
+	blocksInAYear = 86400 * 365 / monero.BlockTime
+)
+
+var ErrNotEnoughOutputs = errors.New("not enough outputs to pick from")
+
+// Picker Picks global output indices following the gamma distribution of wallet2 gamma_picker
+//
+// The age of a spent output is drawn as exp(X) seconds with X ~ Gamma(GammaShape, GammaScale), and converted to a number of outputs back from the
+// most recent spendable output using the average output time of the last year. The picked block is then sampled uniformly, so blocks with many
+// outputs such as coinbase-heavy recent blocks are picked no more often than their share of time.
+type Picker struct {
+	distribution *Distribution
+
+	// end Number of blocks which can be picked from
+	end int
+	// outputs Global output index after the most recent spendable output
+	outputs uint64
+
+	averageOutputTime float64
+
+	rng *unsafeRandom.Rand
+}
+
+// NewPicker Creates a Picker over the distribution, which must contain more than SpendableAge blocks
+// Seeding rng makes the picked outputs deterministic.
+func NewPicker(distribution *Distribution, rng *unsafeRandom.Rand) (*Picker, error) {
+	if len(distribution.Cumulative) <= SpendableAge {
+		return nil, ErrNotEnoughOutputs
+	}
+
+	blocksToConsider := min(len(distribution.Cumulative), blocksInAYear)
+	outputsBefore := distribution.Base
+	if blocksToConsider < len(distribution.Cumulative) {
+		outputsBefore = distribution.Cumulative[len(distribution.Cumulative)-blocksToConsider-1]
+	}
+	outputsToConsider := distribution.Outputs() - outputsBefore
+
+	p := &Picker{
+		distribution: distribution,
+		end:          len(distribution.Cumulative) - SpendableAge,
+		rng:          rng,
+	}
+	p.outputs = distribution.Cumulative[p.end-1]
+	if p.outputs <= distribution.Base || outputsToConsider == 0 {
+		return nil, ErrNotEnoughOutputs
+	}
+	p.averageOutputTime = float64(monero.BlockTime*blocksToConsider) / float64(outputsToConsider)
+
+	return p, nil
+}
+
+// SpendableOutputs Global output index after the most recent output which can be picked
+func (p *Picker) SpendableOutputs() uint64 {
+	return p.outputs
+}
+
+// Pick Picks a global output index
+// It returns false when the drawn age falls outside the distribution, in which case a new pick must be made.
+func (p *Picker) Pick() (index uint64, ok bool) {
+	age := math.Exp(gamma(p.rng, GammaShape, GammaScale))
+	if age > DefaultUnlockTime {
+		age -= DefaultUnlockTime
+	} else {
+		age = float64(p.rng.Uint64N(RecentSpendWindow))
+	}
+
+	outputsBack := age / p.averageOutputTime
+	if outputsBack >= float64(p.outputs) {
+		return 0, false
+	}
+	outputIndex := p.outputs - 1 - uint64(outputsBack)
+	if outputIndex < p.distribution.Base {
+		return 0, false
+	}
+
+	// first block whose cumulative count is not below outputIndex, as wallet2 lower_bound
+	// An index equal to a cumulative count, the first output of the next block, picks the earlier block.
+	i, _ := slices.BinarySearch(p.distribution.Cumulative[:p.end], outputIndex)
+
+	first, n := p.distribution.blockOutputs(i)
+	if n == 0 {
+		return 0, false
+	}
+	return first + p.rng.Uint64N(n), true
+}
+
+// gamma Samples a Gamma(shape, scale) distribution with shape >= 1, using the Marsaglia and Tsang method
+func gamma(rng *unsafeRandom.Rand, shape, scale float64) float64 {
+	d := shape - 1.0/3
+	c := 1 / math.Sqrt(9*d)
+	for {
+		x := rng.NormFloat64()
+		v := 1 + c*x
+		if v <= 0 {
+			continue
+		}
+		v = v * v * v
+		u := rng.Float64()
+		x2 := x * x
+		if u < 1-0.0331*x2*x2 || math.Log(u) < 0.5*x2+d*(1-v+math.Log(v)) {
+			return d * v * scale
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package decoy
+
+import (
+	"cmp"
+	"errors"
+	unsafeRandom "math/rand/v2" //nolint:depguard
+	"slices"
+
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/client"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/client/rpc/daemon"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/crypto/curve25519"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/crypto/ringct"
+)
+
+// MaxPicksPerMember Number of picks attempted for each ring member before giving up
+const MaxPicksPerMember = 100
+
+var ErrOutputNotSpendable = errors.New("output is not within the spendable outputs of the distribution")
+var ErrOutputLocked = errors.New("output is locked")
+
+// OutputGetter Fetches RingCT outputs by global index, as client.Client
+type OutputGetter interface {
+	GetOuts(inputs ...daemon.GetOutsInput) ([]client.Output, error)
+}
+
+// Selector Selects rings for spent outputs with a Picker, fetching ring members with an OutputGetter
+// Locked outputs, such as recent coinbase outputs, and outputs with invalid keys are skipped. It can be used as a txbuilder.DecoySource.
+type Selector[T curve25519.PointOperations] struct {
+	picker *Picker
+	getter OutputGetter
+}
+
+func NewSelector[T curve25519.PointOperations](distribution *Distribution, getter OutputGetter, rng *unsafeRandom.Rand) (*Selector[T], error) {
+	picker, err := NewPicker(distribution, rng)
+	if err != nil {
+		return nil, err
+	}
+	return &Selector[T]{
+		picker: picker,
+		getter: getter,
+	}, nil
+}
+
+// Pick Picks count unique global output indices not present in exclude, in ascending order
+// Picked indices are not checked to be unlocked.
+func (s *Selector[T]) Pick(count int, exclude ...uint64) ([]uint64, error) {
+	picked := make(map[uint64]struct{}, count+len(exclude))
+	for _, index := range exclude {
+		picked[index] = struct{}{}
+	}
+
+	indices := make([]uint64, 0, count)
+	for attempts := 0; len(indices) < count; attempts++ {
+		if attempts >= count*MaxPicksPerMember {
+			return nil, ErrNotEnoughOutputs
+		}
+		index, ok := s.picker.Pick()
+		if !ok {
+			continue
+		}
+		if _, ok = picked[index]; ok {
+			continue
+		}
+		picked[index] = struct{}{}
+		indices = append(indices, index)
+	}
+	slices.Sort(indices)
+	return indices, nil
+}
+
+// Decoys Selects a ring of ringSize members which includes the output at globalIndex as the signer
+// Offsets are absolute global output indices in ascending order.
+func (s *Selector[T]) Decoys(globalIndex uint64, ringSize int) (decoys ringct.Decoys[T], err error) {
+	if globalIndex < s.picker.distribution.Base || globalIndex >= s.picker.SpendableOutputs() {
+		return decoys, ErrOutputNotSpendable
+	}
+	if uint64(ringSize) > s.picker.SpendableOutputs()-s.picker.distribution.Base {
+		return decoys, ErrNotEnoughOutputs
+	}
+
+	members := make([]fetchedOutput[T], 0, ringSize)
+
+	signer, err := s.fetch(globalIndex)
+	if err != nil {
+		return decoys, err
+	}
+	if len(signer) == 0 {
+		return decoys, ErrOutputLocked
+	}
+	members = append(members, signer[0])
+
+	exclude := []uint64{globalIndex}
+	for attempts := 0; len(members) < ringSize; attempts++ {
+		if attempts >= MaxPicksPerMember {
+			return decoys, ErrNotEnoughOutputs
+		}
+
+		indices, err := s.Pick(ringSize-len(members), exclude...)
+		if err != nil {
+			return decoys, err
+		}
+		// rejected picks are excluded too, so they are not picked again
+		exclude = append(exclude, indices...)
+
+		outputs, err := s.fetch(indices...)
+		if err != nil {
+			return decoys, err
+		}
+		members = append(members, outputs...)
+	}
+
+	slices.SortFunc(members, func(a, b fetchedOutput[T]) int {
+		return cmp.Compare(a.index, b.index)
+	})
+
+	decoys.Offsets = make([]uint64, len(members))
+	decoys.Ring = make([][2]curve25519.PublicKey[T], len(members))
+	for i := range members {
+		decoys.Offsets[i] = members[i].index
+		decoys.Ring[i] = members[i].ring
+		if members[i].index == globalIndex {
+			decoys.SignerIndex = uint64(i)
+		}
+	}
+
+	return decoys, nil
+}
+
+type fetchedOutput[T curve25519.PointOperations] struct {
+	index uint64
+	ring  [2]curve25519.PublicKey[T]
+}
+
+// fetch Gets outputs at indices, skipping locked outputs and outputs with invalid key or commitment
+func (s *Selector[T]) fetch(indices ...uint64) ([]fetchedOutput[T], error) {
+	inputs := make([]daemon.GetOutsInput, len(indices))
+	for i, index := range indices {
+		inputs[i] = daemon.GetOutsInput{
+			Amount: 0,
+			Index:  index,
+		}
+	}
+
+	outs, err := s.getter.GetOuts(inputs...)
+	if err != nil {
+		return nil, err
+	}
+	if len(outs) != len(indices) {
+		return nil, errors.New("invalid output count")
+	}
+
+	result := make([]fetchedOutput[T], 0, len(outs))
+	for i := range outs {
+		if !outs[i].Unlocked {
+			continue
+		}
+		o := fetchedOutput[T]{
+			index: indices[i],
+		}
+		if _, err = o.ring[0].SetBytes(outs[i].Key[:]); err != nil {
+			continue
+		}
+		if _, err = o.ring[1].SetBytes(outs[i].Mask[:]); err != nil {
+			continue
+		}
+		result = append(result, o)
+	}
+	return result, nil
+}
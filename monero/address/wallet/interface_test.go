@@ -256,15 +256,22 @@ func testScanPayment[T curve25519.PointOperations](t *testing.T, wallet SpendWal
 					additionalPub = new(curve25519.PublicKey[T]).ScalarBaseMult(txKey)
 				}
 
-				//todo: payment id
+				var paymentId [monero.PaymentIdSize]byte
+				_, _ = rand.Read(paymentId[:])
+				encryptedPaymentId := address.EncryptPaymentId(paymentId, curve25519.To[T](addr.ViewPublicKey().Point()), txKey)
+
 				i, scan, subaddressIndex := lw.Match(
 					transaction.Outputs{out},
 					[]ringct.CommitmentEncryptedAmount{encryptedAmount},
-					txPubs, nil)
+					txPubs, &encryptedPaymentId)
 				if i != 0 {
 					t.Fatalf("got index %d, want 0", i)
 				}
 
+				if scan.PaymentId != paymentId {
+					t.Fatalf("got payment id %x, want %x", scan.PaymentId[:], paymentId[:])
+				}
+
 				if subaddressIndex != ix {
 					t.Fatalf("got subaddress index %+v, want %+v", subaddressIndex, ix)
 				}
@@ -0,0 +1,409 @@
+package wallet
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/address"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/client/levin"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/crypto"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/crypto/curve25519"
+	"git.gammaspectra.live/P2Pool/consensus/v5/utils"
+)
+
+// DefaultKdfRounds Default --kdf-rounds of monero-wallet-cli
+const DefaultKdfRounds = 1
+
+const (
+	// DefaultSubaddressLookaheadMajor Default account lookahead of monero-wallet-cli
+	DefaultSubaddressLookaheadMajor = 50
+	// DefaultSubaddressLookaheadMinor Default subaddress lookahead of monero-wallet-cli
+	DefaultSubaddressLookaheadMinor = 200
+)
+
+// keysFileMemoryKey HASH_KEY_MEMORY, used to derive the secret keys encryption key from the password key
+const keysFileMemoryKey = 'k'
+
+var (
+	ErrInvalidKeysFile     = errors.New("invalid keys file")
+	ErrUnsupportedKeysFile = errors.New("unsupported keys file, hardware and multisig wallets cannot be loaded")
+	ErrKeysFileMismatch    = errors.New("keys file secret keys do not match address, wrong password?")
+)
+
+// KeysFile Contents of a monero-wallet-cli .keys file
+// Subaddress labels and account tags are kept in the wallet cache file, and are not included.
+type KeysFile struct {
+	// Address Primary address, with network set from the file network type
+	Address *address.Address
+
+	// SpendKey Zero for view-only wallets
+	SpendKey curve25519.PrivateKeyBytes
+	ViewKey  curve25519.PrivateKeyBytes
+
+	CreationTimestamp uint64
+	// RefreshHeight Height to start scanning from when restoring the wallet
+	RefreshHeight uint64
+
+	SeedLanguage string
+
+	// SubaddressLookaheadMajor Number of accounts monero-wallet-cli tracks ahead of the last used one
+	SubaddressLookaheadMajor uint32
+	// SubaddressLookaheadMinor Number of subaddresses monero-wallet-cli tracks ahead of the last used one, per account
+	SubaddressLookaheadMinor uint32
+
+	// Settings Other wallet settings, kept as-is to be written back
+	Settings map[string]json.RawMessage
+}
+
+// keysFileAccount account_base as epee portable storage
+type keysFileAccount struct {
+	Keys struct {
+		Address struct {
+			SpendPub curve25519.PublicKeyBytes `levin:"m_spend_public_key"`
+			ViewPub  curve25519.PublicKeyBytes `levin:"m_view_public_key"`
+		} `levin:"m_account_address"`
+		SpendKey     curve25519.PrivateKeyBytes   `levin:"m_spend_secret_key"`
+		ViewKey      curve25519.PrivateKeyBytes   `levin:"m_view_secret_key"`
+		MultisigKeys []byte                       `levin:"m_multisig_keys,omitempty"`
+		EncryptionIV [crypto.ChaChaNonceSize]byte `levin:"m_encryption_iv"`
+	} `levin:"m_keys"`
+	CreationTimestamp uint64 `levin:"m_creation_timestamp"`
+}
+
+// NewKeysFile Creates a keys file for a primary address. spendKey can be nil for view-only wallets
+func NewKeysFile(primaryAddress *address.Address, spendKey, viewKey *curve25519.Scalar, creationTimestamp uint64) *KeysFile {
+	f := &KeysFile{
+		Address:                  primaryAddress,
+		ViewKey:                  curve25519.PrivateKeyBytes(viewKey.Bytes()),
+		CreationTimestamp:        creationTimestamp,
+		SeedLanguage:             "English",
+		SubaddressLookaheadMajor: DefaultSubaddressLookaheadMajor,
+		SubaddressLookaheadMinor: DefaultSubaddressLookaheadMinor,
+	}
+	if spendKey != nil {
+		f.SpendKey = curve25519.PrivateKeyBytes(spendKey.Bytes())
+	}
+	return f
+}
+
+func (f *KeysFile) IsViewOnly() bool {
+	return f.SpendKey == curve25519.ZeroPrivateKeyBytes
+}
+
+// keysFileSecretKeyStream Returns the key stream the secret keys are XOR'd with, as account_keys::xor_with_key_stream
+func keysFileSecretKeyStream(password []byte, iv [crypto.ChaChaNonceSize]byte, kdfRounds int) []byte {
+	key := crypto.GenerateChaChaKey(password, kdfRounds, false)
+	src := make([]byte, crypto.ChaChaNonceSize+curve25519.PrivateKeySize*2)
+	copy(src, iv[:])
+	stream := make([]byte, curve25519.PrivateKeySize*2)
+	crypto.ChaChaDecrypt(stream, src, append(key[:], keysFileMemoryKey), 1)
+	return stream
+}
+
+// DecryptKeysFile Reads a monero-wallet-cli .keys file, checking the secret keys match the address
+func DecryptKeysFile(data []byte, password string, kdfRounds int) (*KeysFile, error) {
+	// keys_file_data: iv, then varint prefixed encrypted account data
+	if len(data) < crypto.ChaChaNonceSize+1 {
+		return nil, ErrInvalidKeysFile
+	}
+	size, n := binary.Uvarint(data[crypto.ChaChaNonceSize:])
+	if n <= 0 || size != uint64(len(data)-crypto.ChaChaNonceSize-n) {
+		return nil, ErrInvalidKeysFile
+	}
+	encrypted := make([]byte, 0, crypto.ChaChaNonceSize+size)
+	encrypted = append(encrypted, data[:crypto.ChaChaNonceSize]...)
+	encrypted = append(encrypted, data[crypto.ChaChaNonceSize+n:]...)
+
+	plain := make([]byte, size)
+	crypto.ChaChaDecrypt(plain, encrypted, []byte(password), kdfRounds)
+
+	f := &KeysFile{
+		SubaddressLookaheadMajor: DefaultSubaddressLookaheadMajor,
+		SubaddressLookaheadMinor: DefaultSubaddressLookaheadMinor,
+	}
+	var keyData []byte
+	var encryptedSecretKeys bool
+	var networkType uint8
+
+	if err := json.Unmarshal(plain, &f.Settings); err != nil {
+		// old format, account data only
+		keyData = plain
+		f.Settings = nil
+	} else {
+		raw, ok := f.Settings["key_data"]
+		if !ok {
+			return nil, ErrInvalidKeysFile
+		}
+		if keyData, err = unquoteJSONBytes(raw); err != nil {
+			return nil, err
+		}
+		delete(f.Settings, "key_data")
+
+		var flags struct {
+			KeyOnDevice         int    `json:"key_on_device"`
+			Multisig            int    `json:"multisig"`
+			EncryptedSecretKeys int    `json:"encrypted_secret_keys"`
+			NetworkType         uint8  `json:"nettype"`
+			SeedLanguage        string `json:"seed_language"`
+			RefreshHeight       uint64 `json:"refresh_height"`
+			LookaheadMajor      uint32 `json:"subaddress_lookahead_major"`
+			LookaheadMinor      uint32 `json:"subaddress_lookahead_minor"`
+		}
+		flags.LookaheadMajor, flags.LookaheadMinor = f.SubaddressLookaheadMajor, f.SubaddressLookaheadMinor
+		if err = json.Unmarshal(plain, &flags); err != nil {
+			return nil, err
+		}
+		if flags.KeyOnDevice != 0 || flags.Multisig != 0 {
+			return nil, ErrUnsupportedKeysFile
+		}
+		for _, k := range []string{"key_on_device", "multisig", "encrypted_secret_keys", "nettype", "seed_language", "refresh_height", "subaddress_lookahead_major", "subaddress_lookahead_minor", "watch_only"} {
+			delete(f.Settings, k)
+		}
+
+		encryptedSecretKeys = flags.EncryptedSecretKeys != 0
+		networkType = flags.NetworkType
+		f.SeedLanguage = flags.SeedLanguage
+		f.RefreshHeight = flags.RefreshHeight
+		f.SubaddressLookaheadMajor, f.SubaddressLookaheadMinor = flags.LookaheadMajor, flags.LookaheadMinor
+	}
+
+	var account keysFileAccount
+	if err := levin.Unmarshal(keyData, &account); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidKeysFile, err)
+	}
+	if len(account.Keys.MultisigKeys) > 0 {
+		return nil, ErrUnsupportedKeysFile
+	}
+
+	f.SpendKey = account.Keys.SpendKey
+	f.ViewKey = account.Keys.ViewKey
+	f.CreationTimestamp = account.CreationTimestamp
+	if encryptedSecretKeys {
+		stream := keysFileSecretKeyStream([]byte(password), account.Keys.EncryptionIV, kdfRounds)
+		for i := range f.SpendKey {
+			f.SpendKey[i] ^= stream[i]
+			f.ViewKey[i] ^= stream[curve25519.PrivateKeySize+i]
+		}
+	}
+
+	var typeNetwork uint8
+	switch networkType {
+	case 0:
+		typeNetwork = monero.MainNetwork
+	case 1:
+		typeNetwork = monero.TestNetwork
+	case 2:
+		typeNetwork = monero.StageNetwork
+	default:
+		return nil, utils.ErrorfNoEscape("unsupported network type %d", networkType)
+	}
+	f.Address = address.FromRawAddress(typeNetwork, account.Keys.Address.SpendPub, account.Keys.Address.ViewPub)
+
+	if err := f.verify(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// verify Checks the secret keys match the address public keys
+func (f *KeysFile) verify() error {
+	viewKey := f.ViewKey.Scalar()
+	if viewKey == nil || new(curve25519.VarTimePublicKey).ScalarBaseMult(viewKey).AsBytes() != f.Address.ViewPub {
+		return ErrKeysFileMismatch
+	}
+	if !f.IsViewOnly() {
+		spendKey := f.SpendKey.Scalar()
+		if spendKey == nil || new(curve25519.VarTimePublicKey).ScalarBaseMult(spendKey).AsBytes() != f.Address.SpendPub {
+			return ErrKeysFileMismatch
+		}
+	}
+	return nil
+}
+
+// Encrypt Writes the .keys file, with secret keys encrypted as done by monero-wallet-cli
+func (f *KeysFile) Encrypt(password string, kdfRounds int) ([]byte, error) {
+	if f.Address == nil || f.Address.IsSubaddress() {
+		return nil, errors.New("address must be a primary address")
+	}
+	if err := f.verify(); err != nil {
+		return nil, err
+	}
+
+	var networkType uint8
+	switch f.Address.BaseNetwork() {
+	case monero.MainNetwork:
+		networkType = 0
+	case monero.TestNetwork:
+		networkType = 1
+	case monero.StageNetwork:
+		networkType = 2
+	default:
+		return nil, errors.New("unsupported address network")
+	}
+
+	var account keysFileAccount
+	account.Keys.Address.SpendPub = f.Address.SpendPub
+	account.Keys.Address.ViewPub = f.Address.ViewPub
+	account.CreationTimestamp = f.CreationTimestamp
+	_, _ = rand.Read(account.Keys.EncryptionIV[:])
+	stream := keysFileSecretKeyStream([]byte(password), account.Keys.EncryptionIV, kdfRounds)
+	for i := range account.Keys.SpendKey {
+		account.Keys.SpendKey[i] = f.SpendKey[i] ^ stream[i]
+		account.Keys.ViewKey[i] = f.ViewKey[i] ^ stream[curve25519.PrivateKeySize+i]
+	}
+
+	keyData, err := levin.Marshal(&account)
+	if err != nil {
+		return nil, err
+	}
+
+	settings := make(map[string]json.RawMessage, len(f.Settings)+10)
+	for k, v := range f.Settings {
+		settings[k] = v
+	}
+	settings["key_data"] = appendJSONBytes(nil, keyData)
+	if settings["seed_language"], err = json.Marshal(f.SeedLanguage); err != nil {
+		return nil, err
+	}
+	settings["key_on_device"] = json.RawMessage("0")
+	settings["multisig"] = json.RawMessage("0")
+	settings["encrypted_secret_keys"] = json.RawMessage("1")
+	settings["nettype"] = strconv.AppendUint(nil, uint64(networkType), 10)
+	settings["refresh_height"] = strconv.AppendUint(nil, f.RefreshHeight, 10)
+	settings["subaddress_lookahead_major"] = strconv.AppendUint(nil, uint64(f.SubaddressLookaheadMajor), 10)
+	settings["subaddress_lookahead_minor"] = strconv.AppendUint(nil, uint64(f.SubaddressLookaheadMinor), 10)
+	if f.IsViewOnly() {
+		settings["watch_only"] = json.RawMessage("1")
+	} else {
+		settings["watch_only"] = json.RawMessage("0")
+	}
+
+	// key_data is a binary string, HTML escaping would be harmless but is not done by monero-wallet-cli
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err = enc.Encode(settings); err != nil {
+		return nil, err
+	}
+	plain := bytes.TrimSuffix(buf.Bytes(), []byte{'\n'})
+
+	encrypted := make([]byte, len(plain)+crypto.ChaChaNonceSize)
+	crypto.ChaChaEncrypt(encrypted, plain, []byte(password), kdfRounds)
+
+	out := make([]byte, 0, len(encrypted)+binary.MaxVarintLen64)
+	out = append(out, encrypted[:crypto.ChaChaNonceSize]...)
+	out = binary.AppendUvarint(out, uint64(len(plain)))
+	return append(out, encrypted[crypto.ChaChaNonceSize:]...), nil
+}
+
+// NewViewWalletFromKeysFile Creates a view wallet from a full or view-only keys file
+func NewViewWalletFromKeysFile[T curve25519.PointOperations](f *KeysFile, accountDepth, indexDepth int) (*ViewWallet[T], error) {
+	return NewViewWallet[T](f.Address, f.ViewKey.Scalar(), accountDepth, indexDepth)
+}
+
+// NewSpendWalletFromKeysFile Creates a spend wallet from a full keys file
+// The view key is taken from the file, and may not be derived from the spend key.
+func NewSpendWalletFromKeysFile[T curve25519.PointOperations](f *KeysFile, accountDepth, indexDepth int) (*SpendWallet[T], error) {
+	if f.IsViewOnly() {
+		return nil, errors.New("keys file is view-only")
+	}
+	spendKey := f.SpendKey.Scalar()
+	if spendKey == nil {
+		return nil, errors.New("invalid spend key")
+	}
+	vw, err := NewViewWalletFromKeysFile[T](f, accountDepth, indexDepth)
+	if err != nil {
+		return nil, err
+	}
+	return &SpendWallet[T]{
+		vw:             *vw,
+		spendKeyScalar: *spendKey,
+	}, nil
+}
+
+// appendJSONBytes Encodes a binary string as a JSON string, leaving bytes above 0x7f as-is as rapidjson does
+func appendJSONBytes(buf []byte, data []byte) []byte {
+	const hex = "0123456789abcdef"
+	buf = append(buf, '"')
+	for _, c := range data {
+		switch {
+		case c == '"' || c == '\\':
+			buf = append(buf, '\\', c)
+		case c < 0x20:
+			buf = append(buf, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xf])
+		default:
+			buf = append(buf, c)
+		}
+	}
+	return append(buf, '"')
+}
+
+// unquoteJSONBytes Decodes a JSON string as a binary string, keeping invalid UTF-8 bytes
+func unquoteJSONBytes(raw []byte) ([]byte, error) {
+	if len(raw) < 2 || raw[0] != '"' || raw[len(raw)-1] != '"' {
+		return nil, ErrInvalidKeysFile
+	}
+	raw = raw[1 : len(raw)-1]
+
+	out := make([]byte, 0, len(raw))
+	for i := 0; i < len(raw); i++ {
+		c := raw[i]
+		if c != '\\' {
+			out = append(out, c)
+			continue
+		}
+		i++
+		if i >= len(raw) {
+			return nil, ErrInvalidKeysFile
+		}
+		switch raw[i] {
+		case '"', '\\', '/':
+			out = append(out, raw[i])
+		case 'b':
+			out = append(out, '\b')
+		case 'f':
+			out = append(out, '\f')
+		case 'n':
+			out = append(out, '\n')
+		case 'r':
+			out = append(out, '\r')
+		case 't':
+			out = append(out, '\t')
+		case 'u':
+			r, ok := readJSONHex(raw[i+1:])
+			if !ok {
+				return nil, ErrInvalidKeysFile
+			}
+			i += 4
+			if utf16.IsSurrogate(r) && i+6 < len(raw) && raw[i+1] == '\\' && raw[i+2] == 'u' {
+				if r2, ok := readJSONHex(raw[i+3:]); ok {
+					r = utf16.DecodeRune(r, r2)
+					i += 6
+				}
+			}
+			out = utf8.AppendRune(out, r)
+		default:
+			return nil, ErrInvalidKeysFile
+		}
+	}
+	return out, nil
+}
+
+func readJSONHex(b []byte) (rune, bool) {
+	if len(b) < 4 {
+		return 0, false
+	}
+	v, err := strconv.ParseUint(string(b[:4]), 16, 16)
+	if err != nil {
+		return 0, false
+	}
+	return rune(v), true
+}
@@ -0,0 +1,249 @@
+package wallet
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/address"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/crypto"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/crypto/curve25519"
+)
+
+func TestKeysFile(t *testing.T) {
+	var spendKey curve25519.Scalar
+	curve25519.RandomScalar(&spendKey, rand.Reader)
+
+	w, err := NewSpendWalletFromSpendKey[curve25519.VarTimeOperations](&spendKey, monero.StageNetwork, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	primary := w.Get(address.ZeroSubaddressIndex)
+
+	const password = "hunter2"
+
+	t.Run("Full", func(t *testing.T) {
+		f := NewKeysFile(primary, w.SpendKey(), w.ViewWallet().ViewKey(), 1700000000)
+		f.RefreshHeight = 1234
+		data, err := f.Encrypt(password, DefaultKdfRounds)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		decoded, err := DecryptKeysFile(data, password, DefaultKdfRounds)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if decoded.IsViewOnly() || decoded.SpendKey != f.SpendKey || decoded.ViewKey != f.ViewKey {
+			t.Fatal("secret keys mismatch")
+		}
+		if decoded.Address.TypeNetwork != monero.StageNetwork || decoded.Address.Compare(primary) != 0 {
+			t.Fatal("address mismatch")
+		}
+		if decoded.CreationTimestamp != f.CreationTimestamp || decoded.RefreshHeight != f.RefreshHeight || decoded.SeedLanguage != f.SeedLanguage {
+			t.Fatalf("metadata mismatch %+v", decoded)
+		}
+
+		sw, err := NewSpendWalletFromKeysFile[curve25519.VarTimeOperations](decoded, 1, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ix := address.SubaddressIndex{Account: 1, Offset: 5}
+		if sw.Get(ix).Compare(w.Get(ix)) != 0 {
+			t.Fatal("subaddress mismatch")
+		}
+		if tracked, ok := sw.HasSpend(*w.Get(ix).SpendPublicKey()); !ok || tracked != ix {
+			t.Fatal("subaddress not tracked")
+		}
+
+		if _, err = DecryptKeysFile(data, "wrong", DefaultKdfRounds); err == nil {
+			t.Fatal("decrypted with wrong password")
+		}
+	})
+
+	t.Run("ViewOnly", func(t *testing.T) {
+		f := NewKeysFile(primary, nil, w.ViewWallet().ViewKey(), 1700000000)
+		data, err := f.Encrypt(password, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		decoded, err := DecryptKeysFile(data, password, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !decoded.IsViewOnly() || decoded.ViewKey != f.ViewKey {
+			t.Fatal("secret keys mismatch")
+		}
+		if _, err = NewSpendWalletFromKeysFile[curve25519.VarTimeOperations](decoded, 0, 0); err == nil {
+			t.Fatal("created spend wallet from view-only keys file")
+		}
+		vw, err := NewViewWalletFromKeysFile[curve25519.VarTimeOperations](decoded, 0, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if vw.Get(address.ZeroSubaddressIndex).Compare(primary) != 0 {
+			t.Fatal("address mismatch")
+		}
+	})
+
+	t.Run("KeyData", func(t *testing.T) {
+		data := make([]byte, 256)
+		for i := range data {
+			data[i] = byte(i)
+		}
+		decoded, err := unquoteJSONBytes(appendJSONBytes(nil, data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(decoded) != string(data) {
+			t.Fatal("binary string mismatch")
+		}
+		if _, err = unquoteJSONBytes([]byte(`"\x`)); !errors.Is(err, ErrInvalidKeysFile) {
+			t.Fatalf("expected invalid keys file, got %v", err)
+		}
+	})
+}
+
+// testEpeeEntry Appends an epee portable storage entry with a name, type and encoded value
+func testEpeeEntry(buf []byte, name string, valueType byte, value []byte) []byte {
+	buf = append(buf, byte(len(name)))
+	buf = append(buf, name...)
+	buf = append(buf, valueType)
+	return append(buf, value...)
+}
+
+// testEpeeString Encodes an epee string value, for lengths below 64
+func testEpeeString(data []byte) []byte {
+	return append([]byte{byte(len(data) << 2)}, data...)
+}
+
+func TestKeysFileWallet2Layout(t *testing.T) {
+	const (
+		epeeTypeUint64 = 5
+		epeeTypeString = 10
+		epeeTypeObject = 12
+	)
+
+	// first wallet of monero tests/functional_tests
+	const (
+		spendKey       = "148d78d2aba7dbca5cd8f6abcfb0b3c009ffbdbea1ff373d50ed94d78286640e"
+		viewKey        = "49774391fa5e8d249fc2c5b45dadef13534bf2483dede880dac88f061e809100"
+		spendPublicKey = "1b3bd040020d3712ab84992b773d0a965134eb2df0392fb84af95de8a17be2ab"
+		viewPublicKey  = "231c9bf8341c6a870d92e3fb98063a90a355fb8dbf74a8561b9d7f9273247e99"
+		primaryAddress = "42ey1afDFnn4886T7196doS9GPMzexD9gXpsZJDwVjeRVdFCSoHnv7KPbBeGpzJBzHRCAs9UxqeoyFQMYbqSWYTfJJQAWDm"
+		password       = "test"
+	)
+	mustHex := func(s string) []byte {
+		b, err := hex.DecodeString(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	// account_base as serialized by wallet2, built by hand: signatures, version, then the root section
+	keyData := []byte{0x01, 0x11, 0x01, 0x01, 0x01, 0x01, 0x02, 0x01, 0x01}
+	keyData = append(keyData, 2<<2)
+	var accountAddress []byte
+	accountAddress = append(accountAddress, 2<<2)
+	accountAddress = testEpeeEntry(accountAddress, "m_spend_public_key", epeeTypeString, testEpeeString(mustHex(spendPublicKey)))
+	accountAddress = testEpeeEntry(accountAddress, "m_view_public_key", epeeTypeString, testEpeeString(mustHex(viewPublicKey)))
+	var keys []byte
+	keys = append(keys, 4<<2)
+	keys = testEpeeEntry(keys, "m_account_address", epeeTypeObject, accountAddress)
+	keys = testEpeeEntry(keys, "m_spend_secret_key", epeeTypeString, testEpeeString(mustHex(spendKey)))
+	keys = testEpeeEntry(keys, "m_view_secret_key", epeeTypeString, testEpeeString(mustHex(viewKey)))
+	keys = testEpeeEntry(keys, "m_encryption_iv", epeeTypeString, testEpeeString(make([]byte, crypto.ChaChaNonceSize)))
+	keyData = testEpeeEntry(keyData, "m_keys", epeeTypeObject, keys)
+	keyData = testEpeeEntry(keyData, "m_creation_timestamp", epeeTypeUint64, binary.LittleEndian.AppendUint64(nil, 1700000000))
+
+	// secret keys stored unencrypted inside the file, as done by wallets before encrypted_secret_keys
+	plain := []byte(`{"key_data":`)
+	plain = appendJSONBytes(plain, keyData)
+	plain = append(plain, `,"seed_language":"English","key_on_device":0,"watch_only":0,"multisig":0,"multisig_threshold":0,"always_confirm_transfers":1,"refresh_height":2000,"nettype":0,"encrypted_secret_keys":0}`...)
+
+	encrypted := make([]byte, len(plain)+crypto.ChaChaNonceSize)
+	crypto.ChaChaEncrypt(encrypted, plain, []byte(password), DefaultKdfRounds)
+	data := append([]byte(nil), encrypted[:crypto.ChaChaNonceSize]...)
+	data = binary.AppendUvarint(data, uint64(len(plain)))
+	data = append(data, encrypted[crypto.ChaChaNonceSize:]...)
+
+	f, err := DecryptKeysFile(data, password, DefaultKdfRounds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hex.EncodeToString(f.SpendKey[:]) != spendKey || hex.EncodeToString(f.ViewKey[:]) != viewKey {
+		t.Fatalf("unexpected secret keys %x %x", f.SpendKey[:], f.ViewKey[:])
+	}
+	if addr := string(f.Address.ToBase58()); addr != primaryAddress {
+		t.Fatalf("expected address %s, got %s", primaryAddress, addr)
+	}
+	if f.CreationTimestamp != 1700000000 || f.RefreshHeight != 2000 || f.SeedLanguage != "English" {
+		t.Fatalf("metadata mismatch %+v", f)
+	}
+	if string(f.Settings["always_confirm_transfers"]) != "1" || string(f.Settings["multisig_threshold"]) != "0" {
+		t.Fatalf("unknown settings not kept: %v", f.Settings)
+	}
+
+	w, err := NewSpendWalletFromKeysFile[curve25519.VarTimeOperations](f, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hex.EncodeToString(w.SpendKey().Bytes()) != spendKey {
+		t.Fatal("spend key mismatch")
+	}
+
+	if _, err = DecryptKeysFile(data, "wrong", DefaultKdfRounds); err == nil {
+		t.Fatal("decrypted with wrong password")
+	}
+}
+
+// testKeysFileEncrypted wallet2 .keys file with encrypted_secret_keys, for the first wallet of monero tests/functional_tests
+// Built outside this package with an independent CryptoNight and ChaCha20 implementation, checked against the monero slow hash vectors
+// Password "test", file iv 0102030405060708, secret keys iv a1a2a3a4a5a6a7a8
+const testKeysFileEncrypted = "0102030405060708830d307477f35c5604e3e35eaa46c100c579680da54396215d2392b0523b66876a845f4a52d74b09874d8484e4075431998967eee3797ce34f12dbba89033ace4dd8ea83f907ecfe807e40c8487bb4d3ca83467965fc19eeb8c800cac2187b328bc7249de93e7714e2d5cdacbe65c2828b45a0d15de01ad7f176549c3f9f926037db67fd81d7076deaaecc91b78990b8347af4f0eb59dcb9a51a11f22ca03b21b3a20cd68efc4aceaa02f868bc9c65cd820793a2b9bc6ba614adbd18f8202ff62c5f32748b95aeadbf498be4b525e5e8cb44b36a622a73a9a735e0a02137fb590d9144af4934215663ac32c1bff2f4d10a9529cb0a6843e049e09ed8a3160e628937c272b8e685d2b47b3122ba821be82996228c6404b9396a233a5ad9dbe0d5d25c7715a3e0ea0b61aae7de51c730d204a80ceab9f05fcec2fcb526bdddcb4382d0aa14713c36bb69806273f7d334d13e4ea8609a36ca8f97c9e189687686563fba4910b66de9d6d1dbb29ad0f3fbfc88b1d64480697b4b803a93bfb81811783794d4e27468c553ac123813e20968413ce2159294a80369a627b91da6311df6b37d181be41d1b803c87e06ebd495c574ee37d3b77cc261d5c8a4e63e58c3f7e7611e15f0f734b337e39f9ac56b8cd6d28bb6a6baa96bf461a1ec4310fbd2f480cbccadceec53c67e02c188f002ccab035ec9ec871c75b3da7dc363750691eb879818ada3ba78f00abd6f449a010a793d941514e951037b816d340d99e3d8ef0596d28df349c05a81acc0cd6e7018cabdaf32aa5e9c9df096a7cb0b31c06e3c68d1810e56fe89719eb1c3d3439c5427797472763d64ad01ffc609087b2dc9c251f37ce60ea097150d651185441f1f37061129134f6927828d98d4b249c5f84c4279d783a2bb9bb5388338517a5caa016a1094ecff394ffd8ec25fb0b2f81da2c971a486ddb03227f1c9c1e41cdf5378f590ad5e4fb0c48642ef8dd301dd0538a32a50925bc8eb17825849ab863e2ae4a80f1d80d76e34f47b7944eda2b0d93721130b1ccc1d2072edcedb979efc0c3b22842e694ad68d527bdc7f36f5185eee1072e6bb45f75f5b6d798dcd6d021000f3434aa8e2e57a558afc7cbbce1e30a5c2eefaa93680f56ed62eb190e5c76cdcf990203affc7cc848ab48d7345390c7c6676feaf8e47f46a9154d3761da63ba20c17f040b7b23890aad5a58660330cd73701b7ebe7e3fdfd6b844ff45370ef2b1bf758b7e9a325f2987b6a21d288b5419b9a2b56edf8798c22498ea5f72ed3af177b4eb66377023c16bc035e6020e62c470c84eaa4e238b84382614116121fcadc6f494ce1fcae0fd309cadf14759ea2f09cdb1ab0074bc35c400e5a7848331439a894647622c57420f3bd2c8a5d14a874fcd4c8d42b29486bb48bc09ac3743e9bfaf8b8d939261ad5e2453d9720931439cd133826433d05f1e6e1fa0de38acb1d3c23f7ba6142f6188920ae80a6831878b393f9b79100875702e94ed5640ada371f29d7f7dbff39ae8a3d7e21449b9fca7e8bba87efac4904192eb9fb1b4fc817200fc6fa622890e9a48b048f729270ded37eb0aa2baa7a011deefbb985121313d53b9ffb85d30ae800dd1d82d3d5cd0701e90ee800a433f1bc0bc16b7e8c8a08f6d8873cf38d995fe85f2e949c4822725113af4ebd754dfc4f00d6621bfb94161cb0c1e04930c2d5350637fc175e6c66f116cb11b43f412d9ea67d7490eafdec81691d9ef033ab3f6237e7bcc08b6e3367eb0ae2e7b5cade935510d54978e1de81817c0acca05c0d99a8a69dcde641778c65a9c5f10f0afd30acac2c9cade72ffca5c4057adab7993b35c2f20a57e1a131fd84c9d9a08509b2a1a27a078c4c68b12c340a2e418266a05d6565ff3be0c814d785d90c540fe9d0cfd7b8f5f7ea8c0a482584797d2dbe88c4bf0bba6ff3c5c0eaeb35c017bcbdf49694dfb72f30f23cda5fa8af43ae1e0f0d78f43cd9bce3fec578ba27552c6ace53fbc3d9716733d420519e2281df7d42c3ed37b03e3e5335dc551d483d4fcf2dea9083e57df4b31d2fb85561e0b4aeb078ae9cae6ca747c744160b8262795689f0aa2a4d21195a0a418e98b0bc32659c134ce2493b65a3f0532bf19ac509ded24c793db96ce489ef591a4fb40fcf28c691bcc233c572e0f816832abfc129bdc998770b9366fc054da7408082d52251c57dd3a477fd08c3ab71de2c67ec49acad2d5a9fee7eb727ddbe4e092dbcc28d5d3315b604250c20341a9f91450e67728678493f2276b8e82cd93e945993d05708cc7e48d63f8c9240c178109782353994758f3323fbf0824a072d519205609a4c8484d175cf05b7c1e2a3090"
+
+func TestKeysFileEncryptedSecretKeys(t *testing.T) {
+	const (
+		spendKey       = "148d78d2aba7dbca5cd8f6abcfb0b3c009ffbdbea1ff373d50ed94d78286640e"
+		viewKey        = "49774391fa5e8d249fc2c5b45dadef13534bf2483dede880dac88f061e809100"
+		primaryAddress = "42ey1afDFnn4886T7196doS9GPMzexD9gXpsZJDwVjeRVdFCSoHnv7KPbBeGpzJBzHRCAs9UxqeoyFQMYbqSWYTfJJQAWDm"
+		password       = "test"
+		// keyStream chacha20 of zeroes keyed with cn_slow_hash(cn_slow_hash(password) || 'k')
+		keyStream = "990a23b466623d3df49c4e9b2bc2b1742e11905f3718e271fa0458d7dc1d35190f35d60fa673eb29d34646f7491e453e1c92a910a46f0914e1063588ff5d0898"
+	)
+
+	if stream := keysFileSecretKeyStream([]byte(password), [crypto.ChaChaNonceSize]byte{0xa1, 0xa2, 0xa3, 0xa4, 0xa5, 0xa6, 0xa7, 0xa8}, DefaultKdfRounds); hex.EncodeToString(stream) != keyStream {
+		t.Fatalf("unexpected key stream %x", stream)
+	}
+
+	data, err := hex.DecodeString(testKeysFileEncrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := DecryptKeysFile(data, password, DefaultKdfRounds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hex.EncodeToString(f.SpendKey[:]) != spendKey || hex.EncodeToString(f.ViewKey[:]) != viewKey {
+		t.Fatalf("unexpected secret keys %x %x", f.SpendKey[:], f.ViewKey[:])
+	}
+	if addr := string(f.Address.ToBase58()); addr != primaryAddress {
+		t.Fatalf("expected address %s, got %s", primaryAddress, addr)
+	}
+	if f.CreationTimestamp != 1700000000 || f.RefreshHeight != 2000 || f.SubaddressLookaheadMajor != 50 || f.SubaddressLookaheadMinor != 200 {
+		t.Fatalf("metadata mismatch %+v", f)
+	}
+	if string(f.Settings["ask_password"]) != "2" || string(f.Settings["auto_mine_for_rpc_payment"]) != "0.0" {
+		t.Fatalf("unknown settings not kept: %v", f.Settings)
+	}
+
+	if _, err = DecryptKeysFile(data, "wrong", DefaultKdfRounds); err == nil {
+		t.Fatal("decrypted with wrong password")
+	}
+}
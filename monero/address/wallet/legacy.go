@@ -132,7 +132,7 @@ func (w *ViewWallet[T]) Match(outputs transaction.Outputs, commitments []ringct.
 
 			if encryptedPaymentId != nil {
 				// restore payment id if any
-				paymentIdKey := address.CalculatePaymentIdEncodingKey(extensionGBytes)
+				paymentIdKey := address.CalculatePaymentIdEncodingKey(derivation.AsBytes())
 				subtle.XORBytes(scan.PaymentId[:], encryptedPaymentId[:], paymentIdKey[:])
 			}
 
@@ -155,3 +155,35 @@ func TestSpendWallet_Match(t *testing.T) {
 
 	testScan[curve25519.ConstantTimeOperations](t, wallet)
 }
+
+func TestSpendWallet_SignMessage(t *testing.T) {
+	var spendKey curve25519.Scalar
+	curve25519.RandomScalar(&spendKey, rand.Reader)
+
+	wallet, err := NewSpendWalletFromSpendKey[curve25519.ConstantTimeOperations](&spendKey, monero.MainNetwork, 0, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	message := []byte("test_message")
+	for _, ix := range []address.SubaddressIndex{address.ZeroSubaddressIndex, {Account: 0, Offset: 2}, {Account: 1, Offset: 1}} {
+		a := wallet.Get(ix)
+		for _, e := range []struct {
+			Mode     uint8
+			Expected address.SignatureVerifyResult
+		}{
+			{address.MessageSignatureModeSpend, address.ResultSuccessSpend},
+			{address.MessageSignatureModeView, address.ResultSuccessView},
+		} {
+			for _, version := range []uint8{1, 2} {
+				signature, err := wallet.SignMessage(ix, message, e.Mode, version, rand.Reader)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if result := address.VerifyMessage(a, message, signature); result != e.Expected {
+					t.Fatalf("index %d/%d mode %d version %d: expected %d, got %d", ix.Account, ix.Offset, e.Mode, version, e.Expected, result)
+				}
+			}
+		}
+	}
+}
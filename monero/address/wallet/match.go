@@ -101,7 +101,7 @@ func matchTxProof[T curve25519.PointOperations](proof proofs.TxProof[T], txId ty
 		return -1, nil
 	}
 	for i := range txPubs.AdditionalPublicKeys {
-		if _, err = pubs[i].SetBytes(txPubs.AdditionalPublicKeys[i][:]); err != nil {
+		if _, err = pubs[i+1].SetBytes(txPubs.AdditionalPublicKeys[i][:]); err != nil {
 			return -1, nil
 		}
 	}
@@ -310,7 +310,7 @@ func matchDerivation[T curve25519.PointOperations](derivation curve25519.PublicK
 
 		if encryptedPaymentId != nil {
 			// restore payment id if any
-			paymentIdKey := address.CalculatePaymentIdEncodingKey(extensionGBytes)
+			paymentIdKey := address.CalculatePaymentIdEncodingKey(derivation)
 			subtle.XORBytes(scan.PaymentId[:], encryptedPaymentId[:], paymentIdKey[:])
 		}
 
@@ -376,6 +376,8 @@ func MatchTransaction[T curve25519.PointOperations, ViewWallet ViewWalletInterfa
 		for i != -1 && i < len(tx.Outputs()) {
 			if isCoinbase {
 				i, scan, ix = wallet.MatchCarrotCoinbase(blockIndex, tx.Outputs()[i:], pubs)
+			} else if len(tx.Inputs()) == 0 {
+				return errors.New("no transaction inputs")
 			} else {
 				i, scan, ix = wallet.MatchCarrot(tx.Inputs()[0].KeyImage, tx.Outputs()[i:], commitments, pubs, encryptedPaymentId)
 			}
@@ -407,6 +409,12 @@ func MatchTransaction[T curve25519.PointOperations, ViewWallet ViewWalletInterfa
 
 var ErrNoOutputs = errors.New("no transaction outputs")
 
+// ErrNoExtraTags The transaction extra is empty or could not be parsed
+var ErrNoExtraTags = errors.New("no extra tags")
+
+// ErrNoPublicKeys The transaction extra has no transaction public keys
+var ErrNoPublicKeys = errors.New("no public keys")
+
 func matchTxPreamble(tx transaction.PrunedTransaction) (pubs transaction.PublicKeys, legacyPaymentId *[monero.LegacyPaymentIdSize]byte, encryptedPaymentId *[monero.PaymentIdSize]byte, commitments []ringct.CommitmentEncryptedAmount, isCoinbase bool, blockIndex uint64, err error) {
 	if len(tx.Outputs()) == 0 {
 		return transaction.PublicKeys{}, nil, nil, nil, false, 0, ErrNoOutputs
@@ -414,11 +422,11 @@ func matchTxPreamble(tx transaction.PrunedTransaction) (pubs transaction.PublicK
 
 	extra := tx.ExtraTags()
 	if len(extra) == 0 {
-		return transaction.PublicKeys{}, nil, nil, nil, false, 0, errors.New("no extra tags")
+		return transaction.PublicKeys{}, nil, nil, nil, false, 0, ErrNoExtraTags
 	}
 	pubs, ok := transaction.ExtraPublicKeys(tx.ExtraTags())
 	if !ok {
-		return transaction.PublicKeys{}, nil, nil, nil, false, 0, errors.New("no public keys")
+		return transaction.PublicKeys{}, nil, nil, nil, false, 0, ErrNoPublicKeys
 	}
 
 	legacyPaymentId, encryptedPaymentId = transaction.ExtraPaymentId(extra)
@@ -1,10 +1,12 @@
 package wallet
 
 import (
+	"crypto/rand"
 	"fmt"
 	"os"
 	"testing"
 
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero"
 	"git.gammaspectra.live/P2Pool/consensus/v5/monero/address"
 	"git.gammaspectra.live/P2Pool/consensus/v5/monero/address/carrot"
 	"git.gammaspectra.live/P2Pool/consensus/v5/monero/client"
@@ -83,6 +85,72 @@ func TestMatchTransactionProof(t *testing.T) {
 	}
 }
 
+// TestMatchTransactionProof_AdditionalPublicKeys Proofs for the main transaction public key must match when additional public keys are present
+func TestMatchTransactionProof_AdditionalPublicKeys(t *testing.T) {
+	var spendKey, txKey, additionalTxKey curve25519.Scalar
+	curve25519.RandomScalar(&spendKey, rand.Reader)
+	curve25519.RandomScalar(&txKey, rand.Reader)
+	curve25519.RandomScalar(&additionalTxKey, rand.Reader)
+
+	w, err := NewSpendWalletFromSpendKey[curve25519.VarTimeOperations](&spendKey, monero.MainNetwork, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := w.Get(address.ZeroSubaddressIndex)
+
+	const amount = 600000000000
+	out, _, _ := address.CalculateTransactionOutput[curve25519.VarTimeOperations](addr, &txKey, 0, amount)
+	out.Amount = amount
+
+	txPub := new(curve25519.VarTimePublicKey).ScalarBaseMult(&txKey)
+	additionalTxPub := new(curve25519.VarTimePublicKey).ScalarBaseMult(&additionalTxKey)
+
+	tx := &transaction.P2PoolCoinbaseV2{
+		InputCount:      1,
+		InputType:       transaction.TxInGen,
+		MinerUnlockTime: 100 + monero.MinerRewardUnlockTime,
+		MinerGenHeight:  100,
+		MinerOutputs:    transaction.Outputs{out},
+		Extra: transaction.ExtraTags{
+			{
+				Tag:  transaction.TxExtraTagPubKey,
+				Data: txPub.Bytes(),
+			},
+			{
+				Tag:       transaction.TxExtraTagAdditionalPubKeys,
+				HasVarInt: true,
+				VarInt:    1,
+				Data:      additionalTxPub.Bytes(),
+			},
+		},
+		AuxiliaryData: transaction.CoinbaseTransactionAuxiliaryData{
+			TotalReward: amount,
+		},
+	}
+	txId := tx.Hash()
+
+	proof := address.GetInProof[curve25519.VarTimeOperations](addr, txId, w.ViewWallet().ViewKey(), txPub, "", 2, *additionalTxPub)
+
+	var hadMatch bool
+	err = MatchTransactionProof[curve25519.VarTimeOperations](addr, proof, "",
+		func(index int, scan *LegacyScan, _ address.SubaddressIndex) {
+			if index != 0 || scan.Amount != amount {
+				t.Fatalf("unexpected match of output #%d with amount %d", index, scan.Amount)
+			}
+			hadMatch = true
+		},
+		nil,
+		txId,
+		tx,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hadMatch {
+		t.Fatal("no match")
+	}
+}
+
 func TestMatchTransaction(t *testing.T) {
 	rpc := client.GetDefaultClient()
 
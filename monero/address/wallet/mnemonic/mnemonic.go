@@ -0,0 +1,188 @@
+// Package mnemonic Encodes and decodes Monero 25-word mnemonic seeds, and 16-word Polyseed phrases
+// Only the English Monero seed word list is included. Polyseed word lists are included for every language except Portuguese.
+// Seeds and phrases in other languages are rejected with ErrUnknownWord,
+// unless their word list is created with NewWordList and added to SeedWordLists or PolyseedWordLists.
+package mnemonic
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"strings"
+	"unicode/utf8"
+)
+
+// WordList A word list where each word is identified by its first PrefixLength characters, or by the whole word if PrefixLength is 0
+type WordList struct {
+	Name         string
+	PrefixLength int
+
+	words         []string
+	prefixes      map[string]int
+	ignoreAccents bool
+}
+
+// NewWordList Creates a word list. Word prefixes of prefixLength characters must be unique
+func NewWordList(name string, prefixLength int, words []string) *WordList {
+	return newWordList(name, prefixLength, words, false)
+}
+
+// NewAccentInsensitiveWordList Creates a word list where Latin accents are ignored when matching words, as Polyseed does for Spanish and French
+// Word prefixes of prefixLength characters must be unique without accents.
+func NewAccentInsensitiveWordList(name string, prefixLength int, words []string) *WordList {
+	return newWordList(name, prefixLength, words, true)
+}
+
+func newWordList(name string, prefixLength int, words []string, ignoreAccents bool) *WordList {
+	l := &WordList{
+		Name:          name,
+		PrefixLength:  prefixLength,
+		words:         words,
+		prefixes:      make(map[string]int, len(words)),
+		ignoreAccents: ignoreAccents,
+	}
+	for i, w := range words {
+		l.prefixes[l.key(w)] = i
+	}
+	if len(l.prefixes) != len(words) {
+		panic("word list prefixes are not unique")
+	}
+	return l
+}
+
+// key Returns the prefix of word used to look it up, ignoring case, Unicode normalization form and accents if set
+func (l *WordList) key(word string) string {
+	word = compose(strings.ToLower(word))
+	if l.ignoreAccents {
+		word = stripAccents(word)
+	}
+	return l.prefix(word)
+}
+
+// prefix Returns the first PrefixLength characters of word, or the whole word if shorter or PrefixLength is 0
+func (l *WordList) prefix(word string) string {
+	if l.PrefixLength == 0 {
+		return word
+	}
+	var n int
+	for range l.PrefixLength {
+		if n >= len(word) {
+			return word
+		}
+		_, size := utf8.DecodeRuneInString(word[n:])
+		n += size
+	}
+	return word[:n]
+}
+
+func (l *WordList) Len() int {
+	return len(l.words)
+}
+
+func (l *WordList) Word(index int) string {
+	return l.words[index]
+}
+
+// Index Returns the index of word, matched by its prefix. Case is ignored, and words may be in Unicode NFC or NFKD form
+func (l *WordList) Index(word string) (int, bool) {
+	i, ok := l.prefixes[l.key(word)]
+	return i, ok
+}
+
+// SeedWordLists Word lists tried when decoding Monero seeds, English only by default
+var SeedWordLists = []*WordList{English}
+
+const (
+	// SeedSize Size of a Monero seed, the private spend key
+	SeedSize = 32
+	// SeedWords Number of words of a Monero seed, including the checksum word
+	SeedWords = SeedSize/4*3 + 1
+)
+
+var (
+	ErrInvalidWordCount = errors.New("invalid word count")
+	ErrUnknownWord      = errors.New("word not found in any word list")
+	ErrInvalidChecksum  = errors.New("invalid checksum word")
+	ErrInvalidSeed      = errors.New("invalid seed")
+)
+
+// checksumIndex Returns the index of the word repeated as checksum, from the CRC32 of the word prefixes
+func (l *WordList) checksumIndex(words []string) int {
+	var buf []byte
+	for _, w := range words {
+		buf = append(buf, l.prefix(compose(strings.ToLower(w)))...)
+	}
+	return int(crc32.ChecksumIEEE(buf) % uint32(len(words)))
+}
+
+// EncodeSeed Encodes seed as words, with a trailing checksum word
+// Every 4 bytes are encoded as 3 words, seed length must be a multiple of 4.
+func EncodeSeed(seed []byte, list *WordList) ([]string, error) {
+	if len(seed) == 0 || len(seed)%4 != 0 {
+		return nil, ErrInvalidSeed
+	}
+	n := uint32(list.Len())
+
+	words := make([]string, 0, len(seed)/4*3+1)
+	for i := 0; i < len(seed); i += 4 {
+		x := binary.LittleEndian.Uint32(seed[i:])
+		w1 := x % n
+		w2 := (x/n + w1) % n
+		w3 := (x/n/n + w2) % n
+		words = append(words, list.Word(int(w1)), list.Word(int(w2)), list.Word(int(w3)))
+	}
+	words = append(words, words[list.checksumIndex(words)])
+	return words, nil
+}
+
+// DecodeSeed Decodes words into a seed, detecting the word list among lists, or SeedWordLists if none are given
+// The checksum word is optional, and verified if present.
+func DecodeSeed(words []string, lists ...*WordList) (seed []byte, list *WordList, err error) {
+	if len(lists) == 0 {
+		lists = SeedWordLists
+	}
+
+	if len(words) < 3 || (len(words)%3 != 0 && len(words)%3 != 1) {
+		return nil, nil, ErrInvalidWordCount
+	}
+
+	for _, l := range lists {
+		if seed, err = decodeSeed(words, l); errors.Is(err, ErrUnknownWord) {
+			continue
+		}
+		return seed, l, err
+	}
+	return nil, nil, ErrUnknownWord
+}
+
+func decodeSeed(words []string, list *WordList) ([]byte, error) {
+	indices := make([]uint32, len(words))
+	for i, w := range words {
+		index, ok := list.Index(w)
+		if !ok {
+			return nil, ErrUnknownWord
+		}
+		indices[i] = uint32(index)
+	}
+
+	dataWords := len(words) / 3 * 3
+	if len(words) > dataWords {
+		// compare by index, as words may only match by prefix
+		expected, _ := list.Index(words[list.checksumIndex(words[:dataWords])])
+		if indices[dataWords] != uint32(expected) {
+			return nil, ErrInvalidChecksum
+		}
+	}
+
+	n := uint64(list.Len())
+	seed := make([]byte, 0, dataWords/3*4)
+	for i := 0; i < dataWords; i += 3 {
+		w1, w2, w3 := uint64(indices[i]), uint64(indices[i+1]), uint64(indices[i+2])
+		x := w1 + n*((n-w1+w2)%n) + n*n*((n-w2+w3)%n)
+		if x > 0xffffffff || x%n != w1 {
+			return nil, ErrInvalidSeed
+		}
+		seed = binary.LittleEndian.AppendUint32(seed, uint32(x))
+	}
+	return seed, nil
+}
@@ -0,0 +1,225 @@
+package mnemonic
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSeed(t *testing.T) {
+	const phrase = "sequence atlas unveil summon pebbles tuesday beer rudely snake rockets different fuselage woven tagged bested dented vegan hover rapid fawns obvious muppet randomly seasons randomly"
+	expected, _ := hex.DecodeString("b0ef6bd527b9b23b9ceef70dc8b4cd1ee83ca14541964e764ad23f5151204f0f")
+
+	words := strings.Fields(phrase)
+	seed, list, err := DecodeSeed(words)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list != English || !bytes.Equal(seed, expected) {
+		t.Fatalf("unexpected seed %x", seed)
+	}
+
+	encoded, err := EncodeSeed(seed, English)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(encoded, words) {
+		t.Fatalf("unexpected words %v", encoded)
+	}
+
+	t.Run("Prefix", func(t *testing.T) {
+		prefixed := make([]string, len(words))
+		for i, w := range words {
+			prefixed[i] = strings.ToUpper(w[:3])
+		}
+		if seed, _, err := DecodeSeed(prefixed); err != nil || !bytes.Equal(seed, expected) {
+			t.Fatalf("unexpected seed %x: %v", seed, err)
+		}
+	})
+
+	t.Run("WithoutChecksum", func(t *testing.T) {
+		if seed, _, err := DecodeSeed(words[:24]); err != nil || !bytes.Equal(seed, expected) {
+			t.Fatalf("unexpected seed %x: %v", seed, err)
+		}
+	})
+
+	t.Run("InvalidChecksum", func(t *testing.T) {
+		invalid := slices.Clone(words)
+		invalid[24] = invalid[0]
+		if _, _, err := DecodeSeed(invalid); !errors.Is(err, ErrInvalidChecksum) {
+			t.Fatalf("expected invalid checksum, got %v", err)
+		}
+	})
+
+	t.Run("UnknownWord", func(t *testing.T) {
+		invalid := slices.Clone(words)
+		invalid[3] = "zzz"
+		if _, _, err := DecodeSeed(invalid); !errors.Is(err, ErrUnknownWord) {
+			t.Fatalf("expected unknown word, got %v", err)
+		}
+	})
+
+	t.Run("RoundTrip", func(t *testing.T) {
+		for range 64 {
+			seed := make([]byte, SeedSize)
+			_, _ = rand.Read(seed)
+			words, err := EncodeSeed(seed, English)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(words) != SeedWords {
+				t.Fatalf("expected %d words, got %d", SeedWords, len(words))
+			}
+			decoded, _, err := DecodeSeed(words)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(decoded, seed) {
+				t.Fatalf("expected seed %x, got %x", seed, decoded)
+			}
+		}
+	})
+}
+
+func TestPolyseed(t *testing.T) {
+	const phrase = "raven tail swear infant grief assist regular lamp duck valid someone little harsh puppy airport language"
+
+	words := strings.Fields(phrase)
+	p, list, err := DecodePolyseed(words, PolyseedCoinMonero)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list != PolyseedEnglish || p.Birthday != 1 || p.Features != 0 {
+		t.Fatalf("unexpected polyseed %+v", p)
+	}
+	if birthday := p.Time(); birthday.Year() != 2021 || birthday.Month() != time.December {
+		t.Fatalf("unexpected birthday %s", birthday)
+	}
+	if encoded := p.Encode(PolyseedEnglish, PolyseedCoinMonero); !slices.Equal(encoded, words) {
+		t.Fatalf("unexpected words %v", encoded)
+	}
+
+	t.Run("Coin", func(t *testing.T) {
+		if _, _, err := DecodePolyseed(words, 1); !errors.Is(err, ErrInvalidChecksum) {
+			t.Fatalf("expected invalid checksum, got %v", err)
+		}
+	})
+
+	t.Run("RoundTrip", func(t *testing.T) {
+		now := time.Now()
+		for features := range uint8(PolyseedUserFeatures + 1) {
+			p, err := NewPolyseed(rand.Reader, now, features)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, list := range PolyseedWordLists {
+				words := p.Encode(list, PolyseedCoinMonero)
+				decoded, decodedList, err := DecodePolyseed(words, PolyseedCoinMonero)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if *decoded != *p || decodedList != list {
+					t.Fatalf("expected %+v in %s, got %+v in %s", p, list.Name, decoded, decodedList.Name)
+				}
+			}
+			if now.Sub(p.Time()) < 0 || now.Sub(p.Time()) > PolyseedTimeStep*time.Second {
+				t.Fatalf("unexpected birthday %s", p.Time())
+			}
+		}
+	})
+
+	t.Run("Languages", func(t *testing.T) {
+		// the coefficients of the English phrase with other word lists
+		tests := []struct {
+			list   *WordList
+			phrase string
+		}{
+			{PolyseedSpanish, "pez sujeto sordo innato grave anotar pisar leer dieta tumba rumbo llover haber pecho agonía legión"},
+			{PolyseedFrench, "parcelle sincère service golfeur figure animal peigne humble descente trombone réussir inoculer flocon orgueil admirer humide"},
+			{PolyseedJapanese, "にってい\u3000ほこる\u3000ほうこく\u3000すんぽう\u3000しふく\u3000いねむり\u3000にんにく\u3000そうがんきょう\u3000けちらす\u3000やわらかい\u3000ひよう\u3000そんけい\u3000しゃしん\u3000なまえ\u3000あらわす\u3000そうき"},
+			{PolyseedKorean, "잠깐 캠페인 친척 수컷 서점 고객 장식 신고 미용실 한마디 차림 아시아 설치 입대 강수량 신규"},
+			{PolyseedChineseSimplified, "弧 悄 曼 居 械 由 渡 归 师 徽 漏 折 读 钠 下 召"},
+		}
+		for _, tt := range tests {
+			words := strings.Fields(tt.phrase)
+			decoded, list, err := DecodePolyseed(words, PolyseedCoinMonero)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if list != tt.list || *decoded != *p {
+				t.Fatalf("unexpected polyseed %+v in %s", decoded, list.Name)
+			}
+			if encoded := decoded.Encode(tt.list, PolyseedCoinMonero); !slices.Equal(encoded, words) {
+				t.Fatalf("unexpected words %v", encoded)
+			}
+		}
+	})
+
+	t.Run("Normalization", func(t *testing.T) {
+		tests := []struct {
+			list  *WordList
+			word  string
+			index int
+		}{
+			// accents are ignored
+			{PolyseedSpanish, "AGONIA", 44},
+			{PolyseedSpanish, "LEGIÓ", 999},
+			{PolyseedFrench, "reus", 1656},
+			// NFKD form
+			{PolyseedSpanish, "legio\u0301n", 999},
+			{PolyseedJapanese, "\u305d\u3046\u304b\u3099\u3093\u304d\u3087\u3046", 998},
+			{PolyseedKorean, "\u110c\u1161\u11b7\u1101\u1161\u11ab", 1427},
+		}
+		for _, tt := range tests {
+			if index, ok := tt.list.Index(tt.word); !ok || index != tt.index {
+				t.Fatalf("expected %q at %d in %s, got %d", tt.word, tt.index, tt.list.Name, index)
+			}
+		}
+
+		// whole words must match
+		if _, ok := PolyseedJapanese.Index("そうが"); ok {
+			t.Fatal("unexpected match of a partial word")
+		}
+	})
+
+	t.Run("Crypt", func(t *testing.T) {
+		p, err := NewPolyseed(rand.Reader, time.Now(), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key, err := p.Key(PolyseedCoinMonero, 32)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		encrypted := *p
+		if err = encrypted.Crypt("password"); err != nil {
+			t.Fatal(err)
+		}
+		if !encrypted.IsEncrypted() || encrypted.Secret == p.Secret {
+			t.Fatal("seed was not encrypted")
+		}
+		if _, err = encrypted.Key(PolyseedCoinMonero, 32); !errors.Is(err, ErrPolyseedEncrypted) {
+			t.Fatalf("expected encrypted error, got %v", err)
+		}
+
+		decoded, _, err := DecodePolyseed(encrypted.Encode(PolyseedEnglish, PolyseedCoinMonero), PolyseedCoinMonero)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = decoded.Crypt("password"); err != nil {
+			t.Fatal(err)
+		}
+		if *decoded != *p {
+			t.Fatalf("expected %+v, got %+v", p, decoded)
+		}
+		if decodedKey, err := decoded.Key(PolyseedCoinMonero, 32); err != nil || !bytes.Equal(decodedKey, key) {
+			t.Fatalf("unexpected key %x: %v", decodedKey, err)
+		}
+	})
+}
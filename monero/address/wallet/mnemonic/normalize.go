@@ -0,0 +1,106 @@
+package mnemonic
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// compositions Lowercase Latin-1 letters and Hiragana with their Unicode canonical decomposition, covering the characters of the included word lists
+var compositions = map[rune][2]rune{
+	'à': {'a', '\u0300'}, 'á': {'a', '\u0301'}, 'â': {'a', '\u0302'}, 'ã': {'a', '\u0303'},
+	'ä': {'a', '\u0308'}, 'å': {'a', '\u030a'}, 'ç': {'c', '\u0327'}, 'è': {'e', '\u0300'},
+	'é': {'e', '\u0301'}, 'ê': {'e', '\u0302'}, 'ë': {'e', '\u0308'}, 'ì': {'i', '\u0300'},
+	'í': {'i', '\u0301'}, 'î': {'i', '\u0302'}, 'ï': {'i', '\u0308'}, 'ñ': {'n', '\u0303'},
+	'ò': {'o', '\u0300'}, 'ó': {'o', '\u0301'}, 'ô': {'o', '\u0302'}, 'õ': {'o', '\u0303'},
+	'ö': {'o', '\u0308'}, 'ù': {'u', '\u0300'}, 'ú': {'u', '\u0301'}, 'û': {'u', '\u0302'},
+	'ü': {'u', '\u0308'}, 'ý': {'y', '\u0301'}, 'ÿ': {'y', '\u0308'}, 'が': {'か', '\u3099'},
+	'ぎ': {'き', '\u3099'}, 'ぐ': {'く', '\u3099'}, 'げ': {'け', '\u3099'}, 'ご': {'こ', '\u3099'},
+	'ざ': {'さ', '\u3099'}, 'じ': {'し', '\u3099'}, 'ず': {'す', '\u3099'}, 'ぜ': {'せ', '\u3099'},
+	'ぞ': {'そ', '\u3099'}, 'だ': {'た', '\u3099'}, 'ぢ': {'ち', '\u3099'}, 'づ': {'つ', '\u3099'},
+	'で': {'て', '\u3099'}, 'ど': {'と', '\u3099'}, 'ば': {'は', '\u3099'}, 'ぱ': {'は', '\u309a'},
+	'び': {'ひ', '\u3099'}, 'ぴ': {'ひ', '\u309a'}, 'ぶ': {'ふ', '\u3099'}, 'ぷ': {'ふ', '\u309a'},
+	'べ': {'へ', '\u3099'}, 'ぺ': {'へ', '\u309a'}, 'ぼ': {'ほ', '\u3099'}, 'ぽ': {'ほ', '\u309a'},
+	'ゔ': {'う', '\u3099'}, 'ゞ': {'ゝ', '\u3099'},
+}
+
+var composed = func() map[[2]rune]rune {
+	m := make(map[[2]rune]rune, len(compositions))
+	for c, d := range compositions {
+		m[d] = c
+	}
+	return m
+}()
+
+const (
+	hangulBase      = 0xac00
+	hangulLeadBase  = 0x1100
+	hangulVowelBase = 0x1161
+	hangulTailBase  = 0x11a7
+	hangulLeads     = 19
+	hangulVowels    = 21
+	hangulTails     = 28
+	hangulSyllables = hangulLeads * hangulVowels * hangulTails
+)
+
+// compose Composes decomposed characters in s, so words typed in Unicode NFC or NFKD form match the same
+// Only the characters in compositions and Hangul syllables are handled, which is enough for the included word lists.
+func compose(s string) string {
+	if !hasNonASCII(s) {
+		return s
+	}
+
+	runes := []rune(s)
+	out := runes[:0]
+	for _, r := range runes {
+		if n := len(out); n > 0 {
+			prev := out[n-1]
+			if c, ok := composed[[2]rune{prev, r}]; ok {
+				out[n-1] = c
+				continue
+			}
+			// Hangul leading consonant and vowel jamo, then optional trailing consonant jamo
+			if l, v := prev-hangulLeadBase, r-hangulVowelBase; l >= 0 && l < hangulLeads && v >= 0 && v < hangulVowels {
+				out[n-1] = hangulBase + (l*hangulVowels+v)*hangulTails
+				continue
+			}
+			if lv, t := prev-hangulBase, r-hangulTailBase; lv >= 0 && lv < hangulSyllables && lv%hangulTails == 0 && t > 0 && t < hangulTails {
+				out[n-1] = prev + t
+				continue
+			}
+		}
+		out = append(out, r)
+	}
+	return string(out)
+}
+
+// stripAccents Removes Latin combining diacritical marks from the composed string s
+func stripAccents(s string) string {
+	if !hasNonASCII(s) {
+		return s
+	}
+
+	var b strings.Builder
+	b.Grow(len(s))
+	for _, r := range s {
+		if d, ok := compositions[r]; ok && isCombiningDiacritic(d[1]) {
+			r = d[0]
+		} else if isCombiningDiacritic(r) {
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func isCombiningDiacritic(r rune) bool {
+	return r >= 0x300 && r <= 0x36f
+}
+
+func hasNonASCII(s string) bool {
+	for i := range len(s) {
+		if s[i] >= utf8.RuneSelf {
+			return true
+		}
+	}
+	return false
+}
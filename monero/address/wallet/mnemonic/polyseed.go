@@ -0,0 +1,258 @@
+package mnemonic
+
+import (
+	"crypto/pbkdf2"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+)
+
+const (
+	// PolyseedWords Number of words of a Polyseed phrase
+	PolyseedWords = 16
+	// PolyseedSecretSize Size of the Polyseed secret. Only the lowest 6 bits of the last byte are used, for 150 bits
+	PolyseedSecretSize = 19
+
+	// PolyseedEpoch Birthday zero, 1 November 2021
+	PolyseedEpoch = 1635768000
+	// PolyseedTimeStep Birthday resolution, 1/12 of the Gregorian year
+	PolyseedTimeStep = 2629746
+
+	// PolyseedCoinMonero Coin value for Monero seeds, mixed into the checksum to avoid reusing seeds across coins
+	PolyseedCoinMonero = 0
+
+	// PolyseedUserFeatures Feature bits available to users
+	PolyseedUserFeatures = 0x07
+	// PolyseedReservedFeatures Feature bits reserved for future use. Phrases with these set are rejected
+	PolyseedReservedFeatures = 0x08
+	// PolyseedEncrypted Feature bit set when the secret has been encrypted with a passphrase
+	PolyseedEncrypted = 0x10
+
+	polyseedKdfIterations = 10000
+	polyseedSecretBits    = 150
+	polyseedClearMask     = 0x3f
+	polyseedDateBits      = 10
+	polyseedDateMask      = 1<<polyseedDateBits - 1
+	polyseedFeatureBits   = 5
+	polyseedShareBits     = 10
+)
+
+// PolyseedWordLists Word lists tried in order when decoding Polyseed phrases
+var PolyseedWordLists = []*WordList{
+	PolyseedEnglish,
+	PolyseedJapanese,
+	PolyseedKorean,
+	PolyseedSpanish,
+	PolyseedFrench,
+	PolyseedItalian,
+	PolyseedCzech,
+	PolyseedChineseSimplified,
+	PolyseedChineseTraditional,
+}
+
+var (
+	ErrUnsupportedFeatures = errors.New("unsupported polyseed features")
+	ErrPolyseedEncrypted   = errors.New("polyseed is encrypted")
+)
+
+// Polyseed A 16-word seed with its wallet birthday, see https://github.com/tevador/polyseed
+type Polyseed struct {
+	Secret [PolyseedSecretSize]byte
+	// Birthday Months since PolyseedEpoch, wrapping every 1024 months
+	Birthday uint16
+	Features uint8
+}
+
+// NewPolyseed Creates a seed with a random secret and birthday at t. Only PolyseedUserFeatures bits are kept from features
+func NewPolyseed(rand io.Reader, t time.Time, features uint8) (*Polyseed, error) {
+	p := &Polyseed{
+		Features: features & PolyseedUserFeatures,
+	}
+	if _, err := io.ReadFull(rand, p.Secret[:]); err != nil {
+		return nil, err
+	}
+	p.Secret[PolyseedSecretSize-1] &= polyseedClearMask
+
+	if unix := t.Unix(); unix >= PolyseedEpoch {
+		p.Birthday = uint16(((unix - PolyseedEpoch) / PolyseedTimeStep) & polyseedDateMask)
+	}
+	return p, nil
+}
+
+// Time Returns the approximate creation time, to be used as wallet restore point
+func (p *Polyseed) Time() time.Time {
+	return time.Unix(PolyseedEpoch+int64(p.Birthday)*PolyseedTimeStep, 0).UTC()
+}
+
+func (p *Polyseed) IsEncrypted() bool {
+	return p.Features&PolyseedEncrypted != 0
+}
+
+// Encode Encodes the seed as PolyseedWords words for coin
+func (p *Polyseed) Encode(list *WordList, coin uint16) []string {
+	poly := p.poly()
+	poly[0] = poly.eval()
+	poly[1] ^= coin
+
+	words := make([]string, PolyseedWords)
+	for i, c := range poly {
+		words[i] = list.Word(int(c))
+	}
+	return words
+}
+
+// Key Derives a key of size bytes for coin from the secret
+// For Monero the key is 32 bytes, and reduced to a scalar to become the private spend key.
+func (p *Polyseed) Key(coin uint16, size int) ([]byte, error) {
+	if p.IsEncrypted() {
+		return nil, ErrPolyseedEncrypted
+	}
+
+	var salt [32]byte
+	copy(salt[:], "POLYSEED key")
+	salt[13], salt[14], salt[15] = 0xff, 0xff, 0xff
+	binary.LittleEndian.PutUint32(salt[16:], uint32(coin))
+	binary.LittleEndian.PutUint32(salt[20:], uint32(p.Birthday))
+	binary.LittleEndian.PutUint32(salt[24:], uint32(p.Features))
+
+	return pbkdf2.Key(sha256.New, string(p.Secret[:]), salt[:], polyseedKdfIterations, size)
+}
+
+// Crypt Encrypts or decrypts the secret with password, toggling PolyseedEncrypted
+// password must be in Unicode NFKD form, which ASCII passwords already are.
+func (p *Polyseed) Crypt(password string) error {
+	var salt [16]byte
+	copy(salt[:], "POLYSEED mask")
+	salt[14], salt[15] = 0xff, 0xff
+
+	mask, err := pbkdf2.Key(sha256.New, password, salt[:], polyseedKdfIterations, 32)
+	if err != nil {
+		return err
+	}
+	for i := range p.Secret {
+		p.Secret[i] ^= mask[i]
+	}
+	p.Secret[PolyseedSecretSize-1] &= polyseedClearMask
+	p.Features ^= PolyseedEncrypted
+	return nil
+}
+
+// DecodePolyseed Decodes a phrase for coin, detecting the word list among lists, or PolyseedWordLists if none are given
+// Lists where all words are known but the checksum fails are skipped, as words may be shared between languages.
+func DecodePolyseed(words []string, coin uint16, lists ...*WordList) (*Polyseed, *WordList, error) {
+	if len(lists) == 0 {
+		lists = PolyseedWordLists
+	}
+	if len(words) != PolyseedWords {
+		return nil, nil, ErrInvalidWordCount
+	}
+
+	err := ErrUnknownWord
+	for _, l := range lists {
+		var poly polyseedPoly
+		known := true
+		for i, w := range words {
+			index, ok := l.Index(w)
+			if !ok {
+				known = false
+				break
+			}
+			poly[i] = uint16(index)
+		}
+		if !known {
+			continue
+		}
+
+		poly[1] ^= coin
+		if poly.eval() != 0 {
+			err = ErrInvalidChecksum
+			continue
+		}
+
+		p := poly.data()
+		if p.Features&PolyseedReservedFeatures != 0 {
+			return nil, nil, ErrUnsupportedFeatures
+		}
+		return p, l, nil
+	}
+	return nil, nil, err
+}
+
+// polyseedPoly Polynomial over GF(2^11), coefficient 0 is the checksum
+type polyseedPoly [PolyseedWords]uint16
+
+// eval Evaluates the polynomial at x = 2 with Horner's method
+func (poly *polyseedPoly) eval() (result uint16) {
+	result = poly[PolyseedWords-1]
+	for i := PolyseedWords - 2; i >= 0; i-- {
+		// multiply by 2 modulo x^11 + x^2 + 1
+		if result >= 1024 {
+			result = (result << 1) ^ 0x805
+		} else {
+			result <<= 1
+		}
+		result ^= poly[i]
+	}
+	return result
+}
+
+// poly Packs 10 secret bits and 1 birthday or feature bit in each data coefficient, most significant first
+func (p *Polyseed) poly() (poly polyseedPoly) {
+	extraValue := uint32(p.Features)<<polyseedDateBits | uint32(p.Birthday)
+	extraBits := polyseedFeatureBits + polyseedDateBits
+
+	var secretIndex int
+	secretValue := uint32(p.Secret[0])
+	secretBits := 8
+	remainingBits := polyseedSecretBits - 8
+
+	for i := 1; i < PolyseedWords; i++ {
+		var value uint32
+		for bits := 0; bits < polyseedShareBits; {
+			if secretBits == 0 {
+				secretIndex++
+				secretBits = min(remainingBits, 8)
+				secretValue = uint32(p.Secret[secretIndex])
+				remainingBits -= secretBits
+			}
+			chunkBits := min(secretBits, polyseedShareBits-bits)
+			secretBits -= chunkBits
+			bits += chunkBits
+			value = value<<chunkBits | (secretValue>>secretBits)&(1<<chunkBits-1)
+		}
+		extraBits--
+		value = value<<1 | (extraValue>>extraBits)&1
+		poly[i] = uint16(value)
+	}
+	return poly
+}
+
+// data Unpacks the data coefficients, the reverse of Polyseed.poly
+func (poly *polyseedPoly) data() *Polyseed {
+	p := &Polyseed{}
+
+	var extraValue uint32
+	var secretIndex, secretBits int
+	for i := 1; i < PolyseedWords; i++ {
+		value := uint32(poly[i])
+		extraValue = extraValue<<1 | value&1
+		value >>= 1
+
+		for bits := polyseedShareBits; bits > 0; {
+			if secretBits == 8 {
+				secretIndex++
+				secretBits = 0
+			}
+			chunkBits := min(bits, 8-secretBits)
+			bits -= chunkBits
+			p.Secret[secretIndex] = p.Secret[secretIndex]<<chunkBits | byte((value>>bits)&(1<<chunkBits-1))
+			secretBits += chunkBits
+		}
+	}
+
+	p.Birthday = uint16(extraValue & polyseedDateMask)
+	p.Features = uint8(extraValue >> polyseedDateBits)
+	return p
+}
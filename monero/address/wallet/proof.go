@@ -0,0 +1,351 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/address"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/address/carrot"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/client"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/client/rpc/daemon"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/crypto"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/crypto/curve25519"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/crypto/ringct"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/proofs"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/transaction"
+	"git.gammaspectra.live/P2Pool/consensus/v5/types"
+)
+
+// ChainClient Fetches transactions, outputs and key image spent status, implemented by monero/client.Client
+type ChainClient interface {
+	GetPrunedTransactions(txIds ...types.Hash) (data [][]byte, jsonTx []*daemon.TransactionJSON, err error)
+	GetOuts(inputs ...daemon.GetOutsInput) ([]client.Output, error)
+	IsKeyImageSpent(ki ...curve25519.PublicKeyBytes) (status []int, err error)
+}
+
+var ErrOutputNotFound = errors.New("output not found in transaction")
+var ErrOutputNotOwned = errors.New("output does not belong to wallet")
+
+// OutputReference Identifies an output by the transaction that created it
+type OutputReference struct {
+	TransactionId types.Hash `json:"transaction_id"`
+	// Index Output index within the transaction
+	Index uint64 `json:"index"`
+}
+
+// GetReserveProof Creates a reserve proof for outputs received by the wallet, as monero-wallet-cli get_reserve_proof
+// Transactions are fetched to find the transaction public key each output was derived with. Only legacy outputs can be proven.
+func GetReserveProof[T curve25519.PointOperations, SpendWallet LegacyWalletInterface[T]](w SpendWallet, c ChainClient, message string, outputs []OutputReference, randomReader io.Reader) (proofs.ReserveProof[T], error) {
+	txIds := make([]types.Hash, 0, len(outputs))
+	for _, o := range outputs {
+		txIds = append(txIds, o.TransactionId)
+	}
+	txs, err := getPrunedTransactions(c, txIds...)
+	if err != nil {
+		return proofs.ReserveProof[T]{}, err
+	}
+
+	viewKey := w.ViewWallet().ViewKey()
+
+	// the primary address is always signed, as wallet2 does, so the proof is valid for it
+	primaryKey, _, _ := w.Opening(address.ZeroSubaddressIndex)
+	subaddressKeys := []*curve25519.Scalar{primaryKey}
+	usedIndices := map[address.SubaddressIndex]struct{}{
+		address.ZeroSubaddressIndex: {},
+	}
+
+	proofOutputs := make([]proofs.ReserveProofOutput[T], 0, len(outputs))
+	for _, o := range outputs {
+		output, ix, err := openReserveProofOutput[T](w, viewKey, txs[o.TransactionId], o)
+		if err != nil {
+			return proofs.ReserveProof[T]{}, err
+		}
+		proofOutputs = append(proofOutputs, output)
+
+		if _, ok := usedIndices[ix]; !ok {
+			usedIndices[ix] = struct{}{}
+			keyG, _, _ := w.Opening(ix)
+			subaddressKeys = append(subaddressKeys, keyG)
+		}
+	}
+
+	primaryAddress := w.Get(address.ZeroSubaddressIndex)
+	return proofs.GetReserveProof(message, primaryAddress.SpendPublicKey(), primaryAddress.ViewPublicKey(), viewKey, proofOutputs, subaddressKeys, randomReader)
+}
+
+// openReserveProofOutput Finds the transaction public key an output was derived with, and opens its one-time address
+func openReserveProofOutput[T curve25519.PointOperations, SpendWallet LegacyWalletInterface[T]](w SpendWallet, viewKey *curve25519.Scalar, tx transaction.PrunedTransaction, o OutputReference) (output proofs.ReserveProofOutput[T], ix address.SubaddressIndex, err error) {
+	if o.Index >= uint64(len(tx.Outputs())) {
+		return output, ix, ErrOutputNotFound
+	}
+	out := &tx.Outputs()[o.Index]
+	if out.Type != transaction.TxOutToKey && out.Type != transaction.TxOutToTaggedKey {
+		return output, ix, errors.New("only legacy outputs can be proven")
+	}
+
+	pubs, ok := transaction.ExtraPublicKeys(tx.ExtraTags())
+	if !ok {
+		return output, ix, errors.New("no public keys")
+	}
+
+	var oneTimeAddress curve25519.PublicKey[T]
+	if _, err = oneTimeAddress.SetBytes(out.EphemeralPublicKey[:]); err != nil {
+		return output, ix, err
+	}
+
+	var txPub, spendPub curve25519.PublicKey[T]
+	var extensionG curve25519.Scalar
+	for pub := range pubs.Scan(o.Index) {
+		if _, err = txPub.SetBytes(pub[:]); err != nil {
+			continue
+		}
+
+		// D = O - Hs(8 a R || i) G
+		derivation := address.GetDerivation(new(curve25519.PublicKey[T]), &txPub, viewKey).AsBytes()
+		crypto.GetDerivationSharedDataForOutputIndex(&extensionG, derivation, o.Index)
+		spendPub.Subtract(&oneTimeAddress, new(curve25519.PublicKey[T]).ScalarBaseMult(&extensionG))
+
+		if ix, ok = w.HasSpend(spendPub.AsBytes()); !ok {
+			continue
+		}
+
+		x, _, err := TrySearchForOpeningForOneTimeAddress[T, SpendWallet](w, &spendPub, &extensionG, new(curve25519.Scalar))
+		if err != nil {
+			return output, ix, err
+		}
+		keyPair := crypto.NewKeyPairFromPrivate[T](x)
+		if keyPair.PublicKey.Equal(&oneTimeAddress) == 0 {
+			return output, ix, ErrCannotRecomputeOneTimeAddressFromOpening
+		}
+
+		return proofs.ReserveProofOutput[T]{
+			TransactionId:        o.TransactionId,
+			Index:                o.Index,
+			TransactionPublicKey: txPub,
+			KeyPair:              keyPair,
+		}, ix, nil
+	}
+
+	return output, ix, ErrOutputNotOwned
+}
+
+// VerifyReserveProof Verifies a reserve proof for the account of primary address a, as monero-wallet-cli check_reserve_proof
+// Transactions and the spent status of the proven outputs are fetched from c. It returns the total amount of the proven outputs, and how much of it is spent.
+func VerifyReserveProof[T curve25519.PointOperations](c ChainClient, a address.Interface, message string, proof proofs.ReserveProof[T]) (total, spent uint64, err error) {
+	if sa, ok := a.(address.InterfaceSubaddress); ok && sa.IsSubaddress() {
+		return 0, 0, errors.New("address must not be a subaddress")
+	}
+	if len(proof.Entries) == 0 {
+		return 0, 0, errors.New("reserve proof has no entries")
+	}
+
+	// without a signature of the primary spend key, a holder of the view key could prove outputs of its own spend key
+	if !slices.ContainsFunc(proof.Subaddresses, func(s proofs.ReserveProofSubaddress[T]) bool {
+		return s.SpendPub == *a.SpendPublicKey()
+	}) {
+		return 0, 0, errors.New("address is not found in the reserve proof")
+	}
+
+	prefixHash := proof.PrefixHash(message, a.SpendPublicKey(), a.ViewPublicKey())
+	if !proof.VerifySubaddresses(prefixHash) {
+		return 0, 0, errors.New("invalid subaddress signature")
+	}
+
+	spendPubs := make([]curve25519.PublicKey[T], len(proof.Subaddresses))
+	for i, s := range proof.Subaddresses {
+		// checked by VerifySubaddresses
+		_, _ = spendPubs[i].SetBytes(s.SpendPub[:])
+	}
+
+	var viewPub curve25519.PublicKey[T]
+	if _, err = viewPub.SetBytes(a.ViewPublicKey()[:]); err != nil {
+		return 0, 0, err
+	}
+
+	txIds := make([]types.Hash, 0, len(proof.Entries))
+	for _, e := range proof.Entries {
+		txIds = append(txIds, e.TransactionId)
+	}
+	txs, err := getPrunedTransactions(c, txIds...)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	keyImages := make([]curve25519.PublicKeyBytes, 0, len(proof.Entries))
+	amounts := make([]uint64, 0, len(proof.Entries))
+	seen := make(map[curve25519.PublicKeyBytes]struct{}, len(proof.Entries))
+	for i, e := range proof.Entries {
+		tx := txs[e.TransactionId]
+		if e.Index >= uint64(len(tx.Outputs())) {
+			return 0, 0, ErrOutputNotFound
+		}
+		out := &tx.Outputs()[e.Index]
+
+		pubs, _, _, commitments, _, _, err := matchTxPreamble(tx)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		var oneTimeAddress curve25519.PublicKey[T]
+		if _, err = oneTimeAddress.SetBytes(out.EphemeralPublicKey[:]); err != nil {
+			return 0, 0, err
+		}
+		txPubs := make([]curve25519.PublicKey[T], 0, 2)
+		for pub := range pubs.Scan(e.Index) {
+			var txPub curve25519.PublicKey[T]
+			if _, err = txPub.SetBytes(pub[:]); err == nil {
+				txPubs = append(txPubs, txPub)
+			}
+		}
+
+		if !proof.VerifyEntry(prefixHash, i, &viewPub, &oneTimeAddress, txPubs...) {
+			return 0, 0, fmt.Errorf("invalid signature for entry #%d", i)
+		}
+
+		if _, ok := seen[e.KeyImage]; ok {
+			return 0, 0, fmt.Errorf("duplicate output for entry #%d", i)
+		}
+		seen[e.KeyImage] = struct{}{}
+
+		// checked by VerifyEntry
+		var sharedSecret curve25519.PublicKey[T]
+		_, _ = sharedSecret.SetBytes(e.SharedSecret[:])
+		derivation := new(curve25519.PublicKey[T]).MultByCofactor(&sharedSecret).AsBytes()
+
+		var scan *LegacyScan
+		for j := range spendPubs {
+			if _, scan = matchDerivation(derivation, &spendPubs[j], out, commitments, nil); scan != nil {
+				break
+			}
+		}
+		if scan == nil {
+			return 0, 0, fmt.Errorf("output of entry #%d was not received by a signed address", i)
+		}
+
+		keyImages = append(keyImages, e.KeyImage)
+		amounts = append(amounts, scan.Amount)
+		total += scan.Amount
+	}
+
+	status, err := c.IsKeyImageSpent(keyImages...)
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(status) != len(keyImages) {
+		return 0, 0, errors.New("invalid key image status count")
+	}
+	for i, s := range status {
+		// spent in blockchain or pool
+		if s != 0 {
+			spent += amounts[i]
+		}
+	}
+
+	return total, spent, nil
+}
+
+// VerifySpendProof Verifies a spend proof of transaction txId, as monero-wallet-cli check_spend_proof
+// The transaction inputs and their ring members are fetched from c.
+func VerifySpendProof[T curve25519.PointOperations](c ChainClient, txId types.Hash, message string, proof proofs.SpendProof[T]) (ok bool, err error) {
+	txs, err := getPrunedTransactions(c, txId)
+	if err != nil {
+		return false, err
+	}
+	tx := txs[txId]
+	if len(tx.Inputs()) == 0 {
+		return false, errors.New("transaction has no inputs")
+	}
+
+	var outs []daemon.GetOutsInput
+	for _, in := range tx.Inputs() {
+		var index uint64
+		for _, offset := range in.Offsets {
+			index += offset
+			outs = append(outs, daemon.GetOutsInput{
+				Amount: in.Amount,
+				Index:  index,
+			})
+		}
+	}
+
+	members, err := c.GetOuts(outs...)
+	if err != nil {
+		return false, err
+	}
+	if len(members) != len(outs) {
+		return false, errors.New("invalid output count")
+	}
+
+	keyImages := make([]curve25519.PublicKey[T], len(tx.Inputs()))
+	rings := make([]ringct.Ring[T], len(tx.Inputs()))
+	for i, in := range tx.Inputs() {
+		if _, err = keyImages[i].SetBytes(in.KeyImage[:]); err != nil {
+			return false, err
+		}
+		rings[i] = make(ringct.Ring[T], len(in.Offsets))
+		for j := range rings[i] {
+			if _, err = rings[i][j].SetBytes(members[j].Key[:]); err != nil {
+				return false, err
+			}
+		}
+		members = members[len(in.Offsets):]
+	}
+
+	return proof.Verify(proofs.TxPrefixHash(txId, message), keyImages, rings), nil
+}
+
+// VerifyTransactionProof Verifies an OutProof or InProof of transaction txId for address a, as monero-wallet-cli check_tx_proof
+// The transaction is fetched from c. It returns the amount received by a, and false when the proof is invalid or no outputs for a were found.
+func VerifyTransactionProof[T curve25519.PointOperations](c ChainClient, a address.InterfaceSubaddress, txId types.Hash, message string, proof proofs.TxProof[T]) (received uint64, ok bool, err error) {
+	txs, err := getPrunedTransactions(c, txId)
+	if err != nil {
+		return 0, false, err
+	}
+
+	err = MatchTransactionProof(a, proof, message,
+		func(_ int, scan *LegacyScan, _ address.SubaddressIndex) {
+			ok = true
+			received += scan.Amount
+		},
+		func(_ int, scan *carrot.ScanV1, _ address.SubaddressIndex) {
+			ok = true
+			received += scan.Amount
+		},
+		txId, txs[txId],
+	)
+	if err != nil {
+		return 0, false, err
+	}
+	return received, ok, nil
+}
+
+// getPrunedTransactions Fetches and decodes transactions, keyed by id. Duplicate ids are fetched once
+func getPrunedTransactions(c ChainClient, txIds ...types.Hash) (map[types.Hash]transaction.PrunedTransaction, error) {
+	txs := make(map[types.Hash]transaction.PrunedTransaction, len(txIds))
+	unique := make([]types.Hash, 0, len(txIds))
+	for _, txId := range txIds {
+		if _, ok := txs[txId]; !ok {
+			txs[txId] = nil
+			unique = append(unique, txId)
+		}
+	}
+
+	data, _, err := c.GetPrunedTransactions(unique...)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) != len(unique) {
+		return nil, errors.New("invalid transaction count")
+	}
+
+	for i, txId := range unique {
+		tx, err := transaction.NewPrunedTransactionFromBytes(data[i])
+		if err != nil {
+			return nil, err
+		}
+		txs[txId] = tx
+	}
+	return txs, nil
+}
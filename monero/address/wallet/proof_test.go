@@ -0,0 +1,284 @@
+package wallet
+
+import (
+	"crypto/rand"
+	"errors"
+	"testing"
+
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/address"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/client"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/client/rpc/daemon"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/crypto"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/crypto/curve25519"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/crypto/ringct"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/proofs"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/transaction"
+	"git.gammaspectra.live/P2Pool/consensus/v5/types"
+)
+
+// testChain Serves pruned transactions, ring members and key image status
+type testChain struct {
+	txs     map[types.Hash][]byte
+	outputs map[uint64]client.Output
+	spent   map[curve25519.PublicKeyBytes]int
+}
+
+func (c *testChain) GetPrunedTransactions(txIds ...types.Hash) (data [][]byte, jsonTx []*daemon.TransactionJSON, err error) {
+	for _, txId := range txIds {
+		blob, ok := c.txs[txId]
+		if !ok {
+			return nil, nil, errors.New("transaction not found")
+		}
+		data = append(data, blob)
+	}
+	return data, nil, nil
+}
+
+func (c *testChain) GetOuts(inputs ...daemon.GetOutsInput) ([]client.Output, error) {
+	result := make([]client.Output, 0, len(inputs))
+	for _, in := range inputs {
+		o, ok := c.outputs[in.Index]
+		if !ok || in.Amount != 0 {
+			return nil, errors.New("output not found")
+		}
+		result = append(result, o)
+	}
+	return result, nil
+}
+
+func (c *testChain) IsKeyImageSpent(ki ...curve25519.PublicKeyBytes) (status []int, err error) {
+	for _, k := range ki {
+		status = append(status, c.spent[k])
+	}
+	return status, nil
+}
+
+type testPayment struct {
+	Address address.Interface
+	Amount  uint64
+}
+
+// addTransaction Adds a transaction with one input signed by keyPair at a ring of chain outputs, paying to payments with txKey
+func (c *testChain) addTransaction(t *testing.T, keyPair *crypto.KeyPair[curve25519.VarTimeOperations], txKey *curve25519.Scalar, payments ...testPayment) (txId types.Hash, ring ringct.Ring[curve25519.VarTimeOperations]) {
+	const ringSize = 4
+
+	var offsets []uint64
+	for i := range ringSize {
+		var key curve25519.Scalar
+		curve25519.RandomScalar(&key, rand.Reader)
+		member := new(curve25519.VarTimePublicKey).ScalarBaseMult(&key)
+		if i == 1 {
+			member = &keyPair.PublicKey
+		}
+		index := uint64(len(c.outputs))
+		c.outputs[index] = client.Output{
+			GlobalOutputIndex: index,
+			Key:               types.Hash(member.AsBytes()),
+			Unlocked:          true,
+		}
+		ring = append(ring, *member)
+		if i == 0 {
+			offsets = append(offsets, index)
+		} else {
+			offsets = append(offsets, 1)
+		}
+	}
+
+	tx := &transaction.TransactionV2{
+		Prefix: transaction.Prefix{
+			Inputs: transaction.Inputs{
+				{
+					Offsets:  offsets,
+					KeyImage: crypto.GetBiasedKeyImage(new(curve25519.VarTimePublicKey), keyPair).AsBytes(),
+				},
+			},
+		},
+		Base: transaction.Base{
+			ProofType: transaction.CLSAGBulletproofPlus,
+			Fee:       1000000,
+		},
+	}
+
+	var additionalPubs []byte
+	for i, p := range payments {
+		out, additionalPub, commitment := address.CalculateTransactionOutput[curve25519.VarTimeOperations](p.Address, txKey, uint64(i), p.Amount)
+		if additionalPub == nil {
+			additionalPub = new(curve25519.VarTimePublicKey).ScalarBaseMult(txKey)
+		}
+		additionalPubs = append(additionalPubs, additionalPub.Bytes()...)
+		tx.Prefix.Outputs = append(tx.Prefix.Outputs, out)
+		tx.Base.EncryptedAmounts = append(tx.Base.EncryptedAmounts, commitment.EncryptedAmount)
+		tx.Base.Commitments = append(tx.Base.Commitments, commitment.Commitment)
+	}
+
+	tags := transaction.ExtraTags{
+		{
+			Tag:  transaction.TxExtraTagPubKey,
+			Data: new(curve25519.VarTimePublicKey).ScalarBaseMult(txKey).Bytes(),
+		},
+		{
+			Tag:       transaction.TxExtraTagAdditionalPubKeys,
+			HasVarInt: true,
+			VarInt:    uint64(len(payments)),
+			Data:      additionalPubs,
+		},
+	}
+	extra, err := tags.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.Prefix.Extra = extra
+
+	blob, err := tx.AppendPrunedBinary(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = rand.Read(txId[:])
+	c.txs[txId] = blob
+	return txId, ring
+}
+
+func TestChainProofs(t *testing.T) {
+	newWallet := func() *SpendWallet[curve25519.VarTimeOperations] {
+		var spendKey curve25519.Scalar
+		curve25519.RandomScalar(&spendKey, rand.Reader)
+		w, err := NewSpendWalletFromSpendKey[curve25519.VarTimeOperations](&spendKey, monero.MainNetwork, 0, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return w
+	}
+
+	w := newWallet()
+	primaryAddress := w.Get(address.ZeroSubaddressIndex)
+	subaddress := w.Get(address.SubaddressIndex{Account: 0, Offset: 2})
+	other := newWallet().Get(address.ZeroSubaddressIndex)
+
+	chain := &testChain{
+		txs:     make(map[types.Hash][]byte),
+		outputs: make(map[uint64]client.Output),
+		spent:   make(map[curve25519.PublicKeyBytes]int),
+	}
+
+	var inputKey, txKey curve25519.Scalar
+	curve25519.RandomScalar(&inputKey, rand.Reader)
+	curve25519.RandomScalar(&txKey, rand.Reader)
+	keyPair := crypto.NewKeyPairFromPrivate[curve25519.VarTimeOperations](&inputKey)
+
+	txId, ring := chain.addTransaction(t, keyPair, &txKey,
+		testPayment{Address: primaryAddress, Amount: 3000000000000},
+		testPayment{Address: subaddress, Amount: 2000000000000},
+		testPayment{Address: other, Amount: 1000000000000},
+	)
+
+	const message = "proof message"
+
+	t.Run("SpendProof", func(t *testing.T) {
+		proof, err := proofs.GetSpendProof[curve25519.VarTimeOperations](txId, message, 1, []*crypto.KeyPair[curve25519.VarTimeOperations]{keyPair}, []ringct.Ring[curve25519.VarTimeOperations]{ring}, rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok, err := VerifySpendProof(chain, txId, message, proof); err != nil {
+			t.Fatal(err)
+		} else if !ok {
+			t.Fatal("spend proof verification failed")
+		}
+		if ok, err := VerifySpendProof(chain, txId, "other message", proof); err != nil {
+			t.Fatal(err)
+		} else if ok {
+			t.Fatal("spend proof verified with a different message")
+		}
+	})
+
+	t.Run("TxProof", func(t *testing.T) {
+		for _, e := range []struct {
+			Address  *address.Address
+			Expected uint64
+		}{
+			{primaryAddress, 3000000000000},
+			{subaddress, 2000000000000},
+		} {
+			proof := address.GetOutProof[curve25519.VarTimeOperations](e.Address, txId, &txKey, message, 2, txKey, txKey, txKey)
+			received, ok, err := VerifyTransactionProof(chain, e.Address, txId, message, proof)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !ok || received != e.Expected {
+				t.Fatalf("expected %d received, got %d", e.Expected, received)
+			}
+		}
+	})
+
+	t.Run("ReserveProof", func(t *testing.T) {
+		proof, err := GetReserveProof[curve25519.VarTimeOperations](w, chain, message, []OutputReference{
+			{TransactionId: txId, Index: 0},
+			{TransactionId: txId, Index: 1},
+		}, rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(proof.Subaddresses) != 2 {
+			t.Fatalf("expected 2 subaddress signatures, got %d", len(proof.Subaddresses))
+		}
+
+		decoded, err := proofs.NewReserveProofFromString[curve25519.VarTimeOperations](proof.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		total, spent, err := VerifyReserveProof(chain, primaryAddress, message, decoded)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if total != 5000000000000 || spent != 0 {
+			t.Fatalf("expected total 5000000000000 and nothing spent, got %d and %d", total, spent)
+		}
+
+		chain.spent[decoded.Entries[1].KeyImage] = 1
+		if total, spent, err = VerifyReserveProof(chain, primaryAddress, message, decoded); err != nil {
+			t.Fatal(err)
+		}
+		if total != 5000000000000 || spent != 2000000000000 {
+			t.Fatalf("expected total 5000000000000 and 2000000000000 spent, got %d and %d", total, spent)
+		}
+
+		if _, _, err = VerifyReserveProof(chain, primaryAddress, "other message", decoded); err == nil {
+			t.Fatal("reserve proof verified with a different message")
+		}
+		if _, _, err = VerifyReserveProof(chain, other, message, decoded); err == nil {
+			t.Fatal("reserve proof verified for a different address")
+		}
+
+		if _, err = GetReserveProof[curve25519.VarTimeOperations](w, chain, message, []OutputReference{{TransactionId: txId, Index: 2}}, rand.Reader); !errors.Is(err, ErrOutputNotOwned) {
+			t.Fatalf("expected %s, got %v", ErrOutputNotOwned, err)
+		}
+	})
+
+	t.Run("ReserveProofSubaddress", func(t *testing.T) {
+		proof, err := GetReserveProof[curve25519.VarTimeOperations](w, chain, message, []OutputReference{
+			{TransactionId: txId, Index: 1},
+		}, rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the primary address is signed even when it received none of the outputs
+		if len(proof.Subaddresses) != 2 || proof.Subaddresses[0].SpendPub != *primaryAddress.SpendPublicKey() {
+			t.Fatalf("expected primary and subaddress signatures, got %d", len(proof.Subaddresses))
+		}
+
+		total, _, err := VerifyReserveProof(chain, primaryAddress, message, proof)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if total != 2000000000000 {
+			t.Fatalf("expected total 2000000000000, got %d", total)
+		}
+
+		withoutPrimary := proof
+		withoutPrimary.Subaddresses = proof.Subaddresses[1:]
+		if _, _, err = VerifyReserveProof(chain, primaryAddress, message, withoutPrimary); err == nil {
+			t.Fatal("reserve proof verified without a primary address signature")
+		}
+	})
+}
@@ -0,0 +1,293 @@
+// Package scanner Walks main chain blocks via monerod binary RPC, matching coinbase and regular transactions against a view wallet
+// OutputStore keeps the received outputs with their key images and spend state.
+package scanner
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/address"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/address/carrot"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/address/wallet"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/block"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/client"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/crypto/curve25519"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/transaction"
+	"git.gammaspectra.live/P2Pool/consensus/v5/types"
+	"git.gammaspectra.live/P2Pool/consensus/v5/utils"
+)
+
+// CheckpointDepth Number of recent block ids kept in a Checkpoint to detect reorgs
+const CheckpointDepth = 64
+
+var ErrReorgTooDeep = errors.New("reorg deeper than checkpoint depth")
+
+// Checkpoint Scanning progress, which can be persisted to resume scanning
+type Checkpoint struct {
+	// Height Next height to scan
+	Height uint64 `json:"height"`
+	// Ids Ids of the most recently scanned blocks, up to CheckpointDepth. The last entry is at Height - 1
+	Ids []types.Hash `json:"ids"`
+}
+
+// Output A received output matched by the wallet
+type Output struct {
+	TransactionId types.Hash `json:"transaction_id"`
+	BlockId       types.Hash `json:"block_id"`
+	BlockHeight   uint64     `json:"block_height"`
+	Timestamp     uint64     `json:"timestamp"`
+
+	// Index Output index within the transaction
+	Index int `json:"index"`
+	// GlobalOutputIndex Index of the output across all RingCT outputs, as used in rings
+	GlobalOutputIndex uint64 `json:"global_output_index"`
+
+	Amount         uint64                    `json:"amount"`
+	OneTimeAddress curve25519.PublicKeyBytes `json:"one_time_address"`
+	AddressIndex   address.SubaddressIndex   `json:"address_index"`
+	// PaymentId Decrypted payment id, only meaningful for payments to integrated addresses
+	PaymentId [monero.PaymentIdSize]byte `json:"payment_id,omitzero"`
+
+	// Coinbase Whether the output was created by a miner transaction, for example a P2Pool payout
+	Coinbase   bool   `json:"coinbase"`
+	UnlockTime uint64 `json:"unlock_time"`
+
+	// Legacy Scan data, set for legacy outputs
+	Legacy *wallet.LegacyScan `json:"-"`
+	// Carrot Scan data, set for Carrot outputs
+	Carrot *carrot.ScanV1 `json:"-"`
+}
+
+// Handler Receives scanned blocks in chain order
+type Handler interface {
+	// HandleBlock Called for every scanned block with the outputs received in it, which may be empty
+	// Transactions are pruned. Returning an error stops scanning, and the block is scanned again on the next call.
+	HandleBlock(height uint64, b *block.CompleteEntry, outputs []Output) error
+	// HandleReorg Called when blocks at height and above are no longer part of the main chain
+	HandleReorg(height uint64) error
+}
+
+type Scanner[T curve25519.PointOperations, ViewWallet wallet.ViewWalletInterface[T]] struct {
+	client     client.RPC
+	wallet     ViewWallet
+	handler    Handler
+	checkpoint Checkpoint
+}
+
+// NewScanner Creates a scanner resuming from checkpoint. Use Checkpoint{Height: restoreHeight} to start a new scan
+// The genesis block is never scanned.
+func NewScanner[T curve25519.PointOperations, ViewWallet wallet.ViewWalletInterface[T]](c client.RPC, viewWallet ViewWallet, handler Handler, checkpoint Checkpoint) *Scanner[T, ViewWallet] {
+	checkpoint.Ids = append([]types.Hash(nil), checkpoint.Ids...)
+	return &Scanner[T, ViewWallet]{
+		client:     c,
+		wallet:     viewWallet,
+		handler:    handler,
+		checkpoint: checkpoint,
+	}
+}
+
+// Checkpoint Returns a copy of the current progress
+func (s *Scanner[T, ViewWallet]) Checkpoint() Checkpoint {
+	return Checkpoint{
+		Height: s.checkpoint.Height,
+		Ids:    append([]types.Hash(nil), s.checkpoint.Ids...),
+	}
+}
+
+func (s *Scanner[T, ViewWallet]) tip() (types.Hash, bool) {
+	if len(s.checkpoint.Ids) == 0 {
+		return types.ZeroHash, false
+	}
+	return s.checkpoint.Ids[len(s.checkpoint.Ids)-1], true
+}
+
+// Scan Scans the next batch of blocks. Returns done when the checkpoint has reached the daemon height
+// When a reorg is detected the checkpoint is rewound and Handler.HandleReorg is called, without scanning blocks.
+func (s *Scanner[T, ViewWallet]) Scan(ctx context.Context) (done bool, err error) {
+	tipId, hasTip := s.tip()
+
+	// request the last scanned block again to check it is still in the main chain
+	// the genesis block cannot be requested by height, and never changes
+	start := s.checkpoint.Height
+	verify := hasTip && start > 1
+	if verify {
+		start--
+	}
+	start = max(start, 1)
+
+	result, err := s.client.GetBlocksBin(ctx, nil, start, true)
+	if err != nil {
+		if verify {
+			// the chain may have become shorter than our checkpoint
+			if rewound, rewindErr := s.rewind(ctx); rewindErr == nil && rewound {
+				return false, nil
+			}
+		}
+		return false, err
+	}
+	if result.StartHeight != start {
+		return false, utils.ErrorfNoEscape("unexpected start height %d, expected %d", result.StartHeight, start)
+	}
+
+	blocks, err := block.DecodeCompleteEntries(result)
+	if err != nil {
+		return false, err
+	}
+
+	for i := range blocks {
+		b := &blocks[i]
+		height := result.StartHeight + uint64(i)
+		if verify && i == 0 {
+			if b.Block.Id() != tipId {
+				_, err = s.rewind(ctx)
+				return false, err
+			}
+			continue
+		}
+		if tipId, hasTip = s.tip(); hasTip && b.Block.PreviousId != tipId {
+			_, err = s.rewind(ctx)
+			return false, err
+		}
+
+		outputs, err := s.scanBlock(height, b)
+		if err != nil {
+			return false, err
+		}
+		if err = s.handler.HandleBlock(height, b, outputs); err != nil {
+			return false, err
+		}
+
+		s.checkpoint.Height = height + 1
+		s.checkpoint.Ids = append(s.checkpoint.Ids, b.Block.Id())
+		if len(s.checkpoint.Ids) > CheckpointDepth {
+			s.checkpoint.Ids = append(s.checkpoint.Ids[:0], s.checkpoint.Ids[len(s.checkpoint.Ids)-CheckpointDepth:]...)
+		}
+	}
+
+	return s.checkpoint.Height >= result.CurrentHeight, nil
+}
+
+// Run Scans until the context is done, waiting interval between scans once the daemon height is reached
+// onError is called for scan errors, which are retried after interval.
+func (s *Scanner[T, ViewWallet]) Run(ctx context.Context, interval time.Duration, onError func(err error)) error {
+	for {
+		done, err := s.Scan(ctx)
+		if err != nil && onError != nil {
+			onError(err)
+		}
+		if done || err != nil {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(interval):
+			}
+		} else if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+}
+
+// rewind Finds the highest checkpoint id still in the main chain, and rewinds the checkpoint after it
+func (s *Scanner[T, ViewWallet]) rewind(ctx context.Context) (rewound bool, err error) {
+	oldest := s.checkpoint.Height - uint64(len(s.checkpoint.Ids))
+
+	// as in Scan, the genesis block is assumed to match
+	start := max(oldest, 1)
+	result, err := s.client.GetHashesBin(ctx, nil, start)
+	if err != nil {
+		return false, err
+	}
+	if result.StartHeight != start {
+		return false, utils.ErrorfNoEscape("unexpected start height %d, expected %d", result.StartHeight, start)
+	}
+	ids := result.BlockIds
+
+	matching := start - oldest
+	for matching < uint64(len(s.checkpoint.Ids)) {
+		i := oldest + matching - result.StartHeight
+		if i >= uint64(len(ids)) || ids[i] != s.checkpoint.Ids[matching] {
+			break
+		}
+		matching++
+	}
+	if matching == 0 {
+		return false, ErrReorgTooDeep
+	}
+
+	height := oldest + matching
+	if height == s.checkpoint.Height {
+		// the chain changed back in the meantime
+		return false, nil
+	}
+	if err = s.handler.HandleReorg(height); err != nil {
+		return false, err
+	}
+	utils.Logf("Scanner", "reorg detected, rewound from height %d to %d", s.checkpoint.Height, height)
+	s.checkpoint.Height = height
+	s.checkpoint.Ids = s.checkpoint.Ids[:matching]
+	return true, nil
+}
+
+// scanBlock Matches the miner transaction and all regular transactions of a block
+func (s *Scanner[T, ViewWallet]) scanBlock(height uint64, b *block.CompleteEntry) (outputs []Output, err error) {
+	if len(b.OutputIndices) != len(b.Transactions)+1 {
+		return nil, utils.ErrorfNoEscape("block %d: invalid output indices count", height)
+	}
+
+	blockId := b.Block.Id()
+	scanTx := func(txId types.Hash, tx transaction.PrunedTransaction, indices []uint64, coinbase bool) error {
+		if len(indices) != len(tx.Outputs()) {
+			return utils.ErrorfNoEscape("transaction %s: invalid output indices count", txId)
+		}
+
+		record := func(index int, amount uint64, ix address.SubaddressIndex) *Output {
+			outputs = append(outputs, Output{
+				TransactionId:     txId,
+				BlockId:           blockId,
+				BlockHeight:       height,
+				Timestamp:         b.Block.Timestamp,
+				Index:             index,
+				GlobalOutputIndex: indices[index],
+				Amount:            amount,
+				OneTimeAddress:    tx.Outputs()[index].EphemeralPublicKey,
+				AddressIndex:      ix,
+				Coinbase:          coinbase,
+				UnlockTime:        tx.UnlockTime(),
+			})
+			return &outputs[len(outputs)-1]
+		}
+
+		err := wallet.MatchTransaction[T, ViewWallet](s.wallet, func(index int, scan *wallet.LegacyScan, ix address.SubaddressIndex) {
+			o := record(index, scan.Amount, ix)
+			o.PaymentId = scan.PaymentId
+			o.Legacy = scan
+		}, func(index int, scan *carrot.ScanV1, ix address.SubaddressIndex) {
+			o := record(index, scan.Amount, ix)
+			o.PaymentId = scan.PaymentId
+			o.Carrot = scan
+		}, tx)
+		switch {
+		case err == nil:
+		case errors.Is(err, wallet.ErrNoOutputs), errors.Is(err, wallet.ErrNoExtraTags), errors.Is(err, wallet.ErrNoPublicKeys):
+			// transactions without outputs or public keys cannot pay to the wallet, and are skipped as in wallet2
+			utils.Debugf("Scanner", "transaction %s: %s", txId, err)
+		default:
+			// the block is scanned again on the next call
+			return utils.ErrorfNoEscape("transaction %s: %w", txId, err)
+		}
+		return nil
+	}
+
+	if err = scanTx(b.Block.Coinbase.Hash(), &b.Block.Coinbase, b.OutputIndices[0], true); err != nil {
+		return nil, err
+	}
+	for i, tx := range b.Transactions {
+		if err = scanTx(b.Block.Transactions[i], tx, b.OutputIndices[i+1], false); err != nil {
+			return nil, err
+		}
+	}
+
+	return outputs, nil
+}
@@ -0,0 +1,233 @@
+package scanner_test
+
+import (
+	"context"
+	"crypto/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/address"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/address/wallet"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/address/wallet/scanner"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/block"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/client"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/client/fakemonerod"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/client/rpc/daemon"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/crypto/curve25519"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/crypto/ringct"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/transaction"
+	"git.gammaspectra.live/P2Pool/consensus/v5/types"
+)
+
+type testHandler struct {
+	outputs map[uint64][]scanner.Output
+	reorgs  []uint64
+}
+
+func (h *testHandler) HandleBlock(height uint64, b *block.CompleteEntry, outputs []scanner.Output) error {
+	h.outputs[height] = outputs
+	return nil
+}
+
+func (h *testHandler) HandleReorg(height uint64) error {
+	h.reorgs = append(h.reorgs, height)
+	for k := range h.outputs {
+		if k >= height {
+			delete(h.outputs, k)
+		}
+	}
+	return nil
+}
+
+func scanAll[T curve25519.PointOperations, ViewWallet wallet.ViewWalletInterface[T]](t *testing.T, ctx context.Context, s *scanner.Scanner[T, ViewWallet]) {
+	for range 100 {
+		done, err := s.Scan(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if done {
+			return
+		}
+	}
+	t.Fatal("scan did not finish")
+}
+
+func TestScanner(t *testing.T) {
+	var spendKey curve25519.Scalar
+	curve25519.RandomScalar(&spendKey, rand.Reader)
+
+	w, err := wallet.NewSpendWalletFromSpendKey[curve25519.VarTimeOperations](&spendKey, monero.MainNetwork, 0, 80)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := fakemonerod.New(fakemonerod.Config{
+		Height:       20,
+		MinerAddress: w.Get(address.ZeroSubaddressIndex),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	rpcClient, err := client.NewClient(d.RPCAddress(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	h := &testHandler{outputs: make(map[uint64][]scanner.Output)}
+
+	checkOutputs := func(from, to uint64) {
+		for height := from; height < to; height++ {
+			outputs, ok := h.outputs[height]
+			if !ok {
+				t.Fatalf("block %d not scanned", height)
+			}
+			b := d.BlockByHeight(height)
+			if len(outputs) != 1 {
+				t.Fatalf("expected 1 output at height %d, got %d", height, len(outputs))
+			}
+			o := outputs[0]
+			if o.BlockId != b.Id || o.TransactionId != b.Block.Coinbase.Hash() || !o.Coinbase || o.Legacy == nil {
+				t.Fatalf("unexpected output at height %d", height)
+			}
+			if o.Amount != b.Reward || o.GlobalOutputIndex != height || o.UnlockTime != height+monero.MinerRewardUnlockTime {
+				t.Fatalf("unexpected output amount %d, global index %d, unlock time %d at height %d", o.Amount, o.GlobalOutputIndex, o.UnlockTime, height)
+			}
+		}
+	}
+
+	s := scanner.NewScanner[curve25519.VarTimeOperations](rpcClient, w.ViewWallet(), h, scanner.Checkpoint{Height: 10})
+	scanAll(t, ctx, s)
+	if len(h.outputs) != 10 {
+		t.Fatalf("expected 10 scanned blocks, got %d", len(h.outputs))
+	}
+	checkOutputs(10, 20)
+
+	// resume from checkpoint
+	d.Mine(5)
+	s = scanner.NewScanner[curve25519.VarTimeOperations](rpcClient, w.ViewWallet(), h, s.Checkpoint())
+	scanAll(t, ctx, s)
+	if s.Checkpoint().Height != 25 {
+		t.Fatalf("expected checkpoint at height 25, got %d", s.Checkpoint().Height)
+	}
+	checkOutputs(10, 25)
+
+	// replace blocks 23 and 24
+	d.Reorg(2)
+	scanAll(t, ctx, s)
+	if len(h.reorgs) != 1 || h.reorgs[0] != 23 {
+		t.Fatalf("unexpected reorgs %v", h.reorgs)
+	}
+	checkOutputs(10, 26)
+	if cp := s.Checkpoint(); cp.Height != 26 || cp.Ids[len(cp.Ids)-1] != d.Tip().Id {
+		t.Fatal("checkpoint does not match tip")
+	}
+}
+
+// staticRPC Serves a fixed get_blocks.bin result, other methods are not implemented
+type staticRPC struct {
+	client.RPC
+	result *daemon.GetBlocksBinResult
+}
+
+func (c *staticRPC) GetBlocksBin(ctx context.Context, blockIds []types.Hash, startHeight uint64, prune bool) (*daemon.GetBlocksBinResult, error) {
+	return c.result, nil
+}
+
+func TestScannerMalformedTransaction(t *testing.T) {
+	const height = 10
+
+	var spendKey curve25519.Scalar
+	curve25519.RandomScalar(&spendKey, rand.Reader)
+	w, err := wallet.NewSpendWalletFromSpendKey[curve25519.VarTimeOperations](&spendKey, monero.MainNetwork, 0, 80)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var txKey curve25519.Scalar
+	curve25519.RandomScalar(&txKey, rand.Reader)
+	extraTags := transaction.ExtraTags{{Tag: transaction.TxExtraTagPubKey, Data: new(curve25519.VarTimePublicKey).ScalarBaseMult(&txKey).Bytes()}}
+	extra, err := extraTags.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Carrot outputs require a key image from the first input, which this transaction does not have
+	tx := &transaction.TransactionV2{
+		Prefix: transaction.Prefix{
+			Outputs: transaction.Outputs{{Index: 0, Type: transaction.TxOutToCarrotV1}},
+			Extra:   extra,
+		},
+		Base: transaction.Base{
+			ProofType:        transaction.CLSAGBulletproofPlus,
+			EncryptedAmounts: make([]ringct.EncryptedAmount, 1),
+			Commitments:      make([]curve25519.PublicKeyBytes, 1),
+		},
+	}
+	txBlob, err := tx.AppendPrunedBinary(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	txId := types.Hash{1}
+
+	b := &block.PoolMainBlock{
+		MajorVersion: 16,
+		MinorVersion: 16,
+		Coinbase: transaction.P2PoolCoinbaseV2{
+			InputCount:      1,
+			InputType:       transaction.TxInGen,
+			MinerUnlockTime: height + monero.MinerRewardUnlockTime,
+			MinerGenHeight:  height,
+			MinerOutputs: transaction.Outputs{
+				{Index: 0, Amount: 600000000000, Type: transaction.TxOutToTaggedKey},
+			},
+			Extra: extraTags,
+			AuxiliaryData: transaction.CoinbaseTransactionAuxiliaryData{
+				TotalReward: 600000000000,
+			},
+		},
+		Transactions: []types.Hash{txId},
+	}
+	blob, err := b.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := &daemon.GetBlocksBinResult{
+		Blocks: []daemon.BlockCompleteEntry{
+			{
+				Pruned:       true,
+				Block:        blob,
+				BlockWeight:  uint64(len(blob) + len(txBlob)),
+				Transactions: []daemon.TransactionBlobEntry{{Blob: txBlob, PrunableHash: types.Hash{2}}},
+			},
+		},
+		StartHeight:   height,
+		CurrentHeight: height + 1,
+		OutputIndices: make([]daemon.BlockOutputIndices, 1),
+	}
+	result.OutputIndices[0].Transactions = make([]struct {
+		Indices []uint64 `levin:"indices"`
+	}, 2)
+	result.OutputIndices[0].Transactions[0].Indices = []uint64{height}
+	result.OutputIndices[0].Transactions[1].Indices = []uint64{height + 1}
+
+	h := &testHandler{outputs: make(map[uint64][]scanner.Output)}
+	s := scanner.NewScanner[curve25519.VarTimeOperations](&staticRPC{result: result}, w.ViewWallet(), h, scanner.Checkpoint{Height: height})
+
+	for range 2 {
+		if _, err = s.Scan(context.Background()); err == nil || !strings.Contains(err.Error(), txId.String()) {
+			t.Fatalf("expected transaction error, got %v", err)
+		}
+		// the block is not skipped
+		if s.Checkpoint().Height != height || len(h.outputs) != 0 {
+			t.Fatal("checkpoint advanced past malformed transaction")
+		}
+	}
+}
@@ -0,0 +1,405 @@
+package scanner
+
+import (
+	"errors"
+	"io"
+	"slices"
+	"sync"
+
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/address"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/address/wallet"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/block"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/crypto"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/crypto/curve25519"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/crypto/ringct"
+	"git.gammaspectra.live/P2Pool/consensus/v5/types"
+)
+
+// SpentStatus Same values as returned by monerod is_key_image_spent
+type SpentStatus int
+
+const (
+	Unspent SpentStatus = iota
+	SpentInBlockchain
+	SpentInPool
+)
+
+// unlockTimeMaxBlockHeight Unlock times below this value are block heights, otherwise timestamps
+const unlockTimeMaxBlockHeight = 500000000
+
+// OwnedOutput A received output with its spend state
+type OwnedOutput struct {
+	Output
+
+	// SpendPub Address spend public key the output was received on
+	SpendPub curve25519.PublicKeyBytes `json:"spend_pub"`
+	// ExtensionG Sender extension over G, added to the address opening to spend the output
+	ExtensionG curve25519.PrivateKeyBytes `json:"extension_g"`
+	// ExtensionT Sender extension over T, always zero for legacy outputs
+	ExtensionT           curve25519.PrivateKeyBytes `json:"extension_t"`
+	AmountBlindingFactor curve25519.PrivateKeyBytes `json:"amount_blinding_factor"`
+
+	// KeyImage Zero when not known, as for view-only stores without imported key images
+	KeyImage curve25519.PublicKeyBytes `json:"key_image"`
+
+	Spent SpentStatus `json:"spent"`
+	// SpentHeight Height of the block including the spending transaction, when spent in a scanned block
+	SpentHeight        uint64     `json:"spent_height,omitempty"`
+	SpentTransactionId types.Hash `json:"spent_transaction_id,omitempty"`
+}
+
+// UnlockHeight Lowest chain height at which the output can be spent, ignoring unlock times given as timestamps
+// Coinbase outputs are locked for monero.MinerRewardUnlockTime blocks, others for monero.TransactionUnlockTime blocks.
+func (o *OwnedOutput) UnlockHeight() uint64 {
+	if o.Coinbase {
+		return o.BlockHeight + monero.MinerRewardUnlockTime
+	}
+	unlockHeight := o.BlockHeight + monero.TransactionUnlockTime
+	if o.UnlockTime < unlockTimeMaxBlockHeight {
+		unlockHeight = max(unlockHeight, o.UnlockTime)
+	}
+	return unlockHeight
+}
+
+// Unlocked Whether the output can be spent in a block at height with the given timestamp
+func (o *OwnedOutput) Unlocked(height, timestamp uint64) bool {
+	if height < o.UnlockHeight() {
+		return false
+	}
+	if !o.Coinbase && o.UnlockTime >= unlockTimeMaxBlockHeight {
+		return timestamp >= o.UnlockTime
+	}
+	return true
+}
+
+type Balance struct {
+	// Unlocked Sum of unspent outputs that can be spent at the current height
+	Unlocked uint64 `json:"unlocked"`
+	// Locked Sum of unspent outputs that are not yet spendable
+	Locked uint64 `json:"locked"`
+}
+
+// KeyImageChecker Implemented by monero/client.Client and monero/client.PoolClient
+type KeyImageChecker interface {
+	IsKeyImageSpent(ki ...curve25519.PublicKeyBytes) (status []int, err error)
+}
+
+// OutputStore Records outputs received by a wallet and tracks when they are spent
+// It implements Handler to be fed by a Scanner. Key images are computed for spend wallets, or can be imported for view wallets.
+type OutputStore[T curve25519.PointOperations] struct {
+	lock sync.RWMutex
+
+	// spendWallet nil for view-only stores
+	spendWallet wallet.SpendWalletInterface[T]
+
+	outputs    []*OwnedOutput
+	byKeyImage map[curve25519.PublicKeyBytes]*OwnedOutput
+
+	// height Next height to be scanned
+	height    uint64
+	timestamp uint64
+}
+
+// NewOutputStore Creates an empty store. spendWallet can be nil for view-only wallets
+func NewOutputStore[T curve25519.PointOperations](spendWallet wallet.SpendWalletInterface[T]) *OutputStore[T] {
+	return &OutputStore[T]{
+		spendWallet: spendWallet,
+		byKeyImage:  make(map[curve25519.PublicKeyBytes]*OwnedOutput),
+	}
+}
+
+// keyImage Computes the key image of an output with the spend wallet opening
+func (s *OutputStore[T]) keyImage(o *OwnedOutput) (ki curve25519.PublicKeyBytes, err error) {
+	var spendPub, oneTimeAddress curve25519.PublicKey[T]
+	if _, err = spendPub.SetBytes(o.SpendPub[:]); err != nil {
+		return ki, err
+	}
+	if _, err = oneTimeAddress.SetBytes(o.OneTimeAddress[:]); err != nil {
+		return ki, err
+	}
+
+	// x = k^{j,g}_addr + k^g_o, using the generate-image key for Carrot wallets
+	x, _, err := wallet.TrySearchForOpeningForOneTimeAddress[T, wallet.SpendWalletInterface[T]](s.spendWallet, &spendPub, o.ExtensionG.Scalar(), o.ExtensionT.Scalar())
+	if err != nil {
+		return ki, err
+	}
+
+	var image curve25519.PublicKey[T]
+	crypto.GetBiasedKeyImage(&image, &crypto.KeyPair[T]{PrivateKey: *x, PublicKey: oneTimeAddress})
+	return image.AsBytes(), nil
+}
+
+// HandleBlock Records received outputs, and marks outputs spent by key images in the block inputs
+func (s *OutputStore[T]) HandleBlock(height uint64, b *block.CompleteEntry, outputs []Output) error {
+	owned := make([]*OwnedOutput, 0, len(outputs))
+	for _, out := range outputs {
+		o := &OwnedOutput{
+			Output: out,
+		}
+		if out.Legacy != nil {
+			o.SpendPub = out.Legacy.SpendPub
+			o.ExtensionG = curve25519.PrivateKeyBytes(out.Legacy.ExtensionG.Bytes())
+			o.ExtensionT = curve25519.PrivateKeyBytes(out.Legacy.ExtensionT.Bytes())
+			o.AmountBlindingFactor = out.Legacy.AmountBlindingFactor
+		} else if out.Carrot != nil {
+			o.SpendPub = out.Carrot.SpendPub
+			o.ExtensionG = curve25519.PrivateKeyBytes(out.Carrot.ExtensionG.Bytes())
+			o.ExtensionT = curve25519.PrivateKeyBytes(out.Carrot.ExtensionT.Bytes())
+			o.AmountBlindingFactor = out.Carrot.AmountBlindingFactor
+		}
+
+		if s.spendWallet != nil {
+			ki, err := s.keyImage(o)
+			if err != nil {
+				return err
+			}
+			o.KeyImage = ki
+		}
+		owned = append(owned, o)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, o := range owned {
+		s.outputs = append(s.outputs, o)
+		if o.KeyImage != curve25519.ZeroPublicKeyBytes {
+			s.byKeyImage[o.KeyImage] = o
+		}
+	}
+
+	for i, tx := range b.Transactions {
+		for _, in := range tx.Inputs() {
+			if o, ok := s.byKeyImage[in.KeyImage]; ok {
+				o.Spent = SpentInBlockchain
+				o.SpentHeight = height
+				o.SpentTransactionId = b.Block.Transactions[i]
+			}
+		}
+	}
+
+	s.height = height + 1
+	s.timestamp = b.Block.Timestamp
+	return nil
+}
+
+// HandleReorg Removes outputs received at height and above, and restores outputs spent there
+func (s *OutputStore[T]) HandleReorg(height uint64) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.outputs = slices.DeleteFunc(s.outputs, func(o *OwnedOutput) bool {
+		if o.BlockHeight >= height {
+			delete(s.byKeyImage, o.KeyImage)
+			return true
+		}
+		return false
+	})
+	for _, o := range s.outputs {
+		if o.Spent == SpentInBlockchain && o.SpentHeight >= height {
+			o.Spent = Unspent
+			o.SpentHeight = 0
+			o.SpentTransactionId = types.ZeroHash
+		}
+	}
+	s.height = min(s.height, height)
+	return nil
+}
+
+var ErrKeyImageCountMismatch = errors.New("key image count does not match outputs")
+
+// ImportKeyImages Sets key images of a view-only store from an export, as read by wallet.DecryptKeyImages
+// Images are in the order outputs were received, starting at the export offset. Each signature is verified against the output.
+// Only legacy outputs can be verified, as the signature proves knowledge of x for O = x G.
+func (s *OutputStore[T]) ImportKeyImages(export *wallet.KeyImageExport[T]) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if uint64(export.Offset)+uint64(len(export.Images)) > uint64(len(s.outputs)) {
+		return ErrKeyImageCountMismatch
+	}
+
+	for i := range export.Images {
+		image := &export.Images[i]
+		o := s.outputs[int(export.Offset)+i]
+
+		var oneTimeAddress curve25519.PublicKey[T]
+		if _, err := oneTimeAddress.SetBytes(o.OneTimeAddress[:]); err != nil {
+			return err
+		}
+
+		ki := image.KI.AsBytes()
+		sig := ringct.RingSignature[T]{image.Signature}
+		if !sig.Verify(types.Hash(ki), ringct.Ring[T]{oneTimeAddress}, &image.KI) {
+			return errors.New("invalid key image signature")
+		}
+
+		if o.KeyImage != curve25519.ZeroPublicKeyBytes {
+			delete(s.byKeyImage, o.KeyImage)
+		}
+		o.KeyImage = ki
+		s.byKeyImage[ki] = o
+	}
+	return nil
+}
+
+var ErrViewOnlyStore = errors.New("view-only store cannot export key images")
+
+// ExportKeyImages Creates signed key images for the outputs starting at offset, to be imported by a view-only store
+func (s *OutputStore[T]) ExportKeyImages(offset uint32, randomReader io.Reader) (*wallet.KeyImageExport[T], error) {
+	if s.spendWallet == nil {
+		return nil, ErrViewOnlyStore
+	}
+
+	s.lock.RLock()
+	if uint64(offset) > uint64(len(s.outputs)) {
+		s.lock.RUnlock()
+		return nil, ErrKeyImageCountMismatch
+	}
+	outputs := make([]OwnedOutput, 0, len(s.outputs)-int(offset))
+	for _, o := range s.outputs[offset:] {
+		outputs = append(outputs, *o)
+	}
+	s.lock.RUnlock()
+
+	return ExportKeyImages[T](s.spendWallet, offset, outputs, randomReader)
+}
+
+// ExportKeyImages Creates signed key images for outputs, which are at offset within all outputs received by the wallet
+// The signature proves knowledge of x for O = x G, so only legacy outputs without a T component can be exported.
+func ExportKeyImages[T curve25519.PointOperations, SpendWallet wallet.SpendWalletInterface[T]](w SpendWallet, offset uint32, outputs []OwnedOutput, randomReader io.Reader) (*wallet.KeyImageExport[T], error) {
+	primaryAddress := w.Get(address.ZeroSubaddressIndex)
+	export := &wallet.KeyImageExport[T]{
+		Offset: offset,
+		Images: make([]wallet.SignedKeyImage[T], 0, len(outputs)),
+	}
+	if _, err := export.SpendPub.SetBytes(primaryAddress.SpendPublicKey()[:]); err != nil {
+		return nil, err
+	}
+	if _, err := export.ViewPub.SetBytes(primaryAddress.ViewPublicKey()[:]); err != nil {
+		return nil, err
+	}
+
+	for i := range outputs {
+		o := &outputs[i]
+
+		var spendPub, oneTimeAddress curve25519.PublicKey[T]
+		if _, err := spendPub.SetBytes(o.SpendPub[:]); err != nil {
+			return nil, err
+		}
+		if _, err := oneTimeAddress.SetBytes(o.OneTimeAddress[:]); err != nil {
+			return nil, err
+		}
+
+		x, y, err := wallet.TrySearchForOpeningForOneTimeAddress[T, SpendWallet](w, &spendPub, o.ExtensionG.Scalar(), o.ExtensionT.Scalar())
+		if err != nil {
+			return nil, err
+		}
+		if y.Equal(new(curve25519.Scalar)) == 0 {
+			return nil, errors.New("cannot sign key image of output with a T component")
+		}
+
+		keyPair := crypto.NewKeyPairFromPrivate[T](x)
+		if keyPair.PublicKey.Equal(&oneTimeAddress) == 0 {
+			return nil, wallet.ErrCannotRecomputeOneTimeAddressFromOpening
+		}
+
+		var image wallet.SignedKeyImage[T]
+		crypto.GetBiasedKeyImage(&image.KI, keyPair)
+
+		var sig ringct.RingSignature[T]
+		if !sig.Sign(types.Hash(image.KI.AsBytes()), ringct.Ring[T]{keyPair.PublicKey}, keyPair, randomReader) {
+			return nil, errors.New("failed to sign key image")
+		}
+		image.Signature = sig[0]
+		export.Images = append(export.Images, image)
+	}
+	return export, nil
+}
+
+// UpdateSpent Queries the spent status of every unspent output with a known key image
+// Outputs spent in blocks not scanned yet are marked as spent without height.
+func (s *OutputStore[T]) UpdateSpent(checker KeyImageChecker) error {
+	var keyImages []curve25519.PublicKeyBytes
+	func() {
+		s.lock.RLock()
+		defer s.lock.RUnlock()
+		for _, o := range s.outputs {
+			if o.KeyImage != curve25519.ZeroPublicKeyBytes && o.Spent != SpentInBlockchain {
+				keyImages = append(keyImages, o.KeyImage)
+			}
+		}
+	}()
+	if len(keyImages) == 0 {
+		return nil
+	}
+
+	status, err := checker.IsKeyImageSpent(keyImages...)
+	if err != nil {
+		return err
+	}
+	if len(status) != len(keyImages) {
+		return errors.New("invalid spent status count")
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for i, ki := range keyImages {
+		if o, ok := s.byKeyImage[ki]; ok && o.Spent != SpentInBlockchain {
+			o.Spent = SpentStatus(status[i])
+		}
+	}
+	return nil
+}
+
+// Outputs Returns a copy of all received outputs, in the order they were received
+func (s *OutputStore[T]) Outputs() []OwnedOutput {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	outputs := make([]OwnedOutput, 0, len(s.outputs))
+	for _, o := range s.outputs {
+		outputs = append(outputs, *o)
+	}
+	return outputs
+}
+
+// Unspent Returns a copy of unspent outputs, including locked ones
+func (s *OutputStore[T]) Unspent() []OwnedOutput {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	var outputs []OwnedOutput
+	for _, o := range s.outputs {
+		if o.Spent == Unspent {
+			outputs = append(outputs, *o)
+		}
+	}
+	return outputs
+}
+
+// Height Returns the next height to be scanned, which is the height used to check unlocked outputs
+func (s *OutputStore[T]) Height() uint64 {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.height
+}
+
+// Balance Returns the sum of unspent outputs. Outputs spent in the transaction pool are not included
+func (s *OutputStore[T]) Balance() (balance Balance) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	for _, o := range s.outputs {
+		if o.Spent != Unspent {
+			continue
+		}
+		if o.Unlocked(s.height, s.timestamp) {
+			balance.Unlocked += o.Amount
+		} else {
+			balance.Locked += o.Amount
+		}
+	}
+	return balance
+}
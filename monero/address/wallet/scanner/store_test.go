@@ -0,0 +1,139 @@
+package scanner_test
+
+import (
+	"context"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/address"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/address/wallet"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/address/wallet/scanner"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/client"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/client/fakemonerod"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/crypto"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/crypto/curve25519"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/crypto/ringct"
+	"git.gammaspectra.live/P2Pool/consensus/v5/types"
+)
+
+type testKeyImageChecker map[curve25519.PublicKeyBytes]int
+
+func (c testKeyImageChecker) IsKeyImageSpent(ki ...curve25519.PublicKeyBytes) (status []int, err error) {
+	for _, k := range ki {
+		status = append(status, c[k])
+	}
+	return status, nil
+}
+
+func TestOutputStore(t *testing.T) {
+	var spendKey curve25519.Scalar
+	curve25519.RandomScalar(&spendKey, rand.Reader)
+
+	w, err := wallet.NewSpendWalletFromSpendKey[curve25519.VarTimeOperations](&spendKey, monero.MainNetwork, 0, 80)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := fakemonerod.New(fakemonerod.Config{
+		Height:       80,
+		MinerAddress: w.Get(address.ZeroSubaddressIndex),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	rpcClient, err := client.NewClient(d.RPCAddress(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	store := scanner.NewOutputStore[curve25519.VarTimeOperations](w)
+	viewStore := scanner.NewOutputStore[curve25519.VarTimeOperations](nil)
+
+	s := scanner.NewScanner[curve25519.VarTimeOperations](rpcClient, w.ViewWallet(), store, scanner.Checkpoint{Height: 10})
+	scanAll(t, ctx, s)
+	viewScanner := scanner.NewScanner[curve25519.VarTimeOperations](rpcClient, w.ViewWallet(), viewStore, scanner.Checkpoint{Height: 10})
+	scanAll(t, ctx, viewScanner)
+
+	// outputs up to height 20 are past the coinbase lock at height 80
+	var expected scanner.Balance
+	for height := uint64(10); height < 80; height++ {
+		if height+monero.MinerRewardUnlockTime <= 80 {
+			expected.Unlocked += d.BlockByHeight(height).Reward
+		} else {
+			expected.Locked += d.BlockByHeight(height).Reward
+		}
+	}
+	if balance := store.Balance(); balance != expected {
+		t.Fatalf("expected balance %+v, got %+v", expected, balance)
+	}
+
+	outputs := store.Outputs()
+	if len(outputs) != 70 {
+		t.Fatalf("expected 70 outputs, got %d", len(outputs))
+	}
+
+	// export key images signed with the output secret keys, and import them into the view-only store
+	export := &wallet.KeyImageExport[curve25519.VarTimeOperations]{}
+	for _, o := range outputs {
+		if o.KeyImage == curve25519.ZeroPublicKeyBytes {
+			t.Fatalf("output at height %d has no key image", o.BlockHeight)
+		}
+
+		var spendPub curve25519.VarTimePublicKey
+		if _, err = spendPub.SetBytes(o.SpendPub[:]); err != nil {
+			t.Fatal(err)
+		}
+		x, _, err := wallet.TrySearchForOpeningForOneTimeAddress(w, &spendPub, o.ExtensionG.Scalar(), o.ExtensionT.Scalar())
+		if err != nil {
+			t.Fatal(err)
+		}
+		keyPair := crypto.NewKeyPairFromPrivate[curve25519.VarTimeOperations](x)
+		if keyPair.PublicKey.AsBytes() != o.OneTimeAddress {
+			t.Fatalf("output at height %d cannot be opened", o.BlockHeight)
+		}
+
+		var sig ringct.RingSignature[curve25519.VarTimeOperations]
+		if !sig.Sign(types.Hash(o.KeyImage), ringct.Ring[curve25519.VarTimeOperations]{keyPair.PublicKey}, keyPair, rand.Reader) {
+			t.Fatal("failed to sign key image")
+		}
+		image := wallet.SignedKeyImage[curve25519.VarTimeOperations]{Signature: sig[0]}
+		if _, err = image.KI.SetBytes(o.KeyImage[:]); err != nil {
+			t.Fatal(err)
+		}
+		export.Images = append(export.Images, image)
+	}
+	if err = viewStore.ImportKeyImages(export); err != nil {
+		t.Fatal(err)
+	}
+
+	// spent in chain and in pool
+	checker := testKeyImageChecker{
+		outputs[0].KeyImage: int(scanner.SpentInBlockchain),
+		outputs[1].KeyImage: int(scanner.SpentInPool),
+	}
+	if err = viewStore.UpdateSpent(checker); err != nil {
+		t.Fatal(err)
+	}
+	expected.Unlocked -= outputs[0].Amount + outputs[1].Amount
+	if balance := viewStore.Balance(); balance != expected {
+		t.Fatalf("expected balance %+v after spends, got %+v", expected, balance)
+	}
+	if len(viewStore.Unspent()) != 68 {
+		t.Fatalf("expected 68 unspent outputs, got %d", len(viewStore.Unspent()))
+	}
+
+	// orphaned outputs are removed
+	if err = store.HandleReorg(70); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.Outputs()) != 60 || store.Height() != 70 {
+		t.Fatalf("expected 60 outputs at height 70, got %d at %d", len(store.Outputs()), store.Height())
+	}
+}
@@ -0,0 +1,34 @@
+package wallet
+
+import (
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/address/wallet/mnemonic"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/crypto/curve25519"
+)
+
+// NewSpendWalletFromMnemonic Restores a wallet from a 25-word Monero seed, or from a 16-word Polyseed phrase
+// Encrypted Polyseed phrases must be decrypted first with mnemonic.Polyseed Crypt.
+func NewSpendWalletFromMnemonic[T curve25519.PointOperations](words []string, addressNetwork uint8, accountDepth, indexDepth int) (*SpendWallet[T], error) {
+	var key []byte
+	if len(words) == mnemonic.PolyseedWords {
+		p, _, err := mnemonic.DecodePolyseed(words, mnemonic.PolyseedCoinMonero)
+		if err != nil {
+			return nil, err
+		}
+		if key, err = p.Key(mnemonic.PolyseedCoinMonero, curve25519.PrivateKeySize); err != nil {
+			return nil, err
+		}
+	} else {
+		seed, _, err := mnemonic.DecodeSeed(words)
+		if err != nil {
+			return nil, err
+		}
+		if len(seed) != mnemonic.SeedSize {
+			return nil, mnemonic.ErrInvalidWordCount
+		}
+		key = seed
+	}
+
+	var spendKey curve25519.Scalar
+	curve25519.BytesToScalar32(&spendKey, [curve25519.PrivateKeySize]byte(key))
+	return NewSpendWalletFromSpendKey[T](&spendKey, addressNetwork, accountDepth, indexDepth)
+}
@@ -0,0 +1,101 @@
+package wallet
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/address"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/address/wallet/mnemonic"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/crypto/curve25519"
+)
+
+func TestNewSpendWalletFromMnemonic(t *testing.T) {
+	t.Run("Seed", func(t *testing.T) {
+		var spendKey curve25519.Scalar
+		curve25519.RandomScalar(&spendKey, rand.Reader)
+
+		words, err := mnemonic.EncodeSeed(spendKey.Bytes(), mnemonic.English)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w, err := NewSpendWalletFromMnemonic[curve25519.VarTimeOperations](words, monero.MainNetwork, 0, 80)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(w.SpendKey().Bytes(), spendKey.Bytes()) {
+			t.Fatal("spend key mismatch")
+		}
+	})
+
+	t.Run("SeedVectors", func(t *testing.T) {
+		// wallets used by monero tests/functional_tests
+		for _, tc := range []struct {
+			phrase   string
+			spendKey string
+			address  string
+		}{
+			{
+				phrase:   "velvet lymph giddy number token physics poetry unquoted nibs useful sabotage limits benches lifestyle eden nitrogen anvil fewest avoid batch vials washing fences goat unquoted",
+				spendKey: "148d78d2aba7dbca5cd8f6abcfb0b3c009ffbdbea1ff373d50ed94d78286640e",
+				address:  "42ey1afDFnn4886T7196doS9GPMzexD9gXpsZJDwVjeRVdFCSoHnv7KPbBeGpzJBzHRCAs9UxqeoyFQMYbqSWYTfJJQAWDm",
+			},
+			{
+				phrase:   "peeled mixture ionic radar utopia puddle buying illness nuns gadget river spout cavernous bounced paradise drunk looking cottage jump tequila melting went winter adjust spout",
+				spendKey: "609ae8e228a871c37b61292ff898dd144db5d784804cc4a971bf74aff3acb70a",
+				address:  "44Kbx4sJ7JDRDV5aAhLJzQCjDz2ViLRduE3ijDZu3osWKBjMGkV1XPk4pfDUMqt1Aiezvephdqm6YD19GKFD9ZcXVUTp6BW",
+			},
+		} {
+			w, err := NewSpendWalletFromMnemonic[curve25519.VarTimeOperations](strings.Fields(tc.phrase), monero.MainNetwork, 0, 80)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if spendKey := hex.EncodeToString(w.SpendKey().Bytes()); spendKey != tc.spendKey {
+				t.Fatalf("expected spend key %s, got %s", tc.spendKey, spendKey)
+			}
+			if addr := string(w.Get(address.ZeroSubaddressIndex).ToBase58()); addr != tc.address {
+				t.Fatalf("expected address %s, got %s", tc.address, addr)
+			}
+		}
+	})
+
+	t.Run("Polyseed", func(t *testing.T) {
+		// phrase and secret from the polyseed tests, birthday December 2021
+		const phrase = "raven tail swear infant grief assist regular lamp duck valid someone little harsh puppy airport language"
+		const secret = "dd76e7359a0ded37cd0ff0f3c829a5ae016733"
+		// key derived from secret per the polyseed specification, and the resulting wallet
+		const key = "21268a76048a3b25a4a9ac179d86b12fab5800b8d858da9facf4b0a778dc2840"
+		const spendKey = "6dd6b2029bfdf1c44a36ce8b229f35dcaa5800b8d858da9facf4b0a778dc2800"
+		const expectedAddress = "47AjPj7DVPQVGGXJXbbTMZWcKQDejGHYZChVkeujy8qPLjKkgdsxge4DzvkRMgU4sDUigGLuBN9stKBMowhuXH2HJHWAuRf"
+
+		words := strings.Fields(phrase)
+		p, _, err := mnemonic.DecodePolyseed(words, mnemonic.PolyseedCoinMonero)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hex.EncodeToString(p.Secret[:]) != secret {
+			t.Fatalf("expected secret %s, got %x", secret, p.Secret[:])
+		}
+		k, err := p.Key(mnemonic.PolyseedCoinMonero, 32)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hex.EncodeToString(k) != key {
+			t.Fatalf("expected key %s, got %x", key, k)
+		}
+
+		w, err := NewSpendWalletFromMnemonic[curve25519.VarTimeOperations](words, monero.MainNetwork, 0, 80)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hex.EncodeToString(w.SpendKey().Bytes()) != spendKey {
+			t.Fatalf("expected spend key %s, got %x", spendKey, w.SpendKey().Bytes())
+		}
+		if addr := string(w.Get(address.ZeroSubaddressIndex).ToBase58()); addr != expectedAddress {
+			t.Fatalf("expected address %s, got %s", expectedAddress, addr)
+		}
+	})
+}
@@ -2,6 +2,7 @@ package wallet
 
 import (
 	"errors"
+	"io"
 
 	"git.gammaspectra.live/P2Pool/blake2b"
 	"git.gammaspectra.live/P2Pool/consensus/v5/monero"
@@ -91,6 +92,15 @@ func (w *CarrotSpendWallet[T]) Opening(index address.SubaddressIndex) (keyG, key
 	return keyG, keyT, spendPub
 }
 
+// SignMessage Signs message for the address at index, verifiable via address.VerifyMessage
+// Carrot spend public keys and subaddress view public keys include a T component, so only the primary address view key can sign
+func (w *CarrotSpendWallet[T]) SignMessage(index address.SubaddressIndex, message []byte, mode, version uint8, randomReader io.Reader) (string, error) {
+	if mode != address.MessageSignatureModeView || !index.IsZero() {
+		return "", ErrCannotSignMessage
+	}
+	return address.SignMessage(w.vw.Get(index), message, w.vw.ViewIncomingKey(), mode, version, randomReader)
+}
+
 func NewCarrotSpendWalletFromMasterSecret[T curve25519.PointOperations](masterSecret types.Hash, addressNetwork uint8, accountDepth, indexDepth int) (*CarrotSpendWallet[T], error) {
 	var hasher blake2b.Digest
 
@@ -168,6 +178,26 @@ func (w *SpendWallet[T]) Opening(index address.SubaddressIndex) (keyG, keyT *cur
 	return keyG, keyT, spendPub
 }
 
+// SignMessage Signs message for the address at index, verifiable via address.VerifyMessage
+func (w *SpendWallet[T]) SignMessage(index address.SubaddressIndex, message []byte, mode, version uint8, randomReader io.Reader) (string, error) {
+	a := w.Get(index)
+	if a == nil {
+		return "", errors.New("invalid subaddress index")
+	}
+
+	// b + m
+	key, _, _ := w.Opening(index)
+	if mode == address.MessageSignatureModeView {
+		if index.IsZero() {
+			key = w.vw.ViewKey()
+		} else {
+			// C = a * D
+			key.Multiply(w.vw.ViewKey(), key)
+		}
+	}
+	return address.SignMessage(a, message, key, mode, version, randomReader)
+}
+
 func NewSpendWalletFromSpendKey[T curve25519.PointOperations](spendKey *curve25519.Scalar, addressNetwork uint8, accountDepth, indexDepth int) (*SpendWallet[T], error) {
 	var viewKey curve25519.Scalar
 	crypto.ScalarDeriveLegacy(&viewKey, spendKey.Bytes())
@@ -185,6 +215,7 @@ func NewSpendWalletFromSpendKey[T curve25519.PointOperations](spendKey *curve255
 }
 
 var ErrNoSpendPub = errors.New("wallet is not tracking spend pub")
+var ErrCannotSignMessage = errors.New("address key cannot sign messages")
 var ErrCannotRecomputeSpendPub = errors.New("cannot recompute spend pub")
 
 func TrySearchForOpeningForSubaddress[T curve25519.PointOperations, SpendWallet SpendWalletInterface[T]](wallet SpendWallet, spendPub *curve25519.PublicKey[T]) (keyG, keyT *curve25519.Scalar, err error) {
@@ -0,0 +1,368 @@
+// Package txbuilder Builds and signs RingCT CLSAG and Bulletproofs+ transactions spending outputs of a wallet
+package txbuilder
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/bits"
+	"slices"
+
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/address"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/address/carrot"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/address/wallet"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/address/wallet/scanner"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/crypto"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/crypto/curve25519"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/crypto/ringct"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/crypto/ringct/bulletproofs"
+	bpp "git.gammaspectra.live/P2Pool/consensus/v5/monero/crypto/ringct/bulletproofs/plus"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/crypto/ringct/clsag"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/transaction"
+)
+
+// RingSize Number of members of each input ring, as required by consensus
+const RingSize = 16
+
+var (
+	ErrNoInputs            = errors.New("no inputs")
+	ErrNoPayments          = errors.New("no payments")
+	ErrTooManyOutputs      = errors.New("too many outputs")
+	ErrInsufficientFunds   = errors.New("inputs do not cover payments and fee")
+	ErrAmountOverflow      = errors.New("amount overflow")
+	ErrInvalidInput        = errors.New("invalid input")
+	ErrUnsupportedInput    = errors.New("input one-time address has a T component, which cannot be signed with CLSAG")
+	ErrDuplicateInput      = errors.New("duplicate input key image")
+	ErrInvalidRing         = errors.New("invalid ring")
+	ErrInvalidChange       = errors.New("invalid change address")
+	ErrMultiplePaymentIds  = errors.New("only one payment can have a payment id")
+	ErrSubaddressPaymentId = errors.New("subaddresses cannot have a payment id")
+)
+
+// DecoySource Provides rings for the outputs being spent
+type DecoySource[T curve25519.PointOperations] interface {
+	// Decoys Returns a ring of ringSize members which includes the output at globalIndex as the signer
+	// Offsets are the absolute global output indices of the ring members, in ascending order.
+	Decoys(globalIndex uint64, ringSize int) (ringct.Decoys[T], error)
+}
+
+// Proposal Outputs to spend and payments to make
+type Proposal[T curve25519.PointOperations] struct {
+	// Inputs Owned outputs to spend, in any order
+	Inputs []scanner.OwnedOutput `json:"inputs"`
+
+	// Payments Payments to other destinations. Destinations with a payment id are integrated addresses
+	// Randomness is only used for Carrot outputs, and is filled from the random reader when zero.
+	Payments []carrot.PaymentProposalV1[T] `json:"payments"`
+
+	// Change Wallet subaddress index receiving the change. A change output is always created, even with zero amount
+	Change address.SubaddressIndex `json:"change"`
+
+	Fee uint64 `json:"fee"`
+
+	// Carrot Creates Carrot outputs instead of legacy tagged key outputs
+	Carrot bool `json:"carrot"`
+}
+
+type input[T curve25519.PointOperations] struct {
+	keyPair  crypto.KeyPair[T]
+	keyImage curve25519.PublicKey[T]
+	context  clsag.Context[T]
+}
+
+type output struct {
+	out              transaction.Output
+	encryptedAmount  ringct.EncryptedAmount
+	commitment       ringct.LazyCommitment
+	amountCommitment curve25519.PublicKeyBytes
+}
+
+// Build Selects rings, creates outputs and signs a transaction for the proposal
+// Outputs are shuffled and inputs are sorted by key image. The transaction is verified against the selected rings before being returned.
+func Build[T curve25519.PointOperations, SpendWallet wallet.LegacyWalletInterface[T]](w SpendWallet, proposal *Proposal[T], decoySource DecoySource[T], randomReader io.Reader) (*transaction.TransactionV2, error) {
+	if len(proposal.Inputs) == 0 {
+		return nil, ErrNoInputs
+	}
+	if len(proposal.Payments) == 0 {
+		return nil, ErrNoPayments
+	}
+	// one more output is used for change
+	if len(proposal.Payments)+1 > bulletproofs.MaxCommitments {
+		return nil, ErrTooManyOutputs
+	}
+
+	var inputAmount, outputAmount, carry uint64
+	for _, o := range proposal.Inputs {
+		if inputAmount, carry = bits.Add64(inputAmount, o.Amount, 0); carry != 0 {
+			return nil, ErrAmountOverflow
+		}
+	}
+	outputAmount = proposal.Fee
+	for _, p := range proposal.Payments {
+		if outputAmount, carry = bits.Add64(outputAmount, p.Amount, 0); carry != 0 {
+			return nil, ErrAmountOverflow
+		}
+		if p.Destination.PaymentId != [monero.PaymentIdSize]byte{} && p.Destination.Address.IsSubaddress() {
+			return nil, ErrSubaddressPaymentId
+		}
+	}
+	if inputAmount < outputAmount {
+		return nil, ErrInsufficientFunds
+	}
+
+	changeAddress := w.Get(proposal.Change)
+	if changeAddress == nil {
+		return nil, ErrInvalidChange
+	}
+
+	inputs, err := prepareInputs[T](w, proposal.Inputs, decoySource)
+	if err != nil {
+		return nil, err
+	}
+
+	// destinations in output order, with change appended and then shuffled
+	destinations := make([]carrot.PaymentProposalV1[T], 0, len(proposal.Payments)+1)
+	destinations = append(destinations, proposal.Payments...)
+	destinations = append(destinations, carrot.PaymentProposalV1[T]{
+		Destination: carrot.DestinationV1{
+			Address: address.NewPackedAddressWithSubaddressFromBytes(*changeAddress.SpendPublicKey(), *changeAddress.ViewPublicKey(), changeAddress.IsSubaddress()),
+		},
+		Amount: inputAmount - outputAmount,
+	})
+	order := make([]int, len(destinations))
+	for i := range order {
+		order[i] = i
+	}
+	if err = shuffle(order, randomReader); err != nil {
+		return nil, err
+	}
+	shuffled := make([]carrot.PaymentProposalV1[T], len(destinations))
+	for i, j := range order {
+		shuffled[i] = destinations[j]
+	}
+	changeIndex := slices.Index(order, len(destinations)-1)
+
+	var outputs []output
+	var extra []byte
+	if proposal.Carrot {
+		viewKey := curve25519.PrivateKeyBytes(w.ViewWallet().ViewKey().Bytes())
+		outputs, extra, err = makeCarrotOutputs(shuffled, changeIndex, inputs[0].keyImage.AsBytes(), viewKey, randomReader)
+	} else {
+		outputs, extra, err = makeLegacyOutputs(shuffled, changeIndex, randomReader)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	tx := &transaction.TransactionV2{
+		Prefix: transaction.Prefix{
+			Extra: extra,
+		},
+		Base: transaction.Base{
+			ProofType: transaction.CLSAGBulletproofPlus,
+			Fee:       proposal.Fee,
+		},
+	}
+
+	for _, in := range inputs {
+		tx.Prefix.Inputs = append(tx.Prefix.Inputs, transaction.InputToKey{
+			Offsets:  relativeOffsets(in.context.Decoys.Offsets),
+			KeyImage: in.keyImage.AsBytes(),
+		})
+	}
+
+	var sumOutputs curve25519.Scalar
+	statement := bpp.AggregateRangeStatement[T]{
+		V: make([]curve25519.PublicKey[T], len(outputs)),
+	}
+	witness := make(bpp.AggregateRangeWitness, len(outputs))
+	for i, o := range outputs {
+		tx.Prefix.Outputs = append(tx.Prefix.Outputs, o.out)
+		tx.Base.EncryptedAmounts = append(tx.Base.EncryptedAmounts, o.encryptedAmount)
+		tx.Base.Commitments = append(tx.Base.Commitments, o.amountCommitment)
+
+		if _, err = statement.V[i].SetBytes(o.amountCommitment[:]); err != nil {
+			return nil, err
+		}
+		witness[i] = o.commitment
+		sumOutputs.Add(&sumOutputs, &o.commitment.Mask)
+	}
+
+	proof, err := statement.Prove(witness, randomReader)
+	if err != nil {
+		return nil, err
+	}
+
+	prunable := &transaction.PrunableCLSAGBulletproofsPlus{}
+	if prunable.Bulletproof, err = toVarTimeRangeProof(&proof); err != nil {
+		return nil, err
+	}
+	tx.Prunable = prunable
+
+	clsagInputs := make([]clsag.Input[T], 0, len(inputs))
+	for _, in := range inputs {
+		clsagInputs = append(clsagInputs, clsag.Input[T]{
+			KeyPair: in.keyPair,
+			Context: in.context,
+		})
+	}
+
+	// signatures are over the prefix, base and range proof
+	results, err := clsag.Sign(tx.SignatureHash(), clsagInputs, &sumOutputs, randomReader)
+	if err != nil {
+		return nil, err
+	}
+	for i := range results {
+		prunable.CLSAG = append(prunable.CLSAG, clsag.Signature[curve25519.VarTimeOperations]{
+			D:  results[i].Signature.D,
+			S:  results[i].Signature.S,
+			C1: results[i].Signature.C1,
+		})
+		prunable.PseudoOuts = append(prunable.PseudoOuts, *curve25519.To[curve25519.VarTimeOperations](&results[i].PseudoOut))
+	}
+
+	rings := make([]ringct.CommitmentRing[curve25519.VarTimeOperations], len(inputs))
+	images := make([]curve25519.VarTimePublicKey, len(inputs))
+	for i := range inputs {
+		for j := range inputs[i].context.Decoys.Ring {
+			member := &inputs[i].context.Decoys.Ring[j]
+			rings[i] = append(rings[i], [2]curve25519.VarTimePublicKey{
+				*curve25519.To[curve25519.VarTimeOperations](&member[0]),
+				*curve25519.To[curve25519.VarTimeOperations](&member[1]),
+			})
+		}
+		images[i] = *curve25519.To[curve25519.VarTimeOperations](&inputs[i].keyImage)
+	}
+
+	if err = tx.Proofs().Verify(tx.SignatureHash(), rings, images); err != nil {
+		return nil, err
+	}
+
+	return tx, nil
+}
+
+// prepareInputs Opens the owned outputs, computes key images and fetches rings
+// Inputs are returned sorted by key image in descending byte order, as required by consensus.
+func prepareInputs[T curve25519.PointOperations, SpendWallet wallet.LegacyWalletInterface[T]](w SpendWallet, owned []scanner.OwnedOutput, decoySource DecoySource[T]) ([]input[T], error) {
+	inputs := make([]input[T], 0, len(owned))
+	for i := range owned {
+		o := &owned[i]
+
+		var spendPub, oneTimeAddress curve25519.PublicKey[T]
+		if _, err := spendPub.SetBytes(o.SpendPub[:]); err != nil {
+			return nil, err
+		}
+		if _, err := oneTimeAddress.SetBytes(o.OneTimeAddress[:]); err != nil {
+			return nil, err
+		}
+
+		extensionG, extensionT, mask := o.ExtensionG.Scalar(), o.ExtensionT.Scalar(), o.AmountBlindingFactor.Scalar()
+		if extensionG == nil || extensionT == nil || mask == nil {
+			return nil, ErrInvalidInput
+		}
+
+		x, y, err := wallet.TrySearchForOpeningForOneTimeAddress[T, SpendWallet](w, &spendPub, extensionG, extensionT)
+		if err != nil {
+			return nil, err
+		}
+		if y.Equal(new(curve25519.Scalar)) == 0 {
+			return nil, ErrUnsupportedInput
+		}
+
+		keyPair := crypto.NewKeyPairFromPrivate[T](x)
+		if keyPair.PublicKey.Equal(&oneTimeAddress) == 0 {
+			return nil, wallet.ErrCannotRecomputeOneTimeAddressFromOpening
+		}
+
+		decoys, err := decoySource.Decoys(o.GlobalOutputIndex, RingSize)
+		if err != nil {
+			return nil, err
+		}
+		if err = checkDecoys(&decoys, o.GlobalOutputIndex, &oneTimeAddress); err != nil {
+			return nil, err
+		}
+
+		ctx, err := clsag.NewContext(decoys, ringct.LazyCommitment{
+			Mask:   *mask,
+			Amount: o.Amount,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		in := input[T]{
+			keyPair: *keyPair,
+			context: *ctx,
+		}
+		crypto.GetBiasedKeyImage(&in.keyImage, keyPair)
+		inputs = append(inputs, in)
+	}
+
+	slices.SortFunc(inputs, func(a, b input[T]) int {
+		return bytes.Compare(b.keyImage.Bytes(), a.keyImage.Bytes())
+	})
+	for i := 1; i < len(inputs); i++ {
+		if inputs[i].keyImage.Equal(&inputs[i-1].keyImage) == 1 {
+			return nil, ErrDuplicateInput
+		}
+	}
+
+	return inputs, nil
+}
+
+// checkDecoys Verifies the ring has RingSize unique members in ascending order, with the spent output as signer
+func checkDecoys[T curve25519.PointOperations](decoys *ringct.Decoys[T], globalIndex uint64, oneTimeAddress *curve25519.PublicKey[T]) error {
+	if len(decoys.Ring) != RingSize || len(decoys.Offsets) != len(decoys.Ring) || decoys.SignerIndex >= uint64(len(decoys.Ring)) {
+		return ErrInvalidRing
+	}
+	if decoys.Offsets[decoys.SignerIndex] != globalIndex {
+		return ErrInvalidRing
+	}
+	for i := 1; i < len(decoys.Offsets); i++ {
+		if decoys.Offsets[i] <= decoys.Offsets[i-1] {
+			return ErrInvalidRing
+		}
+	}
+	if decoys.SignerRingMembers()[0].Equal(oneTimeAddress) == 0 {
+		return ErrInvalidRing
+	}
+	return nil
+}
+
+// relativeOffsets Converts absolute ascending global output indices to the relative offsets used in inputs
+func relativeOffsets(offsets []uint64) []uint64 {
+	out := make([]uint64, len(offsets))
+	var previous uint64
+	for i, o := range offsets {
+		out[i] = o - previous
+		previous = o
+	}
+	return out
+}
+
+// toVarTimeRangeProof Converts a proof created with secret data for use in transaction verification
+func toVarTimeRangeProof[T curve25519.PointOperations](proof *bpp.AggregateRangeProof[T]) (out bpp.AggregateRangeProof[curve25519.VarTimeOperations], err error) {
+	buf, err := proof.AppendBinary(make([]byte, 0, proof.BufferLength(false)), false)
+	if err != nil {
+		return out, err
+	}
+	if err = out.FromReader(bytes.NewReader(buf)); err != nil {
+		return out, err
+	}
+	return out, nil
+}
+
+// shuffle Randomly permutes s with randomness from randomReader
+func shuffle[S ~[]E, E any](s S, randomReader io.Reader) error {
+	var buf [8]byte
+	for i := len(s) - 1; i > 0; i-- {
+		if _, err := io.ReadFull(randomReader, buf[:]); err != nil {
+			return err
+		}
+		j := int(binary.LittleEndian.Uint64(buf[:]) % uint64(i+1))
+		s[i], s[j] = s[j], s[i]
+	}
+	return nil
+}
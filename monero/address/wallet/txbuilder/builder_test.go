@@ -0,0 +1,290 @@
+package txbuilder_test
+
+import (
+	"crypto/rand"
+	"errors"
+	"testing"
+
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/address"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/address/carrot"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/address/wallet"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/address/wallet/scanner"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/address/wallet/txbuilder"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/crypto/curve25519"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/crypto/ringct"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/transaction"
+)
+
+// testDecoySource Rings of consecutive fixture outputs around the spent output
+type testDecoySource struct {
+	outputs map[uint64][2]curve25519.ConstantTimePublicKey
+}
+
+func newTestDecoySource(n uint64) *testDecoySource {
+	s := &testDecoySource{
+		outputs: make(map[uint64][2]curve25519.ConstantTimePublicKey),
+	}
+	var key, mask curve25519.Scalar
+	for i := range n {
+		curve25519.RandomScalar(&key, rand.Reader)
+		curve25519.RandomScalar(&mask, rand.Reader)
+		s.outputs[i] = [2]curve25519.ConstantTimePublicKey{
+			*new(curve25519.ConstantTimePublicKey).ScalarBaseMult(&key),
+			*ringct.CalculateCommitment(new(curve25519.ConstantTimePublicKey), ringct.LazyCommitment{Mask: mask, Amount: i}),
+		}
+	}
+	return s
+}
+
+func (s *testDecoySource) Decoys(globalIndex uint64, ringSize int) (decoys ringct.Decoys[curve25519.ConstantTimeOperations], err error) {
+	for i := globalIndex - min(globalIndex, uint64(ringSize/2)); len(decoys.Ring) < ringSize; i++ {
+		member, ok := s.outputs[i]
+		if !ok {
+			return decoys, errors.New("output not found")
+		}
+		if i == globalIndex {
+			decoys.SignerIndex = uint64(len(decoys.Ring))
+		}
+		decoys.Offsets = append(decoys.Offsets, i)
+		decoys.Ring = append(decoys.Ring, member)
+	}
+	return decoys, nil
+}
+
+// rings Resolves the rings of a decoded transaction from its relative offsets
+func (s *testDecoySource) rings(t *testing.T, tx *transaction.TransactionV2) (rings []ringct.CommitmentRing[curve25519.VarTimeOperations], images []curve25519.VarTimePublicKey) {
+	for _, in := range tx.Inputs() {
+		if len(in.Offsets) != txbuilder.RingSize {
+			t.Fatalf("expected ring size %d, got %d", txbuilder.RingSize, len(in.Offsets))
+		}
+		var ring ringct.CommitmentRing[curve25519.VarTimeOperations]
+		var globalIndex uint64
+		for _, o := range in.Offsets {
+			globalIndex += o
+			member := s.outputs[globalIndex]
+			ring = append(ring, [2]curve25519.VarTimePublicKey{
+				*curve25519.To[curve25519.VarTimeOperations](&member[0]),
+				*curve25519.To[curve25519.VarTimeOperations](&member[1]),
+			})
+		}
+		rings = append(rings, ring)
+
+		var image curve25519.VarTimePublicKey
+		if _, err := image.SetBytes(in.KeyImage[:]); err != nil {
+			t.Fatal(err)
+		}
+		images = append(images, image)
+	}
+	return rings, images
+}
+
+// receive Creates a legacy output to the wallet address at ix, scans it and places it in the fixture outputs
+func (s *testDecoySource) receive(t *testing.T, w *wallet.SpendWallet[curve25519.ConstantTimeOperations], ix address.SubaddressIndex, globalIndex, amount uint64) scanner.OwnedOutput {
+	var txKey curve25519.Scalar
+	curve25519.RandomScalar(&txKey, rand.Reader)
+
+	out, additionalPub, commitment := address.CalculateTransactionOutput[curve25519.ConstantTimeOperations](w.Get(ix), &txKey, 0, amount)
+	pubs := transaction.PublicKeys{
+		PublicKey: new(curve25519.ConstantTimePublicKey).ScalarBaseMult(&txKey).AsBytes(),
+	}
+	if additionalPub != nil {
+		pubs.AdditionalPublicKeys = []curve25519.PublicKeyBytes{additionalPub.AsBytes()}
+	}
+
+	index, scan, addressIndex := w.Match(transaction.Outputs{out}, []ringct.CommitmentEncryptedAmount{commitment}, pubs, nil)
+	if index != 0 || addressIndex != ix || scan.Amount != amount {
+		t.Fatalf("could not match received output")
+	}
+
+	var key, c curve25519.ConstantTimePublicKey
+	if _, err := key.SetBytes(out.EphemeralPublicKey[:]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.SetBytes(commitment.Commitment[:]); err != nil {
+		t.Fatal(err)
+	}
+	s.outputs[globalIndex] = [2]curve25519.ConstantTimePublicKey{key, c}
+
+	return scanner.OwnedOutput{
+		Output: scanner.Output{
+			GlobalOutputIndex: globalIndex,
+			Amount:            scan.Amount,
+			OneTimeAddress:    out.EphemeralPublicKey,
+			AddressIndex:      addressIndex,
+		},
+		SpendPub:             scan.SpendPub,
+		ExtensionG:           curve25519.PrivateKeyBytes(scan.ExtensionG.Bytes()),
+		AmountBlindingFactor: scan.AmountBlindingFactor,
+	}
+}
+
+func newTestSpendWallet(t *testing.T) *wallet.SpendWallet[curve25519.ConstantTimeOperations] {
+	var spendKey curve25519.Scalar
+	curve25519.RandomScalar(&spendKey, rand.Reader)
+	w, err := wallet.NewSpendWalletFromSpendKey[curve25519.ConstantTimeOperations](&spendKey, monero.MainNetwork, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w
+}
+
+func TestBuild(t *testing.T) {
+	sender := newTestSpendWallet(t)
+	recipient := newTestSpendWallet(t)
+
+	recipientMain := recipient.Get(address.ZeroSubaddressIndex)
+	recipientSubaddressIndex := address.SubaddressIndex{Account: 0, Offset: 3}
+	recipientSubaddress := recipient.Get(recipientSubaddressIndex)
+	paymentId := [monero.PaymentIdSize]byte{1, 2, 3, 4, 5, 6, 7, 8}
+
+	const fee = 1000000
+
+	tests := []struct {
+		name     string
+		carrot   bool
+		change   address.SubaddressIndex
+		payments []carrot.PaymentProposalV1[curve25519.ConstantTimeOperations]
+	}{
+		{
+			name: "Legacy",
+			payments: []carrot.PaymentProposalV1[curve25519.ConstantTimeOperations]{
+				{Destination: carrot.MakeDestinationMainAddress(*recipientMain.SpendPublicKey(), *recipientMain.ViewPublicKey()), Amount: 1000000000000},
+			},
+		},
+		{
+			name:   "LegacySubaddress",
+			change: address.SubaddressIndex{Account: 0, Offset: 5},
+			payments: []carrot.PaymentProposalV1[curve25519.ConstantTimeOperations]{
+				{Destination: carrot.MakeDestinationIntegratedAddress(*recipientMain.SpendPublicKey(), *recipientMain.ViewPublicKey(), paymentId), Amount: 1000000000000},
+				{Destination: carrot.DestinationV1{Address: address.NewPackedAddressWithSubaddressFromBytes(*recipientSubaddress.SpendPublicKey(), *recipientSubaddress.ViewPublicKey(), true)}, Amount: 2000000000000},
+			},
+		},
+		{
+			name:   "Carrot",
+			carrot: true,
+			payments: []carrot.PaymentProposalV1[curve25519.ConstantTimeOperations]{
+				{Destination: carrot.MakeDestinationIntegratedAddress(*recipientMain.SpendPublicKey(), *recipientMain.ViewPublicKey(), paymentId), Amount: 1000000000000},
+			},
+		},
+		{
+			name:   "CarrotSubaddress",
+			carrot: true,
+			change: address.SubaddressIndex{Account: 0, Offset: 5},
+			payments: []carrot.PaymentProposalV1[curve25519.ConstantTimeOperations]{
+				{Destination: carrot.MakeDestinationMainAddress(*recipientMain.SpendPublicKey(), *recipientMain.ViewPublicKey()), Amount: 1000000000000},
+				{Destination: carrot.DestinationV1{Address: address.NewPackedAddressWithSubaddressFromBytes(*recipientSubaddress.SpendPublicKey(), *recipientSubaddress.ViewPublicKey(), true)}, Amount: 2000000000000},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := newTestDecoySource(200)
+			inputs := []scanner.OwnedOutput{
+				source.receive(t, sender, address.ZeroSubaddressIndex, 50, 5000000000000),
+				source.receive(t, sender, address.SubaddressIndex{Account: 0, Offset: 2}, 120, 3000000000000),
+			}
+
+			var paid uint64
+			for _, p := range tt.payments {
+				paid += p.Amount
+			}
+
+			tx, err := txbuilder.Build[curve25519.ConstantTimeOperations](sender, &txbuilder.Proposal[curve25519.ConstantTimeOperations]{
+				Inputs:   inputs,
+				Payments: tt.payments,
+				Change:   tt.change,
+				Fee:      fee,
+				Carrot:   tt.carrot,
+			}, source, rand.Reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(tx.Outputs()) != len(tt.payments)+1 {
+				t.Fatalf("expected %d outputs, got %d", len(tt.payments)+1, len(tx.Outputs()))
+			}
+
+			blob, err := tx.AppendBinary(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			decoded, err := transaction.NewTransactionFromBytes(blob)
+			if err != nil {
+				t.Fatal(err)
+			}
+			txv2, ok := decoded.(*transaction.TransactionV2)
+			if !ok {
+				t.Fatal("expected v2 transaction")
+			}
+			if txv2.Hash() != tx.Hash() {
+				t.Fatalf("expected id %s, got %s", tx.Hash(), txv2.Hash())
+			}
+
+			rings, images := source.rings(t, txv2)
+			if err = txv2.Proofs().Verify(txv2.SignatureHash(), rings, images); err != nil {
+				t.Fatalf("tx proof failed: %s", err)
+			}
+
+			received := make(map[address.SubaddressIndex]uint64)
+			var receivedPaymentId [monero.PaymentIdSize]byte
+			legacyMatch := func(index int, scan *wallet.LegacyScan, ix address.SubaddressIndex) {
+				received[ix] += scan.Amount
+				if ix == address.ZeroSubaddressIndex {
+					receivedPaymentId = scan.PaymentId
+				}
+			}
+			carrotMatch := func(index int, scan *carrot.ScanV1, ix address.SubaddressIndex) {
+				received[ix] += scan.Amount
+				if ix == address.ZeroSubaddressIndex {
+					receivedPaymentId = scan.PaymentId
+				}
+			}
+			if err = wallet.MatchTransaction[curve25519.ConstantTimeOperations](recipient.ViewWallet(), legacyMatch, carrotMatch, txv2); err != nil {
+				t.Fatal(err)
+			}
+			for _, p := range tt.payments {
+				ix := address.ZeroSubaddressIndex
+				if p.Destination.Address.IsSubaddress() {
+					ix = recipientSubaddressIndex
+				}
+				if received[ix] != p.Amount {
+					t.Fatalf("expected recipient to receive %d at %v, got %d", p.Amount, ix, received[ix])
+				}
+				if !p.Destination.Address.IsSubaddress() && receivedPaymentId != p.Destination.PaymentId {
+					t.Fatalf("expected payment id %x, got %x", p.Destination.PaymentId, receivedPaymentId)
+				}
+			}
+
+			clear(received)
+			if err = wallet.MatchTransaction[curve25519.ConstantTimeOperations](sender.ViewWallet(), legacyMatch, carrotMatch, txv2); err != nil {
+				t.Fatal(err)
+			}
+			if change := inputs[0].Amount + inputs[1].Amount - paid - fee; received[tt.change] != change || len(received) != 1 {
+				t.Fatalf("expected change %d at %v, got %v", change, tt.change, received)
+			}
+		})
+	}
+}
+
+func TestBuildInsufficientFunds(t *testing.T) {
+	sender := newTestSpendWallet(t)
+	recipient := newTestSpendWallet(t).Get(address.ZeroSubaddressIndex)
+
+	source := newTestDecoySource(100)
+	inputs := []scanner.OwnedOutput{
+		source.receive(t, sender, address.ZeroSubaddressIndex, 50, 1000),
+	}
+
+	_, err := txbuilder.Build[curve25519.ConstantTimeOperations](sender, &txbuilder.Proposal[curve25519.ConstantTimeOperations]{
+		Inputs: inputs,
+		Payments: []carrot.PaymentProposalV1[curve25519.ConstantTimeOperations]{
+			{Destination: carrot.MakeDestinationMainAddress(*recipient.SpendPublicKey(), *recipient.ViewPublicKey()), Amount: 1000},
+		},
+		Fee: 1,
+	}, source, rand.Reader)
+	if !errors.Is(err, txbuilder.ErrInsufficientFunds) {
+		t.Fatalf("expected %s, got %v", txbuilder.ErrInsufficientFunds, err)
+	}
+}
@@ -0,0 +1,281 @@
+package txbuilder
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/address/wallet"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/address/wallet/scanner"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/crypto"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/crypto/curve25519"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/crypto/ringct"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/transaction"
+)
+
+// Transaction sets are not compatible with the monero-wallet-cli unsigned and signed tx set formats
+const (
+	UnsignedTransactionSetMagic = "P2Pool unsigned tx set\001"
+	SignedTransactionSetMagic   = "P2Pool signed tx set\001"
+)
+
+var ErrInvalidTransactionSet = errors.New("invalid transaction set")
+
+// Ring Ring members selected for an input, as ringct.Decoys
+type Ring struct {
+	// Offsets Absolute global output indices, in ascending order
+	Offsets     []uint64 `json:"offsets"`
+	SignerIndex uint64   `json:"signer_index"`
+	// Members One-time address and amount commitment of each ring member
+	Members [][2]curve25519.PublicKeyBytes `json:"members"`
+}
+
+// UnsignedTransaction A proposal with the rings selected for each of its inputs
+type UnsignedTransaction[T curve25519.PointOperations] struct {
+	Proposal Proposal[T] `json:"proposal"`
+	// Rings Ring of each input, in the same order as Proposal.Inputs
+	Rings []Ring `json:"rings"`
+}
+
+// UnsignedTransactionSet Transactions prepared by a view-only wallet, to be signed by an offline spend wallet
+type UnsignedTransactionSet[T curve25519.PointOperations] struct {
+	Transactions []UnsignedTransaction[T] `json:"transactions"`
+
+	// OutputsOffset Position of Outputs within all outputs received by the wallet, as in scanner.OutputStore.Outputs
+	OutputsOffset uint32 `json:"outputs_offset"`
+	// Outputs Wallet outputs the signer returns signed key images for, so the view-only wallet can track spends
+	Outputs []scanner.OwnedOutput `json:"outputs"`
+}
+
+// SignedTransactionSet Transactions signed by an offline spend wallet, to be broadcast by the view-only wallet
+type SignedTransactionSet[T curve25519.PointOperations] struct {
+	// Transactions Signed transactions, in the same order as the unsigned set
+	Transactions []*transaction.TransactionV2
+
+	// KeyImages Signed key images of the unsigned set outputs, to be imported with scanner.OutputStore.ImportKeyImages. Nil when there were no outputs
+	KeyImages *wallet.KeyImageExport[T]
+}
+
+// PrepareUnsigned Selects rings for the inputs of each proposal, creating an unsigned transaction set
+// It only requires a view wallet, such as wallet.ViewWallet or wallet.CarrotViewWallet. outputs are included for key image export, and can be empty.
+func PrepareUnsigned[T curve25519.PointOperations, ViewWallet wallet.ViewWalletInterface[T]](w ViewWallet, proposals []Proposal[T], decoySource DecoySource[T], outputsOffset uint32, outputs []scanner.OwnedOutput) (*UnsignedTransactionSet[T], error) {
+	set := &UnsignedTransactionSet[T]{
+		Transactions:  make([]UnsignedTransaction[T], 0, len(proposals)),
+		OutputsOffset: outputsOffset,
+		Outputs:       outputs,
+	}
+
+	for _, proposal := range proposals {
+		if len(proposal.Inputs) == 0 {
+			return nil, ErrNoInputs
+		}
+		if len(proposal.Payments) == 0 {
+			return nil, ErrNoPayments
+		}
+		if w.Get(proposal.Change) == nil {
+			return nil, ErrInvalidChange
+		}
+
+		tx := UnsignedTransaction[T]{
+			Proposal: proposal,
+			Rings:    make([]Ring, 0, len(proposal.Inputs)),
+		}
+		for i := range proposal.Inputs {
+			o := &proposal.Inputs[i]
+
+			var oneTimeAddress curve25519.PublicKey[T]
+			if _, err := oneTimeAddress.SetBytes(o.OneTimeAddress[:]); err != nil {
+				return nil, err
+			}
+
+			decoys, err := decoySource.Decoys(o.GlobalOutputIndex, RingSize)
+			if err != nil {
+				return nil, err
+			}
+			if err = checkDecoys(&decoys, o.GlobalOutputIndex, &oneTimeAddress); err != nil {
+				return nil, err
+			}
+
+			ring := Ring{
+				Offsets:     decoys.Offsets,
+				SignerIndex: decoys.SignerIndex,
+				Members:     make([][2]curve25519.PublicKeyBytes, len(decoys.Ring)),
+			}
+			for j := range decoys.Ring {
+				ring.Members[j] = [2]curve25519.PublicKeyBytes{decoys.Ring[j][0].AsBytes(), decoys.Ring[j][1].AsBytes()}
+			}
+			tx.Rings = append(tx.Rings, ring)
+		}
+		set.Transactions = append(set.Transactions, tx)
+	}
+
+	return set, nil
+}
+
+// Sign Signs all transactions of an unsigned set with the rings selected by the view-only wallet, and signs key images of the set outputs
+// As with Build, only outputs without a T component can be spent.
+func Sign[T curve25519.PointOperations, SpendWallet wallet.LegacyWalletInterface[T]](w SpendWallet, set *UnsignedTransactionSet[T], randomReader io.Reader) (*SignedTransactionSet[T], error) {
+	signed := &SignedTransactionSet[T]{
+		Transactions: make([]*transaction.TransactionV2, 0, len(set.Transactions)),
+	}
+
+	for i := range set.Transactions {
+		unsigned := &set.Transactions[i]
+		rings, err := unsigned.decoys()
+		if err != nil {
+			return nil, err
+		}
+
+		tx, err := Build[T](w, &unsigned.Proposal, rings, randomReader)
+		if err != nil {
+			return nil, err
+		}
+		signed.Transactions = append(signed.Transactions, tx)
+	}
+
+	if len(set.Outputs) > 0 {
+		export, err := scanner.ExportKeyImages[T](w, set.OutputsOffset, set.Outputs, randomReader)
+		if err != nil {
+			return nil, err
+		}
+		signed.KeyImages = export
+	}
+
+	return signed, nil
+}
+
+// preparedDecoys DecoySource returning the rings of an unsigned transaction
+type preparedDecoys[T curve25519.PointOperations] map[uint64]ringct.Decoys[T]
+
+func (d preparedDecoys[T]) Decoys(globalIndex uint64, ringSize int) (ringct.Decoys[T], error) {
+	decoys, ok := d[globalIndex]
+	if !ok || len(decoys.Ring) != ringSize {
+		return ringct.Decoys[T]{}, ErrInvalidRing
+	}
+	return decoys, nil
+}
+
+// decoys Decodes the prepared rings, keyed by the global output index of the spent output
+func (tx *UnsignedTransaction[T]) decoys() (preparedDecoys[T], error) {
+	if len(tx.Rings) != len(tx.Proposal.Inputs) {
+		return nil, ErrInvalidTransactionSet
+	}
+
+	prepared := make(preparedDecoys[T], len(tx.Rings))
+	for i, ring := range tx.Rings {
+		if len(ring.Offsets) != len(ring.Members) {
+			return nil, ErrInvalidRing
+		}
+		decoys := ringct.Decoys[T]{
+			Offsets:     ring.Offsets,
+			SignerIndex: ring.SignerIndex,
+			Ring:        make([][2]curve25519.PublicKey[T], len(ring.Members)),
+		}
+		for j := range ring.Members {
+			if _, err := decoys.Ring[j][0].SetBytes(ring.Members[j][0][:]); err != nil {
+				return nil, err
+			}
+			if _, err := decoys.Ring[j][1].SetBytes(ring.Members[j][1][:]); err != nil {
+				return nil, err
+			}
+		}
+		prepared[tx.Proposal.Inputs[i].GlobalOutputIndex] = decoys
+	}
+	return prepared, nil
+}
+
+// Encrypt Serializes the set and encrypts it with the account view key
+// key is the view key for legacy wallets, or the view-incoming key for Carrot wallets.
+func (set *UnsignedTransactionSet[T]) Encrypt(key *curve25519.Scalar, kdfRounds int) ([]byte, error) {
+	plain, err := json.Marshal(set)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(UnsignedTransactionSetMagic), wallet.Encrypt(plain, key, kdfRounds, true)...), nil
+}
+
+// DecryptUnsignedTransactionSet Reads a set written by UnsignedTransactionSet.Encrypt
+func DecryptUnsignedTransactionSet[T curve25519.PointOperations](data []byte, key *curve25519.Scalar, kdfRounds int) (*UnsignedTransactionSet[T], error) {
+	if !bytes.HasPrefix(data, []byte(UnsignedTransactionSetMagic)) || len(data) < len(UnsignedTransactionSetMagic)+crypto.ChaChaNonceSize+curve25519.PrivateKeySize*2 {
+		return nil, ErrInvalidTransactionSet
+	}
+	plain, err := wallet.Decrypt[T](data[len(UnsignedTransactionSetMagic):], key, kdfRounds, true)
+	if err != nil {
+		return nil, err
+	}
+
+	set := new(UnsignedTransactionSet[T])
+	if err = json.Unmarshal(plain, set); err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+// signedTransactionSetJSON Serialized SignedTransactionSet, with key images as a key image export file
+type signedTransactionSetJSON struct {
+	Transactions [][]byte `json:"transactions"`
+	KeyImages    []byte   `json:"key_images,omitempty"`
+}
+
+// Encrypt Serializes the set and encrypts it with the account view key
+// The key images are kept as a key image export file, which requires a legacy view key.
+func (set *SignedTransactionSet[T]) Encrypt(key *curve25519.Scalar, kdfRounds int) ([]byte, error) {
+	var encoded signedTransactionSetJSON
+	for _, tx := range set.Transactions {
+		blob, err := tx.AppendBinary(make([]byte, 0, tx.BufferLength()))
+		if err != nil {
+			return nil, err
+		}
+		encoded.Transactions = append(encoded.Transactions, blob)
+	}
+	if set.KeyImages != nil {
+		var err error
+		if encoded.KeyImages, err = wallet.EncryptKeyImages(set.KeyImages, key, kdfRounds); err != nil {
+			return nil, err
+		}
+	}
+
+	plain, err := json.Marshal(encoded)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(SignedTransactionSetMagic), wallet.Encrypt(plain, key, kdfRounds, true)...), nil
+}
+
+// DecryptSignedTransactionSet Reads a set written by SignedTransactionSet.Encrypt
+func DecryptSignedTransactionSet[T curve25519.PointOperations](data []byte, key *curve25519.Scalar, kdfRounds int) (*SignedTransactionSet[T], error) {
+	if !bytes.HasPrefix(data, []byte(SignedTransactionSetMagic)) || len(data) < len(SignedTransactionSetMagic)+crypto.ChaChaNonceSize+curve25519.PrivateKeySize*2 {
+		return nil, ErrInvalidTransactionSet
+	}
+	plain, err := wallet.Decrypt[T](data[len(SignedTransactionSetMagic):], key, kdfRounds, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var encoded signedTransactionSetJSON
+	if err = json.Unmarshal(plain, &encoded); err != nil {
+		return nil, err
+	}
+
+	set := &SignedTransactionSet[T]{
+		Transactions: make([]*transaction.TransactionV2, 0, len(encoded.Transactions)),
+	}
+	for _, blob := range encoded.Transactions {
+		tx, err := transaction.NewTransactionFromBytes(blob)
+		if err != nil {
+			return nil, err
+		}
+		txv2, ok := tx.(*transaction.TransactionV2)
+		if !ok {
+			return nil, ErrInvalidTransactionSet
+		}
+		set.Transactions = append(set.Transactions, txv2)
+	}
+	if len(encoded.KeyImages) > 0 {
+		if set.KeyImages, err = wallet.DecryptKeyImages[T](encoded.KeyImages, key, kdfRounds); err != nil {
+			return nil, err
+		}
+	}
+	return set, nil
+}
@@ -0,0 +1,215 @@
+package txbuilder_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"testing"
+
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/address"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/address/carrot"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/address/wallet"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/address/wallet/scanner"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/address/wallet/txbuilder"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/block"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/crypto/curve25519"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/crypto/ringct"
+	"git.gammaspectra.live/P2Pool/consensus/v5/types"
+)
+
+func TestColdSigning(t *testing.T) {
+	sender := newTestSpendWallet(t)
+	recipient := newTestSpendWallet(t).Get(address.ZeroSubaddressIndex)
+	viewWallet := sender.ViewWallet()
+	viewKey := viewWallet.ViewKey()
+
+	source := newTestDecoySource(200)
+	outputs := []scanner.OwnedOutput{
+		source.receive(t, sender, address.ZeroSubaddressIndex, 50, 5000000000000),
+		source.receive(t, sender, address.SubaddressIndex{Account: 0, Offset: 2}, 120, 3000000000000),
+		source.receive(t, sender, address.ZeroSubaddressIndex, 150, 2000000000000),
+	}
+
+	proposals := []txbuilder.Proposal[curve25519.ConstantTimeOperations]{
+		{
+			Inputs: outputs[:2],
+			Payments: []carrot.PaymentProposalV1[curve25519.ConstantTimeOperations]{
+				{Destination: carrot.MakeDestinationMainAddress(*recipient.SpendPublicKey(), *recipient.ViewPublicKey()), Amount: 6000000000000},
+			},
+			Fee: 1000000,
+		},
+		{
+			Inputs: outputs[2:],
+			Payments: []carrot.PaymentProposalV1[curve25519.ConstantTimeOperations]{
+				{Destination: carrot.MakeDestinationMainAddress(*recipient.SpendPublicKey(), *recipient.ViewPublicKey()), Amount: 1000000000000},
+			},
+			Fee:    1000000,
+			Carrot: true,
+		},
+	}
+
+	// online view-only wallet
+	unsigned, err := txbuilder.PrepareUnsigned[curve25519.ConstantTimeOperations](viewWallet, proposals, source, 0, outputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unsignedData, err := unsigned.Encrypt(viewKey, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// offline spend wallet
+	unsigned, err = txbuilder.DecryptUnsignedTransactionSet[curve25519.ConstantTimeOperations](unsignedData, viewKey, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, err := txbuilder.Sign[curve25519.ConstantTimeOperations](sender, unsigned, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signedData, err := signed.Encrypt(viewKey, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// back on the online view-only wallet
+	result, err := txbuilder.DecryptSignedTransactionSet[curve25519.VarTimeOperations](signedData, viewKey, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Transactions) != len(proposals) {
+		t.Fatalf("expected %d transactions, got %d", len(proposals), len(result.Transactions))
+	}
+
+	spentKeyImages := make(map[curve25519.PublicKeyBytes]struct{})
+	for i, tx := range result.Transactions {
+		if tx.Hash() != signed.Transactions[i].Hash() {
+			t.Fatalf("transaction #%d id mismatch", i)
+		}
+		rings, images := source.rings(t, tx)
+		if err = tx.Proofs().Verify(tx.SignatureHash(), rings, images); err != nil {
+			t.Fatalf("transaction #%d proof failed: %s", i, err)
+		}
+		for _, in := range tx.Inputs() {
+			spentKeyImages[in.KeyImage] = struct{}{}
+		}
+	}
+
+	if result.KeyImages == nil || len(result.KeyImages.Images) != len(outputs) {
+		t.Fatal("expected key images for all outputs")
+	}
+	for i := range result.KeyImages.Images {
+		image := &result.KeyImages.Images[i]
+		var oneTimeAddress curve25519.VarTimePublicKey
+		if _, err = oneTimeAddress.SetBytes(outputs[i].OneTimeAddress[:]); err != nil {
+			t.Fatal(err)
+		}
+		sig := ringct.RingSignature[curve25519.VarTimeOperations]{image.Signature}
+		if !sig.Verify(types.Hash(image.KI.AsBytes()), ringct.Ring[curve25519.VarTimeOperations]{oneTimeAddress}, &image.KI) {
+			t.Fatalf("key image #%d signature is invalid", i)
+		}
+		if _, ok := spentKeyImages[image.KI.AsBytes()]; !ok {
+			t.Fatalf("key image #%d was not spent", i)
+		}
+	}
+
+	// the offline wallet can only read sets encrypted with its view key
+	other := newTestSpendWallet(t)
+	if _, err = txbuilder.DecryptUnsignedTransactionSet[curve25519.ConstantTimeOperations](unsignedData, other.ViewWallet().ViewKey(), 1); err == nil {
+		t.Fatal("expected set encrypted with a different key to fail")
+	}
+}
+
+func TestKeyImageExportRoundTrip(t *testing.T) {
+	w := newTestSpendWallet(t)
+	viewKey := w.ViewWallet().ViewKey()
+
+	source := newTestDecoySource(200)
+	outputs := []scanner.OwnedOutput{
+		source.receive(t, w, address.ZeroSubaddressIndex, 50, 5000000000000),
+		source.receive(t, w, address.SubaddressIndex{Account: 0, Offset: 2}, 120, 3000000000000),
+	}
+
+	export, err := scanner.ExportKeyImages[curve25519.ConstantTimeOperations](w, 3, outputs, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := wallet.EncryptKeyImages(export, viewKey, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roundTrip, err := wallet.DecryptKeyImages[curve25519.ConstantTimeOperations](data, viewKey, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if roundTrip.Offset != export.Offset || roundTrip.SpendPub.Equal(&export.SpendPub) == 0 || len(roundTrip.Images) != len(export.Images) {
+		t.Fatal("key image export round trip mismatch")
+	}
+	for i := range export.Images {
+		if !bytes.Equal(roundTrip.Images[i].KI.Bytes(), export.Images[i].KI.Bytes()) || !bytes.Equal(roundTrip.Images[i].Signature.Bytes(), export.Images[i].Signature.Bytes()) {
+			t.Fatalf("key image #%d round trip mismatch", i)
+		}
+	}
+
+	other := newTestSpendWallet(t)
+	if _, err = wallet.EncryptKeyImages(export, other.ViewWallet().ViewKey(), 1); err == nil {
+		t.Fatal("expected export for a different account to fail")
+	}
+}
+
+func TestOutputStoreExportKeyImages(t *testing.T) {
+	w := newTestSpendWallet(t)
+
+	source := newTestDecoySource(200)
+	received := []scanner.OwnedOutput{
+		source.receive(t, w, address.ZeroSubaddressIndex, 50, 5000000000000),
+		source.receive(t, w, address.SubaddressIndex{Account: 0, Offset: 2}, 120, 3000000000000),
+	}
+
+	outputs := make([]scanner.Output, 0, len(received))
+	for _, o := range received {
+		out := o.Output
+		out.Legacy = &wallet.LegacyScan{
+			Amount:               o.Amount,
+			AmountBlindingFactor: o.AmountBlindingFactor,
+			ExtensionG:           *o.ExtensionG.Scalar(),
+			SpendPub:             o.SpendPub,
+		}
+		outputs = append(outputs, out)
+	}
+
+	store := scanner.NewOutputStore[curve25519.ConstantTimeOperations](w)
+	viewStore := scanner.NewOutputStore[curve25519.ConstantTimeOperations](nil)
+	for _, s := range []*scanner.OutputStore[curve25519.ConstantTimeOperations]{store, viewStore} {
+		if err := s.HandleBlock(10, &block.CompleteEntry{}, outputs); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	export, err := store.ExportKeyImages(0, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored := store.Outputs()
+	if len(export.Images) != len(stored) {
+		t.Fatalf("expected %d key images, got %d", len(stored), len(export.Images))
+	}
+	for i := range export.Images {
+		if export.Images[i].KI.AsBytes() != stored[i].KeyImage {
+			t.Fatalf("key image #%d does not match output", i)
+		}
+	}
+
+	if _, err = viewStore.ExportKeyImages(0, rand.Reader); !errors.Is(err, scanner.ErrViewOnlyStore) {
+		t.Fatalf("expected %s, got %v", scanner.ErrViewOnlyStore, err)
+	}
+	if err = viewStore.ImportKeyImages(export); err != nil {
+		t.Fatal(err)
+	}
+	for i, o := range viewStore.Outputs() {
+		if o.KeyImage != stored[i].KeyImage {
+			t.Fatalf("imported key image #%d does not match output", i)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package txbuilder
+
+import (
+	"io"
+
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/address"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/address/carrot"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/crypto"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/crypto/curve25519"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/crypto/ringct"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/transaction"
+	"git.gammaspectra.live/P2Pool/consensus/v5/types"
+)
+
+// makeLegacyOutputs Creates tagged key outputs for destinations, in order
+// Additional public keys are used when any destination is a subaddress. Outputs to standard addresses are always derived from the main transaction key, as in monero-wallet-cli.
+func makeLegacyOutputs[T curve25519.PointOperations](destinations []carrot.PaymentProposalV1[T], changeIndex int, randomReader io.Reader) (outputs []output, extra []byte, err error) {
+	var txKey curve25519.Scalar
+	curve25519.RandomScalar(&txKey, randomReader)
+	txPub := new(curve25519.PublicKey[T]).ScalarBaseMult(&txKey).AsBytes()
+
+	var needAdditional bool
+	for _, d := range destinations {
+		if d.Destination.Address.IsSubaddress() {
+			needAdditional = true
+			break
+		}
+	}
+
+	var additionalPubs []curve25519.PublicKeyBytes
+	var encryptedPaymentId *[monero.PaymentIdSize]byte
+
+	outputs = make([]output, len(destinations))
+	for i, d := range destinations {
+		var spendPub, viewPub curve25519.PublicKey[T]
+		if _, err = spendPub.SetBytes(d.Destination.Address.SpendPublicKey()[:]); err != nil {
+			return nil, nil, err
+		}
+		if _, err = viewPub.SetBytes(d.Destination.Address.ViewPublicKey()[:]); err != nil {
+			return nil, nil, err
+		}
+
+		key := &txKey
+		if needAdditional {
+			var additionalKey curve25519.Scalar
+			curve25519.RandomScalar(&additionalKey, randomReader)
+			if d.Destination.Address.IsSubaddress() {
+				key = &additionalKey
+				additionalPubs = append(additionalPubs, new(curve25519.PublicKey[T]).ScalarMult(&additionalKey, &spendPub).AsBytes())
+			} else {
+				additionalPubs = append(additionalPubs, new(curve25519.PublicKey[T]).ScalarBaseMult(&additionalKey).AsBytes())
+			}
+		}
+
+		if d.Destination.PaymentId != [monero.PaymentIdSize]byte{} {
+			if encryptedPaymentId != nil {
+				return nil, nil, ErrMultiplePaymentIds
+			}
+			pid := address.EncryptPaymentId(d.Destination.PaymentId, &viewPub, &txKey)
+			encryptedPaymentId = &pid
+		}
+
+		outputs[i] = makeLegacyOutput(&spendPub, &viewPub, key, uint64(i), d.Amount)
+	}
+
+	if encryptedPaymentId == nil && len(destinations) == 2 {
+		// dummy payment id, so two output transactions look alike
+		var viewPub curve25519.PublicKey[T]
+		if _, err = viewPub.SetBytes(destinations[1-changeIndex].Destination.Address.ViewPublicKey()[:]); err != nil {
+			return nil, nil, err
+		}
+		pid := address.EncryptPaymentId([monero.PaymentIdSize]byte{}, &viewPub, &txKey)
+		encryptedPaymentId = &pid
+	}
+
+	if extra, err = makeExtra(&txPub, additionalPubs, encryptedPaymentId); err != nil {
+		return nil, nil, err
+	}
+	return outputs, extra, nil
+}
+
+// makeLegacyOutput Equivalent to address.CalculateTransactionOutput, also returning the commitment mask
+func makeLegacyOutput[T curve25519.PointOperations](spendPub, viewPub *curve25519.PublicKey[T], txKey *curve25519.Scalar, outputIndex, amount uint64) (o output) {
+	var sharedData curve25519.Scalar
+	derivation := address.GetDerivation(new(curve25519.PublicKey[T]), viewPub, txKey)
+	_, viewTag := crypto.GetDerivationSharedDataAndViewTagForOutputIndex(&sharedData, derivation.AsBytes(), outputIndex)
+	sharedDataBytes := curve25519.PrivateKeyBytes(sharedData.Bytes())
+
+	o.out = transaction.Output{
+		Index:              outputIndex,
+		Type:               transaction.TxOutToTaggedKey,
+		EphemeralPublicKey: address.GetPublicKeyForSharedData(new(curve25519.PublicKey[T]), spendPub, &sharedData).AsBytes(),
+		ViewTag:            types.MakeFixed([monero.CarrotViewTagSize]byte{viewTag}),
+	}
+
+	o.commitment.Amount = amount
+	ringct.CalculateCommitmentMask(&o.commitment.Mask, sharedDataBytes)
+	o.amountCommitment = ringct.CalculateCommitment(new(curve25519.PublicKey[T]), o.commitment).AsBytes()
+	o.encryptedAmount.Encode(sharedDataBytes, amount, true)
+	return o
+}
+
+// makeCarrotOutputs Creates Carrot outputs for destinations, in order. The change destination becomes a special self-send enote
+// Two output transactions share one enote ephemeral public key, otherwise each output has its own.
+func makeCarrotOutputs[T curve25519.PointOperations](destinations []carrot.PaymentProposalV1[T], changeIndex int, firstKeyImage curve25519.PublicKeyBytes, viewKey curve25519.PrivateKeyBytes, randomReader io.Reader) (outputs []output, extra []byte, err error) {
+	proposals := make([]carrot.RCTEnoteProposal, len(destinations))
+
+	var encryptedPaymentId *[monero.PaymentIdSize]byte
+	for i := range destinations {
+		if i == changeIndex {
+			continue
+		}
+		p := &destinations[i]
+		if p.Randomness == [monero.JanusAnchorSize]byte{} {
+			if _, err = io.ReadFull(randomReader, p.Randomness[:]); err != nil {
+				return nil, nil, err
+			}
+		}
+		if err = p.Output(&proposals[i], firstKeyImage); err != nil {
+			return nil, nil, err
+		}
+		if p.Destination.PaymentId != [monero.PaymentIdSize]byte{} {
+			if encryptedPaymentId != nil {
+				return nil, nil, ErrMultiplePaymentIds
+			}
+			encryptedPaymentId = &proposals[i].EncryptedPaymentId
+		}
+	}
+
+	change := carrot.PaymentProposalSelfSendV1[T]{
+		DestinationSpendPub: *destinations[changeIndex].Destination.Address.SpendPublicKey(),
+		Amount:              destinations[changeIndex].Amount,
+		EnoteType:           carrot.EnoteTypeChange,
+	}
+	var otherEphemeralPub *curve25519.MontgomeryPoint
+	if len(destinations) == 2 {
+		otherEphemeralPub = &proposals[1-changeIndex].Enote.EphemeralPubKey
+	} else {
+		var ephemeralKey curve25519.Scalar
+		curve25519.RandomScalar(&ephemeralKey, randomReader)
+		ephemeralPub := carrot.MakeEnoteEphemeralPublicKeyCryptonote[T](&ephemeralKey)
+		change.EnoteEphemeralPub = &ephemeralPub
+	}
+	if err = change.SpecialOutput(&proposals[changeIndex], firstKeyImage, viewKey, otherEphemeralPub); err != nil {
+		return nil, nil, err
+	}
+
+	if encryptedPaymentId == nil && len(destinations) == 2 {
+		// dummy payment id, so two output transactions look alike
+		encryptedPaymentId = &proposals[1-changeIndex].EncryptedPaymentId
+	}
+
+	outputs = make([]output, len(proposals))
+	for i := range proposals {
+		enote := &proposals[i].Enote
+		mask := proposals[i].AmountBlindingFactor.Scalar()
+		if mask == nil {
+			return nil, nil, ErrInvalidInput
+		}
+
+		outputs[i].out = transaction.Output{
+			Index:                uint64(i),
+			Type:                 transaction.TxOutToCarrotV1,
+			EphemeralPublicKey:   enote.OneTimeAddress,
+			ViewTag:              types.MakeFixed(enote.ViewTag),
+			EncryptedJanusAnchor: types.MakeFixed(enote.EncryptedAnchor),
+		}
+		copy(outputs[i].encryptedAmount.Amount[:], enote.EncryptedAmount[:])
+		outputs[i].commitment = ringct.LazyCommitment{
+			Mask:   *mask,
+			Amount: proposals[i].Amount,
+		}
+		outputs[i].amountCommitment = enote.AmountCommitment
+	}
+
+	if len(proposals) == 2 {
+		txPub := curve25519.PublicKeyBytes(proposals[0].Enote.EphemeralPubKey)
+		extra, err = makeExtra(&txPub, nil, encryptedPaymentId)
+	} else {
+		ephemeralPubs := make([]curve25519.PublicKeyBytes, 0, len(proposals))
+		for i := range proposals {
+			ephemeralPubs = append(ephemeralPubs, curve25519.PublicKeyBytes(proposals[i].Enote.EphemeralPubKey))
+		}
+		extra, err = makeExtra(nil, ephemeralPubs, encryptedPaymentId)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return outputs, extra, nil
+}
+
+// makeExtra Serializes the transaction public key, additional public keys and encrypted payment id, in the order monero sorts extra fields
+func makeExtra(txPub *curve25519.PublicKeyBytes, additionalPubs []curve25519.PublicKeyBytes, encryptedPaymentId *[monero.PaymentIdSize]byte) ([]byte, error) {
+	var tags transaction.ExtraTags
+	if txPub != nil {
+		tags = append(tags, transaction.ExtraTag{
+			Tag:  transaction.TxExtraTagPubKey,
+			Data: txPub[:],
+		})
+	}
+	if len(additionalPubs) > 0 {
+		data := make([]byte, 0, len(additionalPubs)*curve25519.PublicKeySize)
+		for _, pub := range additionalPubs {
+			data = append(data, pub[:]...)
+		}
+		tags = append(tags, transaction.ExtraTag{
+			Tag:       transaction.TxExtraTagAdditionalPubKeys,
+			HasVarInt: true,
+			VarInt:    uint64(len(additionalPubs)),
+			Data:      data,
+		})
+	}
+	if encryptedPaymentId != nil {
+		data := make([]byte, 0, 1+monero.PaymentIdSize)
+		data = append(data, transaction.TxExtraNonceEncryptedPaymentId)
+		data = append(data, encryptedPaymentId[:]...)
+		tags = append(tags, transaction.ExtraTag{
+			Tag:       transaction.TxExtraTagNonce,
+			HasVarInt: true,
+			VarInt:    uint64(len(data)),
+			Data:      data,
+		})
+	}
+	return tags.MarshalBinary()
+}
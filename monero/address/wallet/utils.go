@@ -3,6 +3,7 @@ package wallet
 import (
 	"bytes"
 	"crypto/rand"
+	"encoding/binary"
 	"errors"
 	"io"
 
@@ -77,6 +78,25 @@ type KeyImageExport[T curve25519.PointOperations] struct {
 	Images []SignedKeyImage[T]
 }
 
+// EncryptKeyImages Writes a key image export file, as read by DecryptKeyImages and monero-wallet-cli import_key_images
+// key is the view key of the account, matching export.ViewPub.
+func EncryptKeyImages[T curve25519.PointOperations](export *KeyImageExport[T], key *curve25519.Scalar, kdfRounds int) ([]byte, error) {
+	if new(curve25519.PublicKey[T]).ScalarBaseMult(key).Equal(&export.ViewPub) == 0 {
+		return nil, errors.New("export is for a different account")
+	}
+
+	plain := make([]byte, 0, 4+curve25519.PublicKeySize*2+len(export.Images)*(curve25519.PublicKeySize+curve25519.PrivateKeySize*2))
+	plain = binary.LittleEndian.AppendUint32(plain, export.Offset)
+	plain = append(plain, export.SpendPub.Bytes()...)
+	plain = append(plain, export.ViewPub.Bytes()...)
+	for i := range export.Images {
+		plain = append(plain, export.Images[i].KI.Bytes()...)
+		plain = append(plain, export.Images[i].Signature.Bytes()...)
+	}
+
+	return append([]byte(KeyImageExportFileMagic), Encrypt(plain, key, kdfRounds, true)...), nil
+}
+
 func DecryptKeyImages[T curve25519.PointOperations](data []byte, key *curve25519.Scalar, kdfRounds int) (*KeyImageExport[T], error) {
 	if !bytes.HasPrefix(data, []byte(KeyImageExportFileMagic)) {
 		return nil, errors.New("invalid key image export file")
@@ -0,0 +1,69 @@
+package block
+
+import (
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/client/rpc/daemon"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/transaction"
+	"git.gammaspectra.live/P2Pool/consensus/v5/types"
+	"git.gammaspectra.live/P2Pool/consensus/v5/utils"
+)
+
+// CompleteEntry A decoded block with its transactions, as returned by get_blocks.bin
+type CompleteEntry struct {
+	Block  GenericBlock
+	Weight uint64
+	// Transactions In the same order as Block.Transactions
+	// When pruned, entries only implement transaction.PrunedTransaction, otherwise they are transaction.Transaction
+	Transactions []transaction.PrunedTransaction
+	// PrunableHashes Hashes of the prunable part of Transactions, only set when pruned
+	PrunableHashes []types.Hash
+	// OutputIndices Global output indices of each transaction, starting with the miner transaction
+	OutputIndices [][]uint64
+}
+
+// DecodeCompleteEntries Decodes blocks and transactions of a get_blocks.bin result
+// Non-pruned transactions are verified against the block transaction ids
+func DecodeCompleteEntries(result *daemon.GetBlocksBinResult) ([]CompleteEntry, error) {
+	entries := make([]CompleteEntry, len(result.Blocks))
+	for i, e := range result.Blocks {
+		b := &entries[i]
+		b.Weight = e.BlockWeight
+		if err := b.Block.UnmarshalBinary(e.Block, false, nil); err != nil {
+			return nil, utils.ErrorfNoEscape("block at height %d: %w", result.StartHeight+uint64(i), err)
+		}
+		if len(e.Transactions) != len(b.Block.Transactions) {
+			return nil, utils.ErrorfNoEscape("block %s: invalid transaction count", b.Block.Id())
+		}
+
+		b.Transactions = make([]transaction.PrunedTransaction, 0, len(e.Transactions))
+		for j, txEntry := range e.Transactions {
+			var tx transaction.PrunedTransaction
+			var err error
+			if e.Pruned {
+				tx, err = transaction.NewPrunedTransactionFromBytes(txEntry.Blob)
+			} else {
+				tx, err = transaction.NewTransactionFromBytes(txEntry.Blob)
+			}
+			if err != nil {
+				return nil, utils.ErrorfNoEscape("block %s transaction %s: %w", b.Block.Id(), b.Block.Transactions[j], err)
+			}
+
+			if fullTx, ok := tx.(transaction.Transaction); ok && !e.Pruned && fullTx.Hash() != b.Block.Transactions[j] {
+				return nil, utils.ErrorfNoEscape("block %s: transaction %s does not match", b.Block.Id(), b.Block.Transactions[j])
+			}
+			b.Transactions = append(b.Transactions, tx)
+			if e.Pruned {
+				b.PrunableHashes = append(b.PrunableHashes, txEntry.PrunableHash)
+			}
+		}
+
+		if i < len(result.OutputIndices) {
+			txs := result.OutputIndices[i].Transactions
+			b.OutputIndices = make([][]uint64, len(txs))
+			for j := range txs {
+				b.OutputIndices[j] = txs[j].Indices
+			}
+		}
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,145 @@
+package block
+
+import (
+	"strings"
+	"testing"
+
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/client/rpc/daemon"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/crypto/curve25519"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/transaction"
+	"git.gammaspectra.live/P2Pool/consensus/v5/types"
+)
+
+// testCoinbase Synthetic coinbase transaction at height, with a single not necessarily valid output
+func testCoinbase(height uint64) transaction.P2PoolCoinbaseV2 {
+	key := curve25519.PublicKeyBytes{byte(height), 1}
+	return transaction.P2PoolCoinbaseV2{
+		InputCount:      1,
+		InputType:       transaction.TxInGen,
+		MinerUnlockTime: height + monero.MinerRewardUnlockTime,
+		MinerGenHeight:  height,
+		MinerOutputs: transaction.Outputs{
+			{
+				Index:              0,
+				Amount:             600000000000,
+				EphemeralPublicKey: key,
+				Type:               transaction.TxOutToTaggedKey,
+				ViewTag:            types.MakeFixed([monero.CarrotViewTagSize]byte{key[0]}),
+			},
+		},
+		Extra: transaction.ExtraTags{
+			{
+				Tag:  transaction.TxExtraTagPubKey,
+				Data: key[:],
+			},
+		},
+		AuxiliaryData: transaction.CoinbaseTransactionAuxiliaryData{
+			TotalReward: 600000000000,
+		},
+	}
+}
+
+func TestDecodeCompleteEntries(t *testing.T) {
+	// a coinbase blob standing in for a regular transaction, which decodes via the coinbase fallback
+	txCoinbase := testCoinbase(99)
+	txBlob, err := txCoinbase.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	txId := txCoinbase.Hash()
+
+	b := &PoolMainBlock{
+		MajorVersion: 16,
+		MinorVersion: 16,
+		Timestamp:    1700000000,
+		Coinbase:     testCoinbase(100),
+		Transactions: []types.Hash{txId},
+	}
+	blob, err := b.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := &daemon.GetBlocksBinResult{
+		Blocks: []daemon.BlockCompleteEntry{
+			{
+				Block:        blob,
+				BlockWeight:  uint64(len(blob) + len(txBlob)),
+				Transactions: []daemon.TransactionBlobEntry{{Blob: txBlob}},
+			},
+		},
+		StartHeight:   100,
+		CurrentHeight: 101,
+		OutputIndices: make([]daemon.BlockOutputIndices, 1),
+	}
+	result.OutputIndices[0].Transactions = make([]struct {
+		Indices []uint64 `levin:"indices"`
+	}, 2)
+	result.OutputIndices[0].Transactions[0].Indices = []uint64{5}
+	result.OutputIndices[0].Transactions[1].Indices = []uint64{6}
+
+	t.Run("Full", func(t *testing.T) {
+		entries, err := DecodeCompleteEntries(result)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 1 {
+			t.Fatalf("expected 1 entry, got %d", len(entries))
+		}
+		e := entries[0]
+		if e.Block.Id() != b.Id() {
+			t.Fatalf("expected block id %s, got %s", b.Id(), e.Block.Id())
+		}
+		if len(e.Transactions) != 1 || e.Transactions[0].(transaction.Transaction).Hash() != txId {
+			t.Fatal("transaction mismatch")
+		}
+		if e.PrunableHashes != nil {
+			t.Fatal("unexpected prunable hashes")
+		}
+		if len(e.OutputIndices) != 2 || e.OutputIndices[0][0] != 5 || e.OutputIndices[1][0] != 6 {
+			t.Fatalf("unexpected output indices %v", e.OutputIndices)
+		}
+	})
+
+	t.Run("Pruned", func(t *testing.T) {
+		pruned := *result
+		pruned.Blocks = []daemon.BlockCompleteEntry{result.Blocks[0]}
+		pruned.Blocks[0].Pruned = true
+		pruned.Blocks[0].Transactions = []daemon.TransactionBlobEntry{{Blob: txBlob, PrunableHash: types.Hash{1}}}
+
+		entries, err := DecodeCompleteEntries(&pruned)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries[0].PrunableHashes) != 1 || entries[0].PrunableHashes[0] != (types.Hash{1}) {
+			t.Fatal("prunable hash mismatch")
+		}
+	})
+
+	t.Run("TransactionMismatch", func(t *testing.T) {
+		otherCoinbase := testCoinbase(98)
+		otherBlob, err := otherCoinbase.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		mismatch := *result
+		mismatch.Blocks = []daemon.BlockCompleteEntry{result.Blocks[0]}
+		mismatch.Blocks[0].Transactions = []daemon.TransactionBlobEntry{{Blob: otherBlob}}
+
+		if _, err = DecodeCompleteEntries(&mismatch); err == nil || !strings.Contains(err.Error(), "does not match") {
+			t.Fatalf("expected mismatch error, got %v", err)
+		}
+	})
+
+	t.Run("TransactionCount", func(t *testing.T) {
+		missing := *result
+		missing.Blocks = []daemon.BlockCompleteEntry{result.Blocks[0]}
+		missing.Blocks[0].Transactions = nil
+
+		if _, err = DecodeCompleteEntries(&missing); err == nil || !strings.Contains(err.Error(), "invalid transaction count") {
+			t.Fatalf("expected count error, got %v", err)
+		}
+	})
+}
@@ -51,6 +51,38 @@ func GetDefaultClient() *Client {
 	}
 }
 
+// RPC Method set of Client, implemented by Client and PoolClient
+type RPC interface {
+	SetThrottle(timesPerSecond uint64)
+	GetTransactions(txIds ...types.Hash) (data [][]byte, jsonTx []*daemon.TransactionJSON, err error)
+	GetPrunedTransactions(txIds ...types.Hash) (data [][]byte, jsonTx []*daemon.TransactionJSON, err error)
+	GetTransactionInputs(ctx context.Context, hashes ...types.Hash) ([]TransactionInputResult, error)
+	IsKeyImageSpent(ki ...curve25519.PublicKeyBytes) (status []int, err error)
+	GetOutputIndexes(id types.Hash) (indexes []uint64, err error)
+	GetOuts(inputs ...daemon.GetOutsInput) ([]Output, error)
+	GetOutsBin(ctx context.Context, inputs ...daemon.GetOutsInput) ([]Output, error)
+	GetBlocksBin(ctx context.Context, blockIds []types.Hash, startHeight uint64, prune bool) (*daemon.GetBlocksBinResult, error)
+	GetHashesBin(ctx context.Context, blockIds []types.Hash, startHeight uint64) (*daemon.GetHashesBinResult, error)
+	GetOutputDistribution(ctx context.Context, fromHeight, toHeight uint64, cumulative bool, amounts ...uint64) ([]daemon.OutputDistribution, error)
+	GetVersion() (*daemon.GetVersionResult, error)
+	GetPeerList() (*daemon.GetPeerListResult, error)
+	GetInfo() (*daemon.GetInfoResult, error)
+	SyncInfo() (*daemon.SyncInfoResult, error)
+	GetAlternateChains(ctx context.Context) (*daemon.GetAlternateChainsResult, error)
+	GetTransactionPool(ctx context.Context) (*daemon.GetTransactionPoolResult, error)
+	GetBlockHeaderByHash(hash types.Hash, ctx context.Context) (*daemon.BlockHeader, error)
+	GetBlock(hash types.Hash, fillPowHash bool, ctx context.Context) (*daemon.GetBlockResult, error)
+	GetBlockByHeight(height uint64, ctx context.Context) (*daemon.GetBlockResult, error)
+	GetLastBlockHeader() (*daemon.GetLastBlockHeaderResult, error)
+	GetBlockHeaderByHeight(height uint64, ctx context.Context) (*daemon.GetBlockHeaderByHeightResult, error)
+	GetBlockHeadersRangeResult(start, end uint64, ctx context.Context) (*daemon.GetBlockHeadersRangeResult, error)
+	SubmitBlock(blob []byte) (*daemon.SubmitBlockResult, error)
+	GetMinerData() (*daemon.GetMinerDataResult, error)
+	GetBlockTemplate(address string) (*daemon.GetBlockTemplateResult, error)
+}
+
+var _ RPC = (*Client)(nil)
+
 type Client struct {
 	c *rpc.Client
 	d *daemon.Client
@@ -268,22 +300,77 @@ func (c *Client) GetOuts(inputs ...daemon.GetOutsInput) ([]Output, error) {
 	if result, err := c.d.GetOuts(context.Background(), inputs, true); err != nil {
 		return nil, err
 	} else {
-		if len(result.Outs) != len(inputs) {
-			return nil, errors.New("invalid output count")
-		}
+		return outsResult(result, inputs)
+	}
+}
+
+// GetOutsBin Same as GetOuts, via get_outs.bin
+func (c *Client) GetOutsBin(ctx context.Context, inputs ...daemon.GetOutsInput) ([]Output, error) {
+	<-c.throttler
+
+	if result, err := c.d.GetOutsBin(ctx, inputs, true); err != nil {
+		return nil, err
+	} else {
+		return outsResult(result, inputs)
+	}
+}
 
-		s := make([]Output, len(inputs))
-		for i := range result.Outs {
-			o := &result.Outs[i]
-			s[i].GlobalOutputIndex = inputs[i].Index
-			s[i].Height = o.Height
-			s[i].Key = o.Key
-			s[i].Mask = o.Mask
-			s[i].TransactionId = o.Txid
-			s[i].Unlocked = o.Unlocked
+func outsResult(result *daemon.GetOutsResult, inputs []daemon.GetOutsInput) ([]Output, error) {
+	if len(result.Outs) != len(inputs) {
+		return nil, errors.New("invalid output count")
+	}
+
+	s := make([]Output, len(inputs))
+	for i := range result.Outs {
+		o := &result.Outs[i]
+		s[i].GlobalOutputIndex = inputs[i].Index
+		s[i].Height = o.Height
+		s[i].Key = o.Key
+		s[i].Mask = o.Mask
+		s[i].TransactionId = o.Txid
+		s[i].Unlocked = o.Unlocked
+	}
+
+	return s, nil
+}
+
+// GetBlocksBin Gets raw blocks and transactions starting at startHeight, or if zero, after the most recent known id in blockIds
+// Use block.DecodeCompleteEntries to decode the result
+func (c *Client) GetBlocksBin(ctx context.Context, blockIds []types.Hash, startHeight uint64, prune bool) (*daemon.GetBlocksBinResult, error) {
+	<-c.throttler
+
+	if result, err := c.d.GetBlocksBin(ctx, blockIds, startHeight, prune); err != nil {
+		return nil, err
+	} else {
+		if len(result.OutputIndices) > 0 && len(result.OutputIndices) != len(result.Blocks) {
+			return nil, errors.New("invalid output indices count")
 		}
+		return result, nil
+	}
+}
 
-		return s, nil
+// GetHashesBin Gets block ids starting at startHeight, or if zero, after the most recent known id in blockIds
+func (c *Client) GetHashesBin(ctx context.Context, blockIds []types.Hash, startHeight uint64) (*daemon.GetHashesBinResult, error) {
+	<-c.throttler
+
+	if result, err := c.d.GetHashesBin(ctx, blockIds, startHeight); err != nil {
+		return nil, err
+	} else {
+		return result, nil
+	}
+}
+
+// GetOutputDistribution Gets the output distribution for each amount. Use amount zero for RingCT outputs
+func (c *Client) GetOutputDistribution(ctx context.Context, fromHeight, toHeight uint64, cumulative bool, amounts ...uint64) ([]daemon.OutputDistribution, error) {
+	<-c.throttler
+
+	if result, err := c.d.GetOutputDistributionBin(ctx, amounts, fromHeight, toHeight, cumulative); err != nil {
+		return nil, err
+	} else {
+		if len(result) != len(amounts) {
+			return nil, errors.New("invalid distribution count")
+		}
+		return result, nil
 	}
 }
 
@@ -314,6 +401,41 @@ func (c *Client) GetInfo() (*daemon.GetInfoResult, error) {
 	}
 }
 
+func (c *Client) SyncInfo() (*daemon.SyncInfoResult, error) {
+	<-c.throttler
+	if result, err := c.d.SyncInfo(context.Background()); err != nil {
+		return nil, err
+	} else {
+		return result, nil
+	}
+}
+
+func (c *Client) GetAlternateChains(ctx context.Context) (*daemon.GetAlternateChainsResult, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-c.throttler:
+		if result, err := c.d.GetAlternateChains(ctx); err != nil {
+			return nil, err
+		} else {
+			return result, nil
+		}
+	}
+}
+
+func (c *Client) GetTransactionPool(ctx context.Context) (*daemon.GetTransactionPoolResult, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-c.throttler:
+		if result, err := c.d.GetTransactionPool(ctx); err != nil {
+			return nil, err
+		} else {
+			return result, nil
+		}
+	}
+}
+
 func (c *Client) GetBlockHeaderByHash(hash types.Hash, ctx context.Context) (*daemon.BlockHeader, error) {
 	<-c.throttler
 	if result, err := c.d.GetBlockHeaderByHash(ctx, []types.Hash{hash}); err != nil {
@@ -2,9 +2,18 @@ package client
 
 import (
 	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"slices"
+	"strings"
 	"testing"
 
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/client/levin"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/client/rpc"
 	"git.gammaspectra.live/P2Pool/consensus/v5/monero/client/rpc/daemon"
 	"git.gammaspectra.live/P2Pool/consensus/v5/types"
 )
@@ -47,3 +56,206 @@ func TestInputs(t *testing.T) {
 		}
 	}
 }
+
+// stringArray Portable Storage array of strings, as monerod sends non-pruned transaction blobs
+type stringArray []string
+
+func (v stringArray) Bytes() ([]byte, error) {
+	varInB, err := levin.VarIn(len(v))
+	if err != nil {
+		return nil, err
+	}
+	b := append([]byte{levin.BoostSerializeTypeString | levin.BoostSerializeFlagArray}, varInB...)
+	for _, s := range v {
+		data, err := levin.BoostString(s).Bytes()
+		if err != nil {
+			return nil, err
+		}
+		// skip string type, it is part of the array type
+		b = append(b, data[1:]...)
+	}
+	return b, nil
+}
+
+// fakeBinaryDaemon Serves binary endpoints with Portable Storage responses laid out like monerod, including fields clients ignore
+func fakeBinaryDaemon(t *testing.T) *httptest.Server {
+	blockId := types.Hash{1}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buf, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		request, err := levin.NewPortableStorageFromBytes(buf)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		entries := levin.Entries{
+			{Name: "credits", Serializable: levin.BoostUint64(0)},
+			{Name: "status", Serializable: levin.BoostString("OK")},
+			{Name: "top_hash", Serializable: levin.BoostString("")},
+			{Name: "untrusted", Serializable: levin.BoostBool(false)},
+		}
+		// a busy node is simulated by requesting start height 1
+		if start, ok := request.Entries.Find("start_height"); ok && start.Uint64() == 1 {
+			entries[1].Serializable = levin.BoostString("BUSY")
+		}
+		switch r.URL.Path {
+		case "/get_blocks.bin":
+			prune, _ := request.Entries.Find("prune")
+			block := levin.Section{Entries: levin.Entries{
+				{Name: "block", Serializable: levin.BoostString("block blob")},
+				{Name: "block_weight", Serializable: levin.BoostUint64(1234)},
+			}}
+			if prune.Bool() {
+				block.Entries = append(block.Entries,
+					levin.Entry{Name: "pruned", Serializable: levin.BoostBool(true)},
+					levin.Entry{Name: "txs", Serializable: levin.BoostSectionArray{
+						{Entries: levin.Entries{
+							{Name: "blob", Serializable: levin.BoostString("tx blob")},
+							{Name: "prunable_hash", Serializable: levin.BoostString(blockId[:])},
+						}},
+					}},
+				)
+			} else {
+				block.Entries = append(block.Entries, levin.Entry{Name: "txs", Serializable: stringArray{"tx blob"}})
+			}
+			entries = append(entries,
+				levin.Entry{Name: "blocks", Serializable: levin.BoostSectionArray{block}},
+				levin.Entry{Name: "current_height", Serializable: levin.BoostUint64(101)},
+				levin.Entry{Name: "daemon_time", Serializable: levin.BoostUint64(1700000000)},
+				levin.Entry{Name: "output_indices", Serializable: levin.BoostSectionArray{
+					{Entries: levin.Entries{
+						{Name: "indices", Serializable: levin.BoostSectionArray{
+							{Entries: levin.Entries{{Name: "indices", Serializable: levin.BoostUint64Array{7}}}},
+							{Entries: levin.Entries{{Name: "indices", Serializable: levin.BoostUint64Array{8, 9}}}},
+						}},
+					}},
+				}},
+				levin.Entry{Name: "pool_info_extent", Serializable: levin.BoostByte(0)},
+				levin.Entry{Name: "start_height", Serializable: levin.BoostUint64(100)},
+			)
+		case "/get_hashes.bin":
+			entries = append(entries,
+				levin.Entry{Name: "current_height", Serializable: levin.BoostUint64(101)},
+				levin.Entry{Name: "m_block_ids", Serializable: levin.BoostString(blockId[:])},
+				levin.Entry{Name: "start_height", Serializable: levin.BoostUint64(100)},
+			)
+		case "/get_outs.bin":
+			outputs, _ := request.Entries.Find("outputs")
+			outs := make(levin.BoostSectionArray, 0, len(outputs.Entries()))
+			for _, o := range outputs.Entries() {
+				index, _ := o.Entries().Find("index")
+				key := types.Hash{byte(index.Uint64())}
+				outs = append(outs, levin.Section{Entries: levin.Entries{
+					{Name: "height", Serializable: levin.BoostUint64(index.Uint64() + 1000)},
+					{Name: "key", Serializable: levin.BoostString(key[:])},
+					{Name: "mask", Serializable: levin.BoostString(key[:])},
+					{Name: "txid", Serializable: levin.BoostString(blockId[:])},
+					{Name: "unlocked", Serializable: levin.BoostBool(true)},
+				}})
+			}
+			entries = append(entries, levin.Entry{Name: "outs", Serializable: outs})
+		case "/get_output_distribution.bin":
+			distribution := make([]byte, 0, 3*8)
+			for _, v := range []uint64{1, 3, 6} {
+				distribution = binary.LittleEndian.AppendUint64(distribution, v)
+			}
+			entries = append(entries, levin.Entry{Name: "distributions", Serializable: levin.BoostSectionArray{
+				{Entries: levin.Entries{
+					{Name: "amount", Serializable: levin.BoostUint64(0)},
+					{Name: "base", Serializable: levin.BoostUint64(0)},
+					{Name: "binary", Serializable: levin.BoostBool(true)},
+					{Name: "compress", Serializable: levin.BoostBool(false)},
+					{Name: "distribution", Serializable: levin.BoostString(distribution)},
+					{Name: "start_height", Serializable: levin.BoostUint64(100)},
+				}},
+			}})
+		default:
+			http.Error(w, "unknown endpoint", http.StatusNotFound)
+			return
+		}
+
+		data, err := (&levin.PortableStorage{Entries: entries}).Bytes()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		_, _ = w.Write(data)
+	}))
+}
+
+func TestBinaryEndpoints(t *testing.T) {
+	s := fakeBinaryDaemon(t)
+	defer s.Close()
+
+	c, err := NewClient(s.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("GetBlocksBin", func(t *testing.T) {
+		for _, prune := range []bool{false, true} {
+			result, err := c.GetBlocksBin(t.Context(), nil, 100, prune)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.StartHeight != 100 || result.CurrentHeight != 101 || len(result.Blocks) != 1 {
+				t.Fatalf("unexpected result %+v", result)
+			}
+			b := result.Blocks[0]
+			if b.Pruned != prune || string(b.Block) != "block blob" || b.BlockWeight != 1234 {
+				t.Fatalf("unexpected block %+v", b)
+			}
+			if len(b.Transactions) != 1 || string(b.Transactions[0].Blob) != "tx blob" {
+				t.Fatalf("unexpected transactions %+v", b.Transactions)
+			}
+			if prune && b.Transactions[0].PrunableHash != (types.Hash{1}) {
+				t.Fatal("prunable hash mismatch")
+			}
+			if len(result.OutputIndices) != 1 || len(result.OutputIndices[0].Transactions) != 2 || result.OutputIndices[0].Transactions[1].Indices[1] != 9 {
+				t.Fatalf("unexpected output indices %+v", result.OutputIndices)
+			}
+		}
+	})
+
+	t.Run("GetHashesBin", func(t *testing.T) {
+		result, err := c.GetHashesBin(t.Context(), []types.Hash{{2}}, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.StartHeight != 100 || result.CurrentHeight != 101 || len(result.BlockIds) != 1 || result.BlockIds[0] != (types.Hash{1}) {
+			t.Fatalf("unexpected result %+v", result)
+		}
+	})
+
+	t.Run("Status", func(t *testing.T) {
+		_, err := c.GetHashesBin(t.Context(), nil, 1)
+		var responseErr *rpc.ResponseError
+		if !errors.As(err, &responseErr) || !strings.Contains(responseErr.Message, "BUSY") {
+			t.Fatalf("expected status error, got %v", err)
+		}
+	})
+
+	t.Run("GetOutsBin", func(t *testing.T) {
+		outs, err := c.GetOutsBin(t.Context(), daemon.GetOutsInput{Index: 5}, daemon.GetOutsInput{Index: 6})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(outs) != 2 || outs[1].GlobalOutputIndex != 6 || outs[1].Height != 1006 || outs[1].Key != (types.Hash{6}) || !outs[1].Unlocked {
+			t.Fatalf("unexpected outputs %+v", outs)
+		}
+	})
+
+	t.Run("GetOutputDistribution", func(t *testing.T) {
+		result, err := c.GetOutputDistribution(t.Context(), 100, 0, true, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(result) != 1 || result[0].StartHeight != 100 || !slices.Equal(result[0].Distribution, []uint64{1, 3, 6}) {
+			t.Fatalf("unexpected result %+v", result)
+		}
+	})
+}
@@ -0,0 +1,134 @@
+package fakemonerod
+
+import (
+	"io"
+	"net/http"
+
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/client/levin"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/client/rpc/daemon"
+	"git.gammaspectra.live/P2Pool/consensus/v5/types"
+)
+
+// maxBlocksCount Maximum blocks returned by get_blocks.bin, same as monerod
+const maxBlocksCount = 1000
+
+const (
+	binaryStatusOK     = "OK"
+	binaryStatusFailed = "Failed"
+)
+
+// serveBinary Serves a Portable Storage endpoint
+// Transaction blobs are not known, so blocks including transactions cannot be decoded by clients.
+func (d *Daemon) serveBinary(w http.ResponseWriter, r *http.Request, handler func(request []byte) (any, error)) {
+	buf, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	response, err := handler(buf)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	data, err := levin.Marshal(response)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	_, _ = w.Write(data)
+}
+
+// supplementStart Returns the height to start from, either startHeight or the first block id in blockIds found in the chain
+// Must be called with lock held
+func (d *Daemon) supplementStart(blockIds []types.Hash, startHeight uint64) (uint64, bool) {
+	if startHeight > 0 {
+		return startHeight, startHeight < uint64(len(d.chain))
+	}
+	for _, id := range blockIds {
+		if b, ok := d.byId[id]; ok && b.Height < uint64(len(d.chain)) && d.chain[b.Height] == b {
+			return b.Height, true
+		}
+	}
+	return 0, false
+}
+
+func (d *Daemon) getBlocksBin(buf []byte) (any, error) {
+	var request struct {
+		BlockIds    []types.Hash `levin:"block_ids,blob"`
+		StartHeight uint64       `levin:"start_height"`
+	}
+	if err := levin.Unmarshal(buf, &request); err != nil {
+		return nil, err
+	}
+
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+
+	start, ok := d.supplementStart(request.BlockIds, request.StartHeight)
+	if !ok {
+		response := &daemon.GetBlocksBinResult{}
+		response.Status = binaryStatusFailed
+		return response, nil
+	}
+
+	end := min(start+maxBlocksCount, uint64(len(d.chain)))
+	response := &daemon.GetBlocksBinResult{
+		Blocks:        make([]daemon.BlockCompleteEntry, 0, end-start),
+		StartHeight:   start,
+		CurrentHeight: uint64(len(d.chain)),
+		OutputIndices: make([]daemon.BlockOutputIndices, 0, end-start),
+	}
+	response.Status = binaryStatusOK
+	for _, b := range d.chain[start:end] {
+		response.Blocks = append(response.Blocks, daemon.BlockCompleteEntry{
+			Block:       b.Blob,
+			BlockWeight: uint64(len(b.Blob)),
+		})
+
+		// synthetic blocks have a single coinbase output, so global output indices match heights
+		var indices daemon.BlockOutputIndices
+		indices.Transactions = make([]struct {
+			Indices []uint64 `levin:"indices"`
+		}, 1)
+		indices.Transactions[0].Indices = []uint64{b.Height}
+		response.OutputIndices = append(response.OutputIndices, indices)
+	}
+
+	return response, nil
+}
+
+func (d *Daemon) getHashesBin(buf []byte) (any, error) {
+	var request struct {
+		BlockIds    []types.Hash `levin:"block_ids,blob"`
+		StartHeight uint64       `levin:"start_height"`
+	}
+	if err := levin.Unmarshal(buf, &request); err != nil {
+		return nil, err
+	}
+
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+
+	start, ok := d.supplementStart(request.BlockIds, request.StartHeight)
+	if !ok {
+		response := &daemon.GetHashesBinResult{}
+		response.Status = binaryStatusFailed
+		return response, nil
+	}
+
+	response := &daemon.GetHashesBinResult{
+		BlockIds:      make([]types.Hash, 0, uint64(len(d.chain))-start),
+		StartHeight:   start,
+		CurrentHeight: uint64(len(d.chain)),
+	}
+	response.Status = binaryStatusOK
+	for _, b := range d.chain[start:] {
+		response.BlockIds = append(response.BlockIds, b.Id)
+	}
+
+	return response, nil
+}
@@ -0,0 +1,439 @@
+// Package fakemonerod Implements an in-process monerod stand-in for tests
+//
+// It keeps a synthetic main chain, serves the JSON-RPC methods used by P2Pool and the block binary endpoints, and publishes ZMQ events as monerod --zmq-pub does.
+// Blocks are not validated beyond their previous id, and proof of work is never checked.
+package fakemonerod
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"time"
+
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/address"
+	mainblock "git.gammaspectra.live/P2Pool/consensus/v5/monero/block"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/client/zmq"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/crypto"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/crypto/curve25519"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/randomx"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/transaction"
+	"git.gammaspectra.live/P2Pool/consensus/v5/p2pool/mempool"
+	"git.gammaspectra.live/P2Pool/consensus/v5/types"
+	"git.gammaspectra.live/P2Pool/consensus/v5/utils"
+	"git.gammaspectra.live/P2Pool/zmq4"
+)
+
+const (
+	// BlockTime Target spacing of synthetic block timestamps, in seconds
+	BlockTime = 120
+
+	// MedianWeight Fixed block weight median reported in miner data
+	MedianWeight = 300000
+
+	DefaultMajorVersion = 16
+)
+
+var DefaultDifficulty = types.DifficultyFrom64(100000)
+
+type Config struct {
+	// Height Number of synthetic blocks created on start, at least 1
+	Height uint64
+	// MajorVersion Block major and minor version. Defaults to DefaultMajorVersion
+	MajorVersion uint8
+	// Difficulty Constant difficulty of every block. Defaults to DefaultDifficulty
+	Difficulty types.Difficulty
+	// Timestamp Timestamp of the first block, subsequent blocks are spaced BlockTime apart
+	// Defaults to a time such that the last initial block was mined now
+	Timestamp uint64
+
+	// ZMQ Endpoint to publish events on, for example tcp://127.0.0.1:0. ZMQ is disabled if empty
+	ZMQ string
+
+	// MinerAddress Main address paid by coinbase outputs. Outputs go to synthetic keys if nil
+	MinerAddress *address.Address
+
+	// NoMinerData Reject get_miner_data as method not found, as monerod versions before it was added
+	NoMinerData bool
+}
+
+// Block A block in the fake chain
+type Block struct {
+	Block *mainblock.PoolMainBlock
+	Blob  []byte
+	Id    types.Hash
+
+	Height               uint64
+	Difficulty           types.Difficulty
+	CumulativeDifficulty types.Difficulty
+	Reward               uint64
+
+	// baseReward Emission part of Reward, without fees
+	baseReward uint64
+}
+
+type Daemon struct {
+	cfg Config
+
+	lock                  sync.RWMutex
+	chain                 []*Block
+	byId                  map[types.Hash]*Block
+	alreadyGeneratedCoins uint64
+	mempool               mempool.Mempool
+	submitted             [][]byte
+	// reorgs Number of reorgs done, used as nonce so replaced blocks get different ids
+	reorgs uint32
+
+	rpc *httptest.Server
+
+	pubLock sync.Mutex
+	pub     zmq4.Socket
+	cancel  context.CancelFunc
+	// zmqAddress Resolved publisher endpoint, kept so StartZMQ listens on the same port
+	zmqAddress string
+}
+
+// New Creates the fake daemon with its initial chain, and starts serving RPC and ZMQ
+func New(cfg Config) (*Daemon, error) {
+	if cfg.Height == 0 {
+		cfg.Height = 1
+	}
+	if cfg.MajorVersion == 0 {
+		cfg.MajorVersion = DefaultMajorVersion
+	}
+	if cfg.MajorVersion >= monero.HardForkFCMPPlusPlus {
+		return nil, errors.New("unsupported major version")
+	}
+	if cfg.Difficulty.IsZero() {
+		cfg.Difficulty = DefaultDifficulty
+	}
+	if cfg.Timestamp == 0 {
+		cfg.Timestamp = uint64(time.Now().Unix()) - (cfg.Height-1)*BlockTime
+	}
+
+	d := &Daemon{
+		cfg:  cfg,
+		byId: make(map[types.Hash]*Block),
+	}
+
+	for range cfg.Height {
+		if err := d.addBlock(d.nextBlock(nil, transaction.TxExtraTemplateNonceSize)); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.ZMQ != "" {
+		if err := d.listenZMQ(cfg.ZMQ); err != nil {
+			return nil, err
+		}
+		d.zmqAddress = "tcp://" + d.pub.Addr().String()
+	}
+
+	d.rpc = httptest.NewServer(d)
+
+	return d, nil
+}
+
+func (d *Daemon) Close() error {
+	d.rpc.Close()
+	if d.pub != nil {
+		d.cancel()
+		return d.pub.Close()
+	}
+	return nil
+}
+
+// RPCAddress Returns the base URL for monero/client.NewClient
+func (d *Daemon) RPCAddress() string {
+	return d.rpc.URL
+}
+
+// ZMQAddress Returns the endpoint for monero/client/zmq.NewClient, or empty if disabled
+func (d *Daemon) ZMQAddress() string {
+	if d.pub == nil {
+		return ""
+	}
+	return "tcp://" + d.pub.Addr().String()
+}
+
+// Height Returns the chain height, which is the height of the next block
+func (d *Daemon) Height() uint64 {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	return uint64(len(d.chain))
+}
+
+// Tip Returns the highest block
+func (d *Daemon) Tip() *Block {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	return d.chain[len(d.chain)-1]
+}
+
+func (d *Daemon) BlockByHeight(height uint64) *Block {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	if height >= uint64(len(d.chain)) {
+		return nil
+	}
+	return d.chain[height]
+}
+
+func (d *Daemon) BlockById(id types.Hash) *Block {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	return d.byId[id]
+}
+
+// Submitted Returns blobs received via submit_block, accepted or not
+func (d *Daemon) Submitted() [][]byte {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	return append([][]byte(nil), d.submitted...)
+}
+
+// outputKey Deterministic, not necessarily valid, output key for synthetic blocks
+func outputKey(height uint64) curve25519.PublicKeyBytes {
+	return curve25519.PublicKeyBytes(crypto.Keccak256Var([]byte("fakemonerod"), binary.LittleEndian.AppendUint64(nil, height)))
+}
+
+// coinbaseOutput Returns the coinbase output key, view tag and transaction public key for the block at height
+// Pays to the configured miner address with a deterministic transaction key, if any.
+func (d *Daemon) coinbaseOutput(height uint64) (key curve25519.PublicKeyBytes, viewTag uint8, txPub curve25519.PublicKeyBytes) {
+	if d.cfg.MinerAddress == nil {
+		key = outputKey(height)
+		return key, key[0], key
+	}
+
+	var spendPub, viewPub curve25519.VarTimePublicKey
+	if _, err := spendPub.SetBytes(d.cfg.MinerAddress.SpendPublicKey()[:]); err != nil {
+		utils.Panic(err)
+	}
+	if _, err := viewPub.SetBytes(d.cfg.MinerAddress.ViewPublicKey()[:]); err != nil {
+		utils.Panic(err)
+	}
+
+	txKey := crypto.ScalarDeriveLegacy(new(curve25519.Scalar), []byte("fakemonerod"), binary.LittleEndian.AppendUint64(nil, height), binary.LittleEndian.AppendUint32(nil, d.reorgs))
+	out, viewTag := address.GetEphemeralPublicKeyAndViewTag(new(curve25519.VarTimePublicKey), &spendPub, &viewPub, txKey, 0)
+	return out.AsBytes(), viewTag, new(curve25519.VarTimePublicKey).ScalarBaseMult(txKey).AsBytes()
+}
+
+// nextBlock Creates the next synthetic block over the current tip, including txs. Must be called with lock held or before serving
+// reserveSize bytes of zero nonce are reserved in the coinbase extra. The reward includes fees of txs found in the mempool.
+func (d *Daemon) nextBlock(txs []types.Hash, reserveSize int) *mainblock.PoolMainBlock {
+	height := uint64(len(d.chain))
+
+	var prevId types.Hash
+	timestamp := d.cfg.Timestamp
+	if height > 0 {
+		tip := d.chain[height-1]
+		prevId = tip.Id
+		timestamp = tip.Block.Timestamp + BlockTime
+	}
+
+	reward := mainblock.GetBaseReward(d.alreadyGeneratedCoins)
+	for _, e := range d.mempool {
+		if slices.Contains(txs, e.Id) {
+			reward += e.Fee
+		}
+	}
+	key, viewTag, txPub := d.coinbaseOutput(height)
+
+	return &mainblock.PoolMainBlock{
+		MajorVersion: d.cfg.MajorVersion,
+		MinorVersion: d.cfg.MajorVersion,
+		Timestamp:    timestamp,
+		PreviousId:   prevId,
+		Nonce:        d.reorgs,
+		Coinbase: transaction.P2PoolCoinbaseV2{
+			InputCount:      1,
+			InputType:       transaction.TxInGen,
+			MinerUnlockTime: height + monero.MinerRewardUnlockTime,
+			MinerGenHeight:  height,
+			MinerOutputs: transaction.Outputs{
+				{
+					Index:              0,
+					Amount:             reward,
+					EphemeralPublicKey: key,
+					Type:               transaction.TxOutToTaggedKey,
+					ViewTag:            types.MakeFixed([monero.CarrotViewTagSize]byte{viewTag}),
+				},
+			},
+			Extra: transaction.ExtraTags{
+				{
+					Tag:  transaction.TxExtraTagPubKey,
+					Data: txPub[:],
+				},
+				{
+					Tag:       transaction.TxExtraTagNonce,
+					HasVarInt: true,
+					VarInt:    uint64(reserveSize),
+					Data:      make([]byte, reserveSize),
+				},
+			},
+			AuxiliaryData: transaction.CoinbaseTransactionAuxiliaryData{
+				TotalReward: reward,
+			},
+		},
+		Transactions: txs,
+	}
+}
+
+// addBlock Appends a block to the chain. Must be called with lock held or before serving
+func (d *Daemon) addBlock(b *mainblock.PoolMainBlock) error {
+	height := uint64(len(d.chain))
+	if b.Coinbase.MinerGenHeight != height {
+		return utils.ErrorfNoEscape("invalid height %d, expected %d", b.Coinbase.MinerGenHeight, height)
+	}
+	var cumulativeDifficulty types.Difficulty
+	if height > 0 {
+		tip := d.chain[height-1]
+		if b.PreviousId != tip.Id {
+			return utils.ErrorfNoEscape("invalid previous id %s, expected %s", b.PreviousId, tip.Id)
+		}
+		cumulativeDifficulty = tip.CumulativeDifficulty
+	}
+
+	blob, err := b.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	entry := &Block{
+		Block:                b,
+		Blob:                 blob,
+		Id:                   b.Id(),
+		Height:               height,
+		Difficulty:           d.cfg.Difficulty,
+		CumulativeDifficulty: cumulativeDifficulty.Add(d.cfg.Difficulty),
+		Reward:               b.Coinbase.TotalReward(),
+		baseReward:           min(b.Coinbase.TotalReward(), mainblock.GetBaseReward(d.alreadyGeneratedCoins)),
+	}
+	d.chain = append(d.chain, entry)
+	d.byId[entry.Id] = entry
+	d.alreadyGeneratedCoins += entry.baseReward
+
+	// remove mined transactions
+	d.mempool = slices.DeleteFunc(d.mempool, func(e *mempool.Entry) bool {
+		return slices.Contains(b.Transactions, e.Id)
+	})
+	return nil
+}
+
+// Mine Appends n synthetic blocks including all mempool transactions, and publishes chain_main and miner_data for each
+func (d *Daemon) Mine(n int) []types.Hash {
+	ids := make([]types.Hash, 0, n)
+	for range n {
+		b := func() *Block {
+			d.lock.Lock()
+			defer d.lock.Unlock()
+			txs := make([]types.Hash, 0, len(d.mempool))
+			for _, e := range d.mempool {
+				txs = append(txs, e.Id)
+			}
+			if err := d.addBlock(d.nextBlock(txs, transaction.TxExtraTemplateNonceSize)); err != nil {
+				// synthetic blocks always extend the tip
+				utils.Panic(err)
+			}
+			return d.chain[len(d.chain)-1]
+		}()
+		ids = append(ids, b.Id)
+		d.publishBlock(b)
+	}
+	return ids
+}
+
+// Reorg Replaces the top depth blocks with depth+1 different blocks, and publishes chain_main and miner_data for each new block
+// Replaced blocks are still available by id. Returns the ids of the new blocks.
+func (d *Daemon) Reorg(depth int) []types.Hash {
+	func() {
+		d.lock.Lock()
+		defer d.lock.Unlock()
+		if depth <= 0 || depth >= len(d.chain) {
+			utils.Panicf("invalid reorg depth %d", depth)
+		}
+		for _, b := range d.chain[len(d.chain)-depth:] {
+			d.alreadyGeneratedCoins -= b.baseReward
+		}
+		d.chain = d.chain[:len(d.chain)-depth]
+		d.reorgs++
+	}()
+	return d.Mine(depth + 1)
+}
+
+// SubmitBlock Appends a block if it extends the tip, and publishes chain_main and miner_data
+func (d *Daemon) SubmitBlock(blob []byte) error {
+	var b mainblock.PoolMainBlock
+	if err := b.UnmarshalBinary(blob, false, nil); err != nil {
+		d.lock.Lock()
+		d.submitted = append(d.submitted, blob)
+		d.lock.Unlock()
+		return err
+	}
+
+	entry, err := func() (*Block, error) {
+		d.lock.Lock()
+		defer d.lock.Unlock()
+		d.submitted = append(d.submitted, blob)
+		if err := d.addBlock(&b); err != nil {
+			return nil, err
+		}
+		return d.chain[len(d.chain)-1], nil
+	}()
+	if err != nil {
+		return err
+	}
+
+	d.publishBlock(entry)
+	return nil
+}
+
+// AddTransactions Adds entries to the mempool, and publishes them as txpool_add
+// Entries are included in the next mined block.
+func (d *Daemon) AddTransactions(entries ...*mempool.Entry) {
+	func() {
+		d.lock.Lock()
+		defer d.lock.Unlock()
+		d.mempool = append(d.mempool, entries...)
+	}()
+	d.publishTxPoolAdd(entries)
+}
+
+// Mempool Returns a copy of the current mempool
+func (d *Daemon) Mempool() mempool.Mempool {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	return append(mempool.Mempool(nil), d.mempool...)
+}
+
+// MinerData Returns the miner data for the next block, as get_miner_data
+func (d *Daemon) MinerData() *zmq.FullMinerData {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	return d.minerData()
+}
+
+func (d *Daemon) minerData() *zmq.FullMinerData {
+	height := uint64(len(d.chain))
+	tip := d.chain[height-1]
+
+	var timestamps []uint64
+	for i := height - min(height, 60); i < height; i++ {
+		timestamps = append(timestamps, d.chain[i].Block.Timestamp)
+	}
+
+	return &zmq.FullMinerData{
+		MajorVersion:          d.cfg.MajorVersion,
+		Height:                height,
+		PrevId:                tip.Id,
+		SeedHash:              d.chain[randomx.SeedHeight(height)].Id,
+		Difficulty:            d.cfg.Difficulty,
+		MedianWeight:          MedianWeight,
+		AlreadyGeneratedCoins: d.alreadyGeneratedCoins,
+		MedianTimestamp:       timestamps[len(timestamps)/2],
+		TxBacklog:             append(mempool.Mempool{}, d.mempool...),
+	}
+}
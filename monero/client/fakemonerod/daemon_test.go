@@ -0,0 +1,207 @@
+package fakemonerod_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	mainblock "git.gammaspectra.live/P2Pool/consensus/v5/monero/block"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/client"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/client/fakemonerod"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/client/zmq"
+	"git.gammaspectra.live/P2Pool/consensus/v5/p2pool/mempool"
+	"git.gammaspectra.live/P2Pool/consensus/v5/types"
+)
+
+func TestDaemon(t *testing.T) {
+	d, err := fakemonerod.New(fakemonerod.Config{
+		Height: 100,
+		ZMQ:    "tcp://127.0.0.1:0",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	rpcClient, err := client.NewClient(d.RPCAddress(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	t.Run("get_miner_data", func(t *testing.T) {
+		data, err := rpcClient.GetMinerData()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data.Height != 100 {
+			t.Fatalf("expected height 100, got %d", data.Height)
+		}
+		if data.PrevId != d.Tip().Id {
+			t.Fatalf("expected prev id %s, got %s", d.Tip().Id, data.PrevId)
+		}
+		if data.SeedHash != d.BlockByHeight(0).Id {
+			t.Fatalf("expected seed hash %s, got %s", d.BlockByHeight(0).Id, data.SeedHash)
+		}
+	})
+
+	t.Run("get_block_headers_range", func(t *testing.T) {
+		result, err := rpcClient.GetBlockHeadersRangeResult(10, 19, ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(result.Headers) != 10 {
+			t.Fatalf("expected 10 headers, got %d", len(result.Headers))
+		}
+		for i, h := range result.Headers {
+			b := d.BlockByHeight(uint64(10 + i))
+			if h.Hash != b.Id || h.PrevHash != b.Block.PreviousId || h.Height != b.Height {
+				t.Fatalf("header %d mismatch", b.Height)
+			}
+		}
+
+		if _, err = rpcClient.GetBlockHeaderByHeight(100, ctx); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+
+	t.Run("get_blocks.bin", func(t *testing.T) {
+		result, err := rpcClient.GetBlocksBin(ctx, nil, 90, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(result.Blocks) != 10 || result.StartHeight != 90 || result.CurrentHeight != 100 {
+			t.Fatalf("unexpected blocks range %d, %d, %d", len(result.Blocks), result.StartHeight, result.CurrentHeight)
+		}
+		blocks, err := mainblock.DecodeCompleteEntries(result)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range blocks {
+			b := d.BlockByHeight(uint64(90 + i))
+			if blocks[i].Block.Id() != b.Id {
+				t.Fatalf("block %d mismatch", b.Height)
+			}
+			if len(blocks[i].OutputIndices) != 1 || blocks[i].OutputIndices[0][0] != b.Height {
+				t.Fatalf("block %d unexpected output indices", b.Height)
+			}
+		}
+
+		hashes, err := rpcClient.GetHashesBin(ctx, []types.Hash{types.ZeroHash, d.BlockByHeight(95).Id}, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hashes.StartHeight != 95 || len(hashes.BlockIds) != 5 || hashes.BlockIds[4] != d.Tip().Id {
+			t.Fatalf("unexpected hashes from %d", hashes.StartHeight)
+		}
+
+		if _, err = rpcClient.GetBlocksBin(ctx, nil, 100, true); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+
+	t.Run("submit_block", func(t *testing.T) {
+		tpl, err := rpcClient.GetBlockTemplate("")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tpl.Height != 100 || tpl.PrevHash != d.Tip().Id {
+			t.Fatalf("unexpected template at height %d", tpl.Height)
+		}
+		blob := tpl.BlocktemplateBlob
+		for i := range 60 {
+			blob[tpl.ReservedOffset+i] = byte(i + 1)
+		}
+		if _, err = rpcClient.SubmitBlock(blob); err != nil {
+			t.Fatal(err)
+		}
+		if d.Height() != 101 {
+			t.Fatalf("expected height 101, got %d", d.Height())
+		}
+		if string(d.Tip().Blob) != string(blob) {
+			t.Fatal("tip is not submitted block")
+		}
+		nonce := d.Tip().Block.Coinbase.Extra[1].Data
+		if len(nonce) != 60 || nonce[0] != 1 || nonce[59] != 60 {
+			t.Fatal("reserved offset does not match extra nonce")
+		}
+
+		// stale block
+		if _, err = rpcClient.SubmitBlock(blob); err == nil {
+			t.Fatal("expected error")
+		}
+		if len(d.Submitted()) != 2 {
+			t.Fatalf("expected 2 submitted blocks, got %d", len(d.Submitted()))
+		}
+	})
+
+	t.Run("zmq", func(t *testing.T) {
+		chainMain := make(chan zmq.FullChainMain, 16)
+		minerData := make(chan *zmq.FullMinerData, 16)
+		subscribed := make(chan struct{})
+
+		zmqClient := zmq.NewClient(d.ZMQAddress())
+		defer zmqClient.Close()
+		go func() {
+			_ = zmqClient.Listen(ctx, zmq.Listeners{
+				zmq.TopicFullChainMain: zmq.DecoderFullChainMain(func(mains []zmq.FullChainMain) {
+					for _, m := range mains {
+						chainMain <- m
+					}
+				}),
+				zmq.TopicFullMinerData: zmq.DecoderFullMinerData(func(data *zmq.FullMinerData) {
+					minerData <- data
+				}),
+			}, func() {
+				close(subscribed)
+			})
+		}()
+		<-subscribed
+
+		// subscriptions propagate asynchronously, resend until the first message is received
+		ticker := time.NewTicker(time.Millisecond * 50)
+		defer ticker.Stop()
+	wait:
+		for {
+			select {
+			case <-ticker.C:
+				d.PublishMinerData()
+			case <-minerData:
+				break wait
+			case <-ctx.Done():
+				t.Fatal(ctx.Err())
+			}
+		}
+
+		tx := &mempool.Entry{Id: types.Hash{1}, BlobSize: 1500, Weight: 1500, Fee: 30000000}
+		d.AddTransactions(tx)
+		if len(d.MinerData().TxBacklog) != 1 {
+			t.Fatal("expected transaction in backlog")
+		}
+
+		ids := d.Mine(1)
+		m := <-chainMain
+		if m.MinerTx.Inputs[0].Gen.Height != 101 {
+			t.Fatalf("expected height 101, got %d", m.MinerTx.Inputs[0].Gen.Height)
+		}
+		if m.PrevID != d.BlockByHeight(100).Id {
+			t.Fatal("unexpected previous id")
+		}
+		if len(m.TxHashes) != 1 || m.TxHashes[0] != tx.Id {
+			t.Fatal("expected mempool transaction in block")
+		}
+
+		data := <-minerData
+		for data.Height != 102 {
+			data = <-minerData
+		}
+		if data.PrevId != ids[0] {
+			t.Fatal("unexpected miner data previous id")
+		}
+		if len(data.TxBacklog) != 0 {
+			t.Fatal("expected empty backlog after mining")
+		}
+	})
+}
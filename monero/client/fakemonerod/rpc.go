@@ -0,0 +1,365 @@
+package fakemonerod
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/client/rpc"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/client/rpc/daemon"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/randomx"
+	"git.gammaspectra.live/P2Pool/consensus/v5/types"
+	"git.gammaspectra.live/P2Pool/consensus/v5/utils"
+)
+
+// rpcVersion RPC version reported by get_version, as major << 16 | minor
+const rpcVersion = 3<<16 | 15
+
+// JSON-RPC error codes as returned by monerod
+const (
+	rpcErrorInvalidParams    = -32602
+	rpcErrorMethodNotFound   = -32601
+	rpcErrorTooBigHeight     = -2
+	rpcErrorInternal         = -5
+	rpcErrorWrongBlockblob   = -6
+	rpcErrorBlockNotAccepted = -7
+	rpcErrorBlockNotFound    = -14
+)
+
+type rpcError struct {
+	code    int
+	message string
+}
+
+func (e *rpcError) Error() string {
+	return e.message
+}
+
+type requestEnvelope struct {
+	ID      string          `json:"id"`
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// ServeHTTP Serves /json_rpc, /get_transaction_pool, /get_blocks.bin and /get_hashes.bin
+func (d *Daemon) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/json_rpc":
+	case "/get_transaction_pool":
+		w.Header().Set("Content-Type", "application/json")
+		_ = utils.NewJSONEncoder(w).Encode(d.transactionPool())
+		return
+	case "/get_blocks.bin":
+		d.serveBinary(w, r, d.getBlocksBin)
+		return
+	case "/get_hashes.bin":
+		d.serveBinary(w, r, d.getHashesBin)
+		return
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	var request requestEnvelope
+	if err := utils.NewJSONDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	response := rpc.ResponseEnvelope{
+		ID:      request.ID,
+		JSONRPC: "2.0",
+	}
+
+	result, err := d.handleRPC(request.Method, request.Params)
+	if err != nil {
+		var e *rpcError
+		if errors.As(err, &e) {
+			response.Error.Code = e.code
+		} else {
+			response.Error.Code = rpcErrorInternal
+		}
+		response.Error.Message = err.Error()
+	} else {
+		response.Result = result
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = utils.NewJSONEncoder(w).Encode(&response)
+}
+
+func decodeParams(params json.RawMessage, v any) error {
+	if len(params) == 0 {
+		return &rpcError{code: rpcErrorInvalidParams, message: "missing params"}
+	}
+	if err := utils.UnmarshalJSON(params, v); err != nil {
+		return &rpcError{code: rpcErrorInvalidParams, message: err.Error()}
+	}
+	return nil
+}
+
+var okFooter = daemon.RPCResultFooter{Status: "OK"}
+
+func (d *Daemon) handleRPC(method string, params json.RawMessage) (any, error) {
+	switch method {
+	case "get_miner_data":
+		if d.cfg.NoMinerData {
+			return nil, &rpcError{code: rpcErrorMethodNotFound, message: "Method not found"}
+		}
+		data := d.MinerData()
+		return &daemon.GetMinerDataResult{
+			MajorVersion:          data.MajorVersion,
+			Height:                data.Height,
+			PrevId:                data.PrevId,
+			SeedHash:              data.SeedHash,
+			Difficulty:            data.Difficulty,
+			MedianWeight:          data.MedianWeight,
+			AlreadyGeneratedCoins: data.AlreadyGeneratedCoins,
+			MedianTimestamp:       data.MedianTimestamp,
+			TxBacklog:             data.TxBacklog,
+		}, nil
+	case "get_version":
+		d.lock.RLock()
+		defer d.lock.RUnlock()
+		return &daemon.GetVersionResult{
+			Release:       true,
+			Version:       rpcVersion,
+			CurrentHeight: uint64(len(d.chain)),
+			TargetHeight:  uint64(len(d.chain)),
+			HardForks: []daemon.HardForkEntry{
+				{Version: uint64(d.cfg.MajorVersion), Height: 0},
+			},
+			RPCResultFooter: okFooter,
+		}, nil
+	case "get_last_block_header":
+		d.lock.RLock()
+		defer d.lock.RUnlock()
+		return &daemon.GetLastBlockHeaderResult{
+			BlockHeader:     d.header(d.chain[len(d.chain)-1]),
+			RPCResultFooter: okFooter,
+		}, nil
+	case "get_block_header_by_height":
+		var p struct {
+			Height uint64 `json:"height"`
+		}
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		d.lock.RLock()
+		defer d.lock.RUnlock()
+		if p.Height >= uint64(len(d.chain)) {
+			return nil, &rpcError{code: rpcErrorTooBigHeight, message: fmt.Sprintf("Requested block height: %d greater than current top block height: %d", p.Height, len(d.chain)-1)}
+		}
+		return &daemon.GetBlockHeaderByHeightResult{
+			BlockHeader:     d.header(d.chain[p.Height]),
+			RPCResultFooter: okFooter,
+		}, nil
+	case "get_block_header_by_hash":
+		var p struct {
+			Hash   types.Hash   `json:"hash"`
+			Hashes []types.Hash `json:"hashes"`
+		}
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		d.lock.RLock()
+		defer d.lock.RUnlock()
+		result := &daemon.GetBlockHeaderByHashResult{
+			RPCResultFooter: okFooter,
+		}
+		if p.Hash != types.ZeroHash {
+			b, ok := d.byId[p.Hash]
+			if !ok {
+				return nil, &rpcError{code: rpcErrorBlockNotFound, message: "Internal error: can't get block by hash. Hash = " + p.Hash.String() + "."}
+			}
+			result.BlockHeader = d.header(b)
+		}
+		for _, h := range p.Hashes {
+			b, ok := d.byId[h]
+			if !ok {
+				return nil, &rpcError{code: rpcErrorBlockNotFound, message: "Internal error: can't get block by hash. Hash = " + h.String() + "."}
+			}
+			result.BlockHeaders = append(result.BlockHeaders, d.header(b))
+		}
+		return result, nil
+	case "get_block":
+		var p daemon.GetBlockRequestParameters
+		if len(params) > 0 {
+			if err := decodeParams(params, &p); err != nil {
+				return nil, err
+			}
+		}
+		d.lock.RLock()
+		defer d.lock.RUnlock()
+		var b *Block
+		if p.Hash != types.ZeroHash {
+			var ok bool
+			if b, ok = d.byId[p.Hash]; !ok {
+				return nil, &rpcError{code: rpcErrorBlockNotFound, message: "Internal error: can't get block by hash. Hash = " + p.Hash.String() + "."}
+			}
+		} else if p.Height < uint64(len(d.chain)) {
+			b = d.chain[p.Height]
+		} else {
+			return nil, &rpcError{code: rpcErrorTooBigHeight, message: fmt.Sprintf("Requested block height: %d greater than current top block height: %d", p.Height, len(d.chain)-1)}
+		}
+		return &daemon.GetBlockResult{
+			Blob:            b.Blob,
+			BlockHeader:     d.header(b),
+			MinerTxHash:     b.Block.Coinbase.Hash(),
+			RPCResultFooter: okFooter,
+		}, nil
+	case "get_block_headers_range":
+		var p struct {
+			StartHeight uint64 `json:"start_height"`
+			EndHeight   uint64 `json:"end_height"`
+		}
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		d.lock.RLock()
+		defer d.lock.RUnlock()
+		if p.StartHeight > p.EndHeight || p.EndHeight >= uint64(len(d.chain)) {
+			return nil, &rpcError{code: rpcErrorTooBigHeight, message: "Invalid start/end heights."}
+		}
+		result := &daemon.GetBlockHeadersRangeResult{
+			Headers:         make([]daemon.BlockHeader, 0, p.EndHeight-p.StartHeight+1),
+			RPCResultFooter: okFooter,
+		}
+		for _, b := range d.chain[p.StartHeight : p.EndHeight+1] {
+			result.Headers = append(result.Headers, d.header(b))
+		}
+		return result, nil
+	case "get_info":
+		d.lock.RLock()
+		defer d.lock.RUnlock()
+		tip := d.chain[len(d.chain)-1]
+		return &daemon.GetInfoResult{
+			BlockWeightMedian:         MedianWeight,
+			CumulativeDifficulty:      int64(tip.CumulativeDifficulty.Lo),
+			CumulativeDifficultyTop64: tip.CumulativeDifficulty.Hi,
+			Difficulty:                d.cfg.Difficulty.Lo,
+			DifficultyTop64:           d.cfg.Difficulty.Hi,
+			Height:                    uint64(len(d.chain)),
+			HeightWithoutBootstrap:    uint64(len(d.chain)),
+			Mainnet:                   true,
+			Nettype:                   "mainnet",
+			Synchronized:              true,
+			Target:                    BlockTime,
+			TargetHeight:              uint64(len(d.chain)),
+			TopBlockHash:              tip.Id,
+			TxPoolSize:                uint64(len(d.mempool)),
+			Version:                   "fakemonerod",
+			WideCumulativeDifficulty:  "0x" + tip.CumulativeDifficulty.String(),
+			WideDifficulty:            "0x" + d.cfg.Difficulty.String(),
+			RPCResultFooter:           okFooter,
+		}, nil
+	case "get_block_template":
+		var p struct {
+			WalletAddress string `json:"wallet_address"`
+			ReserveSize   int    `json:"reserve_size"`
+		}
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		if p.ReserveSize < 0 || p.ReserveSize > 255 {
+			return nil, &rpcError{code: rpcErrorInvalidParams, message: "Too big reserved size, maximum 255"}
+		}
+		return d.blockTemplate(p.ReserveSize)
+	case "submit_block":
+		var blobs []types.Bytes
+		if err := decodeParams(params, &blobs); err != nil {
+			return nil, err
+		}
+		if len(blobs) != 1 {
+			return nil, &rpcError{code: rpcErrorWrongBlockblob, message: "Wrong param"}
+		}
+		if err := d.SubmitBlock(blobs[0]); err != nil {
+			return nil, &rpcError{code: rpcErrorBlockNotAccepted, message: "Block not accepted: " + err.Error()}
+		}
+		return &daemon.SubmitBlockResult{Status: "OK"}, nil
+	default:
+		return nil, &rpcError{code: rpcErrorMethodNotFound, message: "Method not found"}
+	}
+}
+
+// header Returns the RPC header of b. Must be called with lock held
+func (d *Daemon) header(b *Block) daemon.BlockHeader {
+	return daemon.BlockHeader{
+		BlockSize:                 uint64(len(b.Blob)),
+		BlockWeight:               uint64(len(b.Blob)),
+		CumulativeDifficulty:      b.CumulativeDifficulty.Lo,
+		CumulativeDifficultyTop64: b.CumulativeDifficulty.Hi,
+		Depth:                     uint64(len(d.chain)) - 1 - b.Height,
+		Difficulty:                b.Difficulty.Lo,
+		DifficultyTop64:           b.Difficulty.Hi,
+		Hash:                      b.Id,
+		Height:                    b.Height,
+		LongTermWeight:            uint64(len(b.Blob)),
+		MajorVersion:              uint(b.Block.MajorVersion),
+		MinerTxHash:               b.Block.Coinbase.Hash(),
+		MinorVersion:              uint(b.Block.MinorVersion),
+		Nonce:                     uint64(b.Block.Nonce),
+		NumTxes:                   uint(len(b.Block.Transactions)),
+		PrevHash:                  b.Block.PreviousId,
+		Reward:                    b.Reward,
+		Timestamp:                 int64(b.Block.Timestamp),
+		WideCumulativeDifficulty:  "0x" + b.CumulativeDifficulty.String(),
+		WideDifficulty:            "0x" + b.Difficulty.String(),
+	}
+}
+
+// blockTemplate Returns a template for the next block including the mempool, with reserveSize bytes reserved in the coinbase extra nonce
+// The wallet address is ignored, the coinbase output is synthetic.
+func (d *Daemon) blockTemplate(reserveSize int) (*daemon.GetBlockTemplateResult, error) {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+
+	txs := make([]types.Hash, 0, len(d.mempool))
+	for _, e := range d.mempool {
+		txs = append(txs, e.Id)
+	}
+	b := d.nextBlock(txs, reserveSize)
+	blob, err := b.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	// the nonce tag is the last extra tag, followed by the RCT type byte and the transaction list
+	reservedOffset := len(blob) - reserveSize - 1 - utils.UVarInt64Size(len(txs)) - len(txs)*types.HashSize
+
+	return &daemon.GetBlockTemplateResult{
+		BlockhashingBlob:  b.HashingBlob(nil),
+		BlocktemplateBlob: blob,
+		Difficulty:        int64(d.cfg.Difficulty.Lo),
+		ExpectedReward:    int64(b.Coinbase.TotalReward()),
+		Height:            int(b.Coinbase.MinerGenHeight),
+		PrevHash:          b.PreviousId,
+		ReservedOffset:    reservedOffset,
+		SeedHash:          d.chain[randomx.SeedHeight(uint64(len(d.chain)))].Id,
+		RPCResultFooter:   okFooter,
+	}, nil
+}
+
+// transactionPool Returns the mempool as get_transaction_pool
+func (d *Daemon) transactionPool() *daemon.GetTransactionPoolResult {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+
+	result := &daemon.GetTransactionPoolResult{
+		Status: "OK",
+	}
+	result.Transactions = slices.Grow(result.Transactions, len(d.mempool))[:len(d.mempool)]
+	for i, e := range d.mempool {
+		tx := &result.Transactions[i]
+		tx.BlobSize = e.BlobSize
+		tx.Fee = e.Fee
+		tx.IDHash = e.Id
+		tx.ReceiveTime = e.TimeReceivedMilli / 1000
+		tx.Relayed = true
+		tx.Weight = e.Weight
+	}
+	return result
+}
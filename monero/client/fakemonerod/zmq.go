@@ -0,0 +1,172 @@
+package fakemonerod
+
+import (
+	"context"
+	"errors"
+
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/client/zmq"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/transaction"
+	"git.gammaspectra.live/P2Pool/consensus/v5/p2pool/mempool"
+	"git.gammaspectra.live/P2Pool/consensus/v5/types"
+	"git.gammaspectra.live/P2Pool/consensus/v5/utils"
+	"git.gammaspectra.live/P2Pool/zmq4"
+)
+
+// chainMainOutput Output as encoded by monerod in json-full-chain_main
+type chainMainOutput struct {
+	Amount      uint64 `json:"amount"`
+	ToTaggedKey *struct {
+		Key     types.Hash  `json:"key"`
+		ViewTag types.Bytes `json:"view_tag"`
+	} `json:"to_tagged_key,omitempty"`
+	ToKey *struct {
+		Key types.Hash `json:"key"`
+	} `json:"to_key,omitempty"`
+}
+
+type chainMainInput struct {
+	Gen struct {
+		Height uint64 `json:"height"`
+	} `json:"gen"`
+}
+
+// chainMain Block as encoded by monerod in json-full-chain_main, decodable as zmq.FullChainMain
+type chainMain struct {
+	MajorVersion uint8      `json:"major_version"`
+	MinorVersion uint8      `json:"minor_version"`
+	Timestamp    uint64     `json:"timestamp"`
+	PrevID       types.Hash `json:"prev_id"`
+	Nonce        uint32     `json:"nonce"`
+	MinerTx      struct {
+		Version    uint8             `json:"version"`
+		UnlockTime uint64            `json:"unlock_time"`
+		Inputs     []chainMainInput  `json:"inputs"`
+		Outputs    []chainMainOutput `json:"outputs"`
+		Extra      types.Bytes       `json:"extra"`
+		Signatures []any             `json:"signatures"`
+		Ringct     struct {
+			Type        int    `json:"type"`
+			Encrypted   []any  `json:"encrypted"`
+			Commitments []any  `json:"commitments"`
+			Fee         uint64 `json:"fee"`
+		} `json:"ringct"`
+	} `json:"miner_tx"`
+	TxHashes []types.Hash `json:"tx_hashes"`
+}
+
+func newChainMain(b *Block) (c chainMain) {
+	c.MajorVersion = b.Block.MajorVersion
+	c.MinorVersion = b.Block.MinorVersion
+	c.Timestamp = b.Block.Timestamp
+	c.PrevID = b.Block.PreviousId
+	c.Nonce = b.Block.Nonce
+
+	coinbase := &b.Block.Coinbase
+	c.MinerTx.Version = coinbase.Version()
+	c.MinerTx.UnlockTime = coinbase.MinerUnlockTime
+	c.MinerTx.Inputs = make([]chainMainInput, 1)
+	c.MinerTx.Inputs[0].Gen.Height = coinbase.MinerGenHeight
+	for _, o := range coinbase.MinerOutputs {
+		out := chainMainOutput{Amount: o.Amount}
+		switch o.Type {
+		case transaction.TxOutToTaggedKey:
+			out.ToTaggedKey = &struct {
+				Key     types.Hash  `json:"key"`
+				ViewTag types.Bytes `json:"view_tag"`
+			}{Key: types.Hash(o.EphemeralPublicKey), ViewTag: o.ViewTag.Slice()[:1]}
+		default:
+			out.ToKey = &struct {
+				Key types.Hash `json:"key"`
+			}{Key: types.Hash(o.EphemeralPublicKey)}
+		}
+		c.MinerTx.Outputs = append(c.MinerTx.Outputs, out)
+	}
+	c.MinerTx.Extra, _ = coinbase.Extra.MarshalBinary()
+	c.MinerTx.Signatures = []any{}
+	c.MinerTx.Ringct.Encrypted = []any{}
+	c.MinerTx.Ringct.Commitments = []any{}
+	c.TxHashes = append([]types.Hash{}, b.Block.Transactions...)
+	return c
+}
+
+// listenZMQ Creates the publisher socket and listens on endpoint
+func (d *Daemon) listenZMQ(endpoint string) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	pub := zmq4.NewPub(ctx)
+	if err := pub.Listen(endpoint); err != nil {
+		cancel()
+		_ = pub.Close()
+		return err
+	}
+	d.pub = pub
+	d.cancel = cancel
+	return nil
+}
+
+// closeZMQ Closes the publisher socket if open, must be called with pubLock held
+func (d *Daemon) closeZMQ() error {
+	if d.pub == nil {
+		return nil
+	}
+	d.cancel()
+	err := d.pub.Close()
+	d.pub = nil
+	d.cancel = nil
+	return err
+}
+
+// StopZMQ Closes the publisher, disconnecting all subscribers as a monerod restart would
+// Events happening while stopped are not published.
+func (d *Daemon) StopZMQ() error {
+	d.pubLock.Lock()
+	defer d.pubLock.Unlock()
+	return d.closeZMQ()
+}
+
+// StartZMQ Listens again on the endpoint returned by ZMQAddress after StopZMQ
+func (d *Daemon) StartZMQ() error {
+	if d.zmqAddress == "" {
+		return errors.New("zmq is disabled")
+	}
+	d.pubLock.Lock()
+	defer d.pubLock.Unlock()
+	if d.pub != nil {
+		return errors.New("zmq is already started")
+	}
+	return d.listenZMQ(d.zmqAddress)
+}
+
+func (d *Daemon) publish(topic zmq.Topic, v any) {
+	if d.zmqAddress == "" {
+		return
+	}
+	data, err := utils.MarshalJSON(v)
+	if err != nil {
+		utils.Panic(err)
+	}
+
+	d.pubLock.Lock()
+	defer d.pubLock.Unlock()
+	if d.pub == nil {
+		// stopped
+		return
+	}
+	// PUB sockets drop messages without subscribers, so errors are not relevant here
+	_ = d.pub.Send(zmq4.NewMsg(append([]byte(string(topic)+":"), data...)))
+}
+
+// publishBlock Publishes json-full-chain_main for a new tip, followed by json-full-miner_data for the next height
+func (d *Daemon) publishBlock(b *Block) {
+	d.publish(zmq.TopicFullChainMain, []chainMain{newChainMain(b)})
+	d.PublishMinerData()
+}
+
+func (d *Daemon) publishTxPoolAdd(entries mempool.Mempool) {
+	d.publish(zmq.TopicMinimalTxPoolAdd, entries)
+}
+
+// PublishMinerData Publishes json-full-miner_data for the current tip
+// Useful to resend state to subscribers that connected after the last block.
+func (d *Daemon) PublishMinerData() {
+	d.publish(zmq.TopicFullMinerData, d.MinerData())
+}
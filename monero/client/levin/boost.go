@@ -3,6 +3,7 @@ package levin
 import (
 	"encoding/binary"
 	"fmt"
+	"math"
 )
 
 const (
@@ -85,6 +86,49 @@ func (v BoostInt64) Bytes() ([]byte, error) {
 	return b, nil
 }
 
+type BoostInt8 int8
+
+func (v BoostInt8) Bytes() ([]byte, error) {
+	return []byte{
+		BoostSerializeTypeInt8,
+		byte(v),
+	}, nil
+}
+
+type BoostInt16 int16
+
+func (v BoostInt16) Bytes() ([]byte, error) {
+	b := []byte{
+		BoostSerializeTypeInt16,
+		0x00, 0x00,
+	}
+	binary.LittleEndian.PutUint16(b[1:], uint16(v))
+	return b, nil
+}
+
+type BoostInt32 int32
+
+func (v BoostInt32) Bytes() ([]byte, error) {
+	b := []byte{
+		BoostSerializeTypeInt32,
+		0x00, 0x00, 0x00, 0x00,
+	}
+	binary.LittleEndian.PutUint32(b[1:], uint32(v))
+	return b, nil
+}
+
+type BoostDouble float64
+
+func (v BoostDouble) Bytes() ([]byte, error) {
+	b := []byte{
+		BoostSerializeTypeDouble,
+		0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00,
+	}
+	binary.LittleEndian.PutUint64(b[1:], math.Float64bits(float64(v)))
+	return b, nil
+}
+
 type BoostUint64 uint64
 
 func (v BoostUint64) Bytes() ([]byte, error) {
@@ -113,3 +157,40 @@ func (v BoostString) Bytes() ([]byte, error) {
 	b = append(b, []byte(v)...)
 	return b, nil
 }
+
+type BoostUint64Array []uint64
+
+func (v BoostUint64Array) Bytes() ([]byte, error) {
+	varInB, err := VarIn(len(v))
+	if err != nil {
+		return nil, fmt.Errorf("varin '%d': %w", len(v), err)
+	}
+	b := make([]byte, 1, 1+len(varInB)+len(v)*8)
+	b[0] = BoostSerializeTypeUint64 | BoostSerializeFlagArray
+	b = append(b, varInB...)
+	for _, e := range v {
+		b = binary.LittleEndian.AppendUint64(b, e)
+	}
+	return b, nil
+}
+
+type BoostSectionArray []Section
+
+func (v BoostSectionArray) Bytes() ([]byte, error) {
+	varInB, err := VarIn(len(v))
+	if err != nil {
+		return nil, fmt.Errorf("varin '%d': %w", len(v), err)
+	}
+	b := make([]byte, 1, 1+len(varInB))
+	b[0] = BoostSerializeTypeObject | BoostSerializeFlagArray
+	b = append(b, varInB...)
+	for _, s := range v {
+		data, err := s.Bytes()
+		if err != nil {
+			return nil, err
+		}
+		// skip object type, it is part of the array type
+		b = append(b, data[1:]...)
+	}
+	return b, nil
+}
@@ -13,6 +13,9 @@ import (
 
 const DialTimeout = 15 * time.Second
 
+// WriteTimeout Deadline for each message written by LightNode and Server connections
+const WriteTimeout = 30 * time.Second
+
 type Client struct {
 	conn net.Conn
 }
@@ -51,6 +54,13 @@ func NewClient(ctx context.Context, addr string, opts ...ClientOption) (*Client,
 	}, nil
 }
 
+// NewClientFromConn Wraps an already established connection
+func NewClientFromConn(conn net.Conn) *Client {
+	return &Client{
+		conn: conn,
+	}
+}
+
 func (c *Client) Close() error {
 	if c.conn == nil {
 		return nil
@@ -52,6 +52,25 @@ const (
 	CommandSupportFlags uint32 = 1007
 )
 
+const (
+	// cryptonote protocol notifications, see cryptonote_protocol_defs.h
+
+	NotifyNewBlock               uint32 = 2001
+	NotifyNewTransactions        uint32 = 2002
+	NotifyRequestGetObjects      uint32 = 2003
+	NotifyResponseGetObjects     uint32 = 2004
+	NotifyRequestChain           uint32 = 2006
+	NotifyResponseChainEntry     uint32 = 2007
+	NotifyNewFluffyBlock         uint32 = 2008
+	NotifyRequestFluffyMissingTx uint32 = 2009
+	NotifyGetTxPoolComplement    uint32 = 2010
+)
+
+const (
+	// P2PSupportFlagFluffyBlocks Peer accepts NotifyNewFluffyBlock
+	P2PSupportFlagFluffyBlocks uint32 = 0x01
+)
+
 var (
 	MainnetNetworkId = []byte{
 		0x12, 0x30, 0xf1, 0x71,
@@ -60,11 +79,27 @@ var (
 		0x16, 0xa1, 0xa1, 0x10,
 	}
 
+	TestnetNetworkId = []byte{
+		0x12, 0x30, 0xf1, 0x71,
+		0x61, 0x04, 0x41, 0x61,
+		0x17, 0x31, 0x00, 0x82,
+		0x16, 0xa1, 0xa1, 0x11,
+	}
+
+	StagenetNetworkId = []byte{
+		0x12, 0x30, 0xf1, 0x71,
+		0x61, 0x04, 0x41, 0x61,
+		0x17, 0x31, 0x00, 0x82,
+		0x16, 0xa1, 0xa1, 0x12,
+	}
+
 	MainnetGenesisTx = "418015bb9ae982a1975da7d79277c2705727a56894ba0fb246adaabb1f4632e3"
 )
 
 func IsValidCommand(c uint32) bool {
-	return (c >= CommandHandshake && c <= CommandSupportFlags)
+	return (c >= CommandHandshake && c <= CommandSupportFlags) ||
+		// 2005 is not assigned
+		(c >= NotifyNewBlock && c <= NotifyGetTxPoolComplement && c != 2005)
 }
 
 // Header Layout
@@ -153,6 +188,32 @@ func NewRequestHeader(command uint32, length uint64) *Header {
 	}
 }
 
+// NewNotifyHeader Creates a header for a one-way notification, which is not replied to
+func NewNotifyHeader(command uint32, length uint64) *Header {
+	return &Header{
+		Signature:       LevinSignature,
+		Length:          length,
+		ExpectsResponse: false,
+		Command:         command,
+		ReturnCode:      0,
+		Flags:           LevinPacketRequest,
+		Version:         LevinProtocolVersion,
+	}
+}
+
+// NewResponseHeader Creates a header replying to a request with the given return code
+func NewResponseHeader(command uint32, length uint64, returnCode int32) *Header {
+	return &Header{
+		Signature:       LevinSignature,
+		Length:          length,
+		ExpectsResponse: false,
+		Command:         command,
+		ReturnCode:      returnCode,
+		Flags:           LevinPacketReponse,
+		Version:         LevinProtocolVersion,
+	}
+}
+
 func NewHeaderFromBytesBytes(bytes []byte) (*Header, error) {
 	if len(bytes) != LevinHeaderSizeBytes {
 		return nil, fmt.Errorf("invalid header size: expected %d, has %d",
@@ -0,0 +1,466 @@
+package levin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	unsafeRandom "math/rand/v2" //nolint:depguard
+	"sync"
+	"time"
+
+	"git.gammaspectra.live/P2Pool/consensus/v5/types"
+	"git.gammaspectra.live/P2Pool/consensus/v5/utils"
+)
+
+// Message A single levin frame, header and payload
+type Message struct {
+	Header  *Header
+	Payload []byte
+}
+
+// ReadMessage Reads a single levin frame, rejecting payloads larger than maxSize
+func ReadMessage(r io.Reader, maxSize uint64) (*Message, error) {
+	var headerBuf [LevinHeaderSizeBytes]byte
+	if _, err := utils.ReadFullNoEscape(r, headerBuf[:]); err != nil {
+		return nil, fmt.Errorf("read full header: %w", err)
+	}
+
+	header, err := NewHeaderFromBytesBytes(headerBuf[:])
+	if err != nil {
+		return nil, fmt.Errorf("new header from bytes: %w", err)
+	}
+
+	if header.Length > maxSize {
+		return nil, fmt.Errorf("payload too large: %d > %d", header.Length, maxSize)
+	}
+
+	payload := make([]byte, header.Length)
+	if _, err := utils.ReadFullNoEscape(r, payload); err != nil {
+		return nil, fmt.Errorf("read full payload: %w", err)
+	}
+
+	return &Message{
+		Header:  header,
+		Payload: payload,
+	}, nil
+}
+
+// WriteMessage Writes header and payload as a single write. header.Length is set from the payload
+func WriteMessage(w io.Writer, header *Header, payload []byte) error {
+	header.Length = uint64(len(payload))
+	buf := make([]byte, 0, LevinHeaderSizeBytes+len(payload))
+	buf = append(buf, header.Bytes()...)
+	buf = append(buf, payload...)
+	if _, err := w.Write(buf); err != nil {
+		return fmt.Errorf("write: %w", err)
+	}
+	return nil
+}
+
+type LightNodeConfig struct {
+	// NetworkId Defaults to MainnetNetworkId
+	NetworkId []byte
+	// PeerId Random if zero
+	PeerId uint64
+
+	// SyncData Returns the chain state sent on handshake and timed sync. Required
+	// Peers only relay blocks and transactions once they know TopId, so this should follow the current Monero tip.
+	SyncData func() CoreSyncData
+
+	// OnFluffyBlock Called from the read loop for each block relayed by the peer
+	OnFluffyBlock func(b *NewFluffyBlock)
+	// OnTransactions Called from the read loop for each transaction batch relayed by the peer
+	OnTransactions func(txs *NewTransactions)
+}
+
+// LightNode A Monero P2P peer without a chain of its own. It can receive relayed blocks and transactions,
+// request blocks and chain entries, and relay its own blocks and transactions.
+type LightNode struct {
+	client *Client
+	cfg    LightNodeConfig
+
+	peer     BasicNodeData
+	peerLock sync.RWMutex
+	peerSync CoreSyncData
+
+	writeLock sync.Mutex
+
+	// requestLock Serializes requests, as responses and notifications are not correlated
+	requestLock sync.Mutex
+	waitLock    sync.Mutex
+	waiting     map[uint32]chan *Message
+
+	fluffyLock sync.Mutex
+	fluffyId   types.Hash
+	fluffy     NewFluffyBlock
+
+	closed  chan struct{}
+	err     error
+	errOnce sync.Once
+}
+
+// NewLightNode Does a handshake over client and starts processing incoming messages
+// The node takes ownership of client, and closes it on Close or on read errors.
+func NewLightNode(ctx context.Context, client *Client, cfg LightNodeConfig) (*LightNode, error) {
+	if cfg.SyncData == nil {
+		return nil, errors.New("nil SyncData")
+	}
+	if cfg.NetworkId == nil {
+		cfg.NetworkId = MainnetNetworkId
+	}
+	if cfg.PeerId == 0 {
+		cfg.PeerId = unsafeRandom.Uint64()
+	}
+
+	n := &LightNode{
+		client:  client,
+		cfg:     cfg,
+		waiting: make(map[uint32]chan *Message),
+		closed:  make(chan struct{}),
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = client.conn.SetDeadline(deadline)
+	}
+
+	var response HandshakeResponse
+	if err := n.handshake(&response); err != nil {
+		_ = client.Close()
+		return nil, fmt.Errorf("handshake: %w", err)
+	}
+	_ = client.conn.SetDeadline(time.Time{})
+
+	if string(response.NodeData.NetworkId) != string(cfg.NetworkId) {
+		_ = client.Close()
+		return nil, errors.New("handshake: network id mismatch")
+	}
+
+	n.peer = response.NodeData
+	n.peerSync = response.PayloadData
+
+	go n.readLoop()
+
+	return n, nil
+}
+
+func (n *LightNode) handshake(response *HandshakeResponse) error {
+	payload, err := Marshal(&HandshakeRequest{
+		NodeData: BasicNodeData{
+			NetworkId:    n.cfg.NetworkId,
+			PeerId:       n.cfg.PeerId,
+			SupportFlags: P2PSupportFlagFluffyBlocks,
+		},
+		PayloadData: n.cfg.SyncData(),
+	})
+	if err != nil {
+		return err
+	}
+
+	if err = WriteMessage(n.client.conn, NewRequestHeader(CommandHandshake, 0), payload); err != nil {
+		return err
+	}
+
+	for {
+		msg, err := ReadMessage(n.client.conn, LevinPacketMaxInitialSize)
+		if err != nil {
+			return err
+		}
+		if msg.Header.Command != CommandHandshake || msg.Header.Flags&LevinPacketReponse == 0 {
+			// peers can send support flags requests before replying
+			if err = n.handle(msg); err != nil {
+				return err
+			}
+			continue
+		}
+		if msg.Header.ReturnCode < LevinOk {
+			return fmt.Errorf("return code %d", msg.Header.ReturnCode)
+		}
+		return Unmarshal(msg.Payload, response)
+	}
+}
+
+// Peer Returns the identity of the remote node
+func (n *LightNode) Peer() BasicNodeData {
+	return n.peer
+}
+
+// PeerSyncData Returns the last chain state received from the remote node
+func (n *LightNode) PeerSyncData() CoreSyncData {
+	n.peerLock.RLock()
+	defer n.peerLock.RUnlock()
+	return n.peerSync
+}
+
+// Done Closed once the connection is closed
+func (n *LightNode) Done() <-chan struct{} {
+	return n.closed
+}
+
+// Err Returns the error that closed the connection, if any
+func (n *LightNode) Err() error {
+	select {
+	case <-n.closed:
+		return n.err
+	default:
+		return nil
+	}
+}
+
+func (n *LightNode) Close() error {
+	n.close(nil)
+	return nil
+}
+
+func (n *LightNode) close(err error) {
+	n.errOnce.Do(func() {
+		n.err = err
+		_ = n.client.Close()
+		close(n.closed)
+	})
+}
+
+func (n *LightNode) write(header *Header, v any) error {
+	payload, err := Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	n.writeLock.Lock()
+	defer n.writeLock.Unlock()
+	_ = n.client.conn.SetWriteDeadline(time.Now().Add(WriteTimeout))
+	if err = WriteMessage(n.client.conn, header, payload); err != nil {
+		n.close(err)
+		return err
+	}
+	return nil
+}
+
+// Notify Sends a one-way notification
+func (n *LightNode) Notify(command uint32, v any) error {
+	return n.write(NewNotifyHeader(command, 0), v)
+}
+
+// request Sends a request, and waits for a message with responseCommand
+// For invoke commands the response shares the request command, for notifications it's a different notification.
+func (n *LightNode) request(ctx context.Context, header *Header, v any, responseCommand uint32, response any) error {
+	n.requestLock.Lock()
+	defer n.requestLock.Unlock()
+
+	ch := make(chan *Message, 1)
+	n.waitLock.Lock()
+	n.waiting[responseCommand] = ch
+	n.waitLock.Unlock()
+	defer func() {
+		n.waitLock.Lock()
+		defer n.waitLock.Unlock()
+		delete(n.waiting, responseCommand)
+	}()
+
+	if err := n.write(header, v); err != nil {
+		return err
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-n.closed:
+		if n.err != nil {
+			return n.err
+		}
+		return io.ErrClosedPipe
+	case msg := <-ch:
+		if msg.Header.ReturnCode < LevinOk {
+			return fmt.Errorf("command %d: return code %d", responseCommand, msg.Header.ReturnCode)
+		}
+		return Unmarshal(msg.Payload, response)
+	}
+}
+
+// deliver Passes a message to a waiting request. Returns false if none was waiting
+func (n *LightNode) deliver(msg *Message) bool {
+	n.waitLock.Lock()
+	defer n.waitLock.Unlock()
+	if ch, ok := n.waiting[msg.Header.Command]; ok {
+		delete(n.waiting, msg.Header.Command)
+		ch <- msg
+		return true
+	}
+	return false
+}
+
+// TimedSync Exchanges chain state with the peer
+func (n *LightNode) TimedSync(ctx context.Context) (*CoreSyncData, error) {
+	var response TimedSyncResponse
+	if err := n.request(ctx, NewRequestHeader(CommandTimedSync, 0), &TimedSyncRequest{
+		PayloadData: n.cfg.SyncData(),
+	}, CommandTimedSync, &response); err != nil {
+		return nil, err
+	}
+	n.setPeerSync(response.PayloadData)
+	return &response.PayloadData, nil
+}
+
+// RequestObjects Requests full blocks by id
+func (n *LightNode) RequestObjects(ctx context.Context, ids []types.Hash, prune bool) (*ResponseGetObjects, error) {
+	var response ResponseGetObjects
+	if err := n.request(ctx, NewNotifyHeader(NotifyRequestGetObjects, 0), &RequestGetObjects{
+		Blocks: ids,
+		Prune:  prune,
+	}, NotifyResponseGetObjects, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// RequestChain Requests block ids following the first known id in blockIds
+// blockIds is a sparse list of known block ids ordered from most recent, ending with the genesis block id.
+func (n *LightNode) RequestChain(ctx context.Context, blockIds []types.Hash, prune bool) (*ResponseChainEntry, error) {
+	var response ResponseChainEntry
+	if err := n.request(ctx, NewNotifyHeader(NotifyRequestChain, 0), &RequestChain{
+		BlockIds: blockIds,
+		Prune:    prune,
+	}, NotifyResponseChainEntry, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// SendTransactions Relays transaction blobs to the peer, in fluff mode
+func (n *LightNode) SendTransactions(txs ...[]byte) error {
+	return n.Notify(NotifyNewTransactions, &NewTransactions{
+		Transactions:   txs,
+		DandelionFluff: true,
+	})
+}
+
+// SendFluffyBlock Relays a block with the given id and height, without its transactions
+// txs are the transaction blobs of the block in order, and are sent when the peer requests them as missing.
+func (n *LightNode) SendFluffyBlock(id types.Hash, height uint64, blob []byte, txs [][]byte) error {
+	entries := make([]TransactionBlobEntry, 0, len(txs))
+	for _, tx := range txs {
+		entries = append(entries, TransactionBlobEntry{Blob: tx})
+	}
+
+	n.fluffyLock.Lock()
+	n.fluffyId = id
+	n.fluffy = NewFluffyBlock{
+		Block: BlockCompleteEntry{
+			Block:        blob,
+			Transactions: entries,
+		},
+		CurrentBlockchainHeight: height + 1,
+	}
+	n.fluffyLock.Unlock()
+
+	return n.Notify(NotifyNewFluffyBlock, &NewFluffyBlock{
+		Block: BlockCompleteEntry{
+			Block: blob,
+		},
+		CurrentBlockchainHeight: height + 1,
+	})
+}
+
+func (n *LightNode) setPeerSync(data CoreSyncData) {
+	n.peerLock.Lock()
+	defer n.peerLock.Unlock()
+	n.peerSync = data
+}
+
+func (n *LightNode) readLoop() {
+	for {
+		msg, err := ReadMessage(n.client.conn, LevinPacketMaxDefaultSize)
+		if err != nil {
+			n.close(err)
+			return
+		}
+		if err = n.handle(msg); err != nil {
+			n.close(fmt.Errorf("command %d: %w", msg.Header.Command, err))
+			return
+		}
+	}
+}
+
+func (n *LightNode) reply(msg *Message, v any) error {
+	return n.write(NewResponseHeader(msg.Header.Command, 0, 1), v)
+}
+
+func (n *LightNode) handle(msg *Message) error {
+	if msg.Header.Flags&LevinPacketReponse != 0 {
+		// unrequested responses are ignored
+		n.deliver(msg)
+		return nil
+	}
+
+	switch msg.Header.Command {
+	case CommandTimedSync:
+		var request TimedSyncRequest
+		if err := Unmarshal(msg.Payload, &request); err != nil {
+			return err
+		}
+		n.setPeerSync(request.PayloadData)
+		return n.reply(msg, &TimedSyncResponse{
+			PayloadData: n.cfg.SyncData(),
+		})
+	case CommandPing:
+		return n.reply(msg, &PingResponse{
+			Status: "OK",
+			PeerId: n.cfg.PeerId,
+		})
+	case CommandSupportFlags:
+		return n.reply(msg, &SupportFlagsResponse{
+			SupportFlags: P2PSupportFlagFluffyBlocks,
+		})
+	case NotifyNewFluffyBlock:
+		var b NewFluffyBlock
+		if err := Unmarshal(msg.Payload, &b); err != nil {
+			return err
+		}
+		if n.cfg.OnFluffyBlock != nil {
+			n.cfg.OnFluffyBlock(&b)
+		}
+	case NotifyNewTransactions:
+		var txs NewTransactions
+		if err := Unmarshal(msg.Payload, &txs); err != nil {
+			return err
+		}
+		if n.cfg.OnTransactions != nil {
+			n.cfg.OnTransactions(&txs)
+		}
+	case NotifyRequestFluffyMissingTx:
+		var request RequestFluffyMissingTx
+		if err := Unmarshal(msg.Payload, &request); err != nil {
+			return err
+		}
+		return n.sendMissingTransactions(&request)
+	case NotifyResponseGetObjects, NotifyResponseChainEntry:
+		n.deliver(msg)
+	default:
+		// no chain to serve requests from
+		if msg.Header.ExpectsResponse {
+			return n.write(NewResponseHeader(msg.Header.Command, 0, LevinErrorConnectionHandlerNotDefined), struct{}{})
+		}
+	}
+	return nil
+}
+
+func (n *LightNode) sendMissingTransactions(request *RequestFluffyMissingTx) error {
+	n.fluffyLock.Lock()
+	if n.fluffyId != request.BlockHash {
+		n.fluffyLock.Unlock()
+		// not ours
+		return nil
+	}
+	b := n.fluffy
+	b.Block.Transactions = make([]TransactionBlobEntry, 0, len(request.MissingTxIndices))
+	for _, i := range request.MissingTxIndices {
+		if i >= uint64(len(n.fluffy.Block.Transactions)) {
+			n.fluffyLock.Unlock()
+			return fmt.Errorf("missing transaction index %d out of range", i)
+		}
+		b.Block.Transactions = append(b.Block.Transactions, n.fluffy.Block.Transactions[i])
+	}
+	n.fluffyLock.Unlock()
+
+	return n.Notify(NotifyNewFluffyBlock, &b)
+}
@@ -0,0 +1,228 @@
+package levin_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/client/levin"
+	"git.gammaspectra.live/P2Pool/consensus/v5/types"
+)
+
+func TestIsValidCommand(t *testing.T) {
+	for _, c := range []uint32{levin.CommandHandshake, levin.CommandSupportFlags, levin.NotifyNewBlock, levin.NotifyNewFluffyBlock, levin.NotifyGetTxPoolComplement} {
+		assertEqual(t, levin.IsValidCommand(c), true, c)
+	}
+	for _, c := range []uint32{0, 1000, 1008, 2000, 2005, 2011, 0xffffffff} {
+		assertEqual(t, levin.IsValidCommand(c), false, c)
+	}
+}
+
+func TestBlockCompleteEntry(t *testing.T) {
+	it(t, "unpruned transactions are blobs", func(t *testing.T) {
+		b := levin.NewFluffyBlock{
+			Block: levin.BlockCompleteEntry{
+				Block: []byte{1, 2, 3},
+				Transactions: []levin.TransactionBlobEntry{
+					{Blob: []byte{4, 5}},
+					{Blob: []byte{6}},
+				},
+			},
+			CurrentBlockchainHeight: 100,
+		}
+		data, err := levin.Marshal(&b)
+		assertNoError(t, err)
+
+		ps, err := levin.NewPortableStorageFromBytes(data)
+		assertNoError(t, err)
+		entry, ok := ps.Entries.Find("b")
+		assertEqual(t, ok, true)
+		txs, ok := entry.Entries().Find("txs")
+		assertEqual(t, ok, true)
+		assertEqual(t, txs.Entries()[0].String(), "\x04\x05")
+
+		var decoded levin.NewFluffyBlock
+		assertNoError(t, levin.Unmarshal(data, &decoded))
+		assertEqual(t, decoded, b)
+	})
+
+	it(t, "pruned transactions are objects", func(t *testing.T) {
+		b := levin.ResponseGetObjects{
+			Blocks: []levin.BlockCompleteEntry{
+				{
+					Pruned:      true,
+					Block:       []byte{1, 2, 3},
+					BlockWeight: 1000,
+					Transactions: []levin.TransactionBlobEntry{
+						{Blob: []byte{4, 5}, PrunableHash: types.Hash{1}},
+					},
+				},
+			},
+			MissedIds:               []types.Hash{{2}},
+			CurrentBlockchainHeight: 100,
+		}
+		data, err := levin.Marshal(&b)
+		assertNoError(t, err)
+
+		var decoded levin.ResponseGetObjects
+		assertNoError(t, levin.Unmarshal(data, &decoded))
+		assertEqual(t, decoded, b)
+	})
+}
+
+// fakePeer Plays the remote side of a light node connection
+type fakePeer struct {
+	t    *testing.T
+	conn net.Conn
+}
+
+func (p *fakePeer) read(v any) *levin.Message {
+	msg, err := levin.ReadMessage(p.conn, levin.LevinPacketMaxDefaultSize)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	if v != nil {
+		if err = levin.Unmarshal(msg.Payload, v); err != nil {
+			p.t.Fatal(err)
+		}
+	}
+	return msg
+}
+
+func (p *fakePeer) write(header *levin.Header, v any) {
+	payload, err := levin.Marshal(v)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	if err = levin.WriteMessage(p.conn, header, payload); err != nil {
+		p.t.Fatal(err)
+	}
+}
+
+func TestLightNode(t *testing.T) {
+	local, remote := net.Pipe()
+	defer remote.Close()
+	peer := &fakePeer{t: t, conn: remote}
+
+	syncData := levin.CoreSyncData{
+		CurrentHeight: 3000000,
+		TopId:         types.Hash{0xaa},
+		TopVersion:    16,
+	}
+
+	blocks := make(chan *levin.NewFluffyBlock, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	type result struct {
+		node *levin.LightNode
+		err  error
+	}
+	nodeResult := make(chan result, 1)
+	go func() {
+		node, err := levin.NewLightNode(ctx, levin.NewClientFromConn(local), levin.LightNodeConfig{
+			PeerId: 1,
+			SyncData: func() levin.CoreSyncData {
+				return syncData
+			},
+			OnFluffyBlock: func(b *levin.NewFluffyBlock) {
+				blocks <- b
+			},
+		})
+		nodeResult <- result{node, err}
+	}()
+
+	var handshake levin.HandshakeRequest
+	msg := peer.read(&handshake)
+	assertEqual(t, msg.Header.Command, levin.CommandHandshake)
+	assertEqual(t, handshake.NodeData.PeerId, uint64(1))
+	assertEqual(t, handshake.PayloadData, syncData)
+
+	peerData := levin.CoreSyncData{
+		CurrentHeight: 3000001,
+		TopId:         types.Hash{0xbb},
+		TopVersion:    16,
+	}
+	peer.write(levin.NewResponseHeader(levin.CommandHandshake, 0, 1), &levin.HandshakeResponse{
+		NodeData: levin.BasicNodeData{
+			NetworkId: levin.MainnetNetworkId,
+			PeerId:    2,
+		},
+		PayloadData: peerData,
+	})
+
+	r := <-nodeResult
+	assertNoError(t, r.err)
+	if r.err != nil {
+		return
+	}
+	node := r.node
+	defer node.Close()
+	assertEqual(t, node.Peer().PeerId, uint64(2))
+	assertEqual(t, node.PeerSyncData(), peerData)
+
+	it(t, "replies to timed sync", func(t *testing.T) {
+		peer.write(levin.NewRequestHeader(levin.CommandTimedSync, 0), &levin.TimedSyncRequest{PayloadData: peerData})
+		var response levin.TimedSyncResponse
+		msg := peer.read(&response)
+		assertEqual(t, msg.Header.Flags, levin.LevinPacketReponse)
+		assertEqual(t, response.PayloadData, syncData)
+	})
+
+	it(t, "receives fluffy blocks", func(t *testing.T) {
+		b := &levin.NewFluffyBlock{
+			Block:                   levin.BlockCompleteEntry{Block: []byte{1, 2, 3}},
+			CurrentBlockchainHeight: 3000002,
+		}
+		peer.write(levin.NewNotifyHeader(levin.NotifyNewFluffyBlock, 0), b)
+		assertEqual(t, <-blocks, b)
+	})
+
+	it(t, "requests chain", func(t *testing.T) {
+		entry := &levin.ResponseChainEntry{
+			StartHeight:  2999999,
+			TotalHeight:  3000002,
+			BlockIds:     []types.Hash{{0xaa}, {0xbb}, {0xcc}},
+			BlockWeights: []uint64{1000, 2000, 3000},
+			FirstBlock:   []byte{1, 2, 3},
+		}
+		go func() {
+			var request levin.RequestChain
+			peer.read(&request)
+			peer.write(levin.NewNotifyHeader(levin.NotifyResponseChainEntry, 0), entry)
+		}()
+		response, err := node.RequestChain(ctx, []types.Hash{{0xaa}}, true)
+		assertNoError(t, err)
+		assertEqual(t, response, entry)
+	})
+
+	it(t, "sends missing fluffy transactions", func(t *testing.T) {
+		go func() {
+			assertNoError(t, node.SendFluffyBlock(types.Hash{0xdd}, 3000002, []byte{7}, [][]byte{{1}, {2}, {3}}))
+		}()
+
+		var b levin.NewFluffyBlock
+		peer.read(&b)
+		assertEqual(t, len(b.Block.Transactions), 0)
+		assertEqual(t, b.CurrentBlockchainHeight, uint64(3000003))
+
+		peer.write(levin.NewNotifyHeader(levin.NotifyRequestFluffyMissingTx, 0), &levin.RequestFluffyMissingTx{
+			BlockHash:        types.Hash{0xdd},
+			MissingTxIndices: []uint64{0, 2},
+		})
+		peer.read(&b)
+		assertEqual(t, b.Block.Transactions, []levin.TransactionBlobEntry{{Blob: []byte{1}}, {Blob: []byte{3}}})
+	})
+
+	it(t, "closes on peer disconnect", func(t *testing.T) {
+		_ = remote.Close()
+		select {
+		case <-node.Done():
+		case <-time.After(time.Second * 5):
+			t.Fatal("not closed")
+		}
+		assertError(t, node.Err())
+	})
+}
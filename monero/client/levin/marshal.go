@@ -0,0 +1,549 @@
+package levin
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Marshal Encodes a struct as Portable Storage, including signatures and format version
+//
+// Fields are named via `levin:"name"` struct tags, or use the Go field name otherwise. A name of "-" skips the field.
+// Tag options are:
+//   - omitempty: skip the field if it has its zero value
+//   - blob: encode a slice of fixed size values as a single packed little endian string, as epee KV_SERIALIZE_CONTAINER_POD_AS_BLOB
+//
+// Supported types are bool, all integer widths, float64, string, []byte and [N]byte (as strings), structs and pointers to structs (as objects),
+// and slices of any of these (as arrays).
+func Marshal(v any) ([]byte, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return nil, errors.New("nil value")
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("unsupported root type %s", rv.Type())
+	}
+
+	buf := make([]byte, 0, 64)
+	buf = binary.LittleEndian.AppendUint32(buf, PortableStorageSignatureA)
+	buf = binary.LittleEndian.AppendUint32(buf, PortableStorageSignatureB)
+	buf = append(buf, PortableStorageFormatVersion)
+	return appendObject(buf, rv)
+}
+
+// Unmarshal Decodes Portable Storage into a struct pointer. See Marshal for supported types
+// Unknown entries are ignored, and fields without a matching entry are left untouched.
+func Unmarshal(data []byte, v any) error {
+	ps, err := NewPortableStorageFromBytes(data)
+	if err != nil {
+		return err
+	}
+	return UnmarshalEntries(ps.Entries, v)
+}
+
+// UnmarshalEntries Decodes already parsed entries into a struct pointer
+func UnmarshalEntries(entries Entries, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return errors.New("non-pointer or nil value")
+	}
+	rv = rv.Elem()
+	if rv.Kind() != reflect.Struct {
+		return fmt.Errorf("unsupported root type %s", rv.Type())
+	}
+	return decodeObject(entries, rv)
+}
+
+// Unmarshaler Implemented by types that decode themselves from a parsed Portable Storage value
+// value is one of the types returned by ReadAny
+type Unmarshaler interface {
+	UnmarshalLevin(value any) error
+}
+
+var unmarshalerType = reflect.TypeFor[Unmarshaler]()
+
+// Marshaler Implemented by types that encode as a different value, which is then encoded as per Marshal
+type Marshaler interface {
+	MarshalLevin() (any, error)
+}
+
+var marshalerType = reflect.TypeFor[Marshaler]()
+
+// marshalValue Returns the value to encode in place of fv, if it implements Marshaler
+func marshalValue(fv reflect.Value) (reflect.Value, error) {
+	if !fv.Type().Implements(marshalerType) || (fv.Kind() == reflect.Pointer && fv.IsNil()) {
+		return fv, nil
+	}
+	v, err := fv.Interface().(Marshaler).MarshalLevin()
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	if v == nil {
+		return reflect.Value{}, errors.New("nil value from MarshalLevin")
+	}
+	return reflect.ValueOf(v), nil
+}
+
+type fieldInfo struct {
+	index     []int
+	name      string
+	omitEmpty bool
+	blob      bool
+}
+
+var fieldCache sync.Map
+
+func typeFields(t reflect.Type) []fieldInfo {
+	if f, ok := fieldCache.Load(t); ok {
+		return f.([]fieldInfo)
+	}
+
+	var fields []fieldInfo
+	for _, sf := range reflect.VisibleFields(t) {
+		if !sf.IsExported() || sf.Anonymous {
+			continue
+		}
+		tag := sf.Tag.Get("levin")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = sf.Name
+		}
+		f := fieldInfo{
+			index: sf.Index,
+			name:  name,
+		}
+		for opt := range strings.SplitSeq(opts, ",") {
+			switch opt {
+			case "omitempty":
+				f.omitEmpty = true
+			case "blob":
+				f.blob = true
+			}
+		}
+		fields = append(fields, f)
+	}
+
+	fieldCache.Store(t, fields)
+	return fields
+}
+
+func isByteType(t reflect.Type) bool {
+	return t.Kind() == reflect.Uint8
+}
+
+// typeCode Returns the Portable Storage type for a Go type, without array flag
+func typeCode(t reflect.Type) (byte, error) {
+	switch t.Kind() {
+	case reflect.Bool:
+		return BoostSerializeTypeBool, nil
+	case reflect.Int8:
+		return BoostSerializeTypeInt8, nil
+	case reflect.Int16:
+		return BoostSerializeTypeInt16, nil
+	case reflect.Int32:
+		return BoostSerializeTypeInt32, nil
+	case reflect.Int64, reflect.Int:
+		return BoostSerializeTypeInt64, nil
+	case reflect.Uint8:
+		return BoostSerializeTypeUint8, nil
+	case reflect.Uint16:
+		return BoostSerializeTypeUint16, nil
+	case reflect.Uint32:
+		return BoostSerializeTypeUint32, nil
+	case reflect.Uint64, reflect.Uint:
+		return BoostSerializeTypeUint64, nil
+	case reflect.Float64:
+		return BoostSerializeTypeDouble, nil
+	case reflect.String:
+		return BoostSerializeTypeString, nil
+	case reflect.Slice, reflect.Array:
+		if isByteType(t.Elem()) {
+			return BoostSerializeTypeString, nil
+		}
+	case reflect.Struct:
+		return BoostSerializeTypeObject, nil
+	case reflect.Pointer:
+		if t.Elem().Kind() == reflect.Struct {
+			return BoostSerializeTypeObject, nil
+		}
+	default:
+	}
+	return 0, fmt.Errorf("unsupported type %s", t)
+}
+
+func appendVarIn(buf []byte, i int) ([]byte, error) {
+	b, err := VarIn(i)
+	if err != nil {
+		return nil, err
+	}
+	return append(buf, b...), nil
+}
+
+func appendObject(buf []byte, rv reflect.Value) ([]byte, error) {
+	fields := typeFields(rv.Type())
+
+	// count entries first
+	var count int
+	for _, f := range fields {
+		if !skipField(f, rv.FieldByIndex(f.index)) {
+			count++
+		}
+	}
+
+	var err error
+	if buf, err = appendVarIn(buf, count); err != nil {
+		return nil, err
+	}
+
+	for _, f := range fields {
+		fv := rv.FieldByIndex(f.index)
+		if skipField(f, fv) {
+			continue
+		}
+		if len(f.name) > math.MaxUint8 {
+			return nil, fmt.Errorf("field name %s too long", f.name)
+		}
+		buf = append(buf, uint8(len(f.name)))
+		buf = append(buf, f.name...)
+
+		if f.blob {
+			if buf, err = appendBlob(buf, fv); err != nil {
+				return nil, fmt.Errorf("%s: %w", f.name, err)
+			}
+		} else if buf, err = appendValue(buf, fv, true); err != nil {
+			return nil, fmt.Errorf("%s: %w", f.name, err)
+		}
+	}
+
+	return buf, nil
+}
+
+func skipField(f fieldInfo, fv reflect.Value) bool {
+	if fv.Kind() == reflect.Pointer && fv.IsNil() {
+		return true
+	}
+	return f.omitEmpty && fv.IsZero()
+}
+
+// appendBlob Packs a slice or array of fixed size values as a string
+func appendBlob(buf []byte, fv reflect.Value) ([]byte, error) {
+	if fv.Kind() != reflect.Slice && fv.Kind() != reflect.Array {
+		return nil, fmt.Errorf("unsupported blob type %s", fv.Type())
+	}
+	size := binary.Size(fv.Interface())
+	if size < 0 {
+		return nil, fmt.Errorf("unsupported blob type %s", fv.Type())
+	}
+	buf = append(buf, BoostSerializeTypeString)
+	var err error
+	if buf, err = appendVarIn(buf, size); err != nil {
+		return nil, err
+	}
+	return binary.Append(buf, binary.LittleEndian, fv.Interface())
+}
+
+func appendValue(buf []byte, fv reflect.Value, withType bool) ([]byte, error) {
+	fv, err := marshalValue(fv)
+	if err != nil {
+		return nil, err
+	}
+	t := fv.Type()
+
+	if (t.Kind() == reflect.Slice) && !isByteType(t.Elem()) {
+		if !withType {
+			return nil, errors.New("nested arrays are not supported")
+		}
+
+		// elements are marshaled first, as Marshaler types determine the array type
+		elements := make([]reflect.Value, fv.Len())
+		elemType := t.Elem()
+		for i := range elements {
+			if elements[i], err = marshalValue(fv.Index(i)); err != nil {
+				return nil, fmt.Errorf("[%d]: %w", i, err)
+			}
+			if i == 0 {
+				elemType = elements[i].Type()
+			} else if elements[i].Type() != elemType {
+				return nil, fmt.Errorf("[%d]: mixed array types %s and %s", i, elemType, elements[i].Type())
+			}
+		}
+
+		code, err := typeCode(elemType)
+		if err != nil {
+			return nil, err
+		}
+		buf = append(buf, code|BoostSerializeFlagArray)
+		if buf, err = appendVarIn(buf, len(elements)); err != nil {
+			return nil, err
+		}
+		for i := range elements {
+			if buf, err = appendValue(buf, elements[i], false); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	}
+
+	code, err := typeCode(t)
+	if err != nil {
+		return nil, err
+	}
+	if withType {
+		buf = append(buf, code)
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		if fv.Bool() {
+			return append(buf, 1), nil
+		}
+		return append(buf, 0), nil
+	case reflect.Int8:
+		return append(buf, uint8(fv.Int())), nil
+	case reflect.Int16:
+		return binary.LittleEndian.AppendUint16(buf, uint16(fv.Int())), nil
+	case reflect.Int32:
+		return binary.LittleEndian.AppendUint32(buf, uint32(fv.Int())), nil
+	case reflect.Int64, reflect.Int:
+		return binary.LittleEndian.AppendUint64(buf, uint64(fv.Int())), nil
+	case reflect.Uint8:
+		return append(buf, uint8(fv.Uint())), nil
+	case reflect.Uint16:
+		return binary.LittleEndian.AppendUint16(buf, uint16(fv.Uint())), nil
+	case reflect.Uint32:
+		return binary.LittleEndian.AppendUint32(buf, uint32(fv.Uint())), nil
+	case reflect.Uint64, reflect.Uint:
+		return binary.LittleEndian.AppendUint64(buf, fv.Uint()), nil
+	case reflect.Float64:
+		return binary.LittleEndian.AppendUint64(buf, math.Float64bits(fv.Float())), nil
+	case reflect.String:
+		if buf, err = appendVarIn(buf, fv.Len()); err != nil {
+			return nil, err
+		}
+		return append(buf, fv.String()...), nil
+	case reflect.Slice:
+		if buf, err = appendVarIn(buf, fv.Len()); err != nil {
+			return nil, err
+		}
+		return append(buf, fv.Bytes()...), nil
+	case reflect.Array:
+		if buf, err = appendVarIn(buf, fv.Len()); err != nil {
+			return nil, err
+		}
+		for i := range fv.Len() {
+			buf = append(buf, uint8(fv.Index(i).Uint()))
+		}
+		return buf, nil
+	case reflect.Pointer:
+		if fv.IsNil() {
+			return nil, errors.New("nil pointer in array")
+		}
+		return appendObject(buf, fv.Elem())
+	case reflect.Struct:
+		return appendObject(buf, fv)
+	default:
+		return nil, fmt.Errorf("unsupported type %s", t)
+	}
+}
+
+func decodeObject(entries Entries, rv reflect.Value) error {
+	for _, f := range typeFields(rv.Type()) {
+		e, ok := entries.Find(f.name)
+		if !ok {
+			continue
+		}
+		fv := rv.FieldByIndex(f.index)
+		var err error
+		if f.blob {
+			err = decodeBlob(e.Value, fv)
+		} else {
+			err = decodeValue(e.Value, fv)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", f.name, err)
+		}
+	}
+	return nil
+}
+
+func decodeBlob(value any, fv reflect.Value) error {
+	s, ok := value.(string)
+	if !ok {
+		return fmt.Errorf("expected blob string, got %T", value)
+	}
+	t := fv.Type()
+	switch t.Kind() {
+	case reflect.Slice:
+		elemSize := int(t.Elem().Size())
+		if binary.Size(reflect.Zero(t.Elem()).Interface()) != elemSize || elemSize == 0 {
+			return fmt.Errorf("unsupported blob type %s", t)
+		}
+		if len(s)%elemSize != 0 {
+			return fmt.Errorf("invalid blob size %d for element size %d", len(s), elemSize)
+		}
+		fv.Set(reflect.MakeSlice(t, len(s)/elemSize, len(s)/elemSize))
+	case reflect.Array:
+		if binary.Size(fv.Interface()) != len(s) {
+			return fmt.Errorf("invalid blob size %d for %s", len(s), t)
+		}
+	default:
+		return fmt.Errorf("unsupported blob type %s", t)
+	}
+	_, err := binary.Decode([]byte(s), binary.LittleEndian, fv.Addr().Interface())
+	return err
+}
+
+func decodeValue(value any, fv reflect.Value) error {
+	t := fv.Type()
+
+	if fv.CanAddr() && reflect.PointerTo(t).Implements(unmarshalerType) {
+		return fv.Addr().Interface().(Unmarshaler).UnmarshalLevin(value)
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		v, ok := value.(bool)
+		if !ok {
+			return fmt.Errorf("expected bool, got %T", value)
+		}
+		fv.SetBool(v)
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Int:
+		v, err := toInt64(value)
+		if err != nil {
+			return err
+		}
+		if fv.OverflowInt(v) {
+			return fmt.Errorf("value %d overflows %s", v, t)
+		}
+		fv.SetInt(v)
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uint:
+		v, err := toUint64(value)
+		if err != nil {
+			return err
+		}
+		if fv.OverflowUint(v) {
+			return fmt.Errorf("value %d overflows %s", v, t)
+		}
+		fv.SetUint(v)
+	case reflect.Float64:
+		v, ok := value.(float64)
+		if !ok {
+			return fmt.Errorf("expected double, got %T", value)
+		}
+		fv.SetFloat(v)
+	case reflect.String:
+		v, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("expected string, got %T", value)
+		}
+		fv.SetString(v)
+	case reflect.Slice:
+		if isByteType(t.Elem()) {
+			v, ok := value.(string)
+			if !ok {
+				return fmt.Errorf("expected string, got %T", value)
+			}
+			fv.SetBytes([]byte(v))
+			return nil
+		}
+		entries, ok := value.(Entries)
+		if !ok {
+			return fmt.Errorf("expected array, got %T", value)
+		}
+		s := reflect.MakeSlice(t, len(entries), len(entries))
+		for i, e := range entries {
+			if err := decodeValue(e.Value, s.Index(i)); err != nil {
+				return fmt.Errorf("[%d]: %w", i, err)
+			}
+		}
+		fv.Set(s)
+	case reflect.Array:
+		if !isByteType(t.Elem()) {
+			return fmt.Errorf("unsupported type %s", t)
+		}
+		v, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("expected string, got %T", value)
+		}
+		if len(v) != fv.Len() {
+			return fmt.Errorf("invalid string size %d for %s", len(v), t)
+		}
+		for i := range fv.Len() {
+			fv.Index(i).SetUint(uint64(v[i]))
+		}
+	case reflect.Pointer:
+		if t.Elem().Kind() != reflect.Struct {
+			return fmt.Errorf("unsupported type %s", t)
+		}
+		if fv.IsNil() {
+			fv.Set(reflect.New(t.Elem()))
+		}
+		return decodeValue(value, fv.Elem())
+	case reflect.Struct:
+		entries, ok := value.(Entries)
+		if !ok {
+			return fmt.Errorf("expected object, got %T", value)
+		}
+		return decodeObject(entries, fv)
+	default:
+		return fmt.Errorf("unsupported type %s", t)
+	}
+	return nil
+}
+
+func toInt64(value any) (int64, error) {
+	switch v := value.(type) {
+	case int8:
+		return int64(v), nil
+	case int16:
+		return int64(v), nil
+	case int32:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	case uint8:
+		return int64(v), nil
+	case uint16:
+		return int64(v), nil
+	case uint32:
+		return int64(v), nil
+	case uint64:
+		if v > math.MaxInt64 {
+			return 0, fmt.Errorf("value %d overflows int64", v)
+		}
+		return int64(v), nil
+	default:
+		return 0, fmt.Errorf("expected integer, got %T", value)
+	}
+}
+
+func toUint64(value any) (uint64, error) {
+	switch v := value.(type) {
+	case uint8:
+		return uint64(v), nil
+	case uint16:
+		return uint64(v), nil
+	case uint32:
+		return uint64(v), nil
+	case uint64:
+		return v, nil
+	case int8, int16, int32, int64:
+		i, _ := toInt64(v)
+		if i < 0 {
+			return 0, fmt.Errorf("negative value %d", i)
+		}
+		return uint64(i), nil
+	default:
+		return 0, fmt.Errorf("expected integer, got %T", value)
+	}
+}
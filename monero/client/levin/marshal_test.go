@@ -0,0 +1,149 @@
+package levin_test
+
+import (
+	"reflect"
+	"testing"
+
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/client/levin"
+)
+
+type marshalTestInner struct {
+	Number uint32 `levin:"number"`
+	Name   string `levin:"name"`
+}
+
+type marshalTestStruct struct {
+	Bool    bool       `levin:"bool"`
+	Int8    int8       `levin:"int8"`
+	Int16   int16      `levin:"int16"`
+	Int32   int32      `levin:"int32"`
+	Int64   int64      `levin:"int64"`
+	Uint8   uint8      `levin:"uint8"`
+	Uint16  uint16     `levin:"uint16"`
+	Uint32  uint32     `levin:"uint32"`
+	Uint64  uint64     `levin:"uint64"`
+	Double  float64    `levin:"double"`
+	String  string     `levin:"string"`
+	Bytes   []byte     `levin:"bytes"`
+	Hash    [32]byte   `levin:"hash"`
+	Hashes  [][32]byte `levin:"hashes,blob"`
+	Numbers []uint64   `levin:"numbers"`
+	Packed  []uint64   `levin:"packed,blob"`
+	Strings []string   `levin:"strings"`
+
+	Inner    marshalTestInner   `levin:"inner"`
+	InnerPtr *marshalTestInner  `levin:"inner_ptr"`
+	Inners   []marshalTestInner `levin:"inners"`
+
+	Empty   uint64 `levin:"empty,omitempty"`
+	Skipped uint64 `levin:"-"`
+}
+
+func TestMarshal(t *testing.T) {
+	t.Parallel()
+
+	it(t, "round trips all types", func(t *testing.T) {
+		v := marshalTestStruct{
+			Bool:    true,
+			Int8:    -8,
+			Int16:   -16,
+			Int32:   -32,
+			Int64:   -64,
+			Uint8:   8,
+			Uint16:  16,
+			Uint32:  32,
+			Uint64:  1 << 63,
+			Double:  1.5,
+			String:  "string",
+			Bytes:   []byte{1, 2, 3},
+			Hash:    [32]byte{1},
+			Hashes:  [][32]byte{{2}, {3}},
+			Numbers: []uint64{1, 2, 3},
+			Packed:  []uint64{4, 5, 6},
+			Strings: []string{"a", "b"},
+			Inner: marshalTestInner{
+				Number: 1,
+				Name:   "inner",
+			},
+			InnerPtr: &marshalTestInner{
+				Number: 2,
+			},
+			Inners:  []marshalTestInner{{Number: 3}, {Number: 4, Name: "four"}},
+			Skipped: 5,
+		}
+
+		data, err := levin.Marshal(&v)
+		assertNoError(t, err)
+
+		var v2 marshalTestStruct
+		assertNoError(t, levin.Unmarshal(data, &v2))
+
+		v.Skipped = 0
+		if !reflect.DeepEqual(v, v2) {
+			t.Fatalf("expected %+v, got %+v", v, v2)
+		}
+
+		ps, err := levin.NewPortableStorageFromBytes(data)
+		assertNoError(t, err)
+		_, ok := ps.Entries.Find("empty")
+		assertEqual(t, ok, false)
+		_, ok = ps.Entries.Find("Skipped")
+		assertEqual(t, ok, false)
+	})
+
+	it(t, "matches hand built storage", func(t *testing.T) {
+		data, err := levin.Marshal(struct {
+			NodeData marshalTestInner `levin:"node_data"`
+		}{
+			NodeData: marshalTestInner{Number: 1, Name: "bar"},
+		})
+		assertNoError(t, err)
+
+		expected, err := (&levin.PortableStorage{
+			Entries: []levin.Entry{
+				{
+					Name: "node_data",
+					Serializable: &levin.Section{
+						Entries: []levin.Entry{
+							{Name: "number", Serializable: levin.BoostUint32(1)},
+							{Name: "name", Serializable: levin.BoostString("bar")},
+						},
+					},
+				},
+			},
+		}).Bytes()
+		assertNoError(t, err)
+		assertEqual(t, data, expected)
+	})
+
+	it(t, "returns errors on mismatched types", func(t *testing.T) {
+		data, err := levin.Marshal(struct {
+			Value string `levin:"value"`
+			Large uint64 `levin:"large"`
+		}{
+			Value: "string",
+			Large: 1 << 40,
+		})
+		assertNoError(t, err)
+
+		var wrongType struct {
+			Value uint64 `levin:"value"`
+		}
+		assertError(t, levin.Unmarshal(data, &wrongType))
+
+		var overflow struct {
+			Large uint32 `levin:"large"`
+		}
+		assertError(t, levin.Unmarshal(data, &overflow))
+
+		var wrongObject struct {
+			Value marshalTestInner `levin:"value"`
+		}
+		assertError(t, levin.Unmarshal(data, &wrongObject))
+
+		var wrongBlob struct {
+			Value [][32]byte `levin:"value,blob"`
+		}
+		assertError(t, levin.Unmarshal(data, &wrongBlob))
+	})
+}
@@ -18,8 +18,13 @@ const (
 	PortableRawSizeMarkWord  uint16 = 0x01
 	PortableRawSizeMarkDword uint32 = 0x02
 	PortableRawSizeMarkInt64 uint64 = 0x03
+
+	// PortableStorageMaxDepth Maximum nesting of objects and arrays, as epee EPEE_PORTABLE_STORAGE_RECURSION_LIMIT_INTERNAL
+	PortableStorageMaxDepth = 100
 )
 
+var ErrMaxDepthExceeded = errors.New("maximum depth exceeded")
+
 type Entry struct {
 	Name         string
 	Serializable Serializable `json:"-"`
@@ -71,6 +76,15 @@ func (e Entry) Uint64() uint64 {
 	return v
 }
 
+func (e Entry) Bool() bool {
+	v, ok := e.Value.(bool)
+	if !ok {
+		panic(errors.New("interface couldnt be casted to bool"))
+	}
+
+	return v
+}
+
 func (e Entry) Entries() Entries {
 	v, ok := e.Value.(Entries)
 	if !ok {
@@ -90,6 +104,16 @@ func (e Entries) Bytes() []byte {
 	return nil
 }
 
+// Find Returns the first entry with the given name
+func (e Entries) Find(name string) (Entry, bool) {
+	for _, entry := range e {
+		if entry.Name == name {
+			return entry, true
+		}
+	}
+	return Entry{}, false
+}
+
 type PortableStorage struct {
 	Entries Entries
 }
@@ -186,6 +210,15 @@ func ReadString(bytes []byte) (int, string, error) {
 }
 
 func ReadObject(bytes []byte) (int, Entries, error) {
+	return readObject(bytes, 0)
+}
+
+// readObject Reads an object nested depth levels below the root
+func readObject(bytes []byte, depth int) (int, Entries, error) {
+	if depth >= PortableStorageMaxDepth {
+		return 0, nil, ErrMaxDepthExceeded
+	}
+
 	idx := 0
 
 	n, i, err := ReadVarInt(bytes[idx:])
@@ -194,7 +227,7 @@ func ReadObject(bytes []byte) (int, Entries, error) {
 	}
 	idx += n
 
-	if i <= 0 {
+	if i < 0 {
 		return 0, nil, errors.New("invalid length")
 	}
 
@@ -225,7 +258,7 @@ func ReadObject(bytes []byte) (int, Entries, error) {
 		ttype := bytes[idx]
 		idx++
 
-		n, obj, serializable, err := ReadAny(bytes[idx:], ttype)
+		n, obj, serializable, err := readAny(bytes[idx:], ttype, depth+1)
 		if err != nil {
 			return 0, nil, err
 		}
@@ -241,6 +274,15 @@ func ReadObject(bytes []byte) (int, Entries, error) {
 }
 
 func ReadArray(ttype byte, bytes []byte) (int, Entries, error) {
+	return readArray(ttype, bytes, 0)
+}
+
+// readArray Reads an array nested depth levels below the root
+func readArray(ttype byte, bytes []byte, depth int) (int, Entries, error) {
+	if depth >= PortableStorageMaxDepth {
+		return 0, nil, ErrMaxDepthExceeded
+	}
+
 	var (
 		idx = 0
 	)
@@ -262,7 +304,7 @@ func ReadArray(ttype byte, bytes []byte) (int, Entries, error) {
 	entries := make(Entries, 0, min(math.MaxUint16, i))
 
 	for range i {
-		n, obj, serializable, err := ReadAny(bytes[idx:], ttype)
+		n, obj, serializable, err := readAny(bytes[idx:], ttype, depth+1)
 		if err != nil {
 			return 0, nil, err
 		}
@@ -279,13 +321,20 @@ func ReadArray(ttype byte, bytes []byte) (int, Entries, error) {
 
 //nolint:ireturn
 func ReadAny(bytes []byte, ttype byte) (idx int, value any, serializable Serializable, err error) {
+	return readAny(bytes, ttype, 0)
+}
+
+// readAny Reads a value of type ttype nested depth levels below the root
+//
+//nolint:ireturn
+func readAny(bytes []byte, ttype byte, depth int) (idx int, value any, serializable Serializable, err error) {
 	var (
 		n = 0
 	)
 
 	if ttype&BoostSerializeFlagArray != 0 {
 		internalType := ttype &^ BoostSerializeFlagArray
-		n, obj, err := ReadArray(internalType, bytes[idx:])
+		n, obj, err := readArray(internalType, bytes[idx:], depth)
 		if err != nil {
 			return 0, nil, nil, err
 		}
@@ -295,7 +344,7 @@ func ReadAny(bytes []byte, ttype byte) (idx int, value any, serializable Seriali
 	}
 
 	if ttype == BoostSerializeTypeObject {
-		n, obj, err := ReadObject(bytes[idx:])
+		n, obj, err := readObject(bytes[idx:], depth)
 		if err != nil {
 			return 0, nil, nil, err
 		}
@@ -359,6 +408,50 @@ func ReadAny(bytes []byte, ttype byte) (idx int, value any, serializable Seriali
 		return idx, int64(obj), BoostInt64(obj), nil
 	}
 
+	if ttype == BoostSerializeTypeInt32 {
+		if len(bytes[idx:]) < 4 {
+			return 0, nil, nil, io.ErrUnexpectedEOF
+		}
+		obj := int32(binary.LittleEndian.Uint32(bytes[idx:]))
+		n += 4
+		idx += n
+
+		return idx, obj, BoostInt32(obj), nil
+	}
+
+	if ttype == BoostSerializeTypeInt16 {
+		if len(bytes[idx:]) < 2 {
+			return 0, nil, nil, io.ErrUnexpectedEOF
+		}
+		obj := int16(binary.LittleEndian.Uint16(bytes[idx:]))
+		n += 2
+		idx += n
+
+		return idx, obj, BoostInt16(obj), nil
+	}
+
+	if ttype == BoostSerializeTypeInt8 {
+		if len(bytes[idx:]) < 1 {
+			return 0, nil, nil, io.ErrUnexpectedEOF
+		}
+		obj := int8(bytes[idx])
+		n++
+		idx += n
+
+		return idx, obj, BoostInt8(obj), nil
+	}
+
+	if ttype == BoostSerializeTypeDouble {
+		if len(bytes[idx:]) < 8 {
+			return 0, nil, nil, io.ErrUnexpectedEOF
+		}
+		obj := math.Float64frombits(binary.LittleEndian.Uint64(bytes[idx:]))
+		n += 8
+		idx += n
+
+		return idx, obj, BoostDouble(obj), nil
+	}
+
 	if ttype == BoostSerializeTypeString {
 		n, obj, err := ReadString(bytes[idx:])
 		if err != nil {
@@ -3,6 +3,7 @@ package levin_test
 import (
 	"bytes"
 	"encoding/hex"
+	"errors"
 	"testing"
 
 	"git.gammaspectra.live/P2Pool/consensus/v5/monero/client/levin"
@@ -227,6 +228,146 @@ func TestPortableStorage(t *testing.T) {
 	})
 }
 
+func TestPortableStorageArrays(t *testing.T) {
+	t.Parallel()
+	it(t, "round trips arrays", func(t *testing.T) {
+		ps := &levin.PortableStorage{
+			Entries: []levin.Entry{
+				{
+					Name:         "amounts",
+					Serializable: levin.BoostUint64Array{0, 1, 1 << 40},
+				},
+				{
+					Name: "outputs",
+					Serializable: levin.BoostSectionArray{
+						{Entries: []levin.Entry{{Name: "index", Serializable: levin.BoostUint64(5)}}},
+						{Entries: []levin.Entry{{Name: "index", Serializable: levin.BoostUint64(6)}}},
+					},
+				},
+			},
+		}
+
+		data, err := ps.Bytes()
+		assertNoError(t, err)
+
+		ps2, err := levin.NewPortableStorageFromBytes(data)
+		assertNoError(t, err)
+
+		amounts, ok := ps2.Entries.Find("amounts")
+		assertEqual(t, ok, true)
+		assertEqual(t, len(amounts.Entries()), 3)
+		assertEqual(t, amounts.Entries()[2].Uint64(), uint64(1<<40))
+
+		outputs, ok := ps2.Entries.Find("outputs")
+		assertEqual(t, ok, true)
+		assertEqual(t, len(outputs.Entries()), 2)
+		index, ok := outputs.Entries()[1].Entries().Find("index")
+		assertEqual(t, ok, true)
+		assertEqual(t, index.Uint64(), uint64(6))
+	})
+}
+
+// TestPortableStorageEmptySections epee writes sections without entries, for example when all fields are empty containers,
+// which are skipped, or for commands without arguments
+func TestPortableStorageEmptySections(t *testing.T) {
+	t.Parallel()
+	it(t, "reads empty sections", func(t *testing.T) {
+		ps := &levin.PortableStorage{
+			Entries: []levin.Entry{
+				{
+					Name: "output_indices",
+					Serializable: levin.BoostSectionArray{
+						{Entries: []levin.Entry{}},
+						{Entries: []levin.Entry{{Name: "indices", Serializable: levin.BoostUint64Array{1}}}},
+					},
+				},
+				{
+					Name:         "payload_data",
+					Serializable: &levin.Section{},
+				},
+			},
+		}
+
+		data, err := ps.Bytes()
+		assertNoError(t, err)
+
+		ps2, err := levin.NewPortableStorageFromBytes(data)
+		assertNoError(t, err)
+
+		indices, ok := ps2.Entries.Find("output_indices")
+		assertEqual(t, ok, true)
+		assertEqual(t, len(indices.Entries()), 2)
+		assertEqual(t, len(indices.Entries()[0].Entries()), 0)
+		assertEqual(t, len(indices.Entries()[1].Entries()), 1)
+
+		payload, ok := ps2.Entries.Find("payload_data")
+		assertEqual(t, ok, true)
+		assertEqual(t, len(payload.Entries()), 0)
+	})
+
+	it(t, "reads an empty storage", func(t *testing.T) {
+		data, err := (&levin.PortableStorage{}).Bytes()
+		assertNoError(t, err)
+
+		ps, err := levin.NewPortableStorageFromBytes(data)
+		assertNoError(t, err)
+		assertEqual(t, len(ps.Entries), 0)
+	})
+}
+
+// testNestedStorage Builds a storage with an empty object nested levels times below the root, each inside an array of one object when array is set
+func testNestedStorage(levels int, array bool) []byte {
+	data := []byte{
+		0x01, 0x11, 0x01, 0x01,
+		0x01, 0x01, 0x02, 0x01,
+		0x01,
+	}
+	ttype := levin.BoostSerializeTypeObject
+	if array {
+		ttype |= levin.BoostSerializeFlagArray
+	}
+	for range levels {
+		// one entry named "a"
+		data = append(data, 0x04, 0x01, 'a', ttype)
+		if array {
+			// one element
+			data = append(data, 0x04)
+		}
+	}
+	return append(data, 0x00)
+}
+
+func TestPortableStorageDepth(t *testing.T) {
+	t.Parallel()
+	it(t, "reads nested objects", func(t *testing.T) {
+		_, err := levin.NewPortableStorageFromBytes(testNestedStorage(levin.PortableStorageMaxDepth-1, false))
+		assertNoError(t, err)
+	})
+
+	it(t, "reads nested arrays", func(t *testing.T) {
+		_, err := levin.NewPortableStorageFromBytes(testNestedStorage(levin.PortableStorageMaxDepth/2-1, true))
+		assertNoError(t, err)
+	})
+
+	it(t, "fails w/ deeply nested objects", func(t *testing.T) {
+		_, err := levin.NewPortableStorageFromBytes(testNestedStorage(1<<20, false))
+		assertError(t, err)
+		assertEqual(t, errors.Is(err, levin.ErrMaxDepthExceeded), true)
+	})
+
+	it(t, "fails w/ deeply nested arrays", func(t *testing.T) {
+		_, err := levin.NewPortableStorageFromBytes(testNestedStorage(1<<20, true))
+		assertError(t, err)
+		assertEqual(t, errors.Is(err, levin.ErrMaxDepthExceeded), true)
+	})
+
+	it(t, "fails to unmarshal deeply nested objects", func(t *testing.T) {
+		var v struct{}
+		err := levin.Unmarshal(testNestedStorage(1<<20, false), &v)
+		assertError(t, err)
+	})
+}
+
 func FuzzLevinPortableStorage_RoundTrip(f *testing.F) {
 	f.Fuzz(func(t *testing.T, buf []byte) {
 		// enforce capacity checks
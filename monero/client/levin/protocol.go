@@ -0,0 +1,223 @@
+package levin
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+
+	"git.gammaspectra.live/P2Pool/consensus/v5/types"
+)
+
+// see https://github.com/monero-project/monero/blob/e45619e61e4831eea70a43fe6985f4d57ea02e9e/src/p2p/p2p_protocol_defs.h
+// see https://github.com/monero-project/monero/blob/e45619e61e4831eea70a43fe6985f4d57ea02e9e/src/cryptonote_protocol/cryptonote_protocol_defs.h
+
+// BasicNodeData Identity of a node, sent on handshake
+type BasicNodeData struct {
+	NetworkId         []byte `levin:"network_id"`
+	MyPort            uint32 `levin:"my_port"`
+	RPCPort           uint16 `levin:"rpc_port"`
+	RPCCreditsPerHash uint32 `levin:"rpc_credits_per_hash"`
+	PeerId            uint64 `levin:"peer_id"`
+	SupportFlags      uint32 `levin:"support_flags"`
+}
+
+// CoreSyncData Chain state of a node, sent on handshake and timed sync
+type CoreSyncData struct {
+	CurrentHeight             uint64     `levin:"current_height"`
+	CumulativeDifficulty      uint64     `levin:"cumulative_difficulty"`
+	CumulativeDifficultyTop64 uint64     `levin:"cumulative_difficulty_top64"`
+	TopId                     types.Hash `levin:"top_id"`
+	TopVersion                uint8      `levin:"top_version"`
+	PruningSeed               uint32     `levin:"pruning_seed"`
+}
+
+const (
+	NetworkAddressTypeIPv4 uint8 = 1
+	NetworkAddressTypeIPv6 uint8 = 2
+)
+
+type NetworkAddressIP struct {
+	// IPv4 Address bytes in network order, read as little endian
+	IPv4 uint32 `levin:"m_ip,omitempty"`
+	IPv6 []byte `levin:"addr,omitempty"`
+	Port uint16 `levin:"m_port"`
+}
+
+type NetworkAddress struct {
+	Type uint8            `levin:"type"`
+	Addr NetworkAddressIP `levin:"addr"`
+}
+
+func NewNetworkAddress(addrPort netip.AddrPort) NetworkAddress {
+	addr := addrPort.Addr().Unmap()
+	if addr.Is4() {
+		ip := addr.As4()
+		return NetworkAddress{
+			Type: NetworkAddressTypeIPv4,
+			Addr: NetworkAddressIP{
+				IPv4: binary.LittleEndian.Uint32(ip[:]),
+				Port: addrPort.Port(),
+			},
+		}
+	}
+	ip := addr.As16()
+	return NetworkAddress{
+		Type: NetworkAddressTypeIPv6,
+		Addr: NetworkAddressIP{
+			IPv6: ip[:],
+			Port: addrPort.Port(),
+		},
+	}
+}
+
+// AddrPort Returns the address, or an invalid one for unsupported types
+func (a NetworkAddress) AddrPort() netip.AddrPort {
+	switch a.Type {
+	case NetworkAddressTypeIPv4:
+		var ip [4]byte
+		binary.LittleEndian.PutUint32(ip[:], a.Addr.IPv4)
+		return netip.AddrPortFrom(netip.AddrFrom4(ip), a.Addr.Port)
+	case NetworkAddressTypeIPv6:
+		if ip, ok := netip.AddrFromSlice(a.Addr.IPv6); ok {
+			return netip.AddrPortFrom(ip, a.Addr.Port)
+		}
+	}
+	return netip.AddrPort{}
+}
+
+type PeerlistEntry struct {
+	Address           NetworkAddress `levin:"adr"`
+	Id                uint64         `levin:"id"`
+	LastSeen          int64          `levin:"last_seen,omitempty"`
+	PruningSeed       uint32         `levin:"pruning_seed,omitempty"`
+	RPCPort           uint16         `levin:"rpc_port,omitempty"`
+	RPCCreditsPerHash uint32         `levin:"rpc_credits_per_hash,omitempty"`
+}
+
+type HandshakeRequest struct {
+	NodeData    BasicNodeData `levin:"node_data"`
+	PayloadData CoreSyncData  `levin:"payload_data"`
+}
+
+type HandshakeResponse struct {
+	NodeData      BasicNodeData   `levin:"node_data"`
+	PayloadData   CoreSyncData    `levin:"payload_data"`
+	LocalPeerlist []PeerlistEntry `levin:"local_peerlist_new,omitempty"`
+}
+
+type TimedSyncRequest struct {
+	PayloadData CoreSyncData `levin:"payload_data"`
+}
+
+type TimedSyncResponse struct {
+	PayloadData   CoreSyncData    `levin:"payload_data"`
+	LocalPeerlist []PeerlistEntry `levin:"local_peerlist_new,omitempty"`
+}
+
+type PingResponse struct {
+	Status string `levin:"status"`
+	PeerId uint64 `levin:"peer_id"`
+}
+
+type SupportFlagsResponse struct {
+	SupportFlags uint32 `levin:"support_flags"`
+}
+
+type TransactionBlobEntry struct {
+	Blob []byte `levin:"blob"`
+	// PrunableHash Hash of the prunable part, set only on pruned entries of v2 transactions
+	PrunableHash types.Hash `levin:"prunable_hash"`
+}
+
+// UnmarshalLevin Transactions are sent as plain blobs when not pruned
+func (e *TransactionBlobEntry) UnmarshalLevin(value any) error {
+	if blob, ok := value.(string); ok {
+		e.Blob = []byte(blob)
+		return nil
+	}
+	entries, ok := value.(Entries)
+	if !ok {
+		return fmt.Errorf("expected blob or object, got %T", value)
+	}
+	type alias TransactionBlobEntry
+	return UnmarshalEntries(entries, (*alias)(e))
+}
+
+// BlockCompleteEntry A block blob together with its transaction blobs
+type BlockCompleteEntry struct {
+	Pruned       bool                   `levin:"pruned"`
+	Block        []byte                 `levin:"block"`
+	BlockWeight  uint64                 `levin:"block_weight"`
+	Transactions []TransactionBlobEntry `levin:"txs"`
+}
+
+// MarshalLevin Transactions are sent as plain blobs when not pruned
+func (e BlockCompleteEntry) MarshalLevin() (any, error) {
+	type alias BlockCompleteEntry
+	if e.Pruned {
+		return alias(e), nil
+	}
+	var txs [][]byte
+	for _, tx := range e.Transactions {
+		txs = append(txs, tx.Blob)
+	}
+	return struct {
+		Pruned       bool     `levin:"pruned"`
+		Block        []byte   `levin:"block"`
+		BlockWeight  uint64   `levin:"block_weight,omitempty"`
+		Transactions [][]byte `levin:"txs,omitempty"`
+	}{
+		Block:        e.Block,
+		BlockWeight:  e.BlockWeight,
+		Transactions: txs,
+	}, nil
+}
+
+// NewTransactions Relays transactions. Padding is random data used to hide the message size
+type NewTransactions struct {
+	Transactions   [][]byte `levin:"txs"`
+	Padding        []byte   `levin:"_,omitempty"`
+	DandelionFluff bool     `levin:"dandelionpp_fluff"`
+}
+
+// RequestGetObjects Requests full blocks by id
+type RequestGetObjects struct {
+	Blocks []types.Hash `levin:"blocks,blob"`
+	Prune  bool         `levin:"prune"`
+}
+
+type ResponseGetObjects struct {
+	Blocks                  []BlockCompleteEntry `levin:"blocks"`
+	MissedIds               []types.Hash         `levin:"missed_ids,blob"`
+	CurrentBlockchainHeight uint64               `levin:"current_blockchain_height"`
+}
+
+// RequestChain Requests the chain following the first known id
+// BlockIds is a sparse list of known block ids ordered from most recent, ending with the genesis block id.
+type RequestChain struct {
+	BlockIds []types.Hash `levin:"block_ids,blob"`
+	Prune    bool         `levin:"prune"`
+}
+
+type ResponseChainEntry struct {
+	StartHeight               uint64       `levin:"start_height"`
+	TotalHeight               uint64       `levin:"total_height"`
+	CumulativeDifficulty      uint64       `levin:"cumulative_difficulty"`
+	CumulativeDifficultyTop64 uint64       `levin:"cumulative_difficulty_top64"`
+	BlockIds                  []types.Hash `levin:"m_block_ids,blob"`
+	BlockWeights              []uint64     `levin:"m_block_weights,blob"`
+	FirstBlock                []byte       `levin:"first_block"`
+}
+
+// NewFluffyBlock Relays a block with only the transactions the receiver is not expected to have
+type NewFluffyBlock struct {
+	Block                   BlockCompleteEntry `levin:"b"`
+	CurrentBlockchainHeight uint64             `levin:"current_blockchain_height"`
+}
+
+// RequestFluffyMissingTx Requests transactions of a fluffy block, by index within the block
+type RequestFluffyMissingTx struct {
+	BlockHash               types.Hash `levin:"block_hash"`
+	CurrentBlockchainHeight uint64     `levin:"current_blockchain_height"`
+	MissingTxIndices        []uint64   `levin:"missing_tx_indices,blob"`
+}
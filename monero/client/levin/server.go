@@ -0,0 +1,378 @@
+package levin
+
+import (
+	"errors"
+	"fmt"
+	unsafeRandom "math/rand/v2" //nolint:depguard
+	"net"
+	"sync"
+	"time"
+)
+
+const DefaultHandshakeTimeout = 30 * time.Second
+
+// Handler Handles a command from a handshaked peer
+// For requests expecting a response, the returned value is sent back. Returning an error closes the connection.
+type Handler func(conn *ServerConn, msg *Message) (response any, err error)
+
+type ServerConfig struct {
+	// NodeData Identity sent on handshake. NetworkId defaults to MainnetNetworkId, and PeerId is random if zero
+	NodeData BasicNodeData
+
+	// SyncData Returns the chain state sent on handshake and timed sync. Required
+	SyncData func() CoreSyncData
+	// Peers Returns the peer list sent on handshake and timed sync, if set
+	Peers func() []PeerlistEntry
+
+	// OnConnect Called after a successful handshake, before any other command is handled
+	OnConnect func(conn *ServerConn)
+	// OnDisconnect Called once a handshaked connection is closed
+	OnDisconnect func(conn *ServerConn)
+
+	// HandshakeTimeout Defaults to DefaultHandshakeTimeout
+	HandshakeTimeout time.Duration
+}
+
+// Server Accepts inbound Monero peers. Handshake, ping, timed sync and support flags are answered by the server,
+// other commands are dispatched to handlers set via Handle.
+type Server struct {
+	cfg ServerConfig
+
+	handlersLock sync.RWMutex
+	handlers     map[uint32]Handler
+
+	lock      sync.Mutex
+	listeners []net.Listener
+	conns     map[*ServerConn]struct{}
+	closed    bool
+}
+
+func NewServer(cfg ServerConfig) (*Server, error) {
+	if cfg.SyncData == nil {
+		return nil, errors.New("nil SyncData")
+	}
+	if cfg.NodeData.NetworkId == nil {
+		cfg.NodeData.NetworkId = MainnetNetworkId
+	}
+	if cfg.NodeData.PeerId == 0 {
+		cfg.NodeData.PeerId = unsafeRandom.Uint64()
+	}
+	if cfg.HandshakeTimeout == 0 {
+		cfg.HandshakeTimeout = DefaultHandshakeTimeout
+	}
+
+	return &Server{
+		cfg:      cfg,
+		handlers: make(map[uint32]Handler),
+		conns:    make(map[*ServerConn]struct{}),
+	}, nil
+}
+
+// Handle Sets the handler for command, or removes it if nil
+func (s *Server) Handle(command uint32, handler Handler) {
+	s.handlersLock.Lock()
+	defer s.handlersLock.Unlock()
+	if handler == nil {
+		delete(s.handlers, command)
+	} else {
+		s.handlers[command] = handler
+	}
+}
+
+func (s *Server) handler(command uint32) Handler {
+	s.handlersLock.RLock()
+	defer s.handlersLock.RUnlock()
+	return s.handlers[command]
+}
+
+// NodeData Returns the identity of this server
+func (s *Server) NodeData() BasicNodeData {
+	return s.cfg.NodeData
+}
+
+// Listen Listens on addr and serves connections until Close is called
+func (s *Server) Listen(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(listener)
+}
+
+// Serve Serves connections from listener until Close is called. The listener is closed on return
+func (s *Server) Serve(listener net.Listener) error {
+	s.lock.Lock()
+	if s.closed {
+		s.lock.Unlock()
+		_ = listener.Close()
+		return net.ErrClosed
+	}
+	s.listeners = append(s.listeners, listener)
+	s.lock.Unlock()
+
+	defer listener.Close()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			s.lock.Lock()
+			closed := s.closed
+			s.lock.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+
+		go s.serveConn(&ServerConn{
+			server: s,
+			conn:   conn,
+		})
+	}
+}
+
+func (s *Server) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	for _, l := range s.listeners {
+		_ = l.Close()
+	}
+	for c := range s.conns {
+		_ = c.conn.Close()
+	}
+	return nil
+}
+
+// Connections Returns handshaked connections
+func (s *Server) Connections() []*ServerConn {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	result := make([]*ServerConn, 0, len(s.conns))
+	for c := range s.conns {
+		result = append(result, c)
+	}
+	return result
+}
+
+// Broadcast Sends a notification to all handshaked connections
+func (s *Server) Broadcast(command uint32, v any) error {
+	payload, err := Marshal(v)
+	if err != nil {
+		return err
+	}
+	for _, c := range s.Connections() {
+		_ = c.writePayload(NewNotifyHeader(command, 0), payload)
+	}
+	return nil
+}
+
+func (s *Server) serveConn(c *ServerConn) {
+	defer c.conn.Close()
+
+	_ = c.conn.SetReadDeadline(time.Now().Add(s.cfg.HandshakeTimeout))
+
+	var handshaked bool
+	defer func() {
+		if handshaked {
+			s.lock.Lock()
+			delete(s.conns, c)
+			s.lock.Unlock()
+			if s.cfg.OnDisconnect != nil {
+				s.cfg.OnDisconnect(c)
+			}
+		}
+	}()
+
+	for {
+		maxSize := LevinPacketMaxInitialSize
+		if handshaked {
+			maxSize = LevinPacketMaxDefaultSize
+		}
+		msg, err := ReadMessage(c.conn, maxSize)
+		if err != nil {
+			return
+		}
+
+		if msg.Header.Flags&LevinPacketReponse != 0 {
+			// requests are never sent by the server, so responses are not expected
+			continue
+		}
+
+		switch msg.Header.Command {
+		case CommandHandshake:
+			if handshaked {
+				return
+			}
+			if err = c.handshake(msg); err != nil {
+				return
+			}
+			s.lock.Lock()
+			if s.closed {
+				s.lock.Unlock()
+				return
+			}
+			s.conns[c] = struct{}{}
+			s.lock.Unlock()
+			handshaked = true
+
+			_ = c.conn.SetReadDeadline(time.Time{})
+			if s.cfg.OnConnect != nil {
+				s.cfg.OnConnect(c)
+			}
+		case CommandPing:
+			// allowed before handshake, used by peers to test reachability
+			err = c.reply(msg, &PingResponse{
+				Status: "OK",
+				PeerId: s.cfg.NodeData.PeerId,
+			})
+		case CommandSupportFlags:
+			err = c.reply(msg, &SupportFlagsResponse{
+				SupportFlags: s.cfg.NodeData.SupportFlags,
+			})
+		default:
+			if !handshaked {
+				return
+			}
+			err = c.handle(msg)
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) peers() []PeerlistEntry {
+	if s.cfg.Peers == nil {
+		return nil
+	}
+	return s.cfg.Peers()
+}
+
+// ServerConn A connection accepted by Server
+type ServerConn struct {
+	server *Server
+	conn   net.Conn
+
+	writeLock sync.Mutex
+
+	lock     sync.RWMutex
+	peer     BasicNodeData
+	peerSync CoreSyncData
+}
+
+func (c *ServerConn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// Peer Returns the identity sent by the peer on handshake
+func (c *ServerConn) Peer() BasicNodeData {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.peer
+}
+
+// PeerSyncData Returns the last chain state received from the peer
+func (c *ServerConn) PeerSyncData() CoreSyncData {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.peerSync
+}
+
+func (c *ServerConn) Close() error {
+	return c.conn.Close()
+}
+
+// Notify Sends a one-way notification
+func (c *ServerConn) Notify(command uint32, v any) error {
+	payload, err := Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.writePayload(NewNotifyHeader(command, 0), payload)
+}
+
+func (c *ServerConn) writePayload(header *Header, payload []byte) error {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	_ = c.conn.SetWriteDeadline(time.Now().Add(WriteTimeout))
+	if err := WriteMessage(c.conn, header, payload); err != nil {
+		_ = c.conn.Close()
+		return err
+	}
+	return nil
+}
+
+func (c *ServerConn) replyCode(msg *Message, returnCode int32, v any) error {
+	if !msg.Header.ExpectsResponse {
+		return nil
+	}
+	payload, err := Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.writePayload(NewResponseHeader(msg.Header.Command, 0, returnCode), payload)
+}
+
+func (c *ServerConn) reply(msg *Message, v any) error {
+	return c.replyCode(msg, 1, v)
+}
+
+func (c *ServerConn) handshake(msg *Message) error {
+	var request HandshakeRequest
+	if err := Unmarshal(msg.Payload, &request); err != nil {
+		return err
+	}
+
+	if string(request.NodeData.NetworkId) != string(c.server.cfg.NodeData.NetworkId) {
+		return errors.New("network id mismatch")
+	}
+	if request.NodeData.PeerId != 0 && request.NodeData.PeerId == c.server.cfg.NodeData.PeerId {
+		return errors.New("connection to self")
+	}
+
+	c.lock.Lock()
+	c.peer = request.NodeData
+	c.peerSync = request.PayloadData
+	c.lock.Unlock()
+
+	return c.reply(msg, &HandshakeResponse{
+		NodeData:      c.server.cfg.NodeData,
+		PayloadData:   c.server.cfg.SyncData(),
+		LocalPeerlist: c.server.peers(),
+	})
+}
+
+func (c *ServerConn) handle(msg *Message) error {
+	if msg.Header.Command == CommandTimedSync {
+		var request TimedSyncRequest
+		if err := Unmarshal(msg.Payload, &request); err != nil {
+			return err
+		}
+		c.lock.Lock()
+		c.peerSync = request.PayloadData
+		c.lock.Unlock()
+
+		return c.reply(msg, &TimedSyncResponse{
+			PayloadData:   c.server.cfg.SyncData(),
+			LocalPeerlist: c.server.peers(),
+		})
+	}
+
+	handler := c.server.handler(msg.Header.Command)
+	if handler == nil {
+		return c.replyCode(msg, LevinErrorConnectionHandlerNotDefined, struct{}{})
+	}
+
+	response, err := handler(c, msg)
+	if err != nil {
+		return fmt.Errorf("command %d: %w", msg.Header.Command, err)
+	}
+	if response == nil {
+		response = struct{}{}
+	}
+	return c.reply(msg, response)
+}
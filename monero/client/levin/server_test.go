@@ -0,0 +1,159 @@
+package levin_test
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/client/levin"
+	"git.gammaspectra.live/P2Pool/consensus/v5/types"
+)
+
+func TestNetworkAddress(t *testing.T) {
+	for _, s := range []string{"1.2.3.4:18080", "[2001:db8::1]:18080"} {
+		addrPort := netip.MustParseAddrPort(s)
+		assertEqual(t, levin.NewNetworkAddress(addrPort).AddrPort(), addrPort, s)
+	}
+}
+
+func TestServer(t *testing.T) {
+	syncData := levin.CoreSyncData{
+		CurrentHeight: 3000000,
+		TopId:         types.Hash{0xaa},
+		TopVersion:    16,
+	}
+
+	server, err := levin.NewServer(levin.ServerConfig{
+		NodeData: levin.BasicNodeData{
+			PeerId:       1,
+			RPCPort:      18081,
+			SupportFlags: levin.P2PSupportFlagFluffyBlocks,
+		},
+		SyncData: func() levin.CoreSyncData {
+			return syncData
+		},
+		Peers: func() []levin.PeerlistEntry {
+			return []levin.PeerlistEntry{
+				{Address: levin.NewNetworkAddress(netip.MustParseAddrPort("1.2.3.4:18080")), Id: 2},
+				{Address: levin.NewNetworkAddress(netip.MustParseAddrPort("[2001:db8::1]:18080")), Id: 3},
+			}
+		},
+	})
+	assertNoError(t, err)
+	if err != nil {
+		return
+	}
+	defer server.Close()
+
+	server.Handle(levin.NotifyRequestChain, func(conn *levin.ServerConn, msg *levin.Message) (any, error) {
+		var request levin.RequestChain
+		if err := levin.Unmarshal(msg.Payload, &request); err != nil {
+			return nil, err
+		}
+		return nil, conn.Notify(levin.NotifyResponseChainEntry, &levin.ResponseChainEntry{
+			StartHeight: syncData.CurrentHeight - 1,
+			TotalHeight: syncData.CurrentHeight,
+			BlockIds:    append(request.BlockIds, syncData.TopId),
+		})
+	})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assertNoError(t, err)
+	if err != nil {
+		return
+	}
+	go server.Serve(listener)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	it(t, "answers client handshake", func(t *testing.T) {
+		client, err := levin.NewClient(ctx, listener.Addr().String())
+		assertNoError(t, err)
+		if err != nil {
+			return
+		}
+		defer client.Close()
+
+		node, err := client.Handshake(ctx)
+		assertNoError(t, err)
+		if err != nil {
+			return
+		}
+		assertEqual(t, node.Id, uint64(1))
+		assertEqual(t, node.RPCPort, uint16(18081))
+		assertEqual(t, node.CurrentHeight, syncData.CurrentHeight)
+		assertEqual(t, len(node.Peers), 2)
+		assertEqual(t, node.Peers["1.2.3.4:18080"] != nil, true)
+		assertEqual(t, node.Peers["2001:db8::1:18080"] != nil, true)
+	})
+
+	it(t, "answers ping before handshake", func(t *testing.T) {
+		client, err := levin.NewClient(ctx, listener.Addr().String())
+		assertNoError(t, err)
+		if err != nil {
+			return
+		}
+		defer client.Close()
+
+		header, err := client.Ping(ctx)
+		assertNoError(t, err)
+		if err != nil {
+			return
+		}
+		assertEqual(t, header.Command, levin.CommandPing)
+		assertEqual(t, header.Flags, levin.LevinPacketReponse)
+	})
+
+	it(t, "serves light node", func(t *testing.T) {
+		client, err := levin.NewClient(ctx, listener.Addr().String())
+		assertNoError(t, err)
+		if err != nil {
+			return
+		}
+
+		node, err := levin.NewLightNode(ctx, client, levin.LightNodeConfig{
+			PeerId: 4,
+			SyncData: func() levin.CoreSyncData {
+				return syncData
+			},
+		})
+		assertNoError(t, err)
+		if err != nil {
+			return
+		}
+		defer node.Close()
+
+		assertEqual(t, node.Peer().PeerId, uint64(1))
+		assertEqual(t, node.PeerSyncData(), syncData)
+
+		sync, err := node.TimedSync(ctx)
+		assertNoError(t, err)
+		if err == nil {
+			assertEqual(t, *sync, syncData)
+		}
+
+		entry, err := node.RequestChain(ctx, []types.Hash{{0xbb}}, false)
+		assertNoError(t, err)
+		if err == nil {
+			assertEqual(t, entry.BlockIds, []types.Hash{{0xbb}, syncData.TopId})
+		}
+
+		// earlier connections may still be closing
+		var found bool
+		for _, conn := range server.Connections() {
+			if conn.Peer().PeerId == 4 {
+				found = true
+			}
+		}
+		assertEqual(t, found, true)
+
+		// notifications without handler are ignored
+		shortCtx, shortCancel := context.WithTimeout(ctx, time.Millisecond*100)
+		defer shortCancel()
+		_, err = node.RequestObjects(shortCtx, []types.Hash{{0xbb}}, false)
+		assertEqual(t, err, context.DeadlineExceeded)
+	})
+}
@@ -0,0 +1,467 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/client/rpc"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/client/rpc/daemon"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/crypto/curve25519"
+	"git.gammaspectra.live/P2Pool/consensus/v5/types"
+	"git.gammaspectra.live/P2Pool/consensus/v5/utils"
+)
+
+// PoolMaxHeightLag Nodes further behind than this from the highest known node are considered unhealthy
+const PoolMaxHeightLag = 2
+
+// NodeStatus Last known state of a node in PoolClient
+type NodeStatus struct {
+	Address string
+	Healthy bool
+	// Inconsistent Set when the node reports a different tip than other healthy nodes at the same height
+	Inconsistent bool
+	Height       uint64
+	TargetHeight uint64
+	TopHash      types.Hash
+	LastCheck    time.Time
+	LastError    error
+}
+
+type poolNode struct {
+	address string
+	client  *Client
+	status  NodeStatus
+}
+
+// PoolClient Client over several monerod nodes with health checks and failover
+// Calls go to the preferred healthy node, in the order given on creation, and fail over to other nodes on error.
+// SubmitBlock is sent to all healthy nodes.
+type PoolClient struct {
+	lock    sync.RWMutex
+	nodes   []*poolNode
+	current int
+}
+
+var _ RPC = (*PoolClient)(nil)
+
+// NewPoolClient Creates a client for the given monerod RPC addresses, in order of preference
+// All nodes are considered healthy until the first CheckHealth
+func NewPoolClient(addresses []string, httpClient *http.Client) (*PoolClient, error) {
+	if len(addresses) == 0 {
+		return nil, errors.New("no addresses")
+	}
+
+	p := &PoolClient{}
+	for _, addr := range addresses {
+		c, err := NewClient(addr, httpClient)
+		if err != nil {
+			return nil, utils.ErrorfNoEscape("%s: %w", addr, err)
+		}
+		p.nodes = append(p.nodes, &poolNode{
+			address: addr,
+			client:  c,
+			status: NodeStatus{
+				Address: addr,
+				Healthy: true,
+			},
+		})
+	}
+	return p, nil
+}
+
+// Status Returns the last known status of all nodes, in order of preference
+func (p *PoolClient) Status() []NodeStatus {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	result := make([]NodeStatus, 0, len(p.nodes))
+	for _, n := range p.nodes {
+		result = append(result, n.status)
+	}
+	return result
+}
+
+// Current Returns the address of the node currently in use
+func (p *PoolClient) Current() string {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.nodes[p.current].address
+}
+
+// CheckHealth Queries all nodes via GetInfo and SyncInfo, and updates health, consistency and the node in use
+func (p *PoolClient) CheckHealth() {
+	statuses := make([]NodeStatus, len(p.nodes))
+
+	var wg sync.WaitGroup
+	for i, n := range p.nodes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			statuses[i] = checkNode(n.client)
+		}()
+	}
+	wg.Wait()
+
+	var maxHeight uint64
+	for i := range statuses {
+		statuses[i].Address = p.nodes[i].address
+		if statuses[i].Healthy {
+			maxHeight = max(maxHeight, statuses[i].Height)
+		}
+	}
+
+	for i := range statuses {
+		st := &statuses[i]
+		if st.Healthy && st.Height+PoolMaxHeightLag < maxHeight {
+			st.Healthy = false
+			st.LastError = utils.ErrorfNoEscape("node is behind: height %d, highest %d", st.Height, maxHeight)
+		}
+	}
+
+	// flag nodes at the same height reporting different tips
+	for i := range statuses {
+		a := &statuses[i]
+		if !a.Healthy {
+			continue
+		}
+		for j := range statuses {
+			b := &statuses[j]
+			if i != j && b.Healthy && a.Height == b.Height && a.TopHash != b.TopHash {
+				a.Inconsistent = true
+			}
+		}
+		if a.Inconsistent {
+			utils.Errorf("RPC", "Node %s reports tip %s at height %d, different than other nodes", a.Address, a.TopHash, a.Height)
+		}
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for i, n := range p.nodes {
+		if n.status.Healthy && !statuses[i].Healthy {
+			utils.Errorf("RPC", "Node %s is unhealthy: %s", statuses[i].Address, statuses[i].LastError)
+		} else if !n.status.Healthy && statuses[i].Healthy {
+			utils.Noticef("RPC", "Node %s is healthy", statuses[i].Address)
+		}
+		n.status = statuses[i]
+	}
+	p.selectNode()
+}
+
+// selectNode Picks the preferred healthy node, or keeps the current one if none is healthy. Must be called with lock held
+func (p *PoolClient) selectNode() {
+	for i, n := range p.nodes {
+		if n.status.Healthy && !n.status.Inconsistent {
+			if i != p.current {
+				utils.Noticef("RPC", "Switching to node %s", n.status.Address)
+				p.current = i
+			}
+			return
+		}
+	}
+	for i, n := range p.nodes {
+		if n.status.Healthy {
+			if i != p.current {
+				utils.Noticef("RPC", "Switching to node %s", n.status.Address)
+				p.current = i
+			}
+			return
+		}
+	}
+}
+
+func checkNode(c *Client) (st NodeStatus) {
+	st.LastCheck = time.Now()
+
+	info, err := c.GetInfo()
+	if err != nil {
+		st.LastError = err
+		return st
+	}
+	if info.Offline {
+		st.LastError = errors.New("node is offline")
+		return st
+	}
+	if !info.Synchronized || info.BusySyncing {
+		st.LastError = errors.New("node is not synchronized")
+		return st
+	}
+
+	syncInfo, err := c.SyncInfo()
+	if err != nil {
+		st.LastError = err
+		return st
+	}
+
+	st.Height = info.Height
+	st.TopHash = info.TopBlockHash
+	st.TargetHeight = max(info.TargetHeight, syncInfo.TargetHeight)
+	if st.TargetHeight > st.Height+PoolMaxHeightLag {
+		st.LastError = utils.ErrorfNoEscape("node is behind target: height %d, target %d", st.Height, st.TargetHeight)
+		return st
+	}
+
+	st.Healthy = true
+	return st
+}
+
+// Run Checks node health periodically until context is done
+func (p *PoolClient) Run(ctx context.Context, interval time.Duration) {
+	p.CheckHealth()
+	for range utils.ContextTick(ctx, interval) {
+		p.CheckHealth()
+	}
+}
+
+// markFailed Marks a node unhealthy after a failed call and fails over
+func (p *PoolClient) markFailed(n *poolNode, err error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if n.status.Healthy {
+		utils.Errorf("RPC", "Node %s failed: %s", n.status.Address, err)
+	}
+	n.status.Healthy = false
+	n.status.LastError = err
+	p.selectNode()
+}
+
+// candidates Returns nodes to try in order, current first, then other healthy nodes, then unhealthy ones
+func (p *PoolClient) candidates() []*poolNode {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	result := make([]*poolNode, 0, len(p.nodes))
+	result = append(result, p.nodes[p.current])
+	for i, n := range p.nodes {
+		if i != p.current && n.status.Healthy {
+			result = append(result, n)
+		}
+	}
+	for i, n := range p.nodes {
+		if i != p.current && !n.status.Healthy {
+			result = append(result, n)
+		}
+	}
+	return result
+}
+
+// isTransportError Whether err was caused by the node or the connection to it, rather than by the request
+// Dial errors, timeouts, HTTP 5xx and undecodable responses are transport errors, errors reported by the RPC server are not
+func isTransportError(err error) bool {
+	var responseErr *rpc.ResponseError
+	if errors.As(err, &responseErr) {
+		return false
+	}
+	var statusErr rpc.StatusCodeError
+	if errors.As(err, &statusErr) {
+		return statusErr >= http.StatusInternalServerError
+	}
+	return true
+}
+
+// poolCall Calls f on nodes until one succeeds
+// Only transport errors mark the node as failed and fail over, errors reported by the node are returned directly
+func poolCall[T any](p *PoolClient, f func(c *Client) (T, error)) (result T, err error) {
+	for _, n := range p.candidates() {
+		if result, err = f(n.client); err == nil {
+			return result, nil
+		}
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || !isTransportError(err) {
+			return result, err
+		}
+		p.markFailed(n, err)
+	}
+	return result, err
+}
+
+func (p *PoolClient) SetThrottle(timesPerSecond uint64) {
+	for _, n := range p.nodes {
+		n.client.SetThrottle(timesPerSecond)
+	}
+}
+
+func (p *PoolClient) GetTransactions(txIds ...types.Hash) (data [][]byte, jsonTx []*daemon.TransactionJSON, err error) {
+	data, err = poolCall(p, func(c *Client) (d [][]byte, err error) {
+		d, jsonTx, err = c.GetTransactions(txIds...)
+		return d, err
+	})
+	return data, jsonTx, err
+}
+
+func (p *PoolClient) GetPrunedTransactions(txIds ...types.Hash) (data [][]byte, jsonTx []*daemon.TransactionJSON, err error) {
+	data, err = poolCall(p, func(c *Client) (d [][]byte, err error) {
+		d, jsonTx, err = c.GetPrunedTransactions(txIds...)
+		return d, err
+	})
+	return data, jsonTx, err
+}
+
+func (p *PoolClient) GetTransactionInputs(ctx context.Context, hashes ...types.Hash) ([]TransactionInputResult, error) {
+	return poolCall(p, func(c *Client) ([]TransactionInputResult, error) {
+		return c.GetTransactionInputs(ctx, hashes...)
+	})
+}
+
+func (p *PoolClient) IsKeyImageSpent(ki ...curve25519.PublicKeyBytes) (status []int, err error) {
+	return poolCall(p, func(c *Client) ([]int, error) {
+		return c.IsKeyImageSpent(ki...)
+	})
+}
+
+func (p *PoolClient) GetOutputIndexes(id types.Hash) (indexes []uint64, err error) {
+	return poolCall(p, func(c *Client) ([]uint64, error) {
+		return c.GetOutputIndexes(id)
+	})
+}
+
+func (p *PoolClient) GetOuts(inputs ...daemon.GetOutsInput) ([]Output, error) {
+	return poolCall(p, func(c *Client) ([]Output, error) {
+		return c.GetOuts(inputs...)
+	})
+}
+
+func (p *PoolClient) GetOutsBin(ctx context.Context, inputs ...daemon.GetOutsInput) ([]Output, error) {
+	return poolCall(p, func(c *Client) ([]Output, error) {
+		return c.GetOutsBin(ctx, inputs...)
+	})
+}
+
+func (p *PoolClient) GetBlocksBin(ctx context.Context, blockIds []types.Hash, startHeight uint64, prune bool) (*daemon.GetBlocksBinResult, error) {
+	return poolCall(p, func(c *Client) (*daemon.GetBlocksBinResult, error) {
+		return c.GetBlocksBin(ctx, blockIds, startHeight, prune)
+	})
+}
+
+func (p *PoolClient) GetHashesBin(ctx context.Context, blockIds []types.Hash, startHeight uint64) (*daemon.GetHashesBinResult, error) {
+	return poolCall(p, func(c *Client) (*daemon.GetHashesBinResult, error) {
+		return c.GetHashesBin(ctx, blockIds, startHeight)
+	})
+}
+
+func (p *PoolClient) GetOutputDistribution(ctx context.Context, fromHeight, toHeight uint64, cumulative bool, amounts ...uint64) ([]daemon.OutputDistribution, error) {
+	return poolCall(p, func(c *Client) ([]daemon.OutputDistribution, error) {
+		return c.GetOutputDistribution(ctx, fromHeight, toHeight, cumulative, amounts...)
+	})
+}
+
+func (p *PoolClient) GetVersion() (*daemon.GetVersionResult, error) {
+	return poolCall(p, (*Client).GetVersion)
+}
+
+func (p *PoolClient) GetPeerList() (*daemon.GetPeerListResult, error) {
+	return poolCall(p, (*Client).GetPeerList)
+}
+
+func (p *PoolClient) GetInfo() (*daemon.GetInfoResult, error) {
+	return poolCall(p, (*Client).GetInfo)
+}
+
+func (p *PoolClient) SyncInfo() (*daemon.SyncInfoResult, error) {
+	return poolCall(p, (*Client).SyncInfo)
+}
+
+func (p *PoolClient) GetAlternateChains(ctx context.Context) (*daemon.GetAlternateChainsResult, error) {
+	return poolCall(p, func(c *Client) (*daemon.GetAlternateChainsResult, error) {
+		return c.GetAlternateChains(ctx)
+	})
+}
+
+func (p *PoolClient) GetTransactionPool(ctx context.Context) (*daemon.GetTransactionPoolResult, error) {
+	return poolCall(p, func(c *Client) (*daemon.GetTransactionPoolResult, error) {
+		return c.GetTransactionPool(ctx)
+	})
+}
+
+func (p *PoolClient) GetBlockHeaderByHash(hash types.Hash, ctx context.Context) (*daemon.BlockHeader, error) {
+	return poolCall(p, func(c *Client) (*daemon.BlockHeader, error) {
+		return c.GetBlockHeaderByHash(hash, ctx)
+	})
+}
+
+func (p *PoolClient) GetBlock(hash types.Hash, fillPowHash bool, ctx context.Context) (*daemon.GetBlockResult, error) {
+	return poolCall(p, func(c *Client) (*daemon.GetBlockResult, error) {
+		return c.GetBlock(hash, fillPowHash, ctx)
+	})
+}
+
+func (p *PoolClient) GetBlockByHeight(height uint64, ctx context.Context) (*daemon.GetBlockResult, error) {
+	return poolCall(p, func(c *Client) (*daemon.GetBlockResult, error) {
+		return c.GetBlockByHeight(height, ctx)
+	})
+}
+
+func (p *PoolClient) GetLastBlockHeader() (*daemon.GetLastBlockHeaderResult, error) {
+	return poolCall(p, (*Client).GetLastBlockHeader)
+}
+
+func (p *PoolClient) GetBlockHeaderByHeight(height uint64, ctx context.Context) (*daemon.GetBlockHeaderByHeightResult, error) {
+	return poolCall(p, func(c *Client) (*daemon.GetBlockHeaderByHeightResult, error) {
+		return c.GetBlockHeaderByHeight(height, ctx)
+	})
+}
+
+func (p *PoolClient) GetBlockHeadersRangeResult(start, end uint64, ctx context.Context) (*daemon.GetBlockHeadersRangeResult, error) {
+	return poolCall(p, func(c *Client) (*daemon.GetBlockHeadersRangeResult, error) {
+		return c.GetBlockHeadersRangeResult(start, end, ctx)
+	})
+}
+
+// SubmitBlock Submits the block to all healthy nodes, or to all nodes if none is healthy
+// Returns the first successful result, or an error if all nodes failed
+func (p *PoolClient) SubmitBlock(blob []byte) (*daemon.SubmitBlockResult, error) {
+	var nodes []*poolNode
+	func() {
+		p.lock.RLock()
+		defer p.lock.RUnlock()
+		for _, n := range p.nodes {
+			if n.status.Healthy {
+				nodes = append(nodes, n)
+			}
+		}
+		if len(nodes) == 0 {
+			nodes = p.nodes
+		}
+	}()
+
+	type submitResult struct {
+		result *daemon.SubmitBlockResult
+		err    error
+	}
+	results := make([]submitResult, len(nodes))
+
+	var wg sync.WaitGroup
+	for i, n := range nodes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := n.client.SubmitBlock(blob)
+			if err == nil && result.Error != nil {
+				err = utils.ErrorfNoEscape("submit error %d: %s", result.Error.Code, result.Error.Message)
+			}
+			results[i] = submitResult{result: result, err: err}
+		}()
+	}
+	wg.Wait()
+
+	var errs []error
+	for i, r := range results {
+		if r.err == nil {
+			return r.result, nil
+		}
+		utils.Errorf("RPC", "Node %s could not submit block: %s", nodes[i].address, r.err)
+		errs = append(errs, r.err)
+	}
+	return nil, errors.Join(errs...)
+}
+
+func (p *PoolClient) GetMinerData() (*daemon.GetMinerDataResult, error) {
+	return poolCall(p, (*Client).GetMinerData)
+}
+
+func (p *PoolClient) GetBlockTemplate(address string) (*daemon.GetBlockTemplateResult, error) {
+	return poolCall(p, func(c *Client) (*daemon.GetBlockTemplateResult, error) {
+		return c.GetBlockTemplate(address)
+	})
+}
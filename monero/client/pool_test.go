@@ -0,0 +1,161 @@
+package client
+
+import (
+	"context"
+	"encoding/json" //nolint:depguard
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/client/rpc"
+	"git.gammaspectra.live/P2Pool/consensus/v5/types"
+)
+
+// fakeDaemon Serves get_info and sync_info with a fixed height and tip
+func fakeDaemon(t *testing.T, height uint64, topHash string, submitted *int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Method string `json:"method"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Error(err)
+			return
+		}
+		var result map[string]any
+		switch req.Method {
+		case "get_info":
+			result = map[string]any{
+				"status":         "OK",
+				"height":         height,
+				"target_height":  height,
+				"top_block_hash": topHash,
+				"synchronized":   true,
+			}
+		case "sync_info":
+			result = map[string]any{
+				"status":        "OK",
+				"height":        height,
+				"target_height": 0,
+			}
+		case "get_block":
+			// monerod reports unknown blocks as an RPC error
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"id":      "0",
+				"jsonrpc": "2.0",
+				"error": map[string]any{
+					"code":    -5,
+					"message": "Internal error: can't get block by hash",
+				},
+			})
+			return
+		case "get_miner_data":
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		case "submit_block":
+			*submitted++
+			result = map[string]any{
+				"status": "OK",
+			}
+		default:
+			http.Error(w, "unknown method", http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"id":      "0",
+			"jsonrpc": "2.0",
+			"result":  result,
+		})
+	}))
+}
+
+func TestPoolClient(t *testing.T) {
+	const tipA = "d9922a1d03160a16e4704b44dc0ed0e5dffc46db94ca86d6f10545132a0926a0"
+	const tipB = "dc18b8ad30e15b21c733032288ac0afa08ae51c972b4ee6546ad74aa77c39ebb"
+
+	var submittedBehind, submittedA, submittedB int
+	behind := fakeDaemon(t, 90, tipA, &submittedBehind)
+	defer behind.Close()
+	a := fakeDaemon(t, 100, tipA, &submittedA)
+	defer a.Close()
+	b := fakeDaemon(t, 100, tipB, &submittedB)
+	defer b.Close()
+
+	p, err := NewPoolClient([]string{behind.URL, a.URL, b.URL}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p.CheckHealth()
+
+	status := p.Status()
+	if status[0].Healthy {
+		t.Fatal("node behind is healthy")
+	}
+	if !status[1].Healthy || !status[2].Healthy {
+		t.Fatal("nodes at tip are not healthy")
+	}
+	if !status[1].Inconsistent || !status[2].Inconsistent {
+		t.Fatal("different tips not flagged")
+	}
+	if p.Current() != a.URL {
+		t.Fatalf("expected current node %s, got %s", a.URL, p.Current())
+	}
+
+	if _, err = p.SubmitBlock([]byte{1}); err != nil {
+		t.Fatal(err)
+	}
+	if submittedBehind != 0 || submittedA != 1 || submittedB != 1 {
+		t.Fatalf("unexpected submit fan out %d %d %d", submittedBehind, submittedA, submittedB)
+	}
+
+	// fail over when current node goes away
+	a.Close()
+	if info, err := p.GetInfo(); err != nil {
+		t.Fatal(err)
+	} else if info.TopBlockHash.String() != tipB {
+		t.Fatalf("unexpected tip %s", info.TopBlockHash)
+	}
+	if p.Current() != b.URL {
+		t.Fatalf("expected current node %s, got %s", b.URL, p.Current())
+	}
+}
+
+func TestPoolClientErrors(t *testing.T) {
+	const tip = "d9922a1d03160a16e4704b44dc0ed0e5dffc46db94ca86d6f10545132a0926a0"
+
+	var submittedA, submittedB int
+	a := fakeDaemon(t, 100, tip, &submittedA)
+	defer a.Close()
+	b := fakeDaemon(t, 100, tip, &submittedB)
+	defer b.Close()
+
+	p, err := NewPoolClient([]string{a.URL, b.URL}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.CheckHealth()
+
+	// errors reported by the node are returned without failing over
+	_, err = p.GetBlock(types.ZeroHash, false, context.Background())
+	var responseErr *rpc.ResponseError
+	if !errors.As(err, &responseErr) || responseErr.Code != -5 {
+		t.Fatalf("expected rpc error, got %v", err)
+	}
+	if status := p.Status(); !status[0].Healthy || !status[1].Healthy {
+		t.Fatal("node is unhealthy after rpc error")
+	}
+	if p.Current() != a.URL {
+		t.Fatalf("expected current node %s, got %s", a.URL, p.Current())
+	}
+
+	// HTTP 5xx fails over to all nodes
+	_, err = p.GetMinerData()
+	var statusErr rpc.StatusCodeError
+	if !errors.As(err, &statusErr) || statusErr != http.StatusServiceUnavailable {
+		t.Fatalf("expected status code error, got %v", err)
+	}
+	if status := p.Status(); status[0].Healthy || status[1].Healthy {
+		t.Fatal("node is healthy after transport error")
+	}
+}
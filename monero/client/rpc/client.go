@@ -110,6 +110,24 @@ type ResponseEnvelope struct {
 	} `json:"error"`
 }
 
+// ResponseError is an error reported by the RPC server itself, either in the
+// response envelope or in the status of the response.
+type ResponseError struct {
+	Code    int
+	Message string
+}
+
+func (e *ResponseError) Error() string {
+	return fmt.Sprintf("rpc error: code=%d message=%s", e.Code, e.Message)
+}
+
+// StatusCodeError is a non-2xx HTTP status code returned by the RPC server.
+type StatusCodeError int
+
+func (e StatusCodeError) Error() string {
+	return fmt.Sprintf("non-2xx status code: %d", int(e))
+}
+
 // RequestEnvelope wraps all requests made to the RPC server.
 type RequestEnvelope struct {
 	ID      string `json:"id"`
@@ -209,10 +227,10 @@ func (c *Client) JSONRPC(ctx context.Context, method string, params any, respons
 	}
 
 	if rpcResponseBody.Error.Code != 0 || rpcResponseBody.Error.Message != "" {
-		return fmt.Errorf("rpc error: code=%d message=%s",
-			rpcResponseBody.Error.Code,
-			rpcResponseBody.Error.Message,
-		)
+		return &ResponseError{
+			Code:    rpcResponseBody.Error.Code,
+			Message: rpcResponseBody.Error.Message,
+		}
 	}
 
 	return nil
@@ -276,7 +294,7 @@ func (c *Client) submitRawRequest(req *http.Request, n int, body []byte, respons
 	defer resp.Body.Close()
 
 	if resp.StatusCode < 200 || resp.StatusCode > 299 {
-		return fmt.Errorf("non-2xx status code: %d", resp.StatusCode)
+		return StatusCodeError(resp.StatusCode)
 	}
 
 	if response != nil {
@@ -2,65 +2,202 @@ package daemon
 
 import (
 	"context"
-	"errors"
+	"fmt"
 	"io"
 
 	"git.gammaspectra.live/P2Pool/consensus/v5/monero/client/levin"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/client/rpc"
 	"git.gammaspectra.live/P2Pool/consensus/v5/types"
 )
 
 const (
-	endpointGetOIndexes = "/get_o_indexes.bin"
+	endpointGetOIndexes              = "/get_o_indexes.bin"
+	endpointGetBlocksBin             = "/get_blocks.bin"
+	endpointGetHashesBin             = "/get_hashes.bin"
+	endpointGetOutsBin               = "/get_outs.bin"
+	endpointGetOutputDistributionBin = "/get_output_distribution.bin"
 )
 
-func (c *Client) GetOIndexes(
-	ctx context.Context, txid types.Hash,
-) (indexes []uint64, finalError error) {
+// binaryResponse Response of a binary endpoint, which carries its status
+type binaryResponse interface {
+	Check(endpoint string) error
+}
 
-	storage := levin.PortableStorage{Entries: levin.Entries{
-		levin.Entry{
-			Name:         "txid",
-			Serializable: levin.BoostString(txid[:]),
-		},
-	}}
+// binaryResponseStatus Status common to all binary endpoint responses, embedded in their response types
+type binaryResponseStatus struct {
+	Status string `levin:"status"`
+}
 
-	data, err := storage.Bytes()
-	if err != nil {
-		return nil, err
+func (s binaryResponseStatus) Check(endpoint string) error {
+	if s.Status != "OK" {
+		return fmt.Errorf("%s: %w", endpoint, &rpc.ResponseError{Message: "status " + s.Status})
 	}
+	return nil
+}
 
-	var buf []byte
-	err = c.RawBinaryRequest(ctx, endpointGetOIndexes, data, func(resp io.ReadCloser) error {
-		buf, err = io.ReadAll(resp)
+// binaryRequest Sends a Portable Storage request to a binary endpoint, and decodes its response and checks its status in a single pass
+func (c *Client) binaryRequest(ctx context.Context, endpoint string, request any, response binaryResponse) (err error) {
+	data, err := levin.Marshal(request)
+	if err != nil {
 		return err
+	}
+
+	err = c.RawBinaryRequest(ctx, endpoint, data, func(resp io.ReadCloser) error {
+		buf, err := io.ReadAll(resp)
+		if err != nil {
+			return err
+		}
+		return levin.Unmarshal(buf, response)
 	})
 	if err != nil {
+		return err
+	}
+
+	return response.Check(endpoint)
+}
+
+func (c *Client) GetOIndexes(
+	ctx context.Context, txid types.Hash,
+) (indexes []uint64, err error) {
+	request := struct {
+		TxId types.Hash `levin:"txid"`
+	}{
+		TxId: txid,
+	}
+
+	var response struct {
+		OIndexes []uint64 `levin:"o_indexes"`
+		binaryResponseStatus
+	}
+
+	if err = c.binaryRequest(ctx, endpointGetOIndexes, &request, &response); err != nil {
 		return nil, err
 	}
 
-	defer func() {
-		if r := recover(); r != nil {
-			indexes = nil
-			finalError = errors.New("error decoding")
-		}
-	}()
-	responseStorage, err := levin.NewPortableStorageFromBytes(buf)
-	if err != nil {
+	return response.OIndexes, nil
+}
+
+type TransactionBlobEntry = levin.TransactionBlobEntry
+
+type BlockCompleteEntry = levin.BlockCompleteEntry
+
+type BlockOutputIndices struct {
+	Transactions []struct {
+		Indices []uint64 `levin:"indices"`
+	} `levin:"indices"`
+}
+
+type GetBlocksBinResult struct {
+	Blocks        []BlockCompleteEntry `levin:"blocks"`
+	StartHeight   uint64               `levin:"start_height"`
+	CurrentHeight uint64               `levin:"current_height"`
+	// OutputIndices Global output indices for each block, for each transaction starting with the miner transaction
+	OutputIndices []BlockOutputIndices `levin:"output_indices"`
+
+	binaryResponseStatus
+}
+
+// GetBlocksBin Gets blocks from get_blocks.bin, starting at startHeight, or if zero, after the first known id in blockIds
+// blockIds is a sparse list of known block ids ordered from most recent, and must end with the genesis block id when startHeight is zero.
+// When prune is set transactions are pruned, with their prunable hashes included.
+func (c *Client) GetBlocksBin(ctx context.Context, blockIds []types.Hash, startHeight uint64, prune bool) (*GetBlocksBinResult, error) {
+	request := struct {
+		RequestedInfo uint8        `levin:"requested_info"`
+		BlockIds      []types.Hash `levin:"block_ids,blob"`
+		StartHeight   uint64       `levin:"start_height"`
+		Prune         bool         `levin:"prune"`
+		NoMinerTx     bool         `levin:"no_miner_tx"`
+	}{
+		BlockIds:    blockIds,
+		StartHeight: startHeight,
+		Prune:       prune,
+	}
+
+	result := &GetBlocksBinResult{}
+	if err := c.binaryRequest(ctx, endpointGetBlocksBin, &request, result); err != nil {
 		return nil, err
 	}
-	for _, e := range responseStorage.Entries {
-		if e.Name == "o_indexes" {
-			if entries, ok := e.Value.(levin.Entries); ok {
-				indexes = make([]uint64, 0, len(entries))
-				for _, e2 := range entries {
-					if v, ok := e2.Value.(uint64); ok {
-						indexes = append(indexes, v)
-					}
-				}
-				return indexes, nil
-			}
-		}
+
+	return result, nil
+}
+
+type GetHashesBinResult struct {
+	BlockIds      []types.Hash `levin:"m_block_ids,blob"`
+	StartHeight   uint64       `levin:"start_height"`
+	CurrentHeight uint64       `levin:"current_height"`
+
+	binaryResponseStatus
+}
+
+// GetHashesBin Gets block ids from get_hashes.bin, with the same starting rules as GetBlocksBin
+func (c *Client) GetHashesBin(ctx context.Context, blockIds []types.Hash, startHeight uint64) (*GetHashesBinResult, error) {
+	request := struct {
+		BlockIds    []types.Hash `levin:"block_ids,blob"`
+		StartHeight uint64       `levin:"start_height"`
+	}{
+		BlockIds:    blockIds,
+		StartHeight: startHeight,
+	}
+
+	result := &GetHashesBinResult{}
+	if err := c.binaryRequest(ctx, endpointGetHashesBin, &request, result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// GetOutsBin Same as GetOuts, via get_outs.bin
+func (c *Client) GetOutsBin(ctx context.Context, outputs []GetOutsInput, getTxId bool) (*GetOutsResult, error) {
+	request := struct {
+		Outputs []GetOutsInput `levin:"outputs"`
+		GetTxId bool           `levin:"get_txid"`
+	}{
+		Outputs: outputs,
+		GetTxId: getTxId,
+	}
+
+	result := &GetOutsResult{}
+	if err := c.binaryRequest(ctx, endpointGetOutsBin, &request, result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+type OutputDistribution struct {
+	Amount      uint64 `levin:"amount"`
+	StartHeight uint64 `levin:"start_height"`
+	Base        uint64 `levin:"base"`
+	// Distribution Number of outputs per block starting at StartHeight, or cumulative number of outputs if requested
+	Distribution []uint64 `levin:"distribution,blob"`
+}
+
+// GetOutputDistributionBin Gets output distributions for amounts from get_output_distribution.bin. Use amount zero for RingCT outputs
+// toHeight zero requests up to the current height.
+func (c *Client) GetOutputDistributionBin(ctx context.Context, amounts []uint64, fromHeight, toHeight uint64, cumulative bool) ([]OutputDistribution, error) {
+	request := struct {
+		Amounts    []uint64 `levin:"amounts"`
+		FromHeight uint64   `levin:"from_height"`
+		ToHeight   uint64   `levin:"to_height"`
+		Cumulative bool     `levin:"cumulative"`
+		Binary     bool     `levin:"binary"`
+		Compress   bool     `levin:"compress"`
+	}{
+		Amounts:    amounts,
+		FromHeight: fromHeight,
+		ToHeight:   toHeight,
+		Cumulative: cumulative,
+		Binary:     true,
+	}
+
+	var result struct {
+		Distributions []OutputDistribution `levin:"distributions"`
+		binaryResponseStatus
+	}
+	if err := c.binaryRequest(ctx, endpointGetOutputDistributionBin, &request, &result); err != nil {
+		return nil, err
 	}
 
-	return nil, errors.New("could not get outputs")
+	return result.Distributions, nil
 }
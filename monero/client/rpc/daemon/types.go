@@ -10,23 +10,28 @@ import (
 type RPCResultFooter struct {
 	// Status dictates whether the request worked or not. "OK" means good.
 	//
-	Status string `json:"status"`
+	Status string `json:"status" levin:"status"`
 
 	// States if the result is obtained using the bootstrap mode, and is
 	// therefore not trusted (`true`), or when the daemon is fully synced
 	// and thus handles the RPC locally (`false`).
 	//
-	Untrusted bool `json:"untrusted"`
+	Untrusted bool `json:"untrusted" levin:"untrusted"`
 
 	// Credits indicates the number of credits available to the requesting
 	// client, if payment for RPC is enabled, otherwise, 0.
 	//
-	Credits uint64 `json:"credits,omitzero"`
+	Credits uint64 `json:"credits,omitzero" levin:"credits"`
 
 	// TopHash is the hash of the highest block in the chain, If payment
 	// for RPC is enabled, otherwise, empty.
 	//
-	TopHash string `json:"top_hash,omitempty"`
+	TopHash string `json:"top_hash,omitempty" levin:"top_hash"`
+}
+
+// Check Returns an error if Status is not OK, for responses of binary endpoints
+func (f RPCResultFooter) Check(endpoint string) error {
+	return binaryResponseStatus{Status: f.Status}.Check(endpoint)
 }
 
 // GetAlternateChainsResult is the result of a call to the GetAlternateChains
@@ -282,6 +287,10 @@ type GetBlockTemplateResult struct {
 	//
 	ReservedOffset int `json:"reserved_offset"`
 
+	// SeedHash is the RandomX seed hash of the block.
+	//
+	SeedHash types.Hash `json:"seed_hash"`
+
 	RPCResultFooter `json:",inline"` //nolint:embeddedstructfieldcheck,revive
 }
 
@@ -363,18 +372,20 @@ type GetConnectionsResult struct {
 }
 
 type GetOutsInput struct {
-	Amount uint64 `json:"amount"`
-	Index  uint64 `json:"index"`
+	Amount uint64 `json:"amount" levin:"amount"`
+	Index  uint64 `json:"index" levin:"index"`
+}
+
+type GetOutsOutput struct {
+	Height   uint64     `json:"height" levin:"height"`
+	Key      types.Hash `json:"key" levin:"key"`
+	Mask     types.Hash `json:"mask" levin:"mask"`
+	Txid     types.Hash `json:"txid" levin:"txid"`
+	Unlocked bool       `json:"unlocked" levin:"unlocked"`
 }
 
 type GetOutsResult struct {
-	Outs []struct {
-		Height   uint64     `json:"height"`
-		Key      types.Hash `json:"key"`
-		Mask     types.Hash `json:"mask"`
-		Txid     types.Hash `json:"txid"`
-		Unlocked bool       `json:"unlocked"`
-	} `json:"outs"`
+	Outs []GetOutsOutput `json:"outs" levin:"outs"`
 
 	RPCResultFooter `json:",inline"` //nolint:embeddedstructfieldcheck,revive
 }
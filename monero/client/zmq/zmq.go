@@ -3,16 +3,42 @@ package zmq
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"slices"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"git.gammaspectra.live/P2Pool/consensus/v5/utils"
 	"git.gammaspectra.live/P2Pool/zmq4"
 )
 
+const (
+	// ReconnectMinDelay Initial delay before reconnecting after the connection failed
+	ReconnectMinDelay = time.Second
+	// ReconnectMaxDelay Maximum delay between reconnection attempts
+	ReconnectMaxDelay = time.Minute
+)
+
+// reconnectWait Waits delay before the next reconnection attempt, or returns early when ctx is done
+// Replaced in tests to observe the backoff without waiting.
+var reconnectWait = func(ctx context.Context, delay time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(delay):
+		return nil
+	}
+}
+
 type Client struct {
 	endpoint string
-	sub      zmq4.Socket
+
+	lock   sync.Mutex
+	sub    zmq4.Socket
+	closed atomic.Bool
 }
 
 // NewClient instantiates a new client that will receive monerod's zmq events.
@@ -55,25 +81,78 @@ func (c *Client) Listen(ctx context.Context, listeners Listeners, success func()
 	return nil
 }
 
-// Close closes any established connection, if any.
+// ListenWithReconnect listens like Listen, but reconnects with exponential
+// backoff when the connection fails, until ctx is done or the client is closed.
+//
+//   - `success` is called once, after the first subscription succeeds
+//
+//   - `resynced` is called after every later successful reconnection, before
+//     any new events are delivered. Events published while disconnected are
+//     lost, so it should recover any missed state by other means.
+func (c *Client) ListenWithReconnect(ctx context.Context, listeners Listeners, success func(), resynced func()) error {
+	delay := ReconnectMinDelay
+	var connected bool
+	for {
+		err := c.Listen(ctx, listeners, func() {
+			delay = ReconnectMinDelay
+			if !connected {
+				connected = true
+				if success != nil {
+					success()
+				}
+			} else if resynced != nil {
+				resynced()
+			}
+		})
+		_ = c.closeSocket()
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if c.closed.Load() {
+			return err
+		}
+
+		utils.Errorf("ZMQ", "connection to %s failed, reconnecting in %s: %s", c.endpoint, delay, err)
+
+		if err = reconnectWait(ctx, delay); err != nil {
+			return err
+		}
+		delay = min(delay*2, ReconnectMaxDelay)
+	}
+}
+
+// Close closes any established connection, if any, and stops reconnecting.
 func (c *Client) Close() error {
+	c.closed.Store(true)
+	return c.closeSocket()
+}
+
+func (c *Client) closeSocket() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
 	if c.sub == nil {
 		return nil
 	}
 
-	return c.sub.Close()
+	err := c.sub.Close()
+	c.sub = nil
+	return err
 }
 
 func (c *Client) listen(ctx context.Context, topics ...Topic) error {
-	c.sub = zmq4.NewSub(ctx)
+	sub := zmq4.NewSub(ctx)
+	c.lock.Lock()
+	c.sub = sub
+	c.lock.Unlock()
 
-	err := c.sub.Dial(c.endpoint)
+	err := sub.Dial(c.endpoint)
 	if err != nil {
 		return fmt.Errorf("dial '%s': %w", c.endpoint, err)
 	}
 
 	for _, topic := range topics {
-		err = c.sub.SetOption(zmq4.OptionSubscribe, string(topic))
+		err = sub.SetOption(zmq4.OptionSubscribe, string(topic))
 		if err != nil {
 			return fmt.Errorf("subscribe: %w", err)
 		}
@@ -83,9 +162,16 @@ func (c *Client) listen(ctx context.Context, topics ...Topic) error {
 }
 
 func (c *Client) loop(listeners Listeners) error {
+	c.lock.Lock()
+	sub := c.sub
+	c.lock.Unlock()
+	if sub == nil {
+		return errors.New("client closed")
+	}
+
 	topics := listeners.Topics()
 	for {
-		msg, err := c.sub.Recv()
+		msg, err := sub.Recv()
 		if err != nil {
 			return fmt.Errorf("recv: %w", err)
 		}
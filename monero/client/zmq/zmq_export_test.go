@@ -1,3 +1,17 @@
 package zmq
 
+import (
+	"context"
+	"time"
+)
+
 var JSONFromFrame = jsonFromFrame
+
+// SetReconnectWait Replaces the wait between reconnection attempts, returning a function that restores it
+func SetReconnectWait(f func(ctx context.Context, delay time.Duration) error) (restore func()) {
+	old := reconnectWait
+	reconnectWait = f
+	return func() {
+		reconnectWait = old
+	}
+}
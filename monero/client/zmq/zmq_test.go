@@ -9,8 +9,10 @@ import (
 	"testing"
 	"time"
 
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/client/fakemonerod"
 	"git.gammaspectra.live/P2Pool/consensus/v5/monero/client/zmq"
 	"git.gammaspectra.live/P2Pool/consensus/v5/p2pool/mempool"
+	"git.gammaspectra.live/P2Pool/zmq4"
 )
 
 func TestJSONFromFrame(t *testing.T) {
@@ -106,3 +108,190 @@ func TestClient(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestClientReconnect(t *testing.T) {
+	ctx, ctxFunc := context.WithTimeout(context.Background(), time.Second*10)
+	defer ctxFunc()
+
+	// reserve an address, then release it so the first connection attempt fails
+	pub := zmq4.NewPub(ctx)
+	if err := pub.Listen("tcp://127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	addr := pub.Addr().String()
+	_ = pub.Close()
+
+	client := zmq.NewClient("tcp://" + addr)
+	defer client.Close()
+
+	received := make(chan *zmq.FullMinerData, 16)
+	subscribed := make(chan struct{})
+	go func() {
+		_ = client.ListenWithReconnect(ctx, zmq.Listeners{
+			zmq.TopicFullMinerData: zmq.DecoderFullMinerData(func(data *zmq.FullMinerData) {
+				received <- data
+			}),
+		}, func() {
+			close(subscribed)
+		}, nil)
+	}()
+
+	pub = zmq4.NewPub(ctx)
+	defer pub.Close()
+	if err := pub.Listen("tcp://" + addr); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-subscribed:
+	case <-ctx.Done():
+		t.Fatal(ctx.Err())
+	}
+
+	// subscriptions propagate asynchronously, resend until received
+	ticker := time.NewTicker(time.Millisecond * 50)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			_ = pub.Send(zmq4.NewMsg([]byte(string(zmq.TopicFullMinerData) + `:{"height":1}`)))
+		case data := <-received:
+			if data.Height != 1 {
+				t.Fatalf("expected height 1, got %d", data.Height)
+			}
+			return
+		case <-ctx.Done():
+			t.Fatal(ctx.Err())
+		}
+	}
+}
+
+func TestClientReconnectPublisherRestart(t *testing.T) {
+	ctx, ctxFunc := context.WithTimeout(context.Background(), time.Second*30)
+	defer ctxFunc()
+
+	d, err := fakemonerod.New(fakemonerod.Config{Height: 100, ZMQ: "tcp://127.0.0.1:0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	// record the backoff instead of waiting, the client blocks until each delay is read
+	delays := make(chan time.Duration)
+	defer zmq.SetReconnectWait(func(ctx context.Context, delay time.Duration) error {
+		select {
+		case delays <- delay:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})()
+
+	client := zmq.NewClient(d.ZMQAddress())
+	defer client.Close()
+
+	received := make(chan *zmq.FullMinerData, 16)
+	subscribed := make(chan struct{})
+	resynced := make(chan struct{}, 1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = client.ListenWithReconnect(ctx, zmq.Listeners{
+			zmq.TopicFullMinerData: zmq.DecoderFullMinerData(func(data *zmq.FullMinerData) {
+				received <- data
+			}),
+		}, func() {
+			close(subscribed)
+		}, func() {
+			resynced <- struct{}{}
+		})
+	}()
+	// wait for the client to stop before the reconnect wait is restored
+	defer func() {
+		ctxFunc()
+		<-done
+	}()
+
+	expectDelay := func(expected time.Duration) {
+		t.Helper()
+		select {
+		case delay := <-delays:
+			if delay != expected {
+				t.Fatalf("expected reconnect delay %s, got %s", expected, delay)
+			}
+		case <-ctx.Done():
+			t.Fatal(ctx.Err())
+		}
+	}
+	// expectResync Waits for the resynced callback, attempts racing the restart must keep doubling the delay after last
+	expectResync := func(last time.Duration) {
+		t.Helper()
+		for {
+			select {
+			case <-resynced:
+				return
+			case delay := <-delays:
+				if delay != min(last*2, zmq.ReconnectMaxDelay) {
+					t.Fatalf("expected reconnect delay %s, got %s", min(last*2, zmq.ReconnectMaxDelay), delay)
+				}
+				last = delay
+			case <-ctx.Done():
+				t.Fatal(ctx.Err())
+			}
+		}
+	}
+	// subscriptions propagate asynchronously, resend until received
+	expectMinerData := func() {
+		t.Helper()
+		ticker := time.NewTicker(time.Millisecond * 50)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				d.PublishMinerData()
+			case data := <-received:
+				if expected := d.MinerData().Height; data.Height != expected {
+					t.Fatalf("expected height %d, got %d", expected, data.Height)
+				}
+				// drain resent copies
+				for len(received) > 0 {
+					<-received
+				}
+				return
+			case <-ctx.Done():
+				t.Fatal(ctx.Err())
+			}
+		}
+	}
+
+	select {
+	case <-subscribed:
+	case <-ctx.Done():
+		t.Fatal(ctx.Err())
+	}
+	expectMinerData()
+
+	// publisher goes away mid-stream, the receive loop fails first, then connection attempts fail
+	if err = d.StopZMQ(); err != nil {
+		t.Fatal(err)
+	}
+	d.Mine(1)
+	expectDelay(zmq.ReconnectMinDelay)
+	expectDelay(zmq.ReconnectMinDelay * 2)
+	if err = d.StartZMQ(); err != nil {
+		t.Fatal(err)
+	}
+	expectResync(zmq.ReconnectMinDelay * 2)
+	expectMinerData()
+
+	// backoff is reset after a successful reconnection
+	if err = d.StopZMQ(); err != nil {
+		t.Fatal(err)
+	}
+	expectDelay(zmq.ReconnectMinDelay)
+	if err = d.StartZMQ(); err != nil {
+		t.Fatal(err)
+	}
+	expectResync(zmq.ReconnectMinDelay)
+	expectMinerData()
+}
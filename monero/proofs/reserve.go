@@ -0,0 +1,328 @@
+package proofs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/crypto"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/crypto/curve25519"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/crypto/ringct"
+	"git.gammaspectra.live/P2Pool/consensus/v5/types"
+	"git.gammaspectra.live/P2Pool/consensus/v5/utils"
+	base58 "git.gammaspectra.live/P2Pool/monero-base58"
+)
+
+const ReserveProofPrefix = "ReserveProof"
+
+// ReserveProofEntry Proves ownership and amount of one unspent output, as wallet2 reserve_proof_entry
+type ReserveProofEntry[T curve25519.PointOperations] struct {
+	TransactionId types.Hash
+	// Index Output index within the transaction
+	Index uint64
+	// SharedSecret ECDH result between the account view key and the transaction public key used by the output
+	SharedSecret curve25519.PublicKeyBytes
+	KeyImage     curve25519.PublicKeyBytes
+
+	// SharedSecretSignature Tx proof of SharedSecret against the account view public key
+	SharedSecretSignature crypto.Signature[T]
+	// KeyImageSignature Ring signature of KeyImage with the output one-time address as the only ring member
+	KeyImageSignature crypto.Signature[T]
+}
+
+// ReserveProofSubaddress Signature by the spend key of an address that received one of the proven outputs
+type ReserveProofSubaddress[T curve25519.PointOperations] struct {
+	SpendPub  curve25519.PublicKeyBytes
+	Signature crypto.Signature[T]
+}
+
+// ReserveProof Proves that an account holds at least an amount, compatible with monero-wallet-cli get_reserve_proof
+type ReserveProof[T curve25519.PointOperations] struct {
+	Version uint8
+
+	Entries      []ReserveProofEntry[T]
+	Subaddresses []ReserveProofSubaddress[T]
+}
+
+// ReserveProofOutput An output to prove, with the transaction public key it was derived with and its one-time address key pair
+type ReserveProofOutput[T curve25519.PointOperations] struct {
+	TransactionId types.Hash
+	Index         uint64
+
+	TransactionPublicKey curve25519.PublicKey[T]
+	KeyPair              *crypto.KeyPair[T]
+}
+
+// GetReserveProof Creates a version 2 reserve proof for outputs of the account with the given primary spend and view public keys
+// subaddressKeys are the spend private keys of every address that received one of the outputs, including the primary address.
+func GetReserveProof[T curve25519.PointOperations](message string, spendPub, viewPub *curve25519.PublicKeyBytes, viewKey *curve25519.Scalar, outputs []ReserveProofOutput[T], subaddressKeys []*curve25519.Scalar, randomReader io.Reader) (ReserveProof[T], error) {
+	if len(outputs) == 0 {
+		return ReserveProof[T]{}, errors.New("no outputs to prove")
+	}
+
+	proof := ReserveProof[T]{
+		Version:      2,
+		Entries:      make([]ReserveProofEntry[T], len(outputs)),
+		Subaddresses: make([]ReserveProofSubaddress[T], 0, len(subaddressKeys)),
+	}
+
+	var keyImage curve25519.PublicKey[T]
+	for i, o := range outputs {
+		proof.Entries[i].TransactionId = o.TransactionId
+		proof.Entries[i].Index = o.Index
+		proof.Entries[i].KeyImage = crypto.GetBiasedKeyImage(&keyImage, o.KeyPair).AsBytes()
+	}
+
+	prefixHash := proof.PrefixHash(message, spendPub, viewPub)
+
+	var viewPubPoint, sharedSecret curve25519.PublicKey[T]
+	if _, err := viewPubPoint.SetBytes(viewPub[:]); err != nil {
+		return ReserveProof[T]{}, err
+	}
+
+	for i, o := range outputs {
+		e := &proof.Entries[i]
+
+		sharedSecret.ScalarMult(viewKey, &o.TransactionPublicKey)
+		e.SharedSecret = sharedSecret.AsBytes()
+		e.SharedSecretSignature = GenerateTxProof(prefixHash, &viewPubPoint, &o.TransactionPublicKey, nil, &sharedSecret, viewKey, proof.Version)
+
+		var rs ringct.RingSignature[T]
+		if !rs.Sign(types.Hash(e.KeyImage), ringct.Ring[T]{o.KeyPair.PublicKey}, o.KeyPair, randomReader) {
+			return ReserveProof[T]{}, errors.New("error signing key image")
+		}
+		e.KeyImageSignature = rs[0]
+	}
+
+	for _, key := range subaddressKeys {
+		proof.Subaddresses = append(proof.Subaddresses, ReserveProofSubaddress[T]{
+			SpendPub:  new(curve25519.PublicKey[T]).ScalarBaseMult(key).AsBytes(),
+			Signature: crypto.CreateMessageSignature[T](prefixHash, key, randomReader),
+		})
+	}
+
+	return proof, nil
+}
+
+// PrefixHash Hash signed by the proof, over the message, the account primary address keys and all key images
+func (p ReserveProof[T]) PrefixHash(message string, spendPub, viewPub *curve25519.PublicKeyBytes) types.Hash {
+	data := make([]byte, 0, len(message)+curve25519.PublicKeySize*(2+len(p.Entries)))
+	data = append(data, message...)
+	data = append(data, spendPub[:]...)
+	data = append(data, viewPub[:]...)
+	for _, e := range p.Entries {
+		data = append(data, e.KeyImage[:]...)
+	}
+	return crypto.Keccak256(data)
+}
+
+// VerifyEntry Verifies the shared secret and key image signatures of entry i
+// txPubs are the transaction public keys the output could be derived with, usually the main key and the additional key at the output index.
+func (p ReserveProof[T]) VerifyEntry(prefixHash types.Hash, i int, viewPub, oneTimeAddress *curve25519.PublicKey[T], txPubs ...curve25519.PublicKey[T]) bool {
+	if i < 0 || i >= len(p.Entries) {
+		return false
+	}
+	e := &p.Entries[i]
+
+	var sharedSecret, keyImage curve25519.PublicKey[T]
+	if _, err := sharedSecret.SetBytes(e.SharedSecret[:]); err != nil {
+		return false
+	}
+	if _, err := keyImage.SetBytes(e.KeyImage[:]); err != nil {
+		return false
+	}
+
+	var ok bool
+	for _, pub := range txPubs {
+		if VerifyTxProof(prefixHash, viewPub, &pub, nil, &sharedSecret, e.SharedSecretSignature, p.Version) {
+			ok = true
+			break
+		}
+	}
+	if !ok {
+		return false
+	}
+
+	rs := ringct.RingSignature[T]{e.KeyImageSignature}
+	return rs.Verify(types.Hash(e.KeyImage), ringct.Ring[T]{*oneTimeAddress}, &keyImage)
+}
+
+// VerifySubaddresses Verifies the signatures of all address spend keys
+func (p ReserveProof[T]) VerifySubaddresses(prefixHash types.Hash) bool {
+	var spendPub curve25519.PublicKey[T]
+	for _, s := range p.Subaddresses {
+		if _, err := spendPub.SetBytes(s.SpendPub[:]); err != nil {
+			return false
+		}
+		if !crypto.VerifyMessageSignature(prefixHash, &spendPub, s.Signature) {
+			return false
+		}
+	}
+	return true
+}
+
+func (p ReserveProof[T]) BufferLength() (n int) {
+	n = utils.UVarInt64Size(len(p.Entries)) + utils.UVarInt64Size(len(p.Subaddresses))
+	for _, e := range p.Entries {
+		n += 1 + types.HashSize + utils.UVarInt64Size(e.Index) + curve25519.PublicKeySize*2 + curve25519.PrivateKeySize*4
+	}
+	n += len(p.Subaddresses) * (1 + curve25519.PublicKeySize + curve25519.PrivateKeySize*2)
+	return n
+}
+
+func (p ReserveProof[T]) AppendBinary(preAllocatedBuf []byte) (data []byte, err error) {
+	data = preAllocatedBuf
+
+	data = binary.AppendUvarint(data, uint64(len(p.Entries)))
+	for _, e := range p.Entries {
+		// entry version
+		data = binary.AppendUvarint(data, 0)
+		data = append(data, e.TransactionId[:]...)
+		data = binary.AppendUvarint(data, e.Index)
+		data = append(data, e.SharedSecret[:]...)
+		data = append(data, e.KeyImage[:]...)
+		data = append(data, e.SharedSecretSignature.Bytes()...)
+		data = append(data, e.KeyImageSignature.Bytes()...)
+	}
+
+	data = binary.AppendUvarint(data, uint64(len(p.Subaddresses)))
+	for _, s := range p.Subaddresses {
+		// pair element count
+		data = binary.AppendUvarint(data, 2)
+		data = append(data, s.SpendPub[:]...)
+		data = append(data, s.Signature.Bytes()...)
+	}
+
+	return data, nil
+}
+
+func (p *ReserveProof[T]) FromReader(reader utils.ReaderAndByteReader) (err error) {
+	var n, version uint64
+	if n, err = utils.ReadCanonicalUvarint(reader); err != nil {
+		return err
+	}
+	if n > 1024*1024 {
+		return errors.New("too many entries")
+	}
+
+	var signatureBuf [curve25519.PrivateKeySize * 2]byte
+	readSignature := func(s *crypto.Signature[T]) error {
+		if _, err := utils.ReadFullNoEscape(reader, signatureBuf[:]); err != nil {
+			return err
+		}
+		sig := crypto.NewSignatureFromBytes[T](signatureBuf[:])
+		if sig == nil {
+			return errors.New("invalid signature")
+		}
+		*s = *sig
+		return nil
+	}
+
+	p.Entries = make([]ReserveProofEntry[T], 0, min(n, 1024))
+	for range n {
+		var e ReserveProofEntry[T]
+		if version, err = utils.ReadCanonicalUvarint(reader); err != nil {
+			return err
+		} else if version != 0 {
+			return errors.New("unsupported entry version")
+		}
+		if _, err = utils.ReadFullNoEscape(reader, e.TransactionId[:]); err != nil {
+			return err
+		}
+		if e.Index, err = utils.ReadCanonicalUvarint(reader); err != nil {
+			return err
+		}
+		if _, err = utils.ReadFullNoEscape(reader, e.SharedSecret[:]); err != nil {
+			return err
+		}
+		if _, err = utils.ReadFullNoEscape(reader, e.KeyImage[:]); err != nil {
+			return err
+		}
+		if err = readSignature(&e.SharedSecretSignature); err != nil {
+			return err
+		}
+		if err = readSignature(&e.KeyImageSignature); err != nil {
+			return err
+		}
+		p.Entries = append(p.Entries, e)
+	}
+
+	if n, err = utils.ReadCanonicalUvarint(reader); err != nil {
+		return err
+	}
+	if n > 1024*1024 {
+		return errors.New("too many subaddresses")
+	}
+
+	p.Subaddresses = make([]ReserveProofSubaddress[T], 0, min(n, 1024))
+	for range n {
+		var s ReserveProofSubaddress[T]
+		if version, err = utils.ReadCanonicalUvarint(reader); err != nil {
+			return err
+		} else if version != 2 {
+			return errors.New("invalid subaddress pair")
+		}
+		if _, err = utils.ReadFullNoEscape(reader, s.SpendPub[:]); err != nil {
+			return err
+		}
+		if err = readSignature(&s.Signature); err != nil {
+			return err
+		}
+		p.Subaddresses = append(p.Subaddresses, s)
+	}
+
+	return nil
+}
+
+func (p ReserveProof[T]) String() string {
+	data, _ := p.AppendBinary(make([]byte, 0, p.BufferLength()))
+	return utils.SprintfNoEscape("%sV%d", ReserveProofPrefix, p.Version) + string(base58.EncodeMoneroBase58(data))
+}
+
+// NewReserveProofFromString Parses a reserve proof, as created by monero-wallet-cli get_reserve_proof
+// Version 1 proofs are rejected, as wallet2 encodes them as a boost portable binary archive and signs them with version 1 tx proofs.
+func NewReserveProofFromString[T curve25519.PointOperations](str string) (ReserveProof[T], error) {
+	proof := ReserveProof[T]{}
+
+	if !strings.HasPrefix(str, ReserveProofPrefix) {
+		return ReserveProof[T]{}, errors.New("invalid reserve proof: unknown prefix")
+	}
+
+	offset := len(ReserveProofPrefix)
+
+	if len(str) <= offset+2 {
+		return ReserveProof[T]{}, errors.New("invalid reserve proof")
+	}
+
+	if str[offset] != 'V' {
+		return ReserveProof[T]{}, errors.New("invalid reserve proof")
+	}
+
+	switch str[offset+1] {
+	case '1':
+		return ReserveProof[T]{}, errors.New("invalid reserve proof: version 1 is not supported")
+	case '2':
+		proof.Version = 2
+	default:
+		return ReserveProof[T]{}, errors.New("invalid reserve proof: unknown version")
+	}
+
+	offset += 2
+
+	data := base58.DecodeMoneroBase58([]byte(str[offset:]))
+	if data == nil {
+		return ReserveProof[T]{}, errors.New("invalid reserve proof: invalid encoding")
+	}
+
+	reader := bytes.NewReader(data)
+	if err := proof.FromReader(reader); err != nil {
+		return ReserveProof[T]{}, utils.ErrorfNoEscape("invalid reserve proof: %w", err)
+	}
+	if reader.Len() > 0 {
+		return ReserveProof[T]{}, errors.New("invalid reserve proof: leftover bytes")
+	}
+
+	return proof, nil
+}
@@ -0,0 +1,146 @@
+package proofs
+
+import (
+	"crypto/rand"
+	"strings"
+	"testing"
+
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/crypto"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/crypto/curve25519"
+	"git.gammaspectra.live/P2Pool/consensus/v5/types"
+)
+
+func TestReserveProof(t *testing.T) {
+	t.Run("Constant", func(t *testing.T) {
+		testReserveProof[curve25519.ConstantTimeOperations](t)
+	})
+	t.Run("Variable", func(t *testing.T) {
+		testReserveProof[curve25519.VarTimeOperations](t)
+	})
+}
+
+func testReserveProof[T curve25519.PointOperations](t *testing.T) {
+	const n = 3
+	const message = "reserve proof"
+
+	randomKey := func() *curve25519.Scalar {
+		return curve25519.RandomScalar(new(curve25519.Scalar), rand.Reader)
+	}
+
+	spendKey, viewKey := randomKey(), randomKey()
+	spendPub := new(curve25519.PublicKey[T]).ScalarBaseMult(spendKey).AsBytes()
+	viewPub := new(curve25519.PublicKey[T]).ScalarBaseMult(viewKey).AsBytes()
+
+	var outputs []ReserveProofOutput[T]
+	var oneTimeAddresses, txPubs []curve25519.PublicKey[T]
+	for i := range n {
+		o := ReserveProofOutput[T]{
+			Index:   uint64(i),
+			KeyPair: crypto.NewKeyPairFromPrivate[T](randomKey()),
+		}
+		_, _ = rand.Read(o.TransactionId[:])
+		o.TransactionPublicKey.ScalarBaseMult(randomKey())
+		outputs = append(outputs, o)
+		oneTimeAddresses = append(oneTimeAddresses, o.KeyPair.PublicKey)
+		txPubs = append(txPubs, o.TransactionPublicKey)
+	}
+
+	proof, err := GetReserveProof(message, &spendPub, &viewPub, viewKey, outputs, []*curve25519.Scalar{spendKey}, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := NewReserveProofFromString[T](proof.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.String() != proof.String() {
+		t.Fatal("reserve proof does not round trip")
+	}
+
+	var viewPubPoint curve25519.PublicKey[T]
+	if _, err = viewPubPoint.SetBytes(viewPub[:]); err != nil {
+		t.Fatal(err)
+	}
+
+	verify := func(prefixHash types.Hash) bool {
+		for i := range n {
+			// the entry is found with any of the candidate transaction public keys
+			if !decoded.VerifyEntry(prefixHash, i, &viewPubPoint, &oneTimeAddresses[i], txPubs[(i+1)%n], txPubs[i]) {
+				return false
+			}
+		}
+		return decoded.VerifySubaddresses(prefixHash)
+	}
+
+	if !verify(decoded.PrefixHash(message, &spendPub, &viewPub)) {
+		t.Fatal("reserve proof verification failed")
+	}
+	if verify(decoded.PrefixHash("other message", &spendPub, &viewPub)) {
+		t.Fatal("reserve proof verified with a different message")
+	}
+	if decoded.VerifyEntry(decoded.PrefixHash(message, &spendPub, &viewPub), 0, &viewPubPoint, &oneTimeAddresses[1], txPubs[0]) {
+		t.Fatal("reserve proof entry verified with a different one-time address")
+	}
+
+	if _, err = NewReserveProofFromString[T](proof.String()[:len(proof.String())-4]); err == nil {
+		t.Fatal("truncated reserve proof was decoded")
+	}
+}
+
+// testReserveProofV2 Reserve proof of an output received by the first monero functional test wallet
+// It was built following wallet2 get_reserve_proof with fixed nonces, independently of this package.
+const testReserveProofV2 = "ReserveProofV21Ai2Z1SZz7SPR87pQmtcC9QrJhcDsDBdE8ULZ5yp5oAdUX3f64vCiSJjGyLqvhivxRL3SrfgihKSvPJJTnXh87o7RMxzXu4vtgG6NtnArns8fvdMT9koGbNvq6eVfGoRVtA1ZGunYr1TNnKXX1Vc2ffQcaPPMP2ScgHAyjmbwkLRtL6GaGZnXryCcbSMHE4b961xyv2hQwdqGWTDEfCJesksXtbPCDpYXHwhLoJfYVyoWnSsWHPhaJHKGDMCmNVgPehf5bFw29rD2SaP4H1bgkTg4TPz69bJPDk7MrVQdhT1hjepi1FhHrFbCvwJSiTBhxZS619Bep8Gg1BJBQvhG8gfGRtA6G7nfuozHVqSXTB58KrsJQXDpYDRgHCSigtrjK5kkEXiJZ2d26PHMdHWTCf4oXzfToc3GEZ64CU4PrRak9XyWnqHF713SrZUXy5"
+
+func TestReserveProofVector(t *testing.T) {
+	const message = "reserve proof fixture"
+
+	spendPub := types.MustBytes32FromString[curve25519.PublicKeyBytes]("1b3bd040020d3712ab84992b773d0a965134eb2df0392fb84af95de8a17be2ab")
+	viewPub := types.MustBytes32FromString[curve25519.PublicKeyBytes]("231c9bf8341c6a870d92e3fb98063a90a355fb8dbf74a8561b9d7f9273247e99")
+	txPub := types.MustBytes32FromString[curve25519.PublicKeyBytes]("d0fccc5644ac63ae3a78a3f9fbb750d4a2d5686c505bff5261cc53318a81a765")
+	oneTimeAddress := types.MustBytes32FromString[curve25519.PublicKeyBytes]("1081fea63f979ae953ebb8557335d0309cd8a6412d1f9d6bfed474465cebc170")
+
+	proof, err := NewReserveProofFromString[curve25519.VarTimeOperations](testReserveProofV2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if proof.String() != testReserveProofV2 {
+		t.Fatal("reserve proof does not round trip")
+	}
+	if proof.Version != 2 || len(proof.Entries) != 1 || len(proof.Subaddresses) != 1 {
+		t.Fatalf("unexpected proof version %d with %d entries and %d subaddresses", proof.Version, len(proof.Entries), len(proof.Subaddresses))
+	}
+
+	e := proof.Entries[0]
+	if e.TransactionId != types.MustHashFromString("293e461c9f89860416268eb8284a8e97224879163bdd2cab0ca8d057fe36a485") || e.Index != 1 {
+		t.Fatalf("unexpected output %s:%d", e.TransactionId, e.Index)
+	}
+	if e.SharedSecret != types.MustBytes32FromString[curve25519.PublicKeyBytes]("cc44123da7fcbf779921c9138a71d87f1e557b14978550130fc19370e291a5d1") {
+		t.Fatalf("unexpected shared secret %x", e.SharedSecret)
+	}
+	if e.KeyImage != types.MustBytes32FromString[curve25519.PublicKeyBytes]("4e60154e09202655468a3489cdd956875e931ad2e621c207366bb8d796c0f49b") {
+		t.Fatalf("unexpected key image %x", e.KeyImage)
+	}
+	if proof.Subaddresses[0].SpendPub != spendPub {
+		t.Fatalf("unexpected subaddress spend key %x", proof.Subaddresses[0].SpendPub)
+	}
+
+	prefixHash := proof.PrefixHash(message, &spendPub, &viewPub)
+	if prefixHash != types.MustHashFromString("f5bbd0ae6d143eaddf2dff42545a79fc980ba8509140f973339a13fd48ff5866") {
+		t.Fatalf("unexpected prefix hash %s", prefixHash)
+	}
+
+	viewPubPoint := viewPub.PointVarTime()
+	txPubPoint := txPub.PointVarTime()
+	oneTimeAddressPoint := oneTimeAddress.PointVarTime()
+	if !proof.VerifyEntry(prefixHash, 0, viewPubPoint, oneTimeAddressPoint, *txPubPoint) {
+		t.Fatal("reserve proof entry verification failed")
+	}
+	if !proof.VerifySubaddresses(prefixHash) {
+		t.Fatal("reserve proof subaddress verification failed")
+	}
+
+	if _, err = NewReserveProofFromString[curve25519.VarTimeOperations](strings.Replace(testReserveProofV2, "V2", "V1", 1)); err == nil {
+		t.Fatal("version 1 reserve proof was decoded")
+	}
+}
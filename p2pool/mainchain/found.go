@@ -0,0 +1,287 @@
+package mainchain
+
+import (
+	"cmp"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	mainblock "git.gammaspectra.live/P2Pool/consensus/v5/monero/block"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/transaction"
+	"git.gammaspectra.live/P2Pool/consensus/v5/p2pool/sidechain"
+	"git.gammaspectra.live/P2Pool/consensus/v5/types"
+	"git.gammaspectra.live/P2Pool/consensus/v5/utils"
+)
+
+type FoundBlockStatus int
+
+const (
+	// FoundBlockStatusFound The block was mined, but no block was seen on top of it yet
+	FoundBlockStatusFound FoundBlockStatus = iota
+	// FoundBlockStatusConfirmed The block is in the main chain with at least one confirmation
+	FoundBlockStatusConfirmed
+	// FoundBlockStatusOrphaned A different block is in the main chain at the same height
+	// Blocks can come back from this status if the main chain reorganizes back.
+	FoundBlockStatusOrphaned
+	// FoundBlockStatusUnlocked The block is in the main chain and its coinbase outputs can be spent
+	FoundBlockStatusUnlocked
+)
+
+func (s FoundBlockStatus) String() string {
+	switch s {
+	case FoundBlockStatusFound:
+		return "found"
+	case FoundBlockStatusConfirmed:
+		return "confirmed"
+	case FoundBlockStatusOrphaned:
+		return "orphaned"
+	case FoundBlockStatusUnlocked:
+		return "unlocked"
+	default:
+		return "unknown"
+	}
+}
+
+// FoundBlock A Monero block found by P2Pool and its lifecycle on the main chain
+type FoundBlock struct {
+	Main  *sidechain.ChainMain
+	Block *sidechain.PoolBlock
+
+	Status FoundBlockStatus
+	// Confirmations Number of main chain blocks on top of this block
+	Confirmations uint64
+	// UnlockHeight Main chain height at which the coinbase outputs can be spent
+	UnlockHeight uint64
+
+	// OutputsVerified Whether the coinbase outputs of the mined Monero block were checked against the outputs calculated from the share
+	OutputsVerified bool
+	// OutputsError Set when the mined coinbase outputs do not match the outputs calculated from the share
+	OutputsError error
+
+	FoundTime   time.Time
+	UpdatedTime time.Time
+}
+
+// FoundBlockTracker Follows found blocks through confirmations until they are unlocked or orphaned
+type FoundBlockTracker struct {
+	// calculateOutputs Returns the coinbase outputs expected for a share
+	calculateOutputs func(block *sidechain.PoolBlock) (transaction.Outputs, error)
+
+	lock   sync.RWMutex
+	blocks map[types.Hash]*FoundBlock
+}
+
+func NewFoundBlockTracker(s *sidechain.SideChain) *FoundBlockTracker {
+	return &FoundBlockTracker{
+		calculateOutputs: s.CalculateOutputs,
+		blocks:           make(map[types.Hash]*FoundBlock),
+	}
+}
+
+// verifyOutputs Checks that the coinbase outputs of the mined Monero block match the outputs calculated from the share
+func (t *FoundBlockTracker) verifyOutputs(block *sidechain.PoolBlock, mined *mainblock.PoolMainBlock) error {
+	outputs, err := t.calculateOutputs(block)
+	if err != nil {
+		return utils.ErrorfNoEscape("could not calculate outputs: %w", err)
+	}
+	if !slices.Equal(outputs, mined.Coinbase.MinerOutputs) {
+		return errors.New("mined coinbase outputs do not match calculated outputs")
+	}
+	return nil
+}
+
+// Track Starts following a found block. Blocks already tracked are ignored
+// Outputs are checked once the mined block is available, see Verify
+func (t *FoundBlockTracker) Track(mainData *sidechain.ChainMain, block *sidechain.PoolBlock) (found *FoundBlock, isNew bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if b, ok := t.blocks[mainData.Id]; ok {
+		return b, false
+	}
+
+	now := time.Now()
+	found = &FoundBlock{
+		Main:         mainData,
+		Block:        block,
+		Status:       FoundBlockStatusFound,
+		UnlockHeight: block.Main.Coinbase.MinerUnlockTime,
+		FoundTime:    now,
+		UpdatedTime:  now,
+	}
+	t.blocks[mainData.Id] = found
+	return found, true
+}
+
+// Verify Checks the outputs of a tracked block against its mined Monero block. Returns a copy if the block changed
+func (t *FoundBlockTracker) Verify(id types.Hash, mined *mainblock.PoolMainBlock) *FoundBlock {
+	block := func() *sidechain.PoolBlock {
+		t.lock.RLock()
+		defer t.lock.RUnlock()
+		if b, ok := t.blocks[id]; ok && !b.OutputsVerified {
+			return b.Block
+		}
+		return nil
+	}()
+	if block == nil {
+		return nil
+	}
+
+	// calculated without lock, as it needs the side chain
+	err := t.verifyOutputs(block, mined)
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	b, ok := t.blocks[id]
+	if !ok || b.OutputsVerified {
+		return nil
+	}
+	if err != nil {
+		utils.Errorf("MainChain", "found block at height = %d, id = %s failed verification: %s", b.Main.Height, b.Main.Id, err)
+	}
+	b.OutputsVerified, b.OutputsError, b.UpdatedTime = true, err, time.Now()
+	c := *b
+	return &c
+}
+
+// Update Updates the status of tracked blocks given the height of the next main chain block
+// getByHeight returns the current main chain block at a height. Changed blocks are returned as copies.
+func (t *FoundBlockTracker) Update(height uint64, getByHeight func(height uint64) *sidechain.ChainMain) (changed []FoundBlock) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	now := time.Now()
+	for _, b := range t.blocks {
+		status, confirmations := b.Status, b.Confirmations
+
+		if m := getByHeight(b.Main.Height); m != nil && m.Id != types.ZeroHash {
+			if m.Id != b.Main.Id {
+				status, confirmations = FoundBlockStatusOrphaned, 0
+			} else if height > b.Main.Height {
+				confirmations = height - 1 - b.Main.Height
+				if height >= b.UnlockHeight {
+					status = FoundBlockStatusUnlocked
+				} else if confirmations > 0 {
+					status = FoundBlockStatusConfirmed
+				} else {
+					status = FoundBlockStatusFound
+				}
+			}
+		}
+
+		if status != b.Status || confirmations != b.Confirmations {
+			if status != b.Status {
+				utils.Logf("MainChain", "found block at height = %d, id = %s is %s (%d confirmations)", b.Main.Height, b.Main.Id, status, confirmations)
+			}
+			b.Status, b.Confirmations, b.UpdatedTime = status, confirmations, now
+			changed = append(changed, *b)
+		}
+	}
+	return changed
+}
+
+// Orphan Marks tracked blocks that left the main chain as orphaned. Changed blocks are returned as copies
+func (t *FoundBlockTracker) Orphan(orphaned []*sidechain.ChainMain) (changed []FoundBlock) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	now := time.Now()
+	for _, m := range orphaned {
+		if b, ok := t.blocks[m.Id]; ok && b.Status != FoundBlockStatusOrphaned {
+			utils.Logf("MainChain", "found block at height = %d, id = %s is %s", b.Main.Height, b.Main.Id, FoundBlockStatusOrphaned)
+			b.Status, b.Confirmations, b.UpdatedTime = FoundBlockStatusOrphaned, 0, now
+			changed = append(changed, *b)
+		}
+	}
+	return changed
+}
+
+// Cleanup Stops tracking unlocked or orphaned blocks more than pruneDistance blocks below height
+func (t *FoundBlockTracker) Cleanup(height, pruneDistance uint64) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	for id, b := range t.blocks {
+		if (b.Status == FoundBlockStatusUnlocked || b.Status == FoundBlockStatusOrphaned) && (b.Main.Height+pruneDistance) < height {
+			delete(t.blocks, id)
+		}
+	}
+}
+
+// Get Returns a copy of a tracked block by its main id
+func (t *FoundBlockTracker) Get(id types.Hash) *FoundBlock {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	if b, ok := t.blocks[id]; ok {
+		c := *b
+		return &c
+	}
+	return nil
+}
+
+// Blocks Returns copies of tracked blocks, by ascending height
+func (t *FoundBlockTracker) Blocks() []FoundBlock {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	result := make([]FoundBlock, 0, len(t.blocks))
+	for _, b := range t.blocks {
+		result = append(result, *b)
+	}
+	slices.SortFunc(result, func(a, b FoundBlock) int {
+		return cmp.Compare(a.Main.Height, b.Main.Height)
+	})
+	return result
+}
+
+// TrackFoundBlock Starts following a found block through confirmations, and verifies its mined outputs
+// It is called from HandleMainBlock and from SideChain for submitted and watched blocks, repeated calls are ignored.
+func (c *MainChain) TrackFoundBlock(mainData *sidechain.ChainMain, block *sidechain.PoolBlock) {
+	if found, isNew := c.found.Track(mainData, block); isNew {
+		c.updateFoundBlocks([]FoundBlock{*found})
+		c.verifyFoundBlock(mainData.Id)
+	}
+}
+
+// verifyFoundBlock Downloads the mined Monero block of a tracked found block, and checks its outputs
+// Blocks that are not available yet, for example right after submitting, are retried on the next miner data.
+func (c *MainChain) verifyFoundBlock(id types.Hash) {
+	result, err := c.p2pool.ClientRPC().GetBlock(id, false, c.p2pool.Context())
+	if err != nil {
+		utils.Logf("MainChain", "couldn't download found block %s: %s", id, err)
+		return
+	}
+	var mined mainblock.PoolMainBlock
+	if err = mined.UnmarshalBinary(result.Blob, false, nil); err != nil {
+		utils.Errorf("MainChain", "couldn't decode found block %s: %s", id, err)
+		return
+	}
+	if found := c.found.Verify(id, &mined); found != nil {
+		c.updateFoundBlocks([]FoundBlock{*found})
+	}
+}
+
+// verifyFoundBlocks Retries verification of found blocks on the main chain that were not verified yet
+func (c *MainChain) verifyFoundBlocks() {
+	for _, b := range c.found.Blocks() {
+		if !b.OutputsVerified && b.Status != FoundBlockStatusOrphaned {
+			c.verifyFoundBlock(b.Main.Id)
+		}
+	}
+}
+
+// GetFoundBlocks Returns the tracked found blocks and their status, by ascending height
+func (c *MainChain) GetFoundBlocks() []FoundBlock {
+	return c.found.Blocks()
+}
+
+// GetFoundBlock Returns a tracked found block by its main id
+func (c *MainChain) GetFoundBlock(id types.Hash) *FoundBlock {
+	return c.found.Get(id)
+}
+
+func (c *MainChain) updateFoundBlocks(changed []FoundBlock) {
+	for i := range changed {
+		c.p2pool.UpdateFoundBlockStatus(&changed[i])
+	}
+}
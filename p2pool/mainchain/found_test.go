@@ -0,0 +1,150 @@
+package mainchain
+
+import (
+	"slices"
+	"testing"
+
+	mainblock "git.gammaspectra.live/P2Pool/consensus/v5/monero/block"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/client/fakemonerod"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/transaction"
+	"git.gammaspectra.live/P2Pool/consensus/v5/p2pool/sidechain"
+	"git.gammaspectra.live/P2Pool/consensus/v5/types"
+)
+
+// testFoundShare Share standing in for the one that found b, its own outputs are never used for verification
+func testFoundShare(b *fakemonerod.Block) *sidechain.PoolBlock {
+	return &sidechain.PoolBlock{
+		Main: mainblock.PoolMainBlock{
+			Coinbase: transaction.P2PoolCoinbaseV2{
+				MinerGenHeight:  b.Height,
+				MinerUnlockTime: b.Height + 10,
+			},
+		},
+	}
+}
+
+func TestFoundBlockTracker(t *testing.T) {
+	const height = 100
+
+	c, p, d := newTestMainChain(t, fakemonerod.Config{Height: height})
+
+	mined := d.Tip()
+	var minedBlock mainblock.PoolMainBlock
+	if err := minedBlock.UnmarshalBinary(mined.Blob, false, nil); err != nil {
+		t.Fatal(err)
+	}
+	expectedOutputs := minedBlock.Coinbase.MinerOutputs
+	c.found.calculateOutputs = func(block *sidechain.PoolBlock) (transaction.Outputs, error) {
+		return expectedOutputs, nil
+	}
+
+	mainData := c.GetChainMainByHash(mined.Id)
+	if mainData == nil {
+		t.Fatal("mined block not in main chain")
+	}
+	c.TrackFoundBlock(mainData, testFoundShare(mined))
+	// repeated calls are ignored
+	c.TrackFoundBlock(mainData, testFoundShare(mined))
+
+	expectStatus := func(status FoundBlockStatus, confirmations uint64) {
+		t.Helper()
+		found := c.GetFoundBlock(mined.Id)
+		if found == nil {
+			t.Fatal("found block not tracked")
+		}
+		if found.Status != status || found.Confirmations != confirmations {
+			t.Fatalf("found block is %s with %d confirmations, expected %s with %d", found.Status, found.Confirmations, status, confirmations)
+		}
+		if last := p.found[len(p.found)-1]; last.Status != status || last.Confirmations != confirmations {
+			t.Fatalf("last update is %s with %d confirmations, expected %s with %d", last.Status, last.Confirmations, status, confirmations)
+		}
+	}
+
+	expectStatus(FoundBlockStatusFound, 0)
+	if found := c.GetFoundBlock(mined.Id); !found.OutputsVerified || found.OutputsError != nil {
+		t.Fatalf("outputs not verified: %v", found.OutputsError)
+	}
+
+	// Confirm
+	d.Mine(1)
+	c.HandleMainBlock(d.Tip().Block)
+	c.HandleMinerData(testMinerData(d.MinerData()))
+	expectStatus(FoundBlockStatusConfirmed, 1)
+
+	// Orphan
+	confirmation := d.Tip()
+	d.Reorg(2)
+	c.HandleMainHeader(testHeader(d.Tip()))
+	expectStatus(FoundBlockStatusOrphaned, 0)
+	c.HandleMinerData(testMinerData(d.MinerData()))
+	expectStatus(FoundBlockStatusOrphaned, 0)
+
+	// Re-confirm, the main chain switches back to the found block
+	c.HandleMainHeader(testHeader(mined))
+	c.HandleMainHeader(testHeader(confirmation))
+	minerData := testMinerData(d.MinerData())
+	minerData.Height = confirmation.Height + 1
+	minerData.PrevId = confirmation.Id
+	c.HandleMinerData(minerData)
+	expectStatus(FoundBlockStatusConfirmed, 1)
+
+	var statuses []FoundBlockStatus
+	for _, f := range p.found {
+		if len(statuses) == 0 || statuses[len(statuses)-1] != f.Status {
+			statuses = append(statuses, f.Status)
+		}
+	}
+	if !slices.Equal(statuses, []FoundBlockStatus{FoundBlockStatusFound, FoundBlockStatusConfirmed, FoundBlockStatusOrphaned, FoundBlockStatusConfirmed}) {
+		t.Fatalf("unexpected status updates %v", statuses)
+	}
+}
+
+func TestFoundBlockTrackerVerify(t *testing.T) {
+	mined := &mainblock.PoolMainBlock{
+		Coinbase: transaction.P2PoolCoinbaseV2{
+			MinerOutputs: transaction.Outputs{
+				{Index: 0, Amount: 1000, Type: transaction.TxOutToTaggedKey},
+				{Index: 1, Amount: 2000, Type: transaction.TxOutToTaggedKey},
+			},
+		},
+	}
+
+	for _, tc := range []struct {
+		name     string
+		expected transaction.Outputs
+		ok       bool
+	}{
+		{"Match", mined.Coinbase.MinerOutputs, true},
+		{"Amount", transaction.Outputs{mined.Coinbase.MinerOutputs[0], {Index: 1, Amount: 2001, Type: transaction.TxOutToTaggedKey}}, false},
+		{"Missing", mined.Coinbase.MinerOutputs[:1], false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tracker := &FoundBlockTracker{
+				calculateOutputs: func(block *sidechain.PoolBlock) (transaction.Outputs, error) {
+					return tc.expected, nil
+				},
+				blocks: make(map[types.Hash]*FoundBlock),
+			}
+
+			id := types.Hash{1}
+			// the share outputs match the calculated ones, only the mined outputs count
+			share := &sidechain.PoolBlock{}
+			share.Main.Coinbase.MinerOutputs = tc.expected
+			if _, isNew := tracker.Track(&sidechain.ChainMain{Id: id, Height: 100}, share); !isNew {
+				t.Fatal("block not tracked")
+			}
+
+			found := tracker.Verify(id, mined)
+			if found == nil || !found.OutputsVerified {
+				t.Fatal("block not verified")
+			}
+			if (found.OutputsError == nil) != tc.ok {
+				t.Fatalf("unexpected verification result %v", found.OutputsError)
+			}
+
+			if tracker.Verify(id, mined) != nil {
+				t.Fatal("block verified twice")
+			}
+		})
+	}
+}
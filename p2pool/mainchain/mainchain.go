@@ -35,6 +35,12 @@ type MainChain struct {
 	mainchainByHeight map[uint64]*sidechain.ChainMain
 	mainchainByHash   map[types.Hash]*sidechain.ChainMain
 
+	// alternateByHash Blocks that left the main chain
+	alternateByHash map[types.Hash]*sidechain.ChainMain
+
+	found   *FoundBlockTracker
+	mempool *mempool.Tracker
+
 	tip          atomic.Pointer[sidechain.ChainMain]
 	tipMinerData atomic.Pointer[p2pooltypes.MinerData]
 
@@ -42,14 +48,21 @@ type MainChain struct {
 }
 
 type P2PoolInterface interface {
-	ClientRPC() *client.Client
+	ClientRPC() client.RPC
 	ClientZMQ() *zmq.Client
 	Context() context.Context
 	Started() bool
 	UpdateMainData(data *sidechain.ChainMain)
 	UpdateMinerData(data *p2pooltypes.MinerData)
-	UpdateMempoolData(data mempool.Mempool)
+	// UpdateMempoolDiff Called for every change to the tracked transaction pool: txpool_add additions, mined, evicted and expired removals
+	UpdateMempoolDiff(diff *mempool.Diff)
 	UpdateBlockFound(data *sidechain.ChainMain, block *sidechain.PoolBlock)
+	// UpdateMainChainReorg Called after main chain blocks were orphaned, with the affected shares and found blocks
+	UpdateMainChainReorg(reorg *Reorg)
+	// UpdateFoundBlockStatus Called when a tracked found block changes status or was verified
+	UpdateFoundBlockStatus(found *FoundBlock)
+	// UpdateMainChainResync Called after missed main chain state was recovered via RPC, once the ZMQ connection was re-established
+	UpdateMainChainResync(resync *Resync)
 }
 
 func NewMainChain(s *sidechain.SideChain, p2pool P2PoolInterface, minorVersion uint8) *MainChain {
@@ -59,14 +72,22 @@ func NewMainChain(s *sidechain.SideChain, p2pool P2PoolInterface, minorVersion u
 		p2pool:            p2pool,
 		mainchainByHeight: make(map[uint64]*sidechain.ChainMain, s.Consensus().BlockHeadersRequired()+3),
 		mainchainByHash:   make(map[types.Hash]*sidechain.ChainMain, s.Consensus().BlockHeadersRequired()+3),
+		alternateByHash:   make(map[types.Hash]*sidechain.ChainMain),
+		found:             NewFoundBlockTracker(s),
+		mempool:           mempool.NewTracker(MempoolMaxAge, p2pool.UpdateMempoolDiff),
 	}
+	s.SetBlockFoundFunc(m.TrackFoundBlock)
 
 	return m
 }
 
+// Listen Subscribes to monerod ZMQ events until the context is done
+// The connection is re-established when it fails, and events missed in between are recovered via Resync.
+// The transaction pool is periodically reconciled via MaintainMempool while listening.
 func (c *MainChain) Listen(success func()) error {
 	ctx := c.p2pool.Context()
-	err := c.p2pool.ClientZMQ().Listen(ctx,
+	go c.MaintainMempool()
+	err := c.p2pool.ClientZMQ().ListenWithReconnect(ctx,
 		zmq.Listeners{
 			zmq.TopicFullChainMain: zmq.DecoderFullChainMain(func(mains []zmq.FullChainMain) {
 				for i := range mains {
@@ -181,10 +202,16 @@ func (c *MainChain) Listen(success func()) error {
 				})
 			}),
 			zmq.TopicMinimalTxPoolAdd: zmq.DecoderMinimalTxPoolAdd(func(txs mempool.Mempool) {
-				c.p2pool.UpdateMempoolData(txs)
+				// changes reach P2Pool via UpdateMempoolDiff
+				c.mempool.Add(txs)
 			}),
 		},
 		success,
+		func() {
+			if err := c.Resync(); err != nil {
+				utils.Errorf("MainChain", "%s", err)
+			}
+		},
 	)
 	if err != nil {
 		return err
@@ -224,26 +251,33 @@ func (c *MainChain) updateMedianTimestamp() {
 }
 
 func (c *MainChain) HandleMainHeader(mainHeader *mainblock.Header) {
-	c.lock.Lock()
-	defer c.lock.Unlock()
-
 	mainData := &sidechain.ChainMain{
 		Difficulty: mainHeader.Difficulty,
 		Height:     mainHeader.Height,
 		Timestamp:  mainHeader.Timestamp,
 		Reward:     mainHeader.Reward,
 		Id:         mainHeader.Id,
+		PreviousId: mainHeader.PreviousId,
 	}
-	c.mainchainByHeight[mainHeader.Height] = mainData
-	c.mainchainByHash[mainHeader.Id] = mainData
 
-	if mainData.Height > c.highest {
-		c.highest = mainData.Height
-	}
+	var orphaned *sidechain.ChainMain
+	var parentMismatch bool
+	func() {
+		c.lock.Lock()
+		defer c.lock.Unlock()
 
-	utils.Logf("MainChain", "new main chain block: height = %d, id = %s, timestamp = %d, reward = %s", mainData.Height, mainData.Id.String(), mainData.Timestamp, utils.XMRUnits(mainData.Reward))
+		orphaned, parentMismatch = c.insertMainData(mainData)
 
-	c.updateMedianTimestamp()
+		if mainData.Height > c.highest {
+			c.highest = mainData.Height
+		}
+
+		utils.Logf("MainChain", "new main chain block: height = %d, id = %s, timestamp = %d, reward = %s", mainData.Height, mainData.Id.String(), mainData.Timestamp, utils.XMRUnits(mainData.Reward))
+
+		c.updateMedianTimestamp()
+	}()
+
+	c.handleReorg(mainData, orphaned, parentMismatch)
 }
 
 func (c *MainChain) HandleMainBlock(b *mainblock.PoolMainBlock) {
@@ -253,8 +287,11 @@ func (c *MainChain) HandleMainBlock(b *mainblock.PoolMainBlock) {
 		Timestamp:  b.Timestamp,
 		Reward:     b.Coinbase.TotalReward(),
 		Id:         b.Id(),
+		PreviousId: b.PreviousId,
 	}
 
+	var orphaned *sidechain.ChainMain
+	var parentMismatch bool
 	func() {
 		c.lock.Lock()
 		defer c.lock.Unlock()
@@ -264,8 +301,7 @@ func (c *MainChain) HandleMainBlock(b *mainblock.PoolMainBlock) {
 		} else {
 			return
 		}
-		c.mainchainByHash[mainData.Id] = mainData
-		c.mainchainByHeight[mainData.Height] = mainData
+		orphaned, parentMismatch = c.insertMainData(mainData)
 
 		if mainData.Height > c.highest {
 			c.highest = mainData.Height
@@ -276,6 +312,10 @@ func (c *MainChain) HandleMainBlock(b *mainblock.PoolMainBlock) {
 		c.updateMedianTimestamp()
 	}()
 
+	c.handleReorg(mainData, orphaned, parentMismatch)
+
+	c.mempool.RemoveMined(mainData.Height, b.Transactions)
+
 	defer c.updateTip()
 
 	var isP2Pool bool
@@ -306,6 +346,7 @@ func (c *MainChain) HandleMainBlock(b *mainblock.PoolMainBlock) {
 		sidechainId := types.HashFromBytes(mergeMineTag.Data)
 
 		if block := c.sidechain.GetPoolBlockByTemplateId(sidechainId); block != nil {
+			c.TrackFoundBlock(mainData, block)
 			c.p2pool.UpdateBlockFound(mainData, block)
 			isP2Pool = true
 		} else {
@@ -323,6 +364,7 @@ func (c *MainChain) HandleMainBlock(b *mainblock.PoolMainBlock) {
 		}
 
 		if block := c.sidechain.GetPoolBlockByMerkleRoot(mergeMiningTag.RootHash); block != nil {
+			c.TrackFoundBlock(mainData, block)
 			c.p2pool.UpdateBlockFound(mainData, block)
 			isP2Pool = true
 		} else {
@@ -388,6 +430,12 @@ func (c *MainChain) cleanup(height uint64) {
 		}
 	}
 
+	for id, m := range c.alternateByHash {
+		if (m.Height + pruneDistance) < height {
+			delete(c.alternateByHash, id)
+		}
+	}
+
 }
 
 func (c *MainChain) DownloadBlockHeaders(currentHeight uint64) error {
@@ -418,18 +466,7 @@ func (c *MainChain) DownloadBlockHeaders(currentHeight uint64) error {
 		return utils.ErrorfNoEscape("couldn't download block headers range for height %d to %d: %s", startHeight, currentHeight-1, err)
 	} else {
 		for i := range rangeResult.Headers {
-			header := &rangeResult.Headers[i]
-			c.HandleMainHeader(&mainblock.Header{
-				MajorVersion: uint8(header.MajorVersion),
-				MinorVersion: uint8(header.MinorVersion),
-				Timestamp:    uint64(header.Timestamp),
-				PreviousId:   header.PrevHash,
-				Height:       header.Height,
-				Nonce:        uint32(header.Nonce),
-				Reward:       header.Reward,
-				Id:           header.Hash,
-				Difficulty:   types.NewDifficulty(header.Difficulty, header.DifficultyTop64),
-			})
+			c.HandleMainHeader(headerFromRPC(&rangeResult.Headers[i]))
 		}
 		utils.Logf("MainChain", "Downloaded headers for range %d to %d", startHeight, currentHeight-1)
 	}
@@ -444,17 +481,37 @@ func (c *MainChain) HandleMinerData(minerData *p2pooltypes.MinerData) {
 	blockHeadersRequired := uint64(c.sidechain.Consensus().BlockHeadersRequired())
 
 	var missingHeights []uint64
+	var orphaned []*sidechain.ChainMain
+	var parentMismatch bool
 	func() {
 		c.lock.Lock()
 		defer c.lock.Unlock()
 
+		if minerData.Height > 0 {
+			if existingPrevMainData, ok := c.mainchainByHeight[minerData.Height-1]; ok && existingPrevMainData.Id != types.ZeroHash && existingPrevMainData.Id != minerData.PrevId {
+				parentMismatch = true
+
+				// Blocks at or above the height being mined are no longer part of the main chain
+				for h, m := range c.mainchainByHeight {
+					if h >= minerData.Height && m.Id != types.ZeroHash {
+						orphaned = append(orphaned, c.orphanMainData(m))
+					}
+				}
+				if c.highest >= minerData.Height {
+					c.highest = minerData.Height - 1
+				}
+			}
+		}
+
 		if existingMainData, ok := c.mainchainByHeight[minerData.Height]; !ok {
 			c.mainchainByHeight[minerData.Height] = &sidechain.ChainMain{
 				Difficulty: minerData.Difficulty,
 				Height:     minerData.Height,
+				PreviousId: minerData.PrevId,
 			}
 		} else {
 			existingMainData.Difficulty = minerData.Difficulty
+			existingMainData.PreviousId = minerData.PrevId
 		}
 
 		if minerData.Height > 0 {
@@ -463,15 +520,12 @@ func (c *MainChain) HandleMinerData(minerData *p2pooltypes.MinerData) {
 				Id:     minerData.PrevId,
 			}
 
-			if existingPrevMainData, ok := c.mainchainByHeight[prevMainData.Height]; !ok {
-				c.mainchainByHeight[prevMainData.Height] = prevMainData
-			} else {
-				existingPrevMainData.Id = prevMainData.Id
-
-				prevMainData = existingPrevMainData
+			if existingPrevMainData, ok := c.mainchainByHeight[prevMainData.Height]; !ok || existingPrevMainData.Id != prevMainData.Id {
+				// Difficulty and parent are unknown for a replaced block, so its header is requested below
+				if o, _ := c.insertMainData(prevMainData); o != nil {
+					orphaned = append(orphaned, o)
+				}
 			}
-
-			c.mainchainByHash[prevMainData.Id] = prevMainData
 		}
 
 		c.cleanup(minerData.Height)
@@ -498,6 +552,16 @@ func (c *MainChain) HandleMinerData(minerData *p2pooltypes.MinerData) {
 		}
 	}()
 
+	if parentMismatch {
+		// Walk back from the new parent until it joins the known main chain
+		orphaned = append(orphaned, c.resolveParents(&sidechain.ChainMain{
+			Height:     minerData.Height,
+			PreviousId: minerData.PrevId,
+		})...)
+	}
+
+	c.notifyReorg(orphaned)
+
 	c.p2pool.UpdateMinerData(minerData)
 
 	var wg sync.WaitGroup
@@ -514,6 +578,9 @@ func (c *MainChain) HandleMinerData(minerData *p2pooltypes.MinerData) {
 
 	c.updateTip()
 
+	c.updateFoundBlocks(c.found.Update(minerData.Height, c.GetChainMainByHeight))
+	c.verifyFoundBlocks()
+	c.found.Cleanup(minerData.Height, blockHeadersRequired)
 }
 
 func (c *MainChain) getBlockHeader(height uint64) error {
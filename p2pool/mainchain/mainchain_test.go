@@ -0,0 +1,181 @@
+package mainchain
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/client"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/client/fakemonerod"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/client/zmq"
+	"git.gammaspectra.live/P2Pool/consensus/v5/p2pool/mempool"
+	"git.gammaspectra.live/P2Pool/consensus/v5/p2pool/sidechain"
+	p2pooltypes "git.gammaspectra.live/P2Pool/consensus/v5/p2pool/types"
+)
+
+// testP2Pool Records all updates sent by MainChain
+type testP2Pool struct {
+	ctx       context.Context
+	clientRPC client.RPC
+	clientZMQ *zmq.Client
+
+	lock       sync.Mutex
+	minerData  []*p2pooltypes.MinerData
+	diffs      []*mempool.Diff
+	blockFound []*sidechain.PoolBlock
+	reorgs     []*Reorg
+	found      []FoundBlock
+	resyncs    []*Resync
+}
+
+func (p *testP2Pool) ClientRPC() client.RPC {
+	return p.clientRPC
+}
+
+func (p *testP2Pool) ClientZMQ() *zmq.Client {
+	return p.clientZMQ
+}
+
+func (p *testP2Pool) Context() context.Context {
+	return p.ctx
+}
+
+func (p *testP2Pool) Started() bool {
+	return false
+}
+
+func (p *testP2Pool) UpdateMainData(data *sidechain.ChainMain) {
+}
+
+func (p *testP2Pool) UpdateMinerData(data *p2pooltypes.MinerData) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.minerData = append(p.minerData, data)
+}
+
+func (p *testP2Pool) UpdateMempoolDiff(diff *mempool.Diff) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.diffs = append(p.diffs, diff)
+}
+
+func (p *testP2Pool) UpdateBlockFound(data *sidechain.ChainMain, block *sidechain.PoolBlock) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.blockFound = append(p.blockFound, block)
+}
+
+func (p *testP2Pool) UpdateMainChainReorg(reorg *Reorg) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.reorgs = append(p.reorgs, reorg)
+}
+
+func (p *testP2Pool) UpdateFoundBlockStatus(found *FoundBlock) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	// copy, the tracker keeps updating its entries
+	p.found = append(p.found, *found)
+}
+
+func (p *testP2Pool) UpdateMainChainResync(resync *Resync) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.resyncs = append(p.resyncs, resync)
+}
+
+// testMinerData Converts miner data published by fakemonerod
+func testMinerData(d *zmq.FullMinerData) *p2pooltypes.MinerData {
+	return &p2pooltypes.MinerData{
+		MajorVersion:          d.MajorVersion,
+		Height:                d.Height,
+		PrevId:                d.PrevId,
+		SeedHash:              d.SeedHash,
+		Difficulty:            d.Difficulty,
+		MedianWeight:          d.MedianWeight,
+		AlreadyGeneratedCoins: d.AlreadyGeneratedCoins,
+		MedianTimestamp:       d.MedianTimestamp,
+		TxBacklog:             d.TxBacklog,
+		TimeReceived:          time.Now(),
+	}
+}
+
+// newTestMainChain Creates a MainChain against fakemonerod, with all headers and the current miner data loaded
+func newTestMainChain(t *testing.T, cfg fakemonerod.Config) (*MainChain, *testP2Pool, *fakemonerod.Daemon) {
+	d, err := fakemonerod.New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = d.Close()
+	})
+
+	rpcClient, err := client.NewClient(d.RPCAddress(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := &testP2Pool{
+		ctx:       context.Background(),
+		clientRPC: rpcClient,
+	}
+	if d.ZMQAddress() != "" {
+		p.clientZMQ = zmq.NewClient(d.ZMQAddress())
+	}
+
+	s := sidechain.GetFakeTestServerWithRPC(sidechain.ConsensusMini, rpcClient).SideChain()
+	c := NewMainChain(s, p, 0)
+
+	if err = c.DownloadBlockHeaders(d.Height()); err != nil {
+		t.Fatal(err)
+	}
+	c.HandleMinerData(testMinerData(d.MinerData()))
+
+	return c, p, d
+}
+
+// listenTestMainChain Runs Listen until the test ends, returning once subscribed with a context bound to the test
+func listenTestMainChain(t *testing.T, c *MainChain, p *testP2Pool) context.Context {
+	ctx, ctxFunc := context.WithTimeout(context.Background(), time.Second*30)
+	p.ctx = ctx
+
+	subscribed := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Listen(func() {
+			close(subscribed)
+		})
+	}()
+	t.Cleanup(func() {
+		ctxFunc()
+		if err := <-done; !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded) {
+			t.Error(err)
+		}
+	})
+
+	select {
+	case <-subscribed:
+	case <-ctx.Done():
+		t.Fatal(ctx.Err())
+	}
+	return ctx
+}
+
+// waitTestCondition Polls f until it returns true, calling resend in between as ZMQ subscriptions propagate asynchronously
+func waitTestCondition(t *testing.T, ctx context.Context, f func() bool, resend func()) {
+	t.Helper()
+	ticker := time.NewTicker(time.Millisecond * 50)
+	defer ticker.Stop()
+	for !f() {
+		select {
+		case <-ticker.C:
+			if resend != nil {
+				resend()
+			}
+		case <-ctx.Done():
+			t.Fatal(ctx.Err())
+		}
+	}
+}
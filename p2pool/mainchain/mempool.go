@@ -0,0 +1,57 @@
+package mainchain
+
+import (
+	"time"
+
+	"git.gammaspectra.live/P2Pool/consensus/v5/p2pool/mempool"
+	"git.gammaspectra.live/P2Pool/consensus/v5/utils"
+)
+
+const (
+	// MempoolMaxAge Transactions are expired after this time, same as monerod default txpool keep time
+	MempoolMaxAge = time.Hour * 24 * 3
+	// MempoolReconcileInterval Interval between full transaction pool downloads
+	MempoolReconcileInterval = time.Minute * 5
+)
+
+// GetMempool Returns the transaction pool tracker, fed from ZMQ txpool_add and chain_main events
+func (c *MainChain) GetMempool() *mempool.Tracker {
+	return c.mempool
+}
+
+// ReconcileMempool Downloads the daemon transaction pool, replacing the tracked transactions, and expires stale ones
+func (c *MainChain) ReconcileMempool() error {
+	result, err := c.p2pool.ClientRPC().GetTransactionPool(c.p2pool.Context())
+	if err != nil {
+		return utils.ErrorfNoEscape("couldn't download transaction pool: %s", err)
+	}
+
+	pool := make(mempool.Mempool, 0, len(result.Transactions))
+	for i := range result.Transactions {
+		tx := &result.Transactions[i]
+		pool = append(pool, &mempool.Entry{
+			Id:                tx.IDHash,
+			BlobSize:          tx.BlobSize,
+			Weight:            tx.Weight,
+			Fee:               tx.Fee,
+			TimeReceivedMilli: tx.ReceiveTime * 1000,
+		})
+	}
+
+	diff := c.mempool.Reconcile(pool)
+	if !diff.Empty() {
+		utils.Logf("MainChain", "reconciled transaction pool: added = %d, evicted = %d, total = %d", len(diff.Added), len(diff.Removed), c.mempool.Len())
+	}
+	c.mempool.Expire(time.Now())
+
+	return nil
+}
+
+// MaintainMempool Periodically reconciles the transaction pool until the context is done
+func (c *MainChain) MaintainMempool() {
+	for range utils.ContextTick(c.p2pool.Context(), MempoolReconcileInterval) {
+		if err := c.ReconcileMempool(); err != nil {
+			utils.Errorf("MainChain", "%s", err)
+		}
+	}
+}
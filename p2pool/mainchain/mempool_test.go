@@ -0,0 +1,72 @@
+package mainchain
+
+import (
+	"slices"
+	"testing"
+
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/client/fakemonerod"
+	"git.gammaspectra.live/P2Pool/consensus/v5/p2pool/mempool"
+	"git.gammaspectra.live/P2Pool/consensus/v5/types"
+)
+
+func TestMainChainListenMempool(t *testing.T) {
+	const height = 100
+
+	c, p, d := newTestMainChain(t, fakemonerod.Config{Height: height, ZMQ: "tcp://127.0.0.1:0"})
+	ctx := listenTestMainChain(t, c, p)
+
+	diffs := func() []*mempool.Diff {
+		p.lock.Lock()
+		defer p.lock.Unlock()
+		return slices.Clone(p.diffs)
+	}
+
+	// each resend is a new transaction, as the tracker ignores known ones
+	var sent byte
+	waitTestCondition(t, ctx, func() bool {
+		return len(diffs()) > 0
+	}, func() {
+		sent++
+		d.AddTransactions(&mempool.Entry{Id: types.Hash{sent}, BlobSize: 1500, Weight: 1500, Fee: 30000000})
+	})
+
+	minedHeight := d.Height()
+	d.Mine(1)
+	var mined *mempool.Diff
+	waitTestCondition(t, ctx, func() bool {
+		for _, diff := range diffs() {
+			if len(diff.Removed) > 0 {
+				mined = diff
+				return true
+			}
+		}
+		return false
+	}, nil)
+
+	// txpool_add events are delivered before chain_main, so all additions were received by now
+	var added []types.Hash
+	for _, diff := range diffs() {
+		if diff == mined {
+			break
+		}
+		if len(diff.Added) != 1 || len(diff.Removed) != 0 {
+			t.Fatalf("unexpected diff with %d additions and %d removals", len(diff.Added), len(diff.Removed))
+		}
+		if slices.Contains(added, diff.Added[0].Id) {
+			t.Fatalf("transaction %s added twice", diff.Added[0].Id)
+		}
+		added = append(added, diff.Added[0].Id)
+	}
+
+	if mined.Reason != mempool.RemoveReasonMined || mined.Height != minedHeight {
+		t.Fatalf("unexpected removal %s at height %d", mined.Reason, mined.Height)
+	}
+	slices.SortFunc(added, types.Hash.Compare)
+	removed := slices.SortedFunc(slices.Values(mined.Removed), types.Hash.Compare)
+	if !slices.Equal(added, removed) {
+		t.Fatalf("removed %s, expected %s", removed, added)
+	}
+	if c.GetMempool().Len() != 0 {
+		t.Fatalf("%d transactions left in mempool", c.GetMempool().Len())
+	}
+}
@@ -0,0 +1,207 @@
+package mainchain
+
+import (
+	"cmp"
+	"slices"
+
+	"git.gammaspectra.live/P2Pool/consensus/v5/p2pool/sidechain"
+	"git.gammaspectra.live/P2Pool/consensus/v5/types"
+	"git.gammaspectra.live/P2Pool/consensus/v5/utils"
+)
+
+// MaxReorgDepth Maximum number of parent headers downloaded to find the fork point of a main chain reorg
+const MaxReorgDepth = 64
+
+// Reorg A Monero main chain reorganization, where known blocks were replaced by blocks with different ids
+type Reorg struct {
+	// Height Lowest height of an orphaned block
+	Height uint64
+	// Orphaned Blocks that left the main chain, by ascending height
+	Orphaned []*sidechain.ChainMain
+	// Shares Known shares mined with an orphaned block as Monero parent
+	Shares []*sidechain.PoolBlock
+	// Found Known shares that were found as an orphaned Monero block
+	Found []*sidechain.PoolBlock
+}
+
+// insertMainData Sets mainData as the main chain block at its height
+// If a different block was known at that height it is moved to the alternate blocks and returned.
+// parentMismatch is set when the known block at the previous height is not the parent of mainData.
+// Expects lock to be already locked here
+func (c *MainChain) insertMainData(mainData *sidechain.ChainMain) (orphaned *sidechain.ChainMain, parentMismatch bool) {
+	if existing, ok := c.mainchainByHeight[mainData.Height]; ok {
+		if existing.Id == types.ZeroHash || existing.Id == mainData.Id {
+			// placeholder from miner data, or the same block
+			if mainData.Difficulty.Equals(types.ZeroDifficulty) {
+				mainData.Difficulty = existing.Difficulty
+			}
+		} else if mainData.Id != types.ZeroHash {
+			orphaned = c.orphanMainData(existing)
+		}
+	}
+
+	c.mainchainByHeight[mainData.Height] = mainData
+	if mainData.Id != types.ZeroHash {
+		c.mainchainByHash[mainData.Id] = mainData
+		// block may be back on the main chain
+		delete(c.alternateByHash, mainData.Id)
+	}
+
+	if mainData.Height > 0 && mainData.PreviousId != types.ZeroHash {
+		if parent, ok := c.mainchainByHeight[mainData.Height-1]; ok && parent.Id != types.ZeroHash && parent.Id != mainData.PreviousId {
+			parentMismatch = true
+		}
+	}
+
+	return orphaned, parentMismatch
+}
+
+// orphanMainData Moves a main chain block to the alternate blocks
+// Expects lock to be already locked here
+func (c *MainChain) orphanMainData(m *sidechain.ChainMain) *sidechain.ChainMain {
+	if c.mainchainByHeight[m.Height] == m {
+		delete(c.mainchainByHeight, m.Height)
+	}
+	if c.mainchainByHash[m.Id] == m {
+		delete(c.mainchainByHash, m.Id)
+	}
+	c.alternateByHash[m.Id] = m
+	return m
+}
+
+// resolveParents Downloads the parents of mainData until one matches the known main chain, replacing the blocks on the way
+func (c *MainChain) resolveParents(mainData *sidechain.ChainMain) (orphaned []*sidechain.ChainMain) {
+	prevId := mainData.PreviousId
+	for range MaxReorgDepth {
+		header, err := c.p2pool.ClientRPC().GetBlockHeaderByHash(prevId, c.p2pool.Context())
+		if err != nil {
+			utils.Errorf("MainChain", "couldn't download block header for id %s: %s", prevId, err)
+			return orphaned
+		}
+
+		parent := &sidechain.ChainMain{
+			Difficulty: types.NewDifficulty(header.Difficulty, header.DifficultyTop64),
+			Height:     header.Height,
+			Timestamp:  uint64(header.Timestamp),
+			Reward:     header.Reward,
+			Id:         header.Hash,
+			PreviousId: header.PrevHash,
+		}
+
+		var o *sidechain.ChainMain
+		var parentMismatch bool
+		func() {
+			c.lock.Lock()
+			defer c.lock.Unlock()
+			o, parentMismatch = c.insertMainData(parent)
+			c.updateMedianTimestamp()
+		}()
+		if o != nil {
+			orphaned = append(orphaned, o)
+		}
+		if !parentMismatch {
+			return orphaned
+		}
+		prevId = parent.PreviousId
+	}
+
+	utils.Errorf("MainChain", "main chain reorg at height %d is deeper than %d blocks", mainData.Height, MaxReorgDepth)
+	return orphaned
+}
+
+// handleReorg Follows a reorg detected when inserting mainData, and notifies about the orphaned blocks
+func (c *MainChain) handleReorg(mainData, orphaned *sidechain.ChainMain, parentMismatch bool) {
+	var blocks []*sidechain.ChainMain
+	if orphaned != nil {
+		blocks = append(blocks, orphaned)
+	}
+	if parentMismatch {
+		blocks = append(blocks, c.resolveParents(mainData)...)
+	}
+	c.notifyReorg(blocks)
+}
+
+// notifyReorg Notifies SideChain and P2Pool about blocks that left the main chain
+func (c *MainChain) notifyReorg(orphaned []*sidechain.ChainMain) {
+	if len(orphaned) == 0 {
+		return
+	}
+
+	slices.SortFunc(orphaned, func(a, b *sidechain.ChainMain) int {
+		return cmp.Compare(a.Height, b.Height)
+	})
+
+	reorg := &Reorg{
+		Height:   orphaned[0].Height,
+		Orphaned: orphaned,
+	}
+	reorg.Shares, reorg.Found = c.sidechain.HandleMainChainReorg(orphaned)
+
+	utils.Noticef("MainChain", "main chain reorg: height = %d, orphaned blocks = %d, affected shares = %d", reorg.Height, len(reorg.Orphaned), len(reorg.Shares))
+	for _, b := range reorg.Found {
+		utils.Errorf("MainChain", "found block orphaned: height = %d, id = %s", b.Main.Coinbase.GenHeight(), b.MainId())
+	}
+
+	c.p2pool.UpdateMainChainReorg(reorg)
+	c.updateFoundBlocks(c.found.Orphan(orphaned))
+}
+
+// DownloadAlternateChains Records alternate blocks known by monerod as orphaned blocks
+func (c *MainChain) DownloadAlternateChains() error {
+	result, err := c.p2pool.ClientRPC().GetAlternateChains(c.p2pool.Context())
+	if err != nil {
+		return utils.ErrorfNoEscape("couldn't download alternate chains: %s", err)
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for _, chain := range result.Chains {
+		// hashes are ordered from the top of the alternate chain, at Height
+		for i, id := range chain.BlockHashes {
+			if uint64(i) > chain.Height {
+				break
+			}
+			if _, ok := c.mainchainByHash[id]; ok {
+				continue
+			}
+			if _, ok := c.alternateByHash[id]; ok {
+				continue
+			}
+
+			m := &sidechain.ChainMain{
+				Height:     chain.Height - uint64(i),
+				Id:         id,
+				PreviousId: chain.MainChainParentBlock,
+			}
+			if i+1 < len(chain.BlockHashes) {
+				m.PreviousId = chain.BlockHashes[i+1]
+			}
+			c.alternateByHash[id] = m
+		}
+	}
+
+	return nil
+}
+
+// GetAlternateChainMainByHash Returns a known block that is not part of the main chain
+func (c *MainChain) GetAlternateChainMainByHash(hash types.Hash) *sidechain.ChainMain {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.alternateByHash[hash]
+}
+
+// GetAlternateChainMains Returns known blocks that are not part of the main chain, by ascending height
+func (c *MainChain) GetAlternateChainMains() []*sidechain.ChainMain {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	result := make([]*sidechain.ChainMain, 0, len(c.alternateByHash))
+	for _, m := range c.alternateByHash {
+		result = append(result, m)
+	}
+	slices.SortFunc(result, func(a, b *sidechain.ChainMain) int {
+		return cmp.Compare(a.Height, b.Height)
+	})
+	return result
+}
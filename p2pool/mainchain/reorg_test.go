@@ -0,0 +1,150 @@
+package mainchain
+
+import (
+	"slices"
+	"testing"
+
+	mainblock "git.gammaspectra.live/P2Pool/consensus/v5/monero/block"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/client/fakemonerod"
+	"git.gammaspectra.live/P2Pool/consensus/v5/types"
+)
+
+func testHeader(b *fakemonerod.Block) *mainblock.Header {
+	return &mainblock.Header{
+		MajorVersion: b.Block.MajorVersion,
+		MinorVersion: b.Block.MinorVersion,
+		Timestamp:    b.Block.Timestamp,
+		PreviousId:   b.Block.PreviousId,
+		Height:       b.Height,
+		Nonce:        b.Block.Nonce,
+		Reward:       b.Reward,
+		Id:           b.Id,
+		Difficulty:   b.Difficulty,
+	}
+}
+
+// testChainIds Returns the ids of the daemon main chain blocks in [from, to)
+func testChainIds(d *fakemonerod.Daemon, from, to uint64) (ids []types.Hash) {
+	for h := from; h < to; h++ {
+		ids = append(ids, d.BlockByHeight(h).Id)
+	}
+	return ids
+}
+
+func TestMainChainReorg(t *testing.T) {
+	const height = 100
+
+	for _, tc := range []struct {
+		name string
+		// run Changes the daemon chain and feeds MainChain
+		// Returns the ids expected to be orphaned in notification order, and the ids expected in the main chain
+		run func(t *testing.T, c *MainChain, d *fakemonerod.Daemon) (orphaned, main []types.Hash)
+	}{
+		{
+			name: "Depth1",
+			run: func(t *testing.T, c *MainChain, d *fakemonerod.Daemon) (orphaned, main []types.Hash) {
+				orphaned = testChainIds(d, height-1, height)
+				d.Reorg(1)
+				// only the new tip is announced, its parent is downloaded
+				c.HandleMainHeader(testHeader(d.Tip()))
+				return orphaned, testChainIds(d, height-3, d.Height())
+			},
+		},
+		{
+			name: "DepthN",
+			run: func(t *testing.T, c *MainChain, d *fakemonerod.Daemon) (orphaned, main []types.Hash) {
+				orphaned = testChainIds(d, height-5, height)
+				d.Reorg(5)
+				c.HandleMainHeader(testHeader(d.Tip()))
+				return orphaned, testChainIds(d, height-7, d.Height())
+			},
+		},
+		{
+			name: "MinerDataDepthN",
+			run: func(t *testing.T, c *MainChain, d *fakemonerod.Daemon) (orphaned, main []types.Hash) {
+				orphaned = testChainIds(d, height-4, height)
+				d.Reorg(4)
+				// miner data on top of a replaced parent
+				minerData := testMinerData(d.MinerData())
+				minerData.Height = height
+				minerData.PrevId = d.BlockByHeight(height - 1).Id
+				c.HandleMinerData(minerData)
+				return orphaned, testChainIds(d, height-6, height)
+			},
+		},
+		{
+			name: "StaleMinerData",
+			run: func(t *testing.T, c *MainChain, d *fakemonerod.Daemon) (orphaned, main []types.Hash) {
+				staleMinerData := testMinerData(d.MinerData())
+				d.Mine(1)
+				c.HandleMainBlock(d.Tip().Block)
+				// parent matches, so the block at the miner data height is kept
+				c.HandleMinerData(staleMinerData)
+				return nil, testChainIds(d, height-2, d.Height())
+			},
+		},
+		{
+			name: "ReannouncedSideBranch",
+			run: func(t *testing.T, c *MainChain, d *fakemonerod.Daemon) (orphaned, main []types.Hash) {
+				old := d.Tip()
+				d.Reorg(1)
+				replaced := d.BlockByHeight(height - 1)
+				c.HandleMainHeader(testHeader(d.Tip()))
+				// main chain switches back to the orphaned block
+				c.HandleMainHeader(testHeader(old))
+				return []types.Hash{old.Id, replaced.Id}, append(testChainIds(d, height-3, height-1), old.Id)
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c, p, d := newTestMainChain(t, fakemonerod.Config{Height: height})
+			if len(p.reorgs) != 0 {
+				t.Fatalf("unexpected reorg on setup: %+v", p.reorgs[0])
+			}
+
+			expectedOrphaned, expectedMain := tc.run(t, c, d)
+
+			var orphaned []types.Hash
+			for _, r := range p.reorgs {
+				if len(r.Orphaned) == 0 || r.Height != r.Orphaned[0].Height {
+					t.Fatalf("unexpected reorg height %d", r.Height)
+				}
+				for i, m := range r.Orphaned {
+					if i > 0 && m.Height <= r.Orphaned[i-1].Height {
+						t.Fatal("orphaned blocks are not sorted by height")
+					}
+					orphaned = append(orphaned, m.Id)
+				}
+			}
+			if !slices.Equal(orphaned, expectedOrphaned) {
+				t.Fatalf("orphaned %s, expected %s", orphaned, expectedOrphaned)
+			}
+
+			for _, id := range expectedOrphaned {
+				if slices.Contains(expectedMain, id) {
+					// came back to the main chain
+					continue
+				}
+				if c.GetAlternateChainMainByHash(id) == nil {
+					t.Fatalf("orphaned block %s is not an alternate block", id)
+				}
+				if c.GetChainMainByHash(id) != nil {
+					t.Fatalf("orphaned block %s is still in the main chain", id)
+				}
+			}
+
+			for _, id := range expectedMain {
+				m := c.GetChainMainByHash(id)
+				if m == nil {
+					t.Fatalf("block %s is not in the main chain", id)
+				}
+				if byHeight := c.GetChainMainByHeight(m.Height); byHeight != m {
+					t.Fatalf("block %s is not the main chain block at height %d", id, m.Height)
+				}
+				if c.GetAlternateChainMainByHash(id) != nil {
+					t.Fatalf("main chain block %s is an alternate block", id)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package mainchain
+
+import (
+	"time"
+
+	mainblock "git.gammaspectra.live/P2Pool/consensus/v5/monero/block"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/client/rpc/daemon"
+	p2pooltypes "git.gammaspectra.live/P2Pool/consensus/v5/p2pool/types"
+	"git.gammaspectra.live/P2Pool/consensus/v5/types"
+	"git.gammaspectra.live/P2Pool/consensus/v5/utils"
+)
+
+// Resync Main chain state recovered via RPC after the ZMQ connection was re-established
+type Resync struct {
+	// FromHeight Height of the first header downloaded
+	FromHeight uint64
+	// ToHeight Height of the last header downloaded
+	ToHeight uint64
+	// MinerData Current miner data, for the block after ToHeight
+	MinerData *p2pooltypes.MinerData
+}
+
+// Resync Downloads headers since the last known main chain tip and the current miner data via RPC
+// Used to recover events that were missed while the ZMQ connection was down.
+func (c *MainChain) Resync() error {
+	result, err := c.p2pool.ClientRPC().GetMinerData()
+	if err != nil {
+		return utils.ErrorfNoEscape("couldn't download miner data: %s", err)
+	}
+
+	minerData := &p2pooltypes.MinerData{
+		MajorVersion:          result.MajorVersion,
+		MinorVersion:          c.minorVersion,
+		Height:                result.Height,
+		PrevId:                result.PrevId,
+		SeedHash:              result.SeedHash,
+		Difficulty:            result.Difficulty,
+		MedianWeight:          result.MedianWeight,
+		AlreadyGeneratedCoins: result.AlreadyGeneratedCoins,
+		MedianTimestamp:       result.MedianTimestamp,
+		TxBacklog:             result.TxBacklog,
+		FCMPTreeLayers:        result.FCMPTreeLayers,
+		FCMPTreeRoot:          result.FCMPTreeRoot,
+		TimeReceived:          time.Now(),
+	}
+
+	if minerData.Height == 0 {
+		return utils.ErrorfNoEscape("couldn't resync: miner data height is zero")
+	}
+
+	resync := &Resync{
+		ToHeight:  minerData.Height - 1,
+		MinerData: minerData,
+	}
+
+	blockHeadersRequired := uint64(c.sidechain.Consensus().BlockHeadersRequired())
+	if resync.ToHeight > blockHeadersRequired {
+		resync.FromHeight = resync.ToHeight - blockHeadersRequired
+	}
+
+	// include the known tip, so a replaced tip is detected as a reorg
+	if tip := c.GetChainMainTip(); tip != nil && tip.Height > resync.FromHeight {
+		resync.FromHeight = min(tip.Height, resync.ToHeight)
+	}
+
+	rangeResult, err := c.p2pool.ClientRPC().GetBlockHeadersRangeResult(resync.FromHeight, resync.ToHeight, c.p2pool.Context())
+	if err != nil {
+		return utils.ErrorfNoEscape("couldn't download block headers range for height %d to %d: %s", resync.FromHeight, resync.ToHeight, err)
+	}
+	for i := range rangeResult.Headers {
+		c.HandleMainHeader(headerFromRPC(&rangeResult.Headers[i]))
+	}
+
+	c.HandleMinerData(minerData)
+
+	// transactions added while disconnected were missed as well
+	if err := c.ReconcileMempool(); err != nil {
+		utils.Errorf("MainChain", "%s", err)
+	}
+
+	utils.Noticef("MainChain", "Resynced main chain: headers %d to %d, miner data height = %d", resync.FromHeight, resync.ToHeight, minerData.Height)
+	c.p2pool.UpdateMainChainResync(resync)
+
+	return nil
+}
+
+func headerFromRPC(header *daemon.BlockHeader) *mainblock.Header {
+	return &mainblock.Header{
+		MajorVersion: uint8(header.MajorVersion),
+		MinorVersion: uint8(header.MinorVersion),
+		Timestamp:    uint64(header.Timestamp),
+		PreviousId:   header.PrevHash,
+		Height:       header.Height,
+		Nonce:        uint32(header.Nonce),
+		Reward:       header.Reward,
+		Id:           header.Hash,
+		Difficulty:   types.NewDifficulty(header.Difficulty, header.DifficultyTop64),
+	}
+}
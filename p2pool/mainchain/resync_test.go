@@ -0,0 +1,65 @@
+package mainchain
+
+import (
+	"testing"
+
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/client/fakemonerod"
+)
+
+func TestMainChainListenResync(t *testing.T) {
+	const height = 100
+
+	c, p, d := newTestMainChain(t, fakemonerod.Config{Height: height, ZMQ: "tcp://127.0.0.1:0"})
+	ctx := listenTestMainChain(t, c, p)
+
+	minerDataReceived := func() bool {
+		tip := c.GetMinerDataTip()
+		return tip != nil && tip.Height == d.Height()
+	}
+	resynced := func() bool {
+		p.lock.Lock()
+		defer p.lock.Unlock()
+		return len(p.resyncs) > 0
+	}
+
+	d.Mine(1)
+	waitTestCondition(t, ctx, minerDataReceived, d.PublishMinerData)
+
+	// blocks mined while monerod ZMQ is down are never published
+	if err := d.StopZMQ(); err != nil {
+		t.Fatal(err)
+	}
+	from := d.Height()
+	d.Mine(3)
+	missed := testChainIds(d, from, d.Height())
+	if err := d.StartZMQ(); err != nil {
+		t.Fatal(err)
+	}
+	waitTestCondition(t, ctx, resynced, nil)
+
+	p.lock.Lock()
+	resync := p.resyncs[0]
+	p.lock.Unlock()
+	if resync.ToHeight != d.Height()-1 || resync.FromHeight > from-1 {
+		t.Fatalf("resynced headers %d to %d, expected from at most %d to %d", resync.FromHeight, resync.ToHeight, from-1, d.Height()-1)
+	}
+	if resync.MinerData.Height != d.Height() || resync.MinerData.PrevId != d.Tip().Id {
+		t.Fatalf("unexpected resync miner data height %d", resync.MinerData.Height)
+	}
+
+	for _, id := range missed {
+		if c.GetChainMainByHash(id) == nil {
+			t.Fatalf("missed block %s is not in the main chain", id)
+		}
+	}
+	if tip := c.GetChainMainTip(); tip == nil || tip.Id != d.Tip().Id {
+		t.Fatal("main chain tip does not match the daemon")
+	}
+	if !minerDataReceived() {
+		t.Fatal("miner data tip does not match the daemon")
+	}
+
+	// events are received again after the resync
+	d.Mine(1)
+	waitTestCondition(t, ctx, minerDataReceived, d.PublishMinerData)
+}
@@ -0,0 +1,268 @@
+package mempool
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"git.gammaspectra.live/P2Pool/consensus/v5/types"
+)
+
+type RemoveReason int
+
+const (
+	// RemoveReasonMined The transaction was included in a main chain block
+	RemoveReasonMined RemoveReason = iota
+	// RemoveReasonEvicted The transaction is no longer in the daemon transaction pool
+	RemoveReasonEvicted
+	// RemoveReasonExpired The transaction was not mined or seen for longer than the maximum age
+	RemoveReasonExpired
+)
+
+func (r RemoveReason) String() string {
+	switch r {
+	case RemoveReasonMined:
+		return "mined"
+	case RemoveReasonEvicted:
+		return "evicted"
+	case RemoveReasonExpired:
+		return "expired"
+	default:
+		return "unknown"
+	}
+}
+
+// Diff Changes to the tracked transaction pool
+type Diff struct {
+	Added   Mempool
+	Removed []types.Hash
+	Reason  RemoveReason
+	// Height Main chain height of the block including Removed transactions, when Reason is RemoveReasonMined
+	Height uint64
+}
+
+func (d *Diff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0
+}
+
+// MinedHistoryDepth Number of main chain blocks for which mined transaction ids are kept, to ignore late additions
+const MinedHistoryDepth = 10
+
+// Tracker Keeps the transaction pool in sync with the daemon
+// Transactions are added from txpool_add events, removed when mined in a block, evicted when the daemon pool
+// no longer has them, and expire after a maximum age. Every change is reported to onDiff.
+type Tracker struct {
+	lock    sync.RWMutex
+	entries map[types.Hash]*Entry
+	// mined Recently mined transaction ids and their block height
+	mined map[types.Hash]uint64
+
+	maxAge time.Duration
+	onDiff func(diff *Diff)
+}
+
+// NewTracker Creates a transaction pool tracker. Entries older than maxAge are expired, if it is non-zero
+// onDiff is called for every non-empty change, with the tracker unlocked, and can be nil.
+func NewTracker(maxAge time.Duration, onDiff func(diff *Diff)) *Tracker {
+	return &Tracker{
+		entries: make(map[types.Hash]*Entry, 512),
+		mined:   make(map[types.Hash]uint64),
+		maxAge:  maxAge,
+		onDiff:  onDiff,
+	}
+}
+
+func (t *Tracker) notify(diff *Diff) *Diff {
+	if !diff.Empty() && t.onDiff != nil {
+		t.onDiff(diff)
+	}
+	return diff
+}
+
+// add Expects lock to be already locked here
+func (t *Tracker) add(tx *Entry, now int64) bool {
+	if _, ok := t.entries[tx.Id]; ok {
+		return false
+	}
+	if tx.TimeReceivedMilli == 0 {
+		tx.TimeReceivedMilli = now
+	}
+	t.entries[tx.Id] = tx
+	return true
+}
+
+// Add Inserts new transactions. Transactions already tracked or recently mined are ignored
+func (t *Tracker) Add(txs Mempool) *Diff {
+	diff := &Diff{}
+	func() {
+		t.lock.Lock()
+		defer t.lock.Unlock()
+
+		now := time.Now().UnixMilli()
+		for _, tx := range txs {
+			if _, ok := t.mined[tx.Id]; ok {
+				continue
+			}
+			if t.add(tx, now) {
+				diff.Added = append(diff.Added, tx)
+			}
+		}
+	}()
+	return t.notify(diff)
+}
+
+// RemoveMined Removes transactions included in the main chain block at height
+func (t *Tracker) RemoveMined(height uint64, ids []types.Hash) *Diff {
+	diff := &Diff{
+		Reason: RemoveReasonMined,
+		Height: height,
+	}
+	func() {
+		t.lock.Lock()
+		defer t.lock.Unlock()
+
+		for _, id := range ids {
+			t.mined[id] = height
+			if _, ok := t.entries[id]; ok {
+				delete(t.entries, id)
+				diff.Removed = append(diff.Removed, id)
+			}
+		}
+
+		for id, h := range t.mined {
+			if h+MinedHistoryDepth < height {
+				delete(t.mined, id)
+			}
+		}
+	}()
+	return t.notify(diff)
+}
+
+// Reconcile Replaces the tracked transactions with the daemon transaction pool
+// Transactions not in pool are evicted, missing ones are added keeping the time they were first received.
+func (t *Tracker) Reconcile(pool Mempool) *Diff {
+	diff := &Diff{
+		Reason: RemoveReasonEvicted,
+	}
+	func() {
+		t.lock.Lock()
+		defer t.lock.Unlock()
+
+		inPool := make(map[types.Hash]struct{}, len(pool))
+		now := time.Now().UnixMilli()
+		for _, tx := range pool {
+			inPool[tx.Id] = struct{}{}
+			// the daemon pool is authoritative, a mined transaction here was returned by a reorg
+			delete(t.mined, tx.Id)
+			if t.add(tx, now) {
+				diff.Added = append(diff.Added, tx)
+			}
+		}
+
+		for id := range t.entries {
+			if _, ok := inPool[id]; !ok {
+				delete(t.entries, id)
+				diff.Removed = append(diff.Removed, id)
+			}
+		}
+	}()
+	return t.notify(diff)
+}
+
+// Expire Removes transactions received longer than the maximum age before now
+func (t *Tracker) Expire(now time.Time) *Diff {
+	diff := &Diff{
+		Reason: RemoveReasonExpired,
+	}
+	if t.maxAge <= 0 {
+		return diff
+	}
+	func() {
+		t.lock.Lock()
+		defer t.lock.Unlock()
+
+		cutoff := now.Add(-t.maxAge).UnixMilli()
+		for id, tx := range t.entries {
+			if tx.TimeReceivedMilli < cutoff {
+				delete(t.entries, id)
+				diff.Removed = append(diff.Removed, id)
+			}
+		}
+	}()
+	return t.notify(diff)
+}
+
+// Get Returns a tracked transaction by id
+func (t *Tracker) Get(id types.Hash) *Entry {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	return t.entries[id]
+}
+
+// IsMined Whether the transaction id was included in a recent main chain block
+func (t *Tracker) IsMined(id types.Hash) bool {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	_, ok := t.mined[id]
+	return ok
+}
+
+func (t *Tracker) Len() int {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	return len(t.entries)
+}
+
+// Mempool Returns the tracked transactions, sorted by preference
+func (t *Tracker) Mempool() Mempool {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	m := make(Mempool, 0, len(t.entries))
+	for _, tx := range t.entries {
+		m = append(m, tx)
+	}
+	m.Sort()
+	return m
+}
+
+// FeeHistogramBucket Transactions with a fee per weight unit of at least FeeRate, and lower than the next bucket
+type FeeHistogramBucket struct {
+	FeeRate uint64 `json:"fee_rate"`
+	Count   uint64 `json:"count"`
+	Weight  uint64 `json:"weight"`
+	Fees    uint64 `json:"fees"`
+}
+
+// FeeHistogram Groups the tracked transactions by fee per weight unit, in atomic units
+// feeRates must be sorted ascending. Transactions below feeRates[0] are not counted.
+func (t *Tracker) FeeHistogram(feeRates []uint64) []FeeHistogramBucket {
+	buckets := make([]FeeHistogramBucket, len(feeRates))
+	for i, r := range feeRates {
+		buckets[i].FeeRate = r
+	}
+	if len(buckets) == 0 {
+		return buckets
+	}
+
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	for _, tx := range t.entries {
+		if tx.Weight == 0 {
+			continue
+		}
+		rate := tx.Fee / tx.Weight
+		i, found := slices.BinarySearch(feeRates, rate)
+		if !found {
+			i--
+		}
+		if i < 0 {
+			continue
+		}
+		buckets[i].Count++
+		buckets[i].Weight += tx.Weight
+		buckets[i].Fees += tx.Fee
+	}
+	return buckets
+}
@@ -0,0 +1,61 @@
+package mempool
+
+import (
+	"testing"
+	"time"
+
+	"git.gammaspectra.live/P2Pool/consensus/v5/types"
+)
+
+func TestTracker(t *testing.T) {
+	var diffs []*Diff
+	tracker := NewTracker(time.Hour, func(diff *Diff) {
+		diffs = append(diffs, diff)
+	})
+
+	txs := Mempool{
+		{Id: types.Hash{1}, Weight: 1000, Fee: 20000},
+		{Id: types.Hash{2}, Weight: 2000, Fee: 100000},
+		{Id: types.Hash{3}, Weight: 1500, Fee: 30000, TimeReceivedMilli: time.Now().Add(-time.Hour * 2).UnixMilli()},
+	}
+
+	if diff := tracker.Add(txs); len(diff.Added) != 3 {
+		t.Fatalf("expected 3 added, got %d", len(diff.Added))
+	}
+	if diff := tracker.Add(txs[:1]); !diff.Empty() {
+		t.Fatal("expected no changes when adding again")
+	}
+
+	histogram := tracker.FeeHistogram([]uint64{0, 20, 50})
+	if histogram[0].Count != 0 || histogram[1].Count != 2 || histogram[2].Count != 1 {
+		t.Fatalf("unexpected histogram %+v", histogram)
+	}
+
+	if diff := tracker.Expire(time.Now()); len(diff.Removed) != 1 || diff.Removed[0] != txs[2].Id || diff.Reason != RemoveReasonExpired {
+		t.Fatalf("unexpected expire diff %+v", diff)
+	}
+
+	if diff := tracker.RemoveMined(100, []types.Hash{txs[0].Id, {9}}); len(diff.Removed) != 1 || diff.Height != 100 {
+		t.Fatalf("unexpected mined diff %+v", diff)
+	}
+	if !tracker.IsMined(txs[0].Id) {
+		t.Fatal("expected transaction to be mined")
+	}
+
+	// late additions of mined transactions are ignored
+	if diff := tracker.Add(txs[:1]); !diff.Empty() {
+		t.Fatal("expected mined transaction to be ignored")
+	}
+
+	diff := tracker.Reconcile(Mempool{{Id: types.Hash{4}, Weight: 1000, Fee: 10000}})
+	if len(diff.Added) != 1 || len(diff.Removed) != 1 || diff.Removed[0] != txs[1].Id || diff.Reason != RemoveReasonEvicted {
+		t.Fatalf("unexpected reconcile diff %+v", diff)
+	}
+	if tracker.Len() != 1 || tracker.Get(types.Hash{4}) == nil {
+		t.Fatal("expected only reconciled transaction")
+	}
+
+	if len(diffs) != 4 {
+		t.Fatalf("expected 4 diffs, got %d", len(diffs))
+	}
+}
@@ -35,7 +35,7 @@ type P2PoolInterface interface {
 	MainChain() *mainchain.MainChain
 	GetChainMainTip() *sidechain.ChainMain
 	GetMinerDataTip() *p2pooltypes.MinerData
-	ClientRPC() *client.Client
+	ClientRPC() client.RPC
 }
 
 type PeerListEntry struct {
@@ -52,7 +52,7 @@ func (s *FakeServer) Broadcast(block *PoolBlock) {
 func (s *FakeServer) BroadcastMoneroBlock(block *mainblock.PoolMainBlock) {
 
 }
-func (s *FakeServer) ClientRPC() *client.Client {
+func (s *FakeServer) ClientRPC() client.RPC {
 	return s.client
 }
 func (s *FakeServer) GetChainMainByHeight(height uint64) *ChainMain {
@@ -38,7 +38,7 @@ type P2PoolInterface interface {
 	UpdateTip(tip *PoolBlock)
 	BroadcastMoneroBlock(block *mainblock.PoolMainBlock)
 	Broadcast(block *PoolBlock)
-	ClientRPC() *client.Client
+	ClientRPC() client.RPC
 	GetChainMainByHeight(height uint64) *ChainMain
 	GetChainMainByHash(hash types.Hash) *ChainMain
 	GetMinimalBlockHeaderByHeight(height uint64) *mainblock.Header
@@ -58,6 +58,7 @@ type ChainMain struct {
 	Timestamp  uint64
 	Reward     uint64
 	Id         types.Hash
+	PreviousId types.Hash
 }
 
 type SideChain struct {
@@ -72,6 +73,10 @@ type SideChain struct {
 	watchBlock           *ChainMain
 	watchBlockPossibleId types.Hash
 
+	blockFoundFunc func(mainData *ChainMain, block *PoolBlock)
+
+	orphanedMainBlocks map[types.Hash]*ChainMain
+
 	blocksByTemplateId       map[types.Hash]*PoolBlock
 	blocksByMerkleRoot       map[types.Hash]*PoolBlock
 	blocksByHeight           map[uint64][]*PoolBlock
@@ -118,6 +123,7 @@ func NewSideChain(server P2PoolInterface) *SideChain {
 	s := &SideChain{
 		derivationCache:            NewDerivationMapCache(),
 		server:                     server,
+		orphanedMainBlocks:         make(map[types.Hash]*ChainMain),
 		blocksByTemplateId:         make(map[types.Hash]*PoolBlock, uint32(server.Consensus().ChainWindowSize*2+300)),
 		blocksByMerkleRoot:         make(map[types.Hash]*PoolBlock, uint32(server.Consensus().ChainWindowSize*2+300)),
 		blocksByHeight:             make(map[uint64][]*PoolBlock, uint32(server.Consensus().ChainWindowSize*2+300)),
@@ -211,6 +217,11 @@ func (c *SideChain) isPoolBlockTransactionKeyIsDeterministic(block *PoolBlock) b
 	return bytes.Equal(pubs[0].Slice(), kP.PublicKey.Bytes()) && block.Side.CoinbasePrivateKey == curve25519.PrivateKeyBytes(kP.PrivateKey.Bytes())
 }
 
+// GetSeedByHeight RandomX seed hash used to mine at a main chain height, zero if the seed block is not known
+func (c *SideChain) GetSeedByHeight(height uint64) types.Hash {
+	return c.getSeedByHeightFunc()(height)
+}
+
 func (c *SideChain) getSeedByHeightFunc() mainblock.GetSeedByHeightFunc {
 	//TODO: do not make this return a function
 	return func(height uint64) (hash types.Hash) {
@@ -423,7 +434,7 @@ func (c *SideChain) PoolBlockExternalVerify(block *PoolBlock) (missingBlocks []t
 					utils.Debugf("SideChain", "add_external_block: couldn't get mainchain difficulty for height = %d: %s", block.Main.Coinbase.MinerGenHeight, err)
 				} else if isHigherMainChain {
 					utils.Logf("SideChain", "add_external_block: ALTERNATE block %x has enough PoW for Monero height %d, submitting it", templateId.Slice(), block.Main.Coinbase.MinerGenHeight)
-					c.server.SubmitBlock(&block.Main)
+					c.submitMainBlock(block)
 				}
 				if isHigher, err := block.IsProofHigherThanDifficultyWithError(c.Consensus().GetHasher(), c.getSeedByHeightFunc()); err != nil {
 					return nil, err, true
@@ -441,6 +452,7 @@ func (c *SideChain) PoolBlockExternalVerify(block *PoolBlock) (missingBlocks []t
 					block.Invalid.Store(false)
 					if c.isWatched(block) {
 						c.server.UpdateBlockFound(c.watchBlock, block)
+						c.notifyBlockFound(c.watchBlock, block)
 						c.watchBlockPossibleId = types.ZeroHash
 					}
 
@@ -543,7 +555,7 @@ func (c *SideChain) AddPoolBlockExternal(block *PoolBlock) (missingBlocks []type
 			utils.Debugf("SideChain", "add_external_block: couldn't get mainchain difficulty for height = %d: %s", block.Main.Coinbase.MinerGenHeight, err)
 		} else if isHigherMainChain {
 			utils.Logf("SideChain", "add_external_block: block %x has enough PoW for Monero height %d, submitting it", templateId.Slice(), block.Main.Coinbase.MinerGenHeight)
-			c.server.SubmitBlock(&block.Main)
+			c.submitMainBlock(block)
 		}
 
 		if isHigher, err := block.IsProofHigherThanDifficultyWithError(c.Consensus().GetHasher(), c.getSeedByHeightFunc()); err != nil {
@@ -596,6 +608,7 @@ func (c *SideChain) AddPoolBlock(block *PoolBlock) (verification error, invalid
 
 	if c.isWatched(block) {
 		c.server.UpdateBlockFound(c.watchBlock, block)
+		c.notifyBlockFound(c.watchBlock, block)
 		c.watchBlockPossibleId = types.ZeroHash
 	}
 
@@ -1494,6 +1507,31 @@ func (c *SideChain) GetPoolBlockCount() int {
 	return len(c.blocksByTemplateId)
 }
 
+// SetBlockFoundFunc Sets a function called with Monero blocks found by shares, once submitted and once a watched main chain block is matched
+// It runs on its own goroutine, as the side chain may be locked. Set before adding blocks
+func (c *SideChain) SetBlockFoundFunc(f func(mainData *ChainMain, block *PoolBlock)) {
+	c.blockFoundFunc = f
+}
+
+func (c *SideChain) notifyBlockFound(mainData *ChainMain, block *PoolBlock) {
+	if c.blockFoundFunc != nil {
+		go c.blockFoundFunc(mainData, block)
+	}
+}
+
+// submitMainBlock Submits a share with enough PoW as a Monero block, and notifies it as found
+func (c *SideChain) submitMainBlock(block *PoolBlock) {
+	c.server.SubmitBlock(&block.Main)
+	c.notifyBlockFound(&ChainMain{
+		Difficulty: c.getOptionalMainDifficulty(block.Main.Coinbase.MinerGenHeight),
+		Height:     block.Main.Coinbase.MinerGenHeight,
+		Timestamp:  block.Main.Timestamp,
+		Reward:     block.Main.Coinbase.TotalReward(),
+		Id:         block.MainId(),
+		PreviousId: block.Main.PreviousId,
+	}, block)
+}
+
 func (c *SideChain) WatchMainChainBlock(mainData *ChainMain, possibleId types.Hash) {
 	c.sidechainLock.Lock()
 	defer c.sidechainLock.Unlock()
@@ -1502,6 +1540,68 @@ func (c *SideChain) WatchMainChainBlock(mainData *ChainMain, possibleId types.Ha
 	c.watchBlockPossibleId = possibleId
 }
 
+// HandleMainChainReorg Records Monero blocks that left the main chain
+// Returns known shares that were mined with an orphaned block as Monero parent, and shares that were found as an orphaned Monero block
+func (c *SideChain) HandleMainChainReorg(orphaned []*ChainMain) (shares, found []*PoolBlock) {
+	if len(orphaned) == 0 {
+		return nil, nil
+	}
+
+	c.sidechainLock.Lock()
+	defer c.sidechainLock.Unlock()
+
+	var highest uint64
+	for _, m := range orphaned {
+		c.orphanedMainBlocks[m.Id] = m
+		highest = max(highest, m.Height)
+	}
+
+	// Keep orphaned blocks within the range of main chain headers
+	pruneDistance := uint64(c.Consensus().BlockHeadersRequired())
+	for id, m := range c.orphanedMainBlocks {
+		if m.Height+pruneDistance < highest {
+			delete(c.orphanedMainBlocks, id)
+		}
+	}
+
+	if c.watchBlock != nil {
+		if _, ok := c.orphanedMainBlocks[c.watchBlock.Id]; ok {
+			c.watchBlock = nil
+			c.watchBlockPossibleId = types.ZeroHash
+		}
+	}
+
+	for _, b := range c.blocksByTemplateId {
+		if _, ok := c.orphanedMainBlocks[b.Main.PreviousId]; ok {
+			shares = append(shares, b)
+		}
+		if _, ok := c.orphanedMainBlocks[b.MainId()]; ok {
+			found = append(found, b)
+		}
+	}
+
+	return shares, found
+}
+
+// CalculateOutputs Calculates the expected coinbase outputs of a share from its known ancestors
+func (c *SideChain) CalculateOutputs(block *PoolBlock) (outputs transaction.Outputs, err error) {
+	preAllocatedShares := c.preAllocatedSharesPool.Get()
+	defer c.preAllocatedSharesPool.Put(preAllocatedShares)
+
+	c.sidechainLock.RLock()
+	defer c.sidechainLock.RUnlock()
+	outputs, _, _, err = CalculateOutputs(block, c.Consensus(), c.server.GetDifficultyByHeight, c.getPoolBlockByTemplateId, c.derivationCache, preAllocatedShares, nil)
+	return outputs, err
+}
+
+// IsMainParentOrphaned Whether the Monero parent of the share is known to have left the main chain
+func (c *SideChain) IsMainParentOrphaned(block *PoolBlock) bool {
+	c.sidechainLock.RLock()
+	defer c.sidechainLock.RUnlock()
+	_, ok := c.orphanedMainBlocks[block.Main.PreviousId]
+	return ok
+}
+
 func (c *SideChain) GetHighestKnownTip() *PoolBlock {
 	if t := c.chainTip.Load(); t != nil {
 		return t
@@ -0,0 +1,771 @@
+package stratum
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/netip"
+	"sync"
+	"syscall"
+	"time"
+
+	"git.gammaspectra.live/P2Pool/consensus/v5/types"
+	"git.gammaspectra.live/P2Pool/consensus/v5/utils"
+)
+
+// Binary mining protocol with Stratum V2 standard channel semantics, see docs/STRATUM.md
+// Frames are extension_type uint16, msg_type uint8, msg_length uint24, followed by msg_length bytes of payload, all little endian
+
+type BinaryMessageType uint8
+
+const (
+	BinaryMessageSetupConnection                  BinaryMessageType = 0x00
+	BinaryMessageSetupConnectionSuccess           BinaryMessageType = 0x01
+	BinaryMessageSetupConnectionError             BinaryMessageType = 0x02
+	BinaryMessageOpenStandardMiningChannel        BinaryMessageType = 0x10
+	BinaryMessageOpenStandardMiningChannelSuccess BinaryMessageType = 0x11
+	BinaryMessageOpenMiningChannelError           BinaryMessageType = 0x12
+	BinaryMessageNewMiningJob                     BinaryMessageType = 0x15
+	BinaryMessageCloseChannel                     BinaryMessageType = 0x18
+	BinaryMessageSubmitSharesStandard             BinaryMessageType = 0x1a
+	BinaryMessageSubmitSharesSuccess              BinaryMessageType = 0x1c
+	BinaryMessageSubmitSharesError                BinaryMessageType = 0x1d
+	BinaryMessageSetTarget                        BinaryMessageType = 0x21
+)
+
+const BinaryProtocolVersion = 1
+
+// BinarySetupFlagNiceHash SetupConnection flag requesting a reserved nonce prefix for each channel, as with the nicehash extension
+const BinarySetupFlagNiceHash uint32 = 1 << 0
+
+const BinaryFrameHeaderSize = 2 + 1 + 3
+
+// BinaryMaxPayloadSize Maximum accepted payload size for incoming frames
+const BinaryMaxPayloadSize = 1 << 16
+
+// binaryMaxChannels Maximum channels per connection
+const binaryMaxChannels = 64
+
+// binaryMaxChannelJobs Number of recent jobs kept per channel
+const binaryMaxChannelJobs = 16
+
+var ErrBinaryShortPayload = errors.New("short payload")
+
+type BinaryFrame struct {
+	ExtensionType uint16
+	Type          BinaryMessageType
+	Payload       []byte
+}
+
+// ReadBinaryFrame Reads a frame, reusing buf for payload if possible
+func ReadBinaryFrame(reader io.Reader, buf []byte) (frame BinaryFrame, err error) {
+	var header [BinaryFrameHeaderSize]byte
+	if _, err = io.ReadFull(reader, header[:]); err != nil {
+		return frame, err
+	}
+	frame.ExtensionType = binary.LittleEndian.Uint16(header[:])
+	frame.Type = BinaryMessageType(header[2])
+	length := int(header[3]) | int(header[4])<<8 | int(header[5])<<16
+	if length > BinaryMaxPayloadSize {
+		return frame, utils.ErrorfNoEscape("payload too large: %d > %d", length, BinaryMaxPayloadSize)
+	}
+	if cap(buf) < length {
+		buf = make([]byte, length)
+	}
+	frame.Payload = buf[:length]
+	if _, err = io.ReadFull(reader, frame.Payload); err != nil {
+		return frame, err
+	}
+	return frame, nil
+}
+
+// AppendBinaryFrame Appends a frame with no extension type
+func AppendBinaryFrame(buf []byte, messageType BinaryMessageType, payload []byte) []byte {
+	buf = binary.LittleEndian.AppendUint16(buf, 0)
+	buf = append(buf, uint8(messageType))
+	buf = append(buf, uint8(len(payload)), uint8(len(payload)>>8), uint8(len(payload)>>16))
+	return append(buf, payload...)
+}
+
+// binaryReader Sequential payload decoder, keeps the first error
+type binaryReader struct {
+	buf []byte
+	err error
+}
+
+func (r *binaryReader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if len(r.buf) < n {
+		r.err = ErrBinaryShortPayload
+		return nil
+	}
+	b := r.buf[:n]
+	r.buf = r.buf[n:]
+	return b
+}
+
+func (r *binaryReader) U8() uint8 {
+	if b := r.next(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *binaryReader) U16() uint16 {
+	if b := r.next(2); b != nil {
+		return binary.LittleEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (r *binaryReader) U32() uint32 {
+	if b := r.next(4); b != nil {
+		return binary.LittleEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (r *binaryReader) U64() uint64 {
+	if b := r.next(8); b != nil {
+		return binary.LittleEndian.Uint64(b)
+	}
+	return 0
+}
+
+func (r *binaryReader) Hash() (h types.Hash) {
+	if b := r.next(types.HashSize); b != nil {
+		copy(h[:], b)
+	}
+	return h
+}
+
+// Str0_255 Reads a string prefixed with uint8 length
+func (r *binaryReader) Str0_255() string {
+	return string(r.next(int(r.U8())))
+}
+
+// B0_64K Reads bytes prefixed with uint16 length
+func (r *binaryReader) B0_64K() []byte {
+	return r.next(int(r.U16()))
+}
+
+// Finish Returns the first decode error, or an error if data is left over
+func (r *binaryReader) Finish() error {
+	if r.err != nil {
+		return r.err
+	}
+	if len(r.buf) > 0 {
+		return errors.New("leftover bytes")
+	}
+	return nil
+}
+
+func appendStr0_255(buf []byte, s string) []byte {
+	if len(s) > 255 {
+		s = s[:255]
+	}
+	buf = append(buf, uint8(len(s)))
+	return append(buf, s...)
+}
+
+func appendB0_64K(buf []byte, b []byte) []byte {
+	if len(b) > 0xffff {
+		b = b[:0xffff]
+	}
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(b)))
+	return append(buf, b...)
+}
+
+type BinarySetupConnection struct {
+	MinVersion uint16
+	MaxVersion uint16
+	Flags      uint32
+	UserAgent  string
+}
+
+func (m *BinarySetupConnection) AppendBinary(buf []byte) []byte {
+	buf = binary.LittleEndian.AppendUint16(buf, m.MinVersion)
+	buf = binary.LittleEndian.AppendUint16(buf, m.MaxVersion)
+	buf = binary.LittleEndian.AppendUint32(buf, m.Flags)
+	return appendStr0_255(buf, m.UserAgent)
+}
+
+func (m *BinarySetupConnection) UnmarshalBinary(data []byte) error {
+	r := binaryReader{buf: data}
+	m.MinVersion = r.U16()
+	m.MaxVersion = r.U16()
+	m.Flags = r.U32()
+	m.UserAgent = r.Str0_255()
+	return r.Finish()
+}
+
+type BinarySetupConnectionSuccess struct {
+	UsedVersion uint16
+	Flags       uint32
+}
+
+func (m *BinarySetupConnectionSuccess) AppendBinary(buf []byte) []byte {
+	buf = binary.LittleEndian.AppendUint16(buf, m.UsedVersion)
+	return binary.LittleEndian.AppendUint32(buf, m.Flags)
+}
+
+func (m *BinarySetupConnectionSuccess) UnmarshalBinary(data []byte) error {
+	r := binaryReader{buf: data}
+	m.UsedVersion = r.U16()
+	m.Flags = r.U32()
+	return r.Finish()
+}
+
+type BinarySetupConnectionError struct {
+	Flags     uint32
+	ErrorCode string
+}
+
+func (m *BinarySetupConnectionError) AppendBinary(buf []byte) []byte {
+	buf = binary.LittleEndian.AppendUint32(buf, m.Flags)
+	return appendStr0_255(buf, m.ErrorCode)
+}
+
+func (m *BinarySetupConnectionError) UnmarshalBinary(data []byte) error {
+	r := binaryReader{buf: data}
+	m.Flags = r.U32()
+	m.ErrorCode = r.Str0_255()
+	return r.Finish()
+}
+
+type BinaryOpenStandardMiningChannel struct {
+	RequestId uint32
+	// UserIdentity Payout address, same as login in JSON protocol
+	UserIdentity string
+	// Password Same as pass in JSON protocol
+	Password string
+	RigId    string
+	// Algorithms Supported algorithms. Empty defaults to rx/0
+	Algorithms []string
+}
+
+func (m *BinaryOpenStandardMiningChannel) AppendBinary(buf []byte) []byte {
+	buf = binary.LittleEndian.AppendUint32(buf, m.RequestId)
+	buf = appendStr0_255(buf, m.UserIdentity)
+	buf = appendStr0_255(buf, m.Password)
+	buf = appendStr0_255(buf, m.RigId)
+	buf = append(buf, uint8(min(len(m.Algorithms), 255)))
+	for _, algo := range m.Algorithms[:min(len(m.Algorithms), 255)] {
+		buf = appendStr0_255(buf, algo)
+	}
+	return buf
+}
+
+func (m *BinaryOpenStandardMiningChannel) UnmarshalBinary(data []byte) error {
+	r := binaryReader{buf: data}
+	m.RequestId = r.U32()
+	m.UserIdentity = r.Str0_255()
+	m.Password = r.Str0_255()
+	m.RigId = r.Str0_255()
+	n := int(r.U8())
+	m.Algorithms = make([]string, 0, n)
+	for range n {
+		m.Algorithms = append(m.Algorithms, r.Str0_255())
+	}
+	return r.Finish()
+}
+
+type BinaryOpenStandardMiningChannelSuccess struct {
+	RequestId uint32
+	ChannelId uint32
+}
+
+func (m *BinaryOpenStandardMiningChannelSuccess) AppendBinary(buf []byte) []byte {
+	buf = binary.LittleEndian.AppendUint32(buf, m.RequestId)
+	return binary.LittleEndian.AppendUint32(buf, m.ChannelId)
+}
+
+func (m *BinaryOpenStandardMiningChannelSuccess) UnmarshalBinary(data []byte) error {
+	r := binaryReader{buf: data}
+	m.RequestId = r.U32()
+	m.ChannelId = r.U32()
+	return r.Finish()
+}
+
+type BinaryOpenMiningChannelError struct {
+	RequestId uint32
+	ErrorCode string
+}
+
+func (m *BinaryOpenMiningChannelError) AppendBinary(buf []byte) []byte {
+	buf = binary.LittleEndian.AppendUint32(buf, m.RequestId)
+	return appendStr0_255(buf, m.ErrorCode)
+}
+
+func (m *BinaryOpenMiningChannelError) UnmarshalBinary(data []byte) error {
+	r := binaryReader{buf: data}
+	m.RequestId = r.U32()
+	m.ErrorCode = r.Str0_255()
+	return r.Finish()
+}
+
+type BinaryNewMiningJob struct {
+	ChannelId uint32
+	JobId     uint32
+	Height    uint64
+	SeedHash  types.Hash
+	Algo      string
+	// NonceOffset Offset of the uint32 nonce within Blob
+	NonceOffset uint32
+	// Blob Hashing blob
+	Blob []byte
+}
+
+func (m *BinaryNewMiningJob) AppendBinary(buf []byte) []byte {
+	buf = binary.LittleEndian.AppendUint32(buf, m.ChannelId)
+	buf = binary.LittleEndian.AppendUint32(buf, m.JobId)
+	buf = binary.LittleEndian.AppendUint64(buf, m.Height)
+	buf = append(buf, m.SeedHash[:]...)
+	buf = appendStr0_255(buf, m.Algo)
+	buf = binary.LittleEndian.AppendUint32(buf, m.NonceOffset)
+	return appendB0_64K(buf, m.Blob)
+}
+
+func (m *BinaryNewMiningJob) UnmarshalBinary(data []byte) error {
+	r := binaryReader{buf: data}
+	m.ChannelId = r.U32()
+	m.JobId = r.U32()
+	m.Height = r.U64()
+	m.SeedHash = r.Hash()
+	m.Algo = r.Str0_255()
+	m.NonceOffset = r.U32()
+	m.Blob = r.B0_64K()
+	return r.Finish()
+}
+
+type BinarySetTarget struct {
+	ChannelId uint32
+	// Target 64-bit target, hash is valid if its last 8 bytes read as little endian are less than or equal to target
+	Target uint64
+}
+
+func (m *BinarySetTarget) AppendBinary(buf []byte) []byte {
+	buf = binary.LittleEndian.AppendUint32(buf, m.ChannelId)
+	return binary.LittleEndian.AppendUint64(buf, m.Target)
+}
+
+func (m *BinarySetTarget) UnmarshalBinary(data []byte) error {
+	r := binaryReader{buf: data}
+	m.ChannelId = r.U32()
+	m.Target = r.U64()
+	return r.Finish()
+}
+
+type BinarySubmitSharesStandard struct {
+	ChannelId      uint32
+	SequenceNumber uint32
+	JobId          uint32
+	Nonce          uint32
+	Result         types.Hash
+}
+
+func (m *BinarySubmitSharesStandard) AppendBinary(buf []byte) []byte {
+	buf = binary.LittleEndian.AppendUint32(buf, m.ChannelId)
+	buf = binary.LittleEndian.AppendUint32(buf, m.SequenceNumber)
+	buf = binary.LittleEndian.AppendUint32(buf, m.JobId)
+	buf = binary.LittleEndian.AppendUint32(buf, m.Nonce)
+	return append(buf, m.Result[:]...)
+}
+
+func (m *BinarySubmitSharesStandard) UnmarshalBinary(data []byte) error {
+	r := binaryReader{buf: data}
+	m.ChannelId = r.U32()
+	m.SequenceNumber = r.U32()
+	m.JobId = r.U32()
+	m.Nonce = r.U32()
+	m.Result = r.Hash()
+	return r.Finish()
+}
+
+type BinarySubmitSharesSuccess struct {
+	ChannelId          uint32
+	LastSequenceNumber uint32
+	AcceptedCount      uint32
+}
+
+func (m *BinarySubmitSharesSuccess) AppendBinary(buf []byte) []byte {
+	buf = binary.LittleEndian.AppendUint32(buf, m.ChannelId)
+	buf = binary.LittleEndian.AppendUint32(buf, m.LastSequenceNumber)
+	return binary.LittleEndian.AppendUint32(buf, m.AcceptedCount)
+}
+
+func (m *BinarySubmitSharesSuccess) UnmarshalBinary(data []byte) error {
+	r := binaryReader{buf: data}
+	m.ChannelId = r.U32()
+	m.LastSequenceNumber = r.U32()
+	m.AcceptedCount = r.U32()
+	return r.Finish()
+}
+
+type BinarySubmitSharesError struct {
+	ChannelId      uint32
+	SequenceNumber uint32
+	ErrorCode      string
+}
+
+func (m *BinarySubmitSharesError) AppendBinary(buf []byte) []byte {
+	buf = binary.LittleEndian.AppendUint32(buf, m.ChannelId)
+	buf = binary.LittleEndian.AppendUint32(buf, m.SequenceNumber)
+	return appendStr0_255(buf, m.ErrorCode)
+}
+
+func (m *BinarySubmitSharesError) UnmarshalBinary(data []byte) error {
+	r := binaryReader{buf: data}
+	m.ChannelId = r.U32()
+	m.SequenceNumber = r.U32()
+	m.ErrorCode = r.Str0_255()
+	return r.Finish()
+}
+
+type BinaryCloseChannel struct {
+	ChannelId  uint32
+	ReasonCode string
+}
+
+func (m *BinaryCloseChannel) AppendBinary(buf []byte) []byte {
+	buf = binary.LittleEndian.AppendUint32(buf, m.ChannelId)
+	return appendStr0_255(buf, m.ReasonCode)
+}
+
+func (m *BinaryCloseChannel) UnmarshalBinary(data []byte) error {
+	r := binaryReader{buf: data}
+	m.ChannelId = r.U32()
+	m.ReasonCode = r.Str0_255()
+	return r.Finish()
+}
+
+type binaryMessage interface {
+	AppendBinary(buf []byte) []byte
+}
+
+// binaryConn Connection shared by all channels of a binary client
+type binaryConn struct {
+	conn      net.Conn
+	writeLock sync.Mutex
+	buf       []byte
+}
+
+func (b *binaryConn) WriteMessage(messageType BinaryMessageType, msg binaryMessage) error {
+	b.writeLock.Lock()
+	defer b.writeLock.Unlock()
+
+	b.buf = AppendBinaryFrame(b.buf[:0], messageType, msg.AppendBinary(nil))
+
+	if err := b.conn.SetWriteDeadline(time.Now().Add(time.Second * 5)); err != nil {
+		return err
+	}
+	_, err := b.conn.Write(b.buf)
+	return err
+}
+
+// binaryChannel Standard channel state, guarded by the owning Client lock
+type binaryChannel struct {
+	conn       *binaryConn
+	id         uint32
+	jobCounter uint32
+	jobs       map[uint32]Job
+	target     uint64
+}
+
+// sendBinaryJob Sends target if changed and a new job to a binary channel. Client must be locked
+func (s *Server) sendBinaryJob(c *Client) error {
+	j, err := s.prepareJob(c, false)
+	if err != nil {
+		return err
+	}
+	tpl := j.Template
+	ch := c.binary
+
+	ch.jobCounter++
+	if ch.jobCounter == 0 {
+		ch.jobCounter++
+	}
+	ch.jobs[ch.jobCounter] = j.Job
+	// forget old jobs
+	delete(ch.jobs, ch.jobCounter-binaryMaxChannelJobs)
+
+	if target := j.Difficulty.Target(); target != ch.target {
+		ch.target = target
+		if err = ch.conn.WriteMessage(BinaryMessageSetTarget, &BinarySetTarget{
+			ChannelId: ch.id,
+			Target:    target,
+		}); err != nil {
+			return err
+		}
+	}
+
+	return ch.conn.WriteMessage(BinaryMessageNewMiningJob, &BinaryNewMiningJob{
+		ChannelId: ch.id,
+		JobId:     ch.jobCounter,
+		Height:    tpl.MainHeight,
+		SeedHash:  j.SeedHash,
+		Algo:      j.Algo,
+		// the hashing blob shares its header with the template
+		NonceOffset: uint32(tpl.NonceOffset),
+		Blob:        tpl.HashingBlob(c.buf, c.NonceStart(), j.Job.ExtraNonce, j.Job.MerkleRoot),
+	})
+}
+
+// ListenBinary Listens for the binary mining protocol. It can run beside Listen, sharing templates, bans and submit handling
+func (s *Server) ListenBinary(listen string, controlOpts ...func(network, address string, c syscall.RawConn) (err error)) error {
+	s.startBackground()
+
+	if tcpListener, err := s.listenTCP(listen, controlOpts...); err != nil {
+		return err
+	} else {
+		defer tcpListener.Close()
+
+		for {
+			if conn, err := tcpListener.Accept(); err != nil {
+				return err
+			} else {
+				var addrPort netip.AddrPort
+				if addrPort, err = s.checkIncoming(conn); err != nil {
+					go func() {
+						defer conn.Close()
+						utils.Noticef("Stratum", "Binary connection from %s rejected (%s)", conn.RemoteAddr().String(), err.Error())
+					}()
+					continue
+				}
+
+				utils.Noticef("Stratum", "Incoming binary connection from %s", conn.RemoteAddr().String())
+				go s.handleBinaryConn(conn, addrPort)
+			}
+		}
+	}
+}
+
+func (s *Server) handleBinaryConn(conn net.Conn, addrPort netip.AddrPort) {
+	bc := &binaryConn{
+		conn: conn,
+	}
+	channels := make(map[uint32]*Client)
+
+	var err error
+	defer func() {
+		_ = conn.Close()
+		for _, c := range channels {
+			s.removeClient(c)
+			s.niceHash.Release(c)
+		}
+		if err != nil {
+			utils.Noticef("Stratum", "Binary connection %s closed with error: %s", conn.RemoteAddr().String(), err)
+			if errors.Is(err, ErrBannable) {
+				s.Ban(addrPort.Addr(), time.Minute*15, err)
+			}
+		} else {
+			utils.Noticef("Stratum", "Binary connection %s closed", conn.RemoteAddr().String())
+		}
+	}()
+
+	reader := bufio.NewReader(conn)
+	var readBuf []byte
+	var setup bool
+	var setupFlags uint32
+	var channelCounter uint32
+
+	for {
+		var frame BinaryFrame
+		if frame, err = ReadBinaryFrame(reader, readBuf); err != nil {
+			if errors.Is(err, io.EOF) {
+				err = nil
+			}
+			return
+		}
+		readBuf = frame.Payload[:0]
+
+		if frame.ExtensionType != 0 {
+			err = BanError(utils.ErrorfNoEscape("unsupported extension type %d", frame.ExtensionType))
+			return
+		}
+
+		if !setup && frame.Type != BinaryMessageSetupConnection {
+			err = BanError(errors.New("connection not set up"))
+			return
+		}
+
+		switch frame.Type {
+		case BinaryMessageSetupConnection:
+			var msg BinarySetupConnection
+			if setup {
+				err = BanError(errors.New("connection already set up"))
+				return
+			} else if err = msg.UnmarshalBinary(frame.Payload); err != nil {
+				err = BanError(err)
+				return
+			} else if msg.MinVersion > BinaryProtocolVersion || msg.MaxVersion < BinaryProtocolVersion {
+				_ = bc.WriteMessage(BinaryMessageSetupConnectionError, &BinarySetupConnectionError{
+					ErrorCode: "unsupported-protocol",
+				})
+				err = errors.New("unsupported protocol version")
+				return
+			}
+			setup = true
+			setupFlags = msg.Flags & BinarySetupFlagNiceHash
+			if err = bc.WriteMessage(BinaryMessageSetupConnectionSuccess, &BinarySetupConnectionSuccess{
+				UsedVersion: BinaryProtocolVersion,
+				Flags:       setupFlags,
+			}); err != nil {
+				return
+			}
+		case BinaryMessageOpenStandardMiningChannel:
+			var msg BinaryOpenStandardMiningChannel
+			if err = msg.UnmarshalBinary(frame.Payload); err != nil {
+				err = BanError(err)
+				return
+			}
+			if len(channels) >= binaryMaxChannels {
+				if err = bc.WriteMessage(BinaryMessageOpenMiningChannelError, &BinaryOpenMiningChannelError{
+					RequestId: msg.RequestId,
+					ErrorCode: "max-channels-reached",
+				}); err != nil {
+					return
+				}
+				continue
+			}
+
+			channelCounter++
+			client := &Client{
+				Conn:       conn,
+				InternalId: s.clientIdCounter.Add(1),
+				binary: &binaryChannel{
+					conn: bc,
+					id:   channelCounter,
+					jobs: make(map[uint32]Job),
+				},
+			}
+
+			if openErr := func() error {
+				client.Lock.Lock()
+				defer client.Lock.Unlock()
+
+				params := map[string]any{
+					"login": msg.UserIdentity,
+					"pass":  msg.Password,
+					"rigid": msg.RigId,
+				}
+				if setupFlags&BinarySetupFlagNiceHash != 0 {
+					params["nicehash"] = true
+				}
+				if len(msg.Algorithms) > 0 {
+					algos := make([]any, 0, len(msg.Algorithms))
+					for _, algo := range msg.Algorithms {
+						algos = append(algos, algo)
+					}
+					params["algo"] = algos
+				}
+				return s.login(client, params)
+			}(); openErr != nil {
+				s.niceHash.Release(client)
+				if err = bc.WriteMessage(BinaryMessageOpenMiningChannelError, &BinaryOpenMiningChannelError{
+					RequestId: msg.RequestId,
+					ErrorCode: openErr.Error(),
+				}); err != nil {
+					return
+				}
+				continue
+			}
+
+			if err = bc.WriteMessage(BinaryMessageOpenStandardMiningChannelSuccess, &BinaryOpenStandardMiningChannelSuccess{
+				RequestId: msg.RequestId,
+				ChannelId: client.binary.id,
+			}); err != nil {
+				return
+			}
+
+			channels[client.binary.id] = client
+			s.addClient(client)
+
+			if err = s.SendTemplate(client, false); err != nil {
+				return
+			}
+		case BinaryMessageSubmitSharesStandard:
+			var msg BinarySubmitSharesStandard
+			if err = msg.UnmarshalBinary(frame.Payload); err != nil {
+				err = BanError(err)
+				return
+			}
+			client, ok := channels[msg.ChannelId]
+			if !ok {
+				err = BanError(errors.New("unknown channel"))
+				return
+			}
+
+			logEntry := newSubmitLogEntry(client)
+			logEntry.Nonce = msg.Nonce
+			logEntry.Result = msg.Result
+			submitError, ban := func() (error, bool) {
+				job, err, ban := func() (Job, error, bool) {
+					client.Lock.RLock()
+					defer client.Lock.RUnlock()
+					ch := client.binary
+					job, ok := ch.jobs[msg.JobId]
+					if !ok {
+						if msg.JobId == 0 || msg.JobId > ch.jobCounter {
+							// never sent to this channel, same as an invalid job id on JSON-RPC
+							return job, errors.New("invalid job id"), true
+						}
+						// only the most recent jobs are kept per channel, unlike JSON-RPC where the job id carries
+						// the template counter. A miner can still be hashing a dropped job after quick job updates
+						return job, errors.New("stale job"), false
+					}
+					logEntry.JobId = job.Id()
+					if !client.ValidNonce(msg.Nonce) {
+						return job, errors.New("nonce outside of reserved range"), true
+					}
+					return job, nil, false
+				}()
+				if err != nil {
+					return err, ban
+				}
+				return s.submitJob(client, &job, msg.Nonce, msg.Result, &logEntry)
+			}()
+			s.logSubmit(&logEntry, submitError)
+
+			if submitError != nil {
+				if err = bc.WriteMessage(BinaryMessageSubmitSharesError, &BinarySubmitSharesError{
+					ChannelId:      msg.ChannelId,
+					SequenceNumber: msg.SequenceNumber,
+					ErrorCode:      submitError.Error(),
+				}); err != nil {
+					return
+				}
+				if ban {
+					err = BanError(submitError)
+					return
+				}
+			} else {
+				if err = bc.WriteMessage(BinaryMessageSubmitSharesSuccess, &BinarySubmitSharesSuccess{
+					ChannelId:          msg.ChannelId,
+					LastSequenceNumber: msg.SequenceNumber,
+					AcceptedCount:      1,
+				}); err != nil {
+					return
+				}
+			}
+		case BinaryMessageCloseChannel:
+			var msg BinaryCloseChannel
+			if err = msg.UnmarshalBinary(frame.Payload); err != nil {
+				err = BanError(err)
+				return
+			}
+			if client, ok := channels[msg.ChannelId]; ok {
+				delete(channels, msg.ChannelId)
+				s.removeClient(client)
+				s.niceHash.Release(client)
+			}
+		default:
+			err = BanError(utils.ErrorfNoEscape("unknown message type %d", frame.Type))
+			return
+		}
+	}
+}
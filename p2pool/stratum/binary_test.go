@@ -0,0 +1,384 @@
+package stratum
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/netip"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/block"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/client"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/client/fakemonerod"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/crypto"
+	"git.gammaspectra.live/P2Pool/consensus/v5/p2pool/sidechain"
+	"git.gammaspectra.live/P2Pool/consensus/v5/types"
+)
+
+func TestBinaryFrameRoundtrip(t *testing.T) {
+	msgs := []struct {
+		Type BinaryMessageType
+		Msg  binaryMessage
+	}{
+		{BinaryMessageSetupConnection, &BinarySetupConnection{MinVersion: 1, MaxVersion: 2, Flags: 3, UserAgent: "test/1.0"}},
+		{BinaryMessageOpenStandardMiningChannel, &BinaryOpenStandardMiningChannel{RequestId: 7, UserIdentity: "4...", Password: "x", RigId: "rig", Algorithms: []string{"rx/0"}}},
+		{BinaryMessageNewMiningJob, &BinaryNewMiningJob{ChannelId: 1, JobId: 2, Height: 3000000, SeedHash: crypto.Keccak256([]byte{1}), Algo: "rx/0", NonceOffset: 39, Blob: []byte{1, 2, 3}}},
+		{BinaryMessageSubmitSharesStandard, &BinarySubmitSharesStandard{ChannelId: 1, SequenceNumber: 2, JobId: 3, Nonce: 0xdeadbeef, Result: crypto.Keccak256([]byte{2})}},
+		{BinaryMessageSubmitSharesError, &BinarySubmitSharesError{ChannelId: 1, SequenceNumber: 2, ErrorCode: "stale"}},
+		{BinaryMessageSetTarget, &BinarySetTarget{ChannelId: 1, Target: 0xffffffff}},
+	}
+
+	for _, m := range msgs {
+		buf := AppendBinaryFrame(nil, m.Type, m.Msg.AppendBinary(nil))
+		frame, err := ReadBinaryFrame(bytes.NewReader(buf), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if frame.Type != m.Type || frame.ExtensionType != 0 {
+			t.Fatalf("unexpected frame header %d/%d", frame.ExtensionType, frame.Type)
+		}
+		decoded := reflect.New(reflect.TypeOf(m.Msg).Elem()).Interface().(interface {
+			UnmarshalBinary(data []byte) error
+		})
+		if err = decoded.UnmarshalBinary(frame.Payload); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(decoded, m.Msg) {
+			t.Fatalf("message %+v does not match message %+v", decoded, m.Msg)
+		}
+
+		// truncated payloads must not decode
+		if err = decoded.UnmarshalBinary(frame.Payload[:len(frame.Payload)-1]); err == nil {
+			t.Fatal("truncated payload decoded")
+		}
+	}
+}
+
+func TestBinaryFrameTooLarge(t *testing.T) {
+	header := []byte{0, 0, uint8(BinaryMessageNewMiningJob), 0xff, 0xff, 0xff}
+	if _, err := ReadBinaryFrame(bytes.NewReader(header), nil); err == nil {
+		t.Fatal("oversized frame accepted")
+	}
+}
+
+// binaryTestConn Client side of a binary connection handled by the server over net.Pipe
+type binaryTestConn struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+	done   chan struct{}
+}
+
+func newBinaryTestConn(t *testing.T, s *Server, addrPort netip.AddrPort) *binaryTestConn {
+	serverConn, clientConn := net.Pipe()
+	c := &binaryTestConn{
+		t:      t,
+		conn:   clientConn,
+		reader: bufio.NewReader(clientConn),
+		done:   make(chan struct{}),
+	}
+	go func() {
+		defer close(c.done)
+		s.handleBinaryConn(serverConn, addrPort)
+	}()
+	return c
+}
+
+func (c *binaryTestConn) Write(messageType BinaryMessageType, msg binaryMessage) {
+	c.t.Helper()
+	if _, err := c.conn.Write(AppendBinaryFrame(nil, messageType, msg.AppendBinary(nil))); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *binaryTestConn) Read(messageType BinaryMessageType, msg interface{ UnmarshalBinary(data []byte) error }) {
+	c.t.Helper()
+	frame, err := ReadBinaryFrame(c.reader, nil)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if frame.Type != messageType {
+		c.t.Fatalf("expected message type 0x%02x, got 0x%02x", messageType, frame.Type)
+	}
+	if err = msg.UnmarshalBinary(frame.Payload); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// Closed Waits for the server to close the connection
+func (c *binaryTestConn) Closed() {
+	c.t.Helper()
+	if _, err := ReadBinaryFrame(c.reader, nil); !errors.Is(err, io.EOF) {
+		c.t.Fatalf("expected closed connection, got %v", err)
+	}
+	<-c.done
+}
+
+func (c *binaryTestConn) OpenChannel(requestId uint32) (channel BinaryOpenStandardMiningChannelSuccess, job BinaryNewMiningJob) {
+	c.t.Helper()
+	c.Write(BinaryMessageOpenStandardMiningChannel, &BinaryOpenStandardMiningChannel{
+		RequestId:    requestId,
+		UserIdentity: types.DonationAddress,
+		Algorithms:   []string{AlgoRandomX_V0},
+	})
+	c.Read(BinaryMessageOpenStandardMiningChannelSuccess, &channel)
+	if channel.RequestId != requestId {
+		c.t.Fatalf("expected request id %d, got %d", requestId, channel.RequestId)
+	}
+	var target BinarySetTarget
+	c.Read(BinaryMessageSetTarget, &target)
+	if target.ChannelId != channel.ChannelId {
+		c.t.Fatalf("target for channel %d, expected %d", target.ChannelId, channel.ChannelId)
+	}
+	c.Read(BinaryMessageNewMiningJob, &job)
+	if job.ChannelId != channel.ChannelId {
+		c.t.Fatalf("job for channel %d, expected %d", job.ChannelId, channel.ChannelId)
+	}
+	return channel, job
+}
+
+func TestBinaryConnection(t *testing.T) {
+	d, err := fakemonerod.New(fakemonerod.Config{
+		Height: 100,
+		// every hash passes main difficulty, so shares found here are blocks
+		Difficulty: types.DifficultyFrom64(1),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	rpcClient, err := client.NewClient(d.RPCAddress(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	minerData, err := MinerDataFromDaemon(rpcClient, types.DonationAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	submitted := make(chan *block.PoolMainBlock, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stratumServer := NewSoloServer(ctx, sidechain.ConsensusMini, donationAddr.ToPackedAddress(), func(b *block.PoolMainBlock) error {
+		submitted <- b
+		return nil
+	})
+	stratumServer.SubmitLog = NewSubmitLog(16, time.Hour)
+	stratumServer.HandleMinerData(minerData)
+	func() {
+		//Process all incoming changes first
+		for {
+			select {
+			case f := <-stratumServer.incomingChanges:
+				f()
+			default:
+				return
+			}
+		}
+	}()
+
+	// loopback addresses are never banned
+	addrPort := netip.MustParseAddrPort("192.0.2.1:3333")
+
+	t.Run("Submit", func(t *testing.T) {
+		c := newBinaryTestConn(t, stratumServer, addrPort)
+
+		c.Write(BinaryMessageSetupConnection, &BinarySetupConnection{
+			MinVersion: BinaryProtocolVersion,
+			MaxVersion: BinaryProtocolVersion,
+			Flags:      BinarySetupFlagNiceHash,
+			UserAgent:  "test/1.0",
+		})
+		var setup BinarySetupConnectionSuccess
+		c.Read(BinaryMessageSetupConnectionSuccess, &setup)
+		if setup.UsedVersion != BinaryProtocolVersion || setup.Flags != BinarySetupFlagNiceHash {
+			t.Fatalf("unexpected setup response %+v", setup)
+		}
+
+		// the second channel gets a non-zero nonce prefix
+		_, _ = c.OpenChannel(1)
+		channel, job := c.OpenChannel(2)
+		if channel.ChannelId != 2 || job.JobId != 1 {
+			t.Fatalf("unexpected channel %d job %d", channel.ChannelId, job.JobId)
+		}
+		if job.Height != minerData.Height || job.SeedHash != minerData.SeedHash {
+			t.Fatalf("unexpected job %+v", job)
+		}
+		if int(job.NonceOffset)+4 > len(job.Blob) {
+			t.Fatalf("nonce offset %d out of blob bounds", job.NonceOffset)
+		}
+		prefix := binary.LittleEndian.Uint32(job.Blob[job.NonceOffset:])
+		if prefix != NiceHashNoncePrefix(1) {
+			t.Fatalf("expected nonce prefix %08x, got %08x", NiceHashNoncePrefix(1), prefix)
+		}
+
+		nonce := prefix | 5
+		blob := slices.Clone(job.Blob)
+		binary.LittleEndian.PutUint32(blob[job.NonceOffset:], nonce)
+		result, err := sidechain.ConsensusMini.GetHasher().Hash(job.SeedHash[:], blob)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c.Write(BinaryMessageSubmitSharesStandard, &BinarySubmitSharesStandard{
+			ChannelId:      channel.ChannelId,
+			SequenceNumber: 1,
+			JobId:          job.JobId,
+			Nonce:          nonce,
+			Result:         result,
+		})
+		var success BinarySubmitSharesSuccess
+		c.Read(BinaryMessageSubmitSharesSuccess, &success)
+		if success.ChannelId != channel.ChannelId || success.LastSequenceNumber != 1 || success.AcceptedCount != 1 {
+			t.Fatalf("unexpected submit response %+v", success)
+		}
+		if b := <-submitted; b.Nonce != nonce || b.Coinbase.MinerGenHeight != minerData.Height {
+			t.Fatalf("unexpected submitted block nonce %08x height %d", b.Nonce, b.Coinbase.MinerGenHeight)
+		}
+		if entries := stratumServer.SubmitLog.Query(SubmitLogFilter{}); len(entries) != 1 || entries[0].Outcome != SubmitOutcomeMainBlock {
+			t.Fatalf("unexpected submit log %+v", entries)
+		} else if entries[0].VerifiedDifficulty != types.DifficultyFromPoW(result) || entries[0].ClaimedDifficulty != entries[0].VerifiedDifficulty {
+			t.Fatalf("verified difficulty %s, claimed %s", entries[0].VerifiedDifficulty, entries[0].ClaimedDifficulty)
+		}
+
+		// push enough new jobs for the first one to be dropped
+		client := func() *Client {
+			stratumServer.clientsLock.RLock()
+			defer stratumServer.clientsLock.RUnlock()
+			for _, sc := range stratumServer.clients {
+				if sc.binary != nil && sc.binary.id == channel.ChannelId {
+					return sc
+				}
+			}
+			return nil
+		}()
+		if client == nil {
+			t.Fatal("channel client not found")
+		}
+		go func() {
+			for range binaryMaxChannelJobs {
+				_ = stratumServer.SendTemplate(client, false)
+			}
+		}()
+		var lastJob BinaryNewMiningJob
+		for range binaryMaxChannelJobs {
+			c.Read(BinaryMessageNewMiningJob, &lastJob)
+		}
+
+		// stale jobs are rejected without closing the connection
+		c.Write(BinaryMessageSubmitSharesStandard, &BinarySubmitSharesStandard{
+			ChannelId:      channel.ChannelId,
+			SequenceNumber: 2,
+			JobId:          job.JobId,
+			Nonce:          nonce,
+			Result:         result,
+		})
+		var submitErr BinarySubmitSharesError
+		c.Read(BinaryMessageSubmitSharesError, &submitErr)
+		if submitErr.SequenceNumber != 2 || submitErr.ErrorCode != "stale job" {
+			t.Fatalf("unexpected submit error %+v", submitErr)
+		}
+
+		// a nonce outside of the reserved prefix gets the peer banned
+		c.Write(BinaryMessageSubmitSharesStandard, &BinarySubmitSharesStandard{
+			ChannelId:      channel.ChannelId,
+			SequenceNumber: 3,
+			JobId:          lastJob.JobId,
+			Nonce:          NiceHashNoncePrefix(7) | 5,
+			Result:         result,
+		})
+		c.Read(BinaryMessageSubmitSharesError, &submitErr)
+		if submitErr.SequenceNumber != 3 || submitErr.ErrorCode != "nonce outside of reserved range" {
+			t.Fatalf("unexpected submit error %+v", submitErr)
+		}
+		c.Closed()
+
+		if banned, _ := stratumServer.IsBanned(addrPort.Addr()); !banned {
+			t.Fatal("peer not banned")
+		}
+		if len(stratumServer.clients) != 0 {
+			t.Fatalf("%d clients left after close", len(stratumServer.clients))
+		}
+		if len(stratumServer.niceHash.free) != NiceHashSlots {
+			t.Fatalf("%d nicehash slots free after close, expected %d", len(stratumServer.niceHash.free), NiceHashSlots)
+		}
+	})
+
+	t.Run("UnknownJob", func(t *testing.T) {
+		otherAddrPort := netip.MustParseAddrPort("192.0.2.4:3333")
+		c := newBinaryTestConn(t, stratumServer, otherAddrPort)
+
+		c.Write(BinaryMessageSetupConnection, &BinarySetupConnection{
+			MinVersion: BinaryProtocolVersion,
+			MaxVersion: BinaryProtocolVersion,
+		})
+		var setup BinarySetupConnectionSuccess
+		c.Read(BinaryMessageSetupConnectionSuccess, &setup)
+
+		// job ids never sent on the channel get the peer banned, same as JSON-RPC
+		channel, job := c.OpenChannel(1)
+		c.Write(BinaryMessageSubmitSharesStandard, &BinarySubmitSharesStandard{
+			ChannelId:      channel.ChannelId,
+			SequenceNumber: 1,
+			JobId:          job.JobId + 100,
+		})
+		var submitErr BinarySubmitSharesError
+		c.Read(BinaryMessageSubmitSharesError, &submitErr)
+		if submitErr.SequenceNumber != 1 || submitErr.ErrorCode != "invalid job id" {
+			t.Fatalf("unexpected submit error %+v", submitErr)
+		}
+		c.Closed()
+
+		if banned, _ := stratumServer.IsBanned(otherAddrPort.Addr()); !banned {
+			t.Fatal("peer not banned")
+		}
+	})
+
+	t.Run("UnknownChannel", func(t *testing.T) {
+		otherAddrPort := netip.MustParseAddrPort("192.0.2.2:3333")
+		c := newBinaryTestConn(t, stratumServer, otherAddrPort)
+
+		c.Write(BinaryMessageSetupConnection, &BinarySetupConnection{
+			MinVersion: BinaryProtocolVersion,
+			MaxVersion: BinaryProtocolVersion,
+		})
+		var setup BinarySetupConnectionSuccess
+		c.Read(BinaryMessageSetupConnectionSuccess, &setup)
+		if setup.Flags != 0 {
+			t.Fatalf("unexpected setup flags %08x", setup.Flags)
+		}
+
+		c.Write(BinaryMessageSubmitSharesStandard, &BinarySubmitSharesStandard{
+			ChannelId: 7,
+			JobId:     1,
+		})
+		c.Closed()
+
+		if banned, _ := stratumServer.IsBanned(otherAddrPort.Addr()); !banned {
+			t.Fatal("peer not banned")
+		}
+	})
+
+	t.Run("NotSetUp", func(t *testing.T) {
+		otherAddrPort := netip.MustParseAddrPort("192.0.2.3:3333")
+		c := newBinaryTestConn(t, stratumServer, otherAddrPort)
+
+		c.Write(BinaryMessageOpenStandardMiningChannel, &BinaryOpenStandardMiningChannel{
+			RequestId:    1,
+			UserIdentity: types.DonationAddress,
+		})
+		c.Closed()
+
+		if banned, _ := stratumServer.IsBanned(otherAddrPort.Addr()); !banned {
+			t.Fatal("peer not banned")
+		}
+	})
+}
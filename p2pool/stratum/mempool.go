@@ -22,6 +22,17 @@ func (m MiningMempool) Add(tx *mempool.Entry) (added bool) {
 	return added
 }
 
+// Remove Deletes transactions from the mempool.
+func (m MiningMempool) Remove(ids ...types.Hash) (removed int) {
+	for _, id := range ids {
+		if _, ok := m[id]; ok {
+			delete(m, id)
+			removed++
+		}
+	}
+	return removed
+}
+
 func (m MiningMempool) Swap(pool mempool.Mempool) {
 	currentTime := time.Now()
 
@@ -44,6 +44,35 @@ type jsonRpcJobParams struct {
 
 	// SeedHash
 	SeedHash types.Hash `json:"seed_hash,omitzero"`
+
+	// Template Full block template, only sent when template extension is negotiated
+	Template *jsonRpcJobTemplate `json:"template,omitempty"`
+}
+
+// jsonRpcJobTemplate Block template data for template mode, see docs/STRATUM.md
+// Offsets are relative to the start of BlockTemplateBlob
+type jsonRpcJobTemplate struct {
+	// BlockTemplateBlob Monero block template, in hex
+	BlockTemplateBlob string `json:"blocktemplate_blob"`
+
+	// SideData P2Pool side data following the block template, in hex
+	SideData string `json:"side_data"`
+
+	// NonceOffset offset of the uint32 nonce
+	NonceOffset int `json:"nonce_offset"`
+
+	// ExtraNonceOffset offset of the uint32 extra nonce in the coinbase transaction
+	ExtraNonceOffset int `json:"extra_nonce_offset"`
+	ExtraNonceSize   int `json:"extra_nonce_size"`
+
+	// MerkleRootOffset offset of the merge mining merkle root in the coinbase transaction
+	MerkleRootOffset int `json:"merkle_root_offset"`
+
+	CoinbaseOffset     int `json:"coinbase_offset"`
+	TransactionsOffset int `json:"transactions_offset"`
+
+	// MerkleBranch main branch of the coinbase transaction id in the transaction merkle tree
+	MerkleBranch []types.Hash `json:"merkle_branch"`
 }
 
 type JsonRpcResponseJob struct {
@@ -61,6 +90,14 @@ type jsonRpcResponseJobResult struct {
 	Status     string           `json:"status"`
 }
 
+const (
+	ExtensionAlgo      = "algo"
+	ExtensionKeepAlive = "keepalive"
+	ExtensionNiceHash  = "nicehash"
+	// ExtensionTemplate Full block template mode, see docs/STRATUM.md
+	ExtensionTemplate = "template"
+)
+
 var baseRpcJob = JsonRpcJob{
 	JsonRpcVersion: "2.0",
 	Method:         "job",
@@ -69,7 +106,7 @@ var baseRpcJob = JsonRpcJob{
 var baseRpcResponseJob = JsonRpcResponseJob{
 	JsonRpcVersion: "2.0",
 	Result: jsonRpcResponseJobResult{
-		Extensions: []string{"algo", "keepalive"},
+		Extensions: []string{ExtensionAlgo, ExtensionKeepAlive},
 		Status:     "OK",
 	},
 }
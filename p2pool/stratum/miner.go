@@ -56,6 +56,12 @@ type ClientExtensions struct {
 	CryptoNight_V1 bool
 	CryptoNight_V2 bool
 	CryptoNight_R  bool
+
+	// NiceHash Upper nonce bits are reserved per connection, see NiceHashReservedNonceBits
+	NiceHash bool
+
+	// Template Full block template is sent alongside jobs, and extra nonce can be rolled by the client
+	Template bool
 }
 
 func (e ClientExtensions) HasAlgo(algo string) bool {
@@ -98,6 +104,14 @@ type Client struct {
 	buf              []byte
 	RpcId            uint32
 	InternalId       uint64
+
+	// NoncePrefix Reserved nonce prefix when Extensions.NiceHash is set
+	NoncePrefix uint32
+	// niceHashSlot Set while NoncePrefix is reserved from the server slots, guarded by the allocator lock
+	niceHashSlot bool
+
+	// binary Standard channel state for binary protocol clients, nil for JSON-RPC clients
+	binary *binaryChannel
 }
 
 func (c *Client) GetAddress(majorVersion uint8) address.PackedAddressWithSubaddress {
@@ -0,0 +1,84 @@
+package stratum
+
+import "sync"
+
+// NiceHashReservedNonceBits Number of upper nonce bits fixed by the server per connection when the nicehash extension is negotiated
+// The client owns the remaining lower bits, and may partition them further for downstream workers
+const NiceHashReservedNonceBits = 8
+
+// NiceHashNonceMask Mask of the reserved upper nonce bits
+const NiceHashNonceMask = ^uint32(0) << (32 - NiceHashReservedNonceBits)
+
+// NiceHashSlots Number of distinct nonce prefixes, and so of concurrent connections with the nicehash extension
+const NiceHashSlots = 1 << NiceHashReservedNonceBits
+
+// NiceHashNoncePrefix Returns the fixed nonce prefix for a slot
+func NiceHashNoncePrefix(slot uint8) uint32 {
+	return (uint32(slot) << (32 - NiceHashReservedNonceBits)) & NiceHashNonceMask
+}
+
+// niceHashAllocator Free list of nonce prefix slots, so no two connections share a prefix
+// Released slots are queued at the end, and are only handed out again once all other free slots were used
+type niceHashAllocator struct {
+	lock        sync.Mutex
+	initialized bool
+	free        []uint8
+}
+
+// Allocate Reserves a slot for the client and sets its nonce prefix
+// Returns false if all slots are taken. A client already holding a slot keeps it.
+func (a *niceHashAllocator) Allocate(c *Client) bool {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if c.niceHashSlot {
+		return true
+	}
+
+	if !a.initialized {
+		a.free = make([]uint8, 0, NiceHashSlots)
+		for i := range NiceHashSlots {
+			a.free = append(a.free, uint8(i))
+		}
+		a.initialized = true
+	}
+
+	if len(a.free) == 0 {
+		return false
+	}
+
+	slot := a.free[0]
+	a.free = a.free[1:]
+	c.NoncePrefix = NiceHashNoncePrefix(slot)
+	c.niceHashSlot = true
+	return true
+}
+
+// Release Returns the client slot to the free list, if it holds one. Safe to call several times
+func (a *niceHashAllocator) Release(c *Client) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if !c.niceHashSlot {
+		return
+	}
+	c.niceHashSlot = false
+	a.free = append(a.free, uint8(c.NoncePrefix>>(32-NiceHashReservedNonceBits)))
+}
+
+// NonceStart Initial nonce placed in job blobs sent to this client
+// For clients with nicehash extension this contains the reserved prefix, zero otherwise
+func (c *Client) NonceStart() uint32 {
+	if c.Extensions.NiceHash {
+		return c.NoncePrefix
+	}
+	return 0
+}
+
+// ValidNonce Checks a submitted nonce against the client reservation
+func (c *Client) ValidNonce(nonce uint32) bool {
+	if c.Extensions.NiceHash {
+		return nonce&NiceHashNonceMask == c.NoncePrefix
+	}
+	return true
+}
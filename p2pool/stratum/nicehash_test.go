@@ -0,0 +1,69 @@
+package stratum
+
+import (
+	"testing"
+)
+
+func TestNiceHashNonce(t *testing.T) {
+	c := &Client{InternalId: 0x1234}
+	if c.NonceStart() != 0 || !c.ValidNonce(0xffffffff) {
+		t.Fatal("nonce reserved without nicehash extension")
+	}
+
+	c.Extensions.NiceHash = true
+	c.NoncePrefix = NiceHashNoncePrefix(0x34)
+
+	if c.NoncePrefix != 0x34000000 {
+		t.Fatalf("unexpected prefix %08x", c.NoncePrefix)
+	}
+
+	if c.NonceStart() != c.NoncePrefix {
+		t.Fatal("nonce start does not contain prefix")
+	}
+
+	if !c.ValidNonce(c.NoncePrefix | 0x00abcdef) {
+		t.Fatal("nonce within reserved range rejected")
+	}
+
+	if c.ValidNonce(0x35abcdef) {
+		t.Fatal("nonce outside reserved range accepted")
+	}
+}
+
+func TestNiceHashAllocator(t *testing.T) {
+	var a niceHashAllocator
+
+	clients := make([]*Client, NiceHashSlots)
+	prefixes := make(map[uint32]struct{}, NiceHashSlots)
+	for i := range clients {
+		clients[i] = &Client{InternalId: uint64(i)}
+		if !a.Allocate(clients[i]) {
+			t.Fatalf("slot %d not allocated", i)
+		}
+		prefixes[clients[i].NoncePrefix] = struct{}{}
+	}
+	if len(prefixes) != NiceHashSlots {
+		t.Fatalf("expected %d distinct prefixes, got %d", NiceHashSlots, len(prefixes))
+	}
+
+	// internal id would wrap around to the first prefix
+	extra := &Client{InternalId: NiceHashSlots}
+	if a.Allocate(extra) {
+		t.Fatal("allocated slot with all slots taken")
+	}
+
+	released := clients[0x34]
+	a.Release(released)
+	a.Release(released)
+	if !a.Allocate(extra) {
+		t.Fatal("released slot not reused")
+	}
+	if extra.NoncePrefix != 0x34000000 {
+		t.Fatalf("unexpected prefix %08x", extra.NoncePrefix)
+	}
+
+	// double release must not free the slot twice
+	if a.Allocate(&Client{}) {
+		t.Fatal("allocated slot with all slots taken")
+	}
+}
@@ -0,0 +1,282 @@
+package stratum
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"math"
+	"time"
+
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/address"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/block"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/client"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/client/rpc"
+	"git.gammaspectra.live/P2Pool/consensus/v5/p2pool/mempool"
+	"git.gammaspectra.live/P2Pool/consensus/v5/p2pool/sidechain"
+	p2pooltypes "git.gammaspectra.live/P2Pool/consensus/v5/p2pool/types"
+	"git.gammaspectra.live/P2Pool/consensus/v5/types"
+	"git.gammaspectra.live/P2Pool/consensus/v5/utils"
+)
+
+type soloMode struct {
+	address address.PackedAddress
+	// seed Random per-server seed for deterministic transaction keys
+	seed types.Hash
+}
+
+// NewSoloServer Creates a stratum server that mines directly against monerod, without a SideChain
+// Templates are built with the same coinbase and transaction selection as pool templates, from miner data and the local
+// mining mempool provided via HandleMinerData and HandleMempoolData. The whole block reward is paid to addr.
+//
+// consensus is used for template identifiers and share version selection, and its hasher must be initialized to verify found blocks.
+// Blocks that pass main difficulty are verified and submitted via submitMain.
+func NewSoloServer(ctx context.Context, consensus *sidechain.Consensus, addr address.PackedAddress, submitMain func(b *block.PoolMainBlock) error) *Server {
+	var seed types.Hash
+	_, _ = rand.Read(seed[:])
+
+	server := &Server{
+		SubmitMainFunc:         submitMain,
+		consensus:              consensus,
+		derivationCache:        sidechain.NewDerivationLRUCache(),
+		ctx:                    ctx,
+		preAllocatedSharesPool: sidechain.NewPreAllocatedSharesPool(1),
+		miners:                 make(map[uint64]*MinerTrackingEntry),
+		bans:                   make(map[[16]byte]BanEntry),
+		mempool:                (MiningMempool)(make(map[types.Hash]*mempool.Entry, 512)),
+		// buffer 8 at a time for non-blocking source
+		incomingChanges: make(chan func() bool, 8),
+
+		//refresh every n seconds
+		refreshDuration: time.Second * 10,
+
+		solo: &soloMode{
+			address: addr,
+			seed:    seed,
+		},
+	}
+	return server
+}
+
+// IsSolo Whether the server mines directly against monerod
+func (s *Server) IsSolo() bool {
+	return s.solo != nil
+}
+
+// submitSolo Verifies the proof of work of a solo block against main difficulty, then submits it
+func (s *Server) submitSolo(b *sidechain.PoolBlock, resultHash types.Hash, entry *SubmitLogEntry) (error, bool) {
+	mainHeight, mainDiff, seedHash := func() (uint64, types.Difficulty, types.Hash) {
+		s.lock.RLock()
+		defer s.lock.RUnlock()
+		if s.minerData == nil {
+			return 0, types.ZeroDifficulty, types.ZeroHash
+		}
+		return s.minerData.Height, s.minerData.Difficulty, s.minerData.SeedHash
+	}()
+
+	if mainDiff == types.ZeroDifficulty {
+		return errors.New("no main data present"), false
+	}
+
+	entry.Target = mainDiff
+
+	if b.Main.Coinbase.MinerGenHeight != mainHeight {
+		return errors.New("stale template"), false
+	}
+
+	if !mainDiff.CheckPoW(resultHash) {
+		return errors.New("low difficulty share"), true
+	}
+
+	powHash, err := b.Main.PowHashWithError(s.consensus.GetHasher(), func(height uint64) types.Hash {
+		if height == mainHeight {
+			return seedHash
+		}
+		return types.ZeroHash
+	})
+	if err != nil {
+		return utils.ErrorfNoEscape("could not calculate pow: %w", err), false
+	}
+
+	entry.PowHash = powHash
+	entry.VerifiedDifficulty = types.DifficultyFromPoW(powHash)
+	if powHash != resultHash {
+		return errors.New("invalid result hash"), true
+	}
+
+	utils.Noticef("Stratum", "Found solo block at height %d, id %s", mainHeight, b.Main.Id())
+
+	if s.SubmitMainFunc == nil {
+		return errors.New("nil submit main function"), false
+	}
+	if err := s.SubmitMainFunc(&b.Main); err != nil {
+		return utils.ErrorfNoEscape("submit main error: %w", err), false
+	}
+	entry.Outcome = SubmitOutcomeMainBlock
+	return nil, false
+}
+
+// MinerDataFromDaemon Queries monerod RPC for current miner data, including the transaction backlog
+// get_miner_data is used when available. Otherwise, as on older monerod, miner data is derived from get_block_template, see MinerDataFromBlockTemplate.
+// walletAddress is only used for get_block_template, and must be valid on the daemon network.
+func MinerDataFromDaemon(c client.RPC, walletAddress string) (*p2pooltypes.MinerData, error) {
+	d, err := c.GetMinerData()
+	if err != nil {
+		var responseErr *rpc.ResponseError
+		if errors.As(err, &responseErr) {
+			utils.Debugf("Stratum", "get_miner_data failed, falling back to get_block_template: %s", err)
+			return MinerDataFromBlockTemplate(c, walletAddress)
+		}
+		return nil, err
+	}
+
+	version, err := c.GetVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	var minorVersion uint8
+	if len(version.HardForks) > 0 {
+		minorVersion = uint8(version.HardForks[len(version.HardForks)-1].Version)
+	}
+
+	return &p2pooltypes.MinerData{
+		MajorVersion:          d.MajorVersion,
+		MinorVersion:          minorVersion,
+		Height:                d.Height,
+		PrevId:                d.PrevId,
+		SeedHash:              d.SeedHash,
+		Difficulty:            d.Difficulty,
+		MedianWeight:          d.MedianWeight,
+		AlreadyGeneratedCoins: d.AlreadyGeneratedCoins,
+		MedianTimestamp:       d.MedianTimestamp,
+		FCMPTreeLayers:        d.FCMPTreeLayers,
+		FCMPTreeRoot:          d.FCMPTreeRoot,
+		TimeReceived:          time.Now(),
+		TxBacklog:             d.TxBacklog,
+	}, nil
+}
+
+// MinerDataFromBlockTemplate Derives miner data from get_block_template, get_info and get_transaction_pool
+// Block templates lack the generated coins required to build the coinbase. The base reward is recovered instead from the template
+// coinbase reward, the fees of its transactions and its weight, and AlreadyGeneratedCoins is set to a value with that base reward.
+// MedianTimestamp is not available and left zero.
+func MinerDataFromBlockTemplate(c client.RPC, walletAddress string) (*p2pooltypes.MinerData, error) {
+	tpl, err := c.GetBlockTemplate(walletAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	var b block.GenericBlock
+	if err = b.UnmarshalBinary(tpl.BlocktemplateBlob, false, nil); err != nil {
+		return nil, utils.ErrorfNoEscape("block template: %w", err)
+	}
+
+	info, err := c.GetInfo()
+	if err != nil {
+		return nil, err
+	}
+
+	pool, err := c.GetTransactionPool(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	backlog := make(mempool.Mempool, 0, len(pool.Transactions))
+	poolEntries := make(map[types.Hash]*mempool.Entry, len(pool.Transactions))
+	for _, tx := range pool.Transactions {
+		e := &mempool.Entry{
+			Id:                tx.IDHash,
+			BlobSize:          tx.BlobSize,
+			Weight:            tx.Weight,
+			Fee:               tx.Fee,
+			TimeReceivedMilli: tx.ReceiveTime * 1000,
+		}
+		backlog = append(backlog, e)
+		poolEntries[e.Id] = e
+	}
+
+	weight := uint64(b.Coinbase.Weight())
+	var fees uint64
+	for _, txId := range b.Transactions {
+		e, ok := poolEntries[txId]
+		if !ok {
+			return nil, utils.ErrorfNoEscape("block template transaction %s not found in pool", txId)
+		}
+		weight += e.Weight
+		fees += e.Fee
+	}
+
+	baseReward, err := templateBaseReward(b.Coinbase.TotalReward(), info.BlockWeightMedian, fees, weight)
+	if err != nil {
+		return nil, err
+	}
+
+	return &p2pooltypes.MinerData{
+		MajorVersion:          b.MajorVersion,
+		MinorVersion:          b.MinorVersion,
+		Height:                uint64(tpl.Height),
+		PrevId:                tpl.PrevHash,
+		SeedHash:              tpl.SeedHash,
+		Difficulty:            types.DifficultyFrom64(uint64(tpl.Difficulty)),
+		MedianWeight:          info.BlockWeightMedian,
+		AlreadyGeneratedCoins: alreadyGeneratedCoinsForBaseReward(baseReward),
+		FCMPTreeLayers:        b.FCMPTreeLayers,
+		FCMPTreeRoot:          b.FCMPTreeRoot,
+		TimeReceived:          time.Now(),
+		TxBacklog:             backlog,
+	}, nil
+}
+
+// baseRewardShift Emission speed factor, as used in block.GetBaseReward
+const baseRewardShift = 19
+
+// templateBaseReward Recovers the base reward of a block template from its total reward, undoing the weight penalty if any
+// Returns the smallest base reward that results in at least the total reward.
+func templateBaseReward(totalReward, medianWeight, fees, weight uint64) (uint64, error) {
+	if totalReward < fees {
+		return 0, utils.ErrorfNoEscape("block template reward %d is less than fees %d", totalReward, fees)
+	}
+	if weight <= medianWeight {
+		return totalReward - fees, nil
+	}
+	if weight > medianWeight*2 {
+		return 0, utils.ErrorfNoEscape("block template weight %d is too large for median weight %d", weight, medianWeight)
+	}
+
+	lo, hi := totalReward-fees, uint64(math.MaxUint64>>baseRewardShift)
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		if mempool.GetBlockReward(mid, medianWeight, fees, weight) >= totalReward {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+	return lo, nil
+}
+
+// alreadyGeneratedCoinsForBaseReward Inverse of block.GetBaseReward, returns generated coins that result in baseReward
+func alreadyGeneratedCoinsForBaseReward(baseReward uint64) uint64 {
+	return ^(baseReward << baseRewardShift)
+}
+
+// PollDaemon Periodically refreshes miner data from monerod RPC until context is done
+// Useful for solo mode when no ZMQ subscription is available
+func (s *Server) PollDaemon(c client.RPC, interval time.Duration) {
+	walletAddress := string(s.solo.address.ToAddress(s.consensus.NetworkType.MustAddressNetwork()).ToBase58())
+
+	var lastPrevId types.Hash
+	for range utils.ContextTick(s.ctx, interval) {
+		minerData, err := MinerDataFromDaemon(c, walletAddress)
+		if err != nil {
+			utils.Errorf("Stratum", "Error getting miner data: %s", err)
+			continue
+		}
+		if minerData.PrevId != lastPrevId {
+			lastPrevId = minerData.PrevId
+			s.HandleMinerData(minerData)
+		} else {
+			s.HandleMempoolData(minerData.TxBacklog)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package stratum
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/block"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/client"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/client/fakemonerod"
+	"git.gammaspectra.live/P2Pool/consensus/v5/p2pool/mempool"
+	"git.gammaspectra.live/P2Pool/consensus/v5/p2pool/sidechain"
+	"git.gammaspectra.live/P2Pool/consensus/v5/types"
+)
+
+func TestSoloServer(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		noMinerData bool
+	}{
+		{"MinerData", false},
+		{"BlockTemplate", true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			d, err := fakemonerod.New(fakemonerod.Config{
+				Height:      100,
+				NoMinerData: tc.noMinerData,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer d.Close()
+
+			d.AddTransactions(&mempool.Entry{Id: types.Hash{1}, BlobSize: 1500, Weight: 1500, Fee: 30000000})
+
+			rpcClient, err := client.NewClient(d.RPCAddress(), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			minerData, err := MinerDataFromDaemon(rpcClient, types.DonationAddress)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			expected := d.MinerData()
+			if minerData.Height != expected.Height || minerData.PrevId != expected.PrevId || minerData.SeedHash != expected.SeedHash {
+				t.Fatalf("unexpected miner data %+v", minerData)
+			}
+			if minerData.MajorVersion != expected.MajorVersion || minerData.Difficulty != expected.Difficulty || minerData.MedianWeight != expected.MedianWeight {
+				t.Fatalf("unexpected miner data %+v", minerData)
+			}
+			if block.GetBaseReward(minerData.AlreadyGeneratedCoins) != block.GetBaseReward(expected.AlreadyGeneratedCoins) {
+				t.Fatalf("base reward %d != %d", block.GetBaseReward(minerData.AlreadyGeneratedCoins), block.GetBaseReward(expected.AlreadyGeneratedCoins))
+			}
+			if len(minerData.TxBacklog) != 1 || minerData.TxBacklog[0].Id != (types.Hash{1}) || minerData.TxBacklog[0].Fee != 30000000 {
+				t.Fatalf("unexpected backlog %+v", minerData.TxBacklog)
+			}
+
+			soloAddr := donationAddr.ToPackedAddress()
+			stratumServer := NewSoloServer(context.Background(), sidechain.ConsensusMini, soloAddr, submitMainBlockFunc)
+			stratumServer.HandleMinerData(minerData)
+
+			func() {
+				//Process all incoming changes first
+				for {
+					select {
+					case f := <-stratumServer.incomingChanges:
+						f()
+					default:
+						return
+					}
+				}
+			}()
+
+			tpl, _, targetDiff, seedHash, err := stratumServer.BuildTemplate(0, donationAddrFunc, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if seedHash != minerData.SeedHash {
+				t.Fatal("different seed hash")
+			}
+
+			if tpl.MainHeight != minerData.Height || tpl.MainParent != minerData.PrevId {
+				t.Fatal("different main parent")
+			}
+
+			if tpl.SideHeight != 0 || tpl.SideParent != types.ZeroHash {
+				t.Fatal("solo template references sidechain")
+			}
+
+			if targetDiff != minerData.Difficulty {
+				t.Fatalf("target difficulty %s != main difficulty %s", targetDiff, minerData.Difficulty)
+			}
+		})
+	}
+}
+
+func TestTemplateBaseReward(t *testing.T) {
+	const medianWeight = 300000
+	const baseReward = 600000000000
+	const fees = 30000000
+
+	for _, weight := range []uint64{1000, medianWeight, medianWeight + 1, medianWeight * 3 / 2, medianWeight*2 - 1} {
+		totalReward := mempool.GetBlockReward(baseReward, medianWeight, fees, weight)
+		result, err := templateBaseReward(totalReward, medianWeight, fees, weight)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mempool.GetBlockReward(result, medianWeight, fees, weight) != totalReward || result > baseReward {
+			t.Fatalf("weight %d: base reward %d, expected %d", weight, result, uint64(baseReward))
+		}
+	}
+
+	if _, err := templateBaseReward(baseReward, medianWeight, fees, medianWeight*2+1); err == nil {
+		t.Fatal("expected error for weight over twice the median")
+	}
+
+	for _, reward := range []uint64{baseReward, 17592186044415} {
+		if block.GetBaseReward(alreadyGeneratedCoinsForBaseReward(reward)) != reward {
+			t.Fatalf("generated coins do not result in base reward %d", reward)
+		}
+	}
+}
+
+func TestSoloServerMempoolDiff(t *testing.T) {
+	d, err := fakemonerod.New(fakemonerod.Config{Height: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	// high fee transactions are picked regardless of the time in mempool
+	tx1 := &mempool.Entry{Id: types.Hash{1}, BlobSize: 1500, Weight: 1500, Fee: HighFeeValue}
+	tx2 := &mempool.Entry{Id: types.Hash{2}, BlobSize: 1500, Weight: 1500, Fee: HighFeeValue}
+	d.AddTransactions(tx1, tx2)
+
+	rpcClient, err := client.NewClient(d.RPCAddress(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	minerData, err := MinerDataFromDaemon(rpcClient, types.DonationAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stratumServer := NewSoloServer(context.Background(), sidechain.ConsensusMini, donationAddr.ToPackedAddress(), submitMainBlockFunc)
+
+	// process Runs all incoming changes, returns whether the template was refreshed
+	process := func() (refreshed bool) {
+		for {
+			select {
+			case f := <-stratumServer.incomingChanges:
+				if f() {
+					refreshed = true
+				}
+			default:
+				return refreshed
+			}
+		}
+	}
+	expectTransactions := func(expected ...types.Hash) {
+		t.Helper()
+		txs := slices.Clone(stratumServer.newTemplateData.Weights[0].Transactions)
+		slices.SortFunc(txs, types.Hash.Compare)
+		if !slices.Equal(txs, expected) {
+			t.Fatalf("template transactions %s, expected %s", txs, expected)
+		}
+	}
+
+	stratumServer.HandleMinerData(minerData)
+	if !process() {
+		t.Fatal("template not refreshed on miner data")
+	}
+	expectTransactions(tx1.Id, tx2.Id)
+
+	stratumServer.HandleMempoolDiff(&mempool.Diff{Removed: []types.Hash{tx1.Id}, Reason: mempool.RemoveReasonMined, Height: minerData.Height})
+	if !process() {
+		t.Fatal("template not refreshed on mined removal")
+	}
+	expectTransactions(tx2.Id)
+
+	stratumServer.HandleMempoolDiff(&mempool.Diff{Removed: []types.Hash{tx2.Id}, Reason: mempool.RemoveReasonEvicted})
+	if !process() {
+		t.Fatal("template not refreshed on evicted removal")
+	}
+	expectTransactions()
+
+	// removals of unknown transactions and low fee additions right after a refresh do not refresh
+	stratumServer.HandleMempoolDiff(&mempool.Diff{Removed: []types.Hash{tx1.Id}, Reason: mempool.RemoveReasonExpired})
+	stratumServer.HandleMempoolDiff(&mempool.Diff{Added: mempool.Mempool{{Id: types.Hash{3}, BlobSize: 1500, Weight: 1500, Fee: 30000000}}})
+	if process() {
+		t.Fatal("template refreshed without changes")
+	}
+}
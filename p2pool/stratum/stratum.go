@@ -2,6 +2,7 @@ package stratum
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"encoding/json" //nolint:depguard
 	"errors"
@@ -78,6 +79,9 @@ type Server struct {
 	SubmitFunc     func(block *sidechain.PoolBlock) error
 	SubmitMainFunc func(b *block.PoolMainBlock) error
 
+	// SubmitLog Optional audit log of all submits, set before listening
+	SubmitLog *SubmitLog
+
 	refreshDuration time.Duration
 
 	minerData       *p2pooltypes.MinerData
@@ -85,6 +89,12 @@ type Server struct {
 	newTemplateData NewTemplateData
 	lock            sync.RWMutex
 	sidechain       *sidechain.SideChain
+	consensus       *sidechain.Consensus
+	derivationCache *sidechain.DerivationCache
+	ctx             context.Context
+
+	// solo Set when mining directly against monerod, sidechain is nil then
+	solo *soloMode
 
 	mempool            MiningMempool
 	lastMempoolRefresh time.Time
@@ -99,8 +109,13 @@ type Server struct {
 	bansLock sync.RWMutex
 	bans     map[[16]byte]BanEntry
 
-	clientsLock sync.RWMutex
-	clients     []*Client
+	clientsLock     sync.RWMutex
+	clients         []*Client
+	clientIdCounter atomic.Uint64
+
+	niceHash niceHashAllocator
+
+	backgroundOnce sync.Once
 
 	incomingChanges chan func() bool
 }
@@ -110,10 +125,14 @@ func NewServer(s *sidechain.SideChain, submitFunc func(block *sidechain.PoolBloc
 		SubmitFunc:                        submitFunc,
 		SubmitMainFunc:                    submitMain,
 		sidechain:                         s,
+		consensus:                         s.Consensus(),
+		derivationCache:                   s.DerivationCache(),
+		ctx:                               s.Server().Context(),
 		preAllocatedDifficultyData:        make([]sidechain.DifficultyData, s.Consensus().ChainWindowSize*2),
 		preAllocatedDifficultyDifferences: make([]uint32, s.Consensus().ChainWindowSize*2),
 		preAllocatedSharesPool:            sidechain.NewPreAllocatedSharesPool(s.Consensus().ChainWindowSize * 2),
 		miners:                            make(map[uint64]*MinerTrackingEntry),
+		bans:                              make(map[[16]byte]BanEntry),
 		mempool:                           (MiningMempool)(make(map[types.Hash]*mempool.Entry, 512)),
 		// buffer 8 at a time for non-blocking source
 		incomingChanges: make(chan func() bool, 8),
@@ -133,20 +152,31 @@ func (s *Server) CleanupMiners() {
 		if cleanupTime.Sub(e.LastJob) > time.Minute*5 {
 			delete(s.miners, k)
 		} else if len(e.Templates) > 0 {
-			var templateSideHeight uint64
-			for _, tpl := range e.Templates {
-				if tpl.SideHeight > templateSideHeight {
-					templateSideHeight = tpl.SideHeight
+			// templateHeight Height templates are ordered by, main height in solo mode as there is no sidechain
+			templateHeight := func(tpl *Template) uint64 {
+				if s.solo != nil {
+					return tpl.MainHeight
 				}
+				return tpl.SideHeight
 			}
 
-			tipHeight := uint64(0)
-			if templateSideHeight > sidechain.UncleBlockDepth {
-				tipHeight = templateSideHeight - sidechain.UncleBlockDepth + 1
+			var maxHeight uint64
+			for _, tpl := range e.Templates {
+				maxHeight = max(maxHeight, templateHeight(tpl))
+			}
+
+			// Solo templates from older main heights cannot become blocks, side templates are kept up to uncle depth
+			minHeight := maxHeight
+			if s.solo == nil {
+				minHeight = 0
+				if maxHeight > sidechain.UncleBlockDepth {
+					minHeight = maxHeight - sidechain.UncleBlockDepth + 1
+				}
 			}
-			//Delete old templates further than uncle depth
+
+			//Delete old templates
 			for key, tpl := range e.Templates {
-				if tpl.SideHeight < tipHeight {
+				if templateHeight(tpl) < minHeight {
 					delete(e.Templates, key)
 				}
 			}
@@ -173,7 +203,7 @@ func (s *Server) fillNewTemplateData(currentDifficulty types.Difficulty) error {
 
 	s.newTemplateData.Timestamp = uint64(time.Now().Unix())
 
-	s.newTemplateData.ShareVersion = sidechain.P2PoolShareVersion(s.sidechain.Consensus(), s.newTemplateData.Timestamp)
+	s.newTemplateData.ShareVersion = sidechain.P2PoolShareVersion(s.consensus, s.newTemplateData.Timestamp)
 
 	// Do not allow mining on old chains, as they are not optimal for CPU usage
 	if s.newTemplateData.ShareVersion < sidechain.ShareVersion_V2 {
@@ -188,8 +218,17 @@ func (s *Server) fillNewTemplateData(currentDifficulty types.Difficulty) error {
 		return utils.ErrorfNoEscape("unsupported major version %d for sidechain version %d", s.minerData.MajorVersion, uint8(s.newTemplateData.ShareVersion))
 	}
 
-	if s.tip != nil {
-		s.newTemplateData.PreviousTemplateId = s.tip.SideTemplateId(s.sidechain.Consensus())
+	if s.solo != nil {
+		// no sidechain, a share is a main block
+		s.newTemplateData.PreviousTemplateId = types.ZeroHash
+		s.newTemplateData.SideHeight = 0
+		s.newTemplateData.TransactionPrivateKeySeed = s.solo.seed
+		s.newTemplateData.Uncles = s.newTemplateData.Uncles[:0]
+		s.newTemplateData.Difficulty = s.minerData.Difficulty
+		s.newTemplateData.Weight = s.newTemplateData.Difficulty
+		s.newTemplateData.CumulativeDifficulty = s.newTemplateData.Difficulty
+	} else if s.tip != nil {
+		s.newTemplateData.PreviousTemplateId = s.tip.SideTemplateId(s.consensus)
 		s.newTemplateData.SideHeight = s.tip.Side.Height + 1
 
 		oldSeed := s.newTemplateData.TransactionPrivateKeySeed
@@ -217,8 +256,8 @@ func (s *Server) fillNewTemplateData(currentDifficulty types.Difficulty) error {
 		s.newTemplateData.CumulativeDifficulty = s.tip.Side.CumulativeDifficulty.Add(s.newTemplateData.Difficulty)
 
 		for _, u := range s.sidechain.GetPossibleUncles(s.tip, s.newTemplateData.SideHeight) {
-			s.newTemplateData.Uncles = append(s.newTemplateData.Uncles, u.SideTemplateId(s.sidechain.Consensus()))
-			_, unclePenalty := s.sidechain.Consensus().ApplyUnclePenalty(u.Side.Difficulty)
+			s.newTemplateData.Uncles = append(s.newTemplateData.Uncles, u.SideTemplateId(s.consensus))
+			_, unclePenalty := s.consensus.ApplyUnclePenalty(u.Side.Difficulty)
 			s.newTemplateData.Weight = s.newTemplateData.Weight.Add(unclePenalty)
 			s.newTemplateData.CumulativeDifficulty = s.newTemplateData.CumulativeDifficulty.Add(u.Side.Difficulty)
 
@@ -229,13 +268,13 @@ func (s *Server) fillNewTemplateData(currentDifficulty types.Difficulty) error {
 		}
 	} else {
 		s.newTemplateData.PreviousTemplateId = types.ZeroHash
-		s.newTemplateData.TransactionPrivateKeySeed = s.sidechain.Consensus().Id
-		s.newTemplateData.Difficulty = types.DifficultyFrom64(s.sidechain.Consensus().MinimumDifficulty)
+		s.newTemplateData.TransactionPrivateKeySeed = s.consensus.Id
+		s.newTemplateData.Difficulty = types.DifficultyFrom64(s.consensus.MinimumDifficulty)
 		s.newTemplateData.Weight = s.newTemplateData.Difficulty
 		s.newTemplateData.CumulativeDifficulty = s.newTemplateData.Difficulty
 	}
 
-	kP := s.sidechain.DerivationCache().GetDeterministicTransactionKey(s.newTemplateData.TransactionPrivateKeySeed, s.minerData.PrevId)
+	kP := s.derivationCache.GetDeterministicTransactionKey(s.newTemplateData.TransactionPrivateKeySeed, s.minerData.PrevId)
 	s.newTemplateData.TransactionPrivateKey = curve25519.PrivateKeyBytes(kP.PrivateKey.Bytes())
 	s.newTemplateData.TransactionPublicKey = kP.PublicKey.AsBytes()
 
@@ -275,9 +314,21 @@ func (s *Server) fillNewTemplateData(currentDifficulty types.Difficulty) error {
 		CachedShareVersion: s.newTemplateData.ShareVersion,
 	}
 
-	shares, _, err := sidechain.GetSharesOrdered(fakeTemplateTipBlock, s.sidechain.Consensus(), s.sidechain.Server().GetDifficultyByHeight, s.sidechain.GetPoolBlockByTemplateId, s.newTemplateData.Window.Shares)
-	if err != nil {
-		return utils.ErrorfNoEscape("could not get outputs: %w", err)
+	var shares sidechain.Shares
+	var err error
+	if s.solo != nil {
+		// single reserved share, replaced by the solo address
+		shares = sidechain.Shares{
+			&sidechain.Share{
+				Address: fakeTemplateTipBlock.GetConsensusPackedAddress(fakeTemplateTipBlock.Main.MajorVersion),
+				Weight:  s.newTemplateData.Weight,
+			},
+		}
+	} else {
+		shares, _, err = sidechain.GetSharesOrdered(fakeTemplateTipBlock, s.consensus, s.sidechain.Server().GetDifficultyByHeight, s.sidechain.GetPoolBlockByTemplateId, s.newTemplateData.Window.Shares)
+		if err != nil {
+			return utils.ErrorfNoEscape("could not get outputs: %w", err)
+		}
 	}
 
 	// todo: add merge mining entries, merkle proof
@@ -314,7 +365,7 @@ func (s *Server) fillNewTemplateData(currentDifficulty types.Difficulty) error {
 	fewShares = slices.Delete(fewShares, s.newTemplateData.Window.ReservedShareIndex, s.newTemplateData.Window.ReservedShareIndex+1)
 
 	//TODO efficient, move elsewhere
-	nonce, ok := merge_mining.FindAuxiliaryNonce([]types.Hash{s.sidechain.Consensus().Id}, math.MaxUint32)
+	nonce, ok := merge_mining.FindAuxiliaryNonce([]types.Hash{s.consensus.Id}, math.MaxUint32)
 	if !ok {
 		return errors.New("could not find nonce")
 	}
@@ -496,7 +547,7 @@ func (s *Server) fillNewTemplateData(currentDifficulty types.Difficulty) error {
 				s.newTemplateData.Window.EphemeralPubKeyCache[tempPubKey] = e
 			} else {
 				var e ephemeralPubKeyCacheEntry
-				e.PublicKey, e.ViewTag = s.sidechain.DerivationCache().GetEphemeralPublicKey(addr, txPrivateKey, txPrivateKeyScalar, uint64(index))
+				e.PublicKey, e.ViewTag = s.derivationCache.GetEphemeralPublicKey(addr, txPrivateKey, txPrivateKeyScalar, uint64(index))
 				s.newTemplateData.Window.EphemeralPubKeyCache[tempPubKey] = &e
 			}
 		}
@@ -660,7 +711,7 @@ func (s *Server) BuildTemplate(minerId uint64, addrFunc func(majorVersion uint8)
 
 			// TODO efficient, move elsewhere
 			// This is deterministic. save this value
-			nonce, ok := merge_mining.FindAuxiliaryNonce([]types.Hash{s.sidechain.Consensus().Id}, math.MaxUint32)
+			nonce, ok := merge_mining.FindAuxiliaryNonce([]types.Hash{s.consensus.Id}, math.MaxUint32)
 			if !ok {
 				return nil, 0, types.ZeroDifficulty, types.ZeroHash, errors.New("could not find nonce")
 			}
@@ -679,7 +730,7 @@ func (s *Server) BuildTemplate(minerId uint64, addrFunc func(majorVersion uint8)
 
 		}
 
-		tpl, err = TemplateFromPoolBlock(s.sidechain.Consensus(), blockTemplate)
+		tpl, err = TemplateFromPoolBlock(s.consensus, blockTemplate)
 		if err != nil {
 			return nil, 0, types.ZeroDifficulty, types.ZeroHash, err
 		}
@@ -876,12 +927,12 @@ func (s *Server) createCoinbaseTransaction(shareVersion sidechain.ShareVersion,
 			oneTimeAddresses := make([]curve25519.VarTimePublicKey, len(shares))
 			oneTimeAddressesBytes := make([]curve25519.PublicKeyBytes, len(shares))
 			for i := range shares {
-				sidechain.CalculateEnoteCarrotOneTimeAddress(s.sidechain.DerivationCache(), &shares[i].Address, s.newTemplateData.TransactionPrivateKeySeed, s.minerData.Height, rewards[i], &oneTimeAddresses[i])
+				sidechain.CalculateEnoteCarrotOneTimeAddress(s.derivationCache, &shares[i].Address, s.newTemplateData.TransactionPrivateKeySeed, s.minerData.Height, rewards[i], &oneTimeAddresses[i])
 			}
 			// batch invert bytes
 			curve25519.BatchBytes(utils.ValuesToPointers(oneTimeAddresses), oneTimeAddressesBytes)
 			for i := range shares {
-				carrotEnotes[i] = sidechain.CalculateEnoteCarrotFinalize(s.sidechain.DerivationCache(), &shares[i].Address, s.newTemplateData.TransactionPrivateKeySeed, s.minerData.Height, rewards[i], oneTimeAddressesBytes[i])
+				carrotEnotes[i] = sidechain.CalculateEnoteCarrotFinalize(s.derivationCache, &shares[i].Address, s.newTemplateData.TransactionPrivateKeySeed, s.minerData.Height, rewards[i], oneTimeAddressesBytes[i])
 				if carrotEnotes[i] == nil {
 					return transaction.P2PoolCoinbaseV2{}, utils.ErrorfNoEscape("invalid carrot enote at index %d", i)
 				}
@@ -919,7 +970,7 @@ func (s *Server) createCoinbaseTransaction(shareVersion sidechain.ShareVersion,
 				if e, ok := s.newTemplateData.Window.EphemeralPubKeyCache[k]; ok {
 					tx.MinerOutputs[outputIndex].EphemeralPublicKey, tx.MinerOutputs[outputIndex].ViewTag.Slice()[0] = e.PublicKey, e.ViewTag
 				} else {
-					tx.MinerOutputs[outputIndex].EphemeralPublicKey, tx.MinerOutputs[outputIndex].ViewTag.Slice()[0] = s.sidechain.DerivationCache().GetEphemeralPublicKey(addr.PackedAddress(), txPrivateKey, txPrivateKeyScalar, outputIndex)
+					tx.MinerOutputs[outputIndex].EphemeralPublicKey, tx.MinerOutputs[outputIndex].ViewTag.Slice()[0] = s.derivationCache.GetEphemeralPublicKey(addr.PackedAddress(), txPrivateKey, txPrivateKeyScalar, outputIndex)
 				}
 			}
 		}
@@ -957,6 +1008,25 @@ func (s *Server) createCoinbaseTransaction(shareVersion sidechain.ShareVersion,
 	return tx, nil
 }
 
+// addMempool Adds new transactions, returns whether any of them had a high fee
+// Expects lock to be already locked here
+func (s *Server) addMempool(data mempool.Mempool) (added int, highFeeReceived bool) {
+	for _, tx := range data {
+		if s.mempool.Add(tx) {
+			added++
+			//prevent a lot of calls if not needed
+			if utils.GlobalLogLevel&utils.LogLevelDebug > 0 {
+				utils.Debugf("Stratum", "new tx id = %s, size = %d, weight = %d, fee = %s XMR", tx.Id, tx.BlobSize, tx.Weight, utils.XMRUnits(tx.Fee))
+			}
+			if tx.Fee >= HighFeeValue {
+				highFeeReceived = true
+				utils.Noticef("Stratum", "high fee tx received: %s, %s XMR - updating template", tx.Id, utils.XMRUnits(tx.Fee))
+			}
+		}
+	}
+	return added, highFeeReceived
+}
+
 func (s *Server) HandleMempoolData(data mempool.Mempool) {
 	s.incomingChanges <- func() bool {
 		timeReceived := time.Now()
@@ -964,23 +1034,44 @@ func (s *Server) HandleMempoolData(data mempool.Mempool) {
 		s.lock.Lock()
 		defer s.lock.Unlock()
 
-		var highFeeReceived bool
-		for _, tx := range data {
+		_, highFeeReceived := s.addMempool(data)
 
-			if s.mempool.Add(tx) {
-				//prevent a lot of calls if not needed
-				if utils.GlobalLogLevel&utils.LogLevelDebug > 0 {
-					utils.Debugf("Stratum", "new tx id = %s, size = %d, weight = %d, fee = %s XMR", tx.Id, tx.BlobSize, tx.Weight, utils.XMRUnits(tx.Fee))
-				}
-				if tx.Fee >= HighFeeValue {
-					highFeeReceived = true
-					utils.Noticef("Stratum", "high fee tx received: %s, %s XMR - updating template", tx.Id, utils.XMRUnits(tx.Fee))
-				}
+		// Refresh if 10 seconds have passed between templates and new transactions arrived, or a high fee was received
+		if highFeeReceived || timeReceived.Sub(s.lastMempoolRefresh) >= s.refreshDuration {
+			s.lastMempoolRefresh = timeReceived
+			if err := s.fillNewTemplateData(types.ZeroDifficulty); err != nil {
+				utils.Errorf("Stratum", "Error building new template data: %s", err)
+				return false
 			}
+			return true
+		}
+		return false
+	}
+}
+
+// HandleMempoolDiff Applies changes from a mempool tracker
+// Additions are handled as in HandleMempoolData, any removal refreshes the template so it stops including mined, evicted or expired transactions.
+func (s *Server) HandleMempoolDiff(diff *mempool.Diff) {
+	if diff.Empty() {
+		return
+	}
+	s.incomingChanges <- func() bool {
+		timeReceived := time.Now()
+
+		s.lock.Lock()
+		defer s.lock.Unlock()
+
+		added, highFeeReceived := s.addMempool(diff.Added)
+		removed := s.mempool.Remove(diff.Removed...)
+		if added == 0 && removed == 0 {
+			return false
 		}
 
-		// Refresh if 10 seconds have passed between templates and new transactions arrived, or a high fee was received
-		if highFeeReceived || timeReceived.Sub(s.lastMempoolRefresh) >= s.refreshDuration {
+		if removed > 0 {
+			utils.Debugf("Stratum", "removed %d %s transactions from mempool", removed, diff.Reason)
+		}
+
+		if removed > 0 || highFeeReceived || timeReceived.Sub(s.lastMempoolRefresh) >= s.refreshDuration {
 			s.lastMempoolRefresh = timeReceived
 			if err := s.fillNewTemplateData(types.ZeroDifficulty); err != nil {
 				utils.Errorf("Stratum", "Error building new template data: %s", err)
@@ -1177,7 +1268,7 @@ func (s *Server) processIncoming() {
 	go func() {
 		defer close(s.incomingChanges)
 
-		ctx := s.sidechain.Server().Context()
+		ctx := s.ctx
 		for {
 			select {
 			case <-ctx.Done():
@@ -1191,22 +1282,26 @@ func (s *Server) processIncoming() {
 	}()
 }
 
-func (s *Server) Listen(listen string, controlOpts ...func(network, address string, c syscall.RawConn) (err error)) error {
-
-	ctx := s.sidechain.Server().Context()
-	go func() {
-		for range utils.ContextTick(ctx, time.Second*15) {
-			s.CleanupMiners()
-		}
-	}()
-	go func() {
-		for range utils.ContextTick(ctx, time.Hour) {
-			s.CleanupBanList()
-		}
-	}()
+// startBackground Starts cleanup tasks and processing of incoming changes, once per server
+func (s *Server) startBackground() {
+	s.backgroundOnce.Do(func() {
+		ctx := s.ctx
+		go func() {
+			for range utils.ContextTick(ctx, time.Second*15) {
+				s.CleanupMiners()
+			}
+		}()
+		go func() {
+			for range utils.ContextTick(ctx, time.Hour) {
+				s.CleanupBanList()
+			}
+		}()
 
-	s.processIncoming()
+		s.processIncoming()
+	})
+}
 
+func (s *Server) listenTCP(listen string, controlOpts ...func(network, address string, c syscall.RawConn) (err error)) (*net.TCPListener, error) {
 	if listener, err := (&net.ListenConfig{
 		Control: func(network, address string, c syscall.RawConn) error {
 			for _, opt := range controlOpts {
@@ -1216,36 +1311,180 @@ func (s *Server) Listen(listen string, controlOpts ...func(network, address stri
 			}
 			return nil
 		},
-	}).Listen(ctx, "tcp", listen); err != nil {
-		return err
+	}).Listen(s.ctx, "tcp", listen); err != nil {
+		return nil, err
 	} else if tcpListener, ok := listener.(*net.TCPListener); !ok {
-		return errors.New("not a tcp listener")
+		_ = listener.Close()
+		return nil, errors.New("not a tcp listener")
 	} else {
-		defer tcpListener.Close()
+		return tcpListener, nil
+	}
+}
+
+// checkIncoming Checks incoming connection against the ban list
+func (s *Server) checkIncoming(conn net.Conn) (netip.AddrPort, error) {
+	addrPort, err := netip.ParseAddrPort(conn.RemoteAddr().String())
+	if err != nil {
+		return addrPort, err
+	} else if !addrPort.Addr().IsLoopback() {
+		addr := addrPort.Addr().Unmap()
+
+		if ok, b := s.IsBanned(addr); ok {
+			return addrPort, utils.ErrorfNoEscape("peer is banned: %w", b.Error)
+		}
+	}
+
+	return addrPort, nil
+}
+
+// login Parses login parameters into the client, and sets it as logged in. Client must be locked
+func (s *Server) login(client *Client, m map[string]any) error {
+	addressNetwork := s.consensus.NetworkType.MustAddressNetwork()
+
+	if str, ok := m["agent"].(string); ok {
+		if len(str) > 512 {
+			return errors.New("agent too long")
+		}
+		client.Agent = str
+	}
+	if str, ok := m["pass"].(string); ok {
+		if len(str) > 512 {
+			return errors.New("pass too long")
+		}
+		client.Password = str
+	}
+
+	if str, ok := m["rigid"].(string); ok {
+		if len(str) > 512 {
+			return errors.New("rigid too long")
+		}
+		client.RigId = str
+	} else if str, ok := m["rig-id"].(string); ok {
+		if len(str) > 512 {
+			return errors.New("rig-id too long")
+		}
+		client.RigId = str
+	}
+
+	if str, ok := m["login"].(string); ok && str != "" {
+		//TODO: support merge mining addresses
+		a := address.FromBase58(str)
+		if a == nil {
+			// do nothing
+		} else if !a.ValidAndTorsionFree() {
+			return errors.New("invalid address in user, or integrated addresses not supported")
+		} else if a.BaseNetwork() != addressNetwork {
+			return errors.New("invalid address in user, wrong network")
+		} else if a.IsSubaddress() {
+			if h, err := types.HashFromString(client.Password); err == nil {
+				viewKey := curve25519.PrivateKeyBytes(h)
+				fa := cryptonote.GetSubaddressFakeAddress(a, viewKey.Scalar())
+				if fa == nil {
+					return errors.New("invalid address in user, invalid subaddress conversion")
+				}
+				client.Address = fa.ToPackedAddress()
+				pa := a.ToPackedAddress()
+				client.Subaddress = &pa
+
+				// cleanup
+				client.Password = ""
+			} else {
+				return errors.New("invalid address in user, subaddress specified but no valid viewkey on pass field")
+			}
+		} else {
+			if sa := address.FromBase58(client.Password); sa != nil && sa.BaseNetwork() == a.BaseNetwork() && sa.IsSubaddress() {
+				if !sa.ValidAndTorsionFree() {
+					return errors.New("invalid subaddress in pass")
+				}
+
+				pa := sa.ToPackedAddress()
+				client.Subaddress = &pa
+				client.Address = address.NewPackedAddressFromBytes(*sa.SpendPublicKey(), *a.ViewPublicKey())
+
+				// cleanup
+				client.Password = ""
+			} else {
+				client.Address = a.ToPackedAddress()
+			}
+		}
+	}
+	// algo extension
+	if algos, ok := m["algo"].([]any); ok {
+		client.Extensions.Algo = true
+		for _, v := range algos {
+			if str, ok := v.(string); !ok {
+				return errors.New("invalid algo")
+			} else if str == AlgoRandomX_V0 {
+				client.Extensions.RandomX_V0 = true
+			} else if str == AlgoRandomX_V2 {
+				client.Extensions.RandomX_V2 = true
+			} else if str == AlgoCryptoNight_V0 {
+				client.Extensions.CryptoNight_V0 = true
+			} else if str == AlgoCryptoNight_V1 {
+				client.Extensions.CryptoNight_V1 = true
+			} else if str == AlgoCryptoNight_V2 {
+				client.Extensions.CryptoNight_V2 = true
+			} else if str == AlgoCryptoNight_R {
+				client.Extensions.CryptoNight_R = true
+			}
+		}
+	} else {
+		// default rx0 true
+		client.Extensions.RandomX_V0 = true
+	}
+
+	if !client.Extensions.RandomX_V0 {
+		return errors.New("algo rx/0 not found")
+	}
+
+	// nicehash extension
+	if v, ok := m["nicehash"].(bool); ok && v {
+		client.Extensions.NiceHash = true
+	}
+	if extensions, ok := m["extensions"].([]any); ok {
+		for _, v := range extensions {
+			if str, ok := v.(string); !ok {
+				return errors.New("invalid extension")
+			} else if str == ExtensionNiceHash {
+				client.Extensions.NiceHash = true
+			} else if str == ExtensionTemplate {
+				client.Extensions.Template = true
+			}
+		}
+	}
+
+	if client.Extensions.NiceHash && !s.niceHash.Allocate(client) {
+		// all nonce prefixes are in use, the client mines the full nonce range instead
+		utils.Noticef("Stratum", "Connection %s: no nicehash nonce prefix available, extension refused", client.Conn.RemoteAddr().String())
+		client.Extensions.NiceHash = false
+	}
+
+	if s.solo != nil {
+		// whole reward goes to the solo address, login is only informational
+		client.Address = s.solo.address
+		client.Subaddress = nil
+	}
 
-		addressNetwork := s.sidechain.Consensus().NetworkType.MustAddressNetwork()
+	utils.Debugf("Stratum", "Connection %s address = %s, agent = \"%s\", pass = \"%s\"", client.Conn.RemoteAddr().String(), client.Address.ToAddress(addressNetwork).ToBase58(), client.Agent, client.Password)
 
-		var idCounter atomic.Uint64
+	client.Login = true
+	return nil
+}
+
+func (s *Server) Listen(listen string, controlOpts ...func(network, address string, c syscall.RawConn) (err error)) error {
+	s.startBackground()
+
+	if tcpListener, err := s.listenTCP(listen, controlOpts...); err != nil {
+		return err
+	} else {
+		defer tcpListener.Close()
 
 		for {
 			if conn, err := tcpListener.Accept(); err != nil {
 				return err
 			} else {
 				var addrPort netip.AddrPort
-				if addrPort, err = func() (netip.AddrPort, error) {
-					addrPort, err := netip.ParseAddrPort(conn.RemoteAddr().String())
-					if err != nil {
-						return addrPort, err
-					} else if !addrPort.Addr().IsLoopback() {
-						addr := addrPort.Addr().Unmap()
-
-						if ok, b := s.IsBanned(addr); ok {
-							return addrPort, utils.ErrorfNoEscape("peer is banned: %w", b.Error)
-						}
-					}
-
-					return addrPort, nil
-				}(); err != nil {
+				if addrPort, err = s.checkIncoming(conn); err != nil {
 					go func() {
 						defer conn.Close()
 						utils.Noticef("Stratum", "Connection from %s rejected (%s)", conn.RemoteAddr().String(), err.Error())
@@ -1253,400 +1492,373 @@ func (s *Server) Listen(listen string, controlOpts ...func(network, address stri
 					continue
 				}
 
-				func() {
-					utils.Noticef("Stratum", "Incoming connection from %s", conn.RemoteAddr().String())
+				go s.handleConn(conn, addrPort)
+			}
 
-					var rpcId uint32
-					for rpcId == 0 {
-						// #nosec G404
-						rpcId = unsafeRandom.Uint32()
-					}
-					decoder := utils.NewJSONDecoder(conn)
-					decoder.UseNumber()
-					client := &Client{
-						RpcId:      rpcId,
-						Conn:       conn,
-						decoder:    decoder,
-						InternalId: idCounter.Add(1),
-
-						// Default to donation address if not specified
-						Address: address.FromBase58(types.DonationAddress).ToPackedAddress(),
+		}
+	}
+}
+
+// handleConn Serves a JSON-RPC client connection until it is closed
+func (s *Server) handleConn(conn net.Conn, addrPort netip.AddrPort) {
+	utils.Noticef("Stratum", "Incoming connection from %s", conn.RemoteAddr().String())
+
+	var rpcId uint32
+	for rpcId == 0 {
+		// #nosec G404
+		rpcId = unsafeRandom.Uint32()
+	}
+	decoder := utils.NewJSONDecoder(conn)
+	decoder.UseNumber()
+	client := &Client{
+		RpcId:      rpcId,
+		Conn:       conn,
+		decoder:    decoder,
+		InternalId: s.clientIdCounter.Add(1),
+
+		// Default to donation address if not specified
+		Address: address.FromBase58(types.DonationAddress).ToPackedAddress(),
+	}
+	// Use deadline
+	client.encoder = utils.NewJSONEncoder(client)
+
+	s.addClient(client)
+
+	var err error
+	defer s.CloseClient(client)
+	defer func() {
+		if err != nil {
+			utils.Noticef("Stratum", "Connection %s closed with error: %s", client.Conn.RemoteAddr().String(), err)
+			if errors.Is(err, ErrBannable) {
+				s.Ban(addrPort.Addr(), time.Minute*15, err)
+			}
+		} else {
+			utils.Noticef("Stratum", "Connection %s closed", client.Conn.RemoteAddr().String())
+		}
+	}()
+	defer func() {
+		if e := recover(); e != nil {
+			if errT, ok := e.(error); !ok || errT == nil {
+				err = utils.ErrorfNoEscape("panic called: %v", e)
+			}
+			s.CloseClient(client)
+		}
+	}()
+
+	for client.decoder.More() {
+		var msg JsonRpcMessage
+		if err = client.decoder.Decode(&msg); err != nil {
+			return
+		}
+
+		if idStr, ok := msg.Id.(string); ok {
+			if len(idStr) == 0 || len(idStr) > 64 {
+				err = errors.New("invalid string id")
+				return
+			}
+		} else if _, ok := msg.Id.(json.Number); !ok {
+			err = errors.New("invalid id format")
+			return
+		}
+
+		switch msg.Method {
+		case "login":
+			if err = func() error {
+				client.Lock.Lock()
+				defer client.Lock.Unlock()
+				if client.Login {
+					return errors.New("already logged in")
+				}
+				if m, ok := msg.Params.(map[string]any); ok {
+					return s.login(client, m)
+				} else {
+					return errors.New("could not read login params")
+				}
+			}(); err != nil {
+				//nolint:errchkjson
+				_ = client.encoder.Encode(JsonRpcResult{
+					Id:             msg.Id,
+					JsonRpcVersion: "2.0",
+					Error: map[string]any{
+						"code":    int(-1),
+						"message": err.Error(),
+					},
+				})
+				return
+			} else if err = s.SendTemplateResponse(client, msg.Id, false); err != nil {
+				//nolint:errchkjson
+				_ = client.encoder.Encode(JsonRpcResult{
+					Id:             msg.Id,
+					JsonRpcVersion: "2.0",
+					Error: map[string]any{
+						"code":    int(-1),
+						"message": err.Error(),
+					},
+				})
+			}
+		/*
+			// send new job directly
+			// TODO: is this even necessary?
+			case "getjob":
+				if submitError, ban := func() (error, bool) {
+					client.Lock.RLock()
+					defer client.Lock.RUnlock()
+					if !client.Login {
+						return errors.New("unauthenticated"), true
 					}
-					// Use deadline
-					client.encoder = utils.NewJSONEncoder(client)
 
-					func() {
-						s.clientsLock.Lock()
-						defer s.clientsLock.Unlock()
-						s.clients = append(s.clients, client)
-					}()
-					go func() {
-						var err error
-						defer s.CloseClient(client)
-						defer func() {
-							if err != nil {
-								utils.Noticef("Stratum", "Connection %s closed with error: %s", client.Conn.RemoteAddr().String(), err)
-								if errors.Is(err, ErrBannable) {
-									s.Ban(addrPort.Addr(), time.Minute*15, err)
-								}
-							} else {
-								utils.Noticef("Stratum", "Connection %s closed", client.Conn.RemoteAddr().String())
-							}
-						}()
-						defer func() {
-							if e := recover(); e != nil {
-								if errT, ok := e.(error); !ok || errT == nil {
-									err = utils.ErrorfNoEscape("panic called: %v", e)
-								}
-								s.CloseClient(client)
-							}
-						}()
-
-						for client.decoder.More() {
-							var msg JsonRpcMessage
-							if err = client.decoder.Decode(&msg); err != nil {
-								return
-							}
-
-							if idStr, ok := msg.Id.(string); ok {
-								if len(idStr) == 0 || len(idStr) > 64 {
-									err = errors.New("invalid string id")
-									return
-								}
-							} else if _, ok := msg.Id.(json.Number); !ok {
-								err = errors.New("invalid id format")
-								return
-							}
-
-							switch msg.Method {
-							case "login":
-								if err = func() error {
-									client.Lock.Lock()
-									defer client.Lock.Unlock()
-									if client.Login {
-										return errors.New("already logged in")
-									}
-									if m, ok := msg.Params.(map[string]any); ok {
-										if str, ok := m["agent"].(string); ok {
-											if len(str) > 512 {
-												return errors.New("agent too long")
-											}
-											client.Agent = str
-										}
-										if str, ok := m["pass"].(string); ok {
-											if len(str) > 512 {
-												return errors.New("pass too long")
-											}
-											client.Password = str
-										}
-
-										if str, ok := m["rigid"].(string); ok {
-											if len(str) > 512 {
-												return errors.New("rigid too long")
-											}
-											client.RigId = str
-										} else if str, ok := m["rig-id"].(string); ok {
-											if len(str) > 512 {
-												return errors.New("rig-id too long")
-											}
-											client.RigId = str
-										}
-
-										if str, ok := m["login"].(string); ok && str != "" {
-											//TODO: support merge mining addresses
-											a := address.FromBase58(str)
-											if a == nil {
-												// do nothing
-											} else if !a.ValidAndTorsionFree() {
-												return errors.New("invalid address in user, or integrated addresses not supported")
-											} else if a.BaseNetwork() != addressNetwork {
-												return errors.New("invalid address in user, wrong network")
-											} else if a.IsSubaddress() {
-												if h, err := types.HashFromString(client.Password); err == nil {
-													viewKey := curve25519.PrivateKeyBytes(h)
-													fa := cryptonote.GetSubaddressFakeAddress(a, viewKey.Scalar())
-													if fa == nil {
-														return errors.New("invalid address in user, invalid subaddress conversion")
-													}
-													client.Address = fa.ToPackedAddress()
-													pa := a.ToPackedAddress()
-													client.Subaddress = &pa
-
-													// cleanup
-													client.Password = ""
-												} else {
-													return errors.New("invalid address in user, subaddress specified but no valid viewkey on pass field")
-												}
-											} else {
-												if sa := address.FromBase58(client.Password); sa != nil && sa.BaseNetwork() == a.BaseNetwork() && sa.IsSubaddress() {
-													if !sa.ValidAndTorsionFree() {
-														return errors.New("invalid subaddress in pass")
-													}
-
-													pa := sa.ToPackedAddress()
-													client.Subaddress = &pa
-													client.Address = address.NewPackedAddressFromBytes(*sa.SpendPublicKey(), *a.ViewPublicKey())
-
-													// cleanup
-													client.Password = ""
-												} else {
-													client.Address = a.ToPackedAddress()
-												}
-											}
-										}
-										// algo extension
-										if algos, ok := m["algo"].([]any); ok {
-											client.Extensions.Algo = true
-											for _, v := range algos {
-												if str, ok := v.(string); !ok {
-													return errors.New("invalid algo")
-												} else if str == AlgoRandomX_V0 {
-													client.Extensions.RandomX_V0 = true
-												} else if str == AlgoRandomX_V2 {
-													client.Extensions.RandomX_V2 = true
-												} else if str == AlgoCryptoNight_V0 {
-													client.Extensions.CryptoNight_V0 = true
-												} else if str == AlgoCryptoNight_V1 {
-													client.Extensions.CryptoNight_V1 = true
-												} else if str == AlgoCryptoNight_V2 {
-													client.Extensions.CryptoNight_V2 = true
-												} else if str == AlgoCryptoNight_R {
-													client.Extensions.CryptoNight_R = true
-												}
-											}
-										} else {
-											// default rx0 true
-											client.Extensions.RandomX_V0 = true
-										}
-
-										if !client.Extensions.RandomX_V0 {
-											return errors.New("algo rx/0 not found")
-										}
-
-										utils.Debugf("Stratum", "Connection %s address = %s, agent = \"%s\", pass = \"%s\"", client.Conn.RemoteAddr().String(), client.Address.ToAddress(addressNetwork).ToBase58(), client.Agent, client.Password)
-
-										client.Login = true
-										return nil
-									} else {
-										return errors.New("could not read login params")
-									}
-								}(); err != nil {
-									//nolint:errchkjson
-									_ = client.encoder.Encode(JsonRpcResult{
-										Id:             msg.Id,
-										JsonRpcVersion: "2.0",
-										Error: map[string]any{
-											"code":    int(-1),
-											"message": err.Error(),
-										},
-									})
-									return
-								} else if err = s.SendTemplateResponse(client, msg.Id, false); err != nil {
-									//nolint:errchkjson
-									_ = client.encoder.Encode(JsonRpcResult{
-										Id:             msg.Id,
-										JsonRpcVersion: "2.0",
-										Error: map[string]any{
-											"code":    int(-1),
-											"message": err.Error(),
-										},
-									})
-								}
-							/*
-								// send new job directly
-								// TODO: is this even necessary?
-								case "getjob":
-									if submitError, ban := func() (error, bool) {
-										client.Lock.RLock()
-										defer client.Lock.RUnlock()
-										if !client.Login {
-											return errors.New("unauthenticated"), true
-										}
-
-										//TODO: limit cadence
-										return nil, false
-									}(); submitError != nil {
-										err = client.encoder.Encode(JsonRpcResult{
-											Id:             msg.Id,
-											JsonRpcVersion: "2.0",
-											Error: map[string]any{
-												"code":    int(-1),
-												"message": submitError.Error(),
-											},
-										})
-										if err != nil || ban {
-											return
-										}
-									} else if err = s.SendTemplateResponse(client, msg.Id); err != nil {
-										_ = client.encoder.Encode(JsonRpcResult{
-											Id:             msg.Id,
-											JsonRpcVersion: "2.0",
-											Error: map[string]any{
-												"code":    int(-1),
-												"message": err.Error(),
-											},
-										})
-									}
-							*/
-							case "submit":
-								if submitError, ban := func() (error, bool) {
-									if err := func() error {
-										client.Lock.RLock()
-										defer client.Lock.RUnlock()
-										if !client.Login {
-											return errors.New("unauthenticated")
-										}
-										return nil
-									}(); err != nil {
-										return err, true
-									}
-									var err error
-									var resultHash types.Hash
-									var nonce uint32
-									if m, ok := msg.Params.(map[string]any); ok {
-										var jobId *Job
-										if str, ok := m["job_id"].(string); ok {
-											if jobId, err = JobFromString(str); err != nil {
-												return err, true
-											}
-										} else {
-											return errors.New("no job_id specified"), true
-										}
-										if str, ok := m["nonce"].(string); ok {
-											var nonceBuf []byte
-											if nonceBuf, err = fasthex.DecodeString(str); err != nil {
-												return err, true
-											}
-											if len(nonceBuf) != 4 {
-												return errors.New("invalid nonce size"), true
-											}
-											nonce = binary.LittleEndian.Uint32(nonceBuf)
-										} else {
-											return errors.New("no nonce specified"), true
-										}
-										if str, ok := m["result"].(string); ok {
-											if resultHash, err = types.HashFromString(str); err != nil {
-												return err, true
-											}
-										} else {
-											return errors.New("no result specified"), true
-										}
-
-										if err, ban := func() (error, bool) {
-											if e, ok := func() (*MinerTrackingEntry, bool) {
-												s.minersLock.RLock()
-												defer s.minersLock.RUnlock()
-												e, ok := s.miners[client.InternalId]
-												return e, ok
-											}(); ok {
-												b := &sidechain.PoolBlock{}
-												if blob := e.GetJobBlob(client, s.sidechain.Consensus(), jobId, nonce); blob == nil {
-													return errors.New("invalid job id"), true
-												} else if err := b.UnmarshalBinary(s.sidechain.Consensus(), s.sidechain.DerivationCache(), blob); err != nil {
-													return err, true
-												} else {
-													powDiff := types.DifficultyFromPoW(resultHash)
-													if powDiff.Cmp(b.Side.Difficulty) >= 0 {
-														//passes difficulty
-														if err := s.SubmitFunc(b); err != nil {
-															return utils.ErrorfNoEscape("submit error: %w", err), true
-														}
-													} else {
-														// explicitly allow low diff shares that pass main difficulty but not sidechain one, useful for testnet
-														if s.SubmitMainFunc != nil && powDiff.Cmp64(s.sidechain.Consensus().MinimumDifficulty) < 0 {
-															if mainDiff := func() types.Difficulty {
-																s.lock.RLock()
-																defer s.lock.RUnlock()
-																if s.minerData == nil {
-																	return types.ZeroDifficulty
-																}
-																return s.minerData.Difficulty
-															}(); mainDiff != types.ZeroDifficulty && mainDiff.CheckPoW(resultHash) {
-																//passes main difficulty
-																if err := s.SubmitMainFunc(&b.Main); err != nil {
-																	return utils.ErrorfNoEscape("submit main error: %w", err), false
-																}
-																return nil, false
-															}
-														}
-														return errors.New("low difficulty share"), true
-													}
-												}
-											} else {
-												return errors.New("unknown miner"), true
-											}
-											return nil, false
-										}(); err != nil {
-											return err, ban
-										}
-										return nil, false
-									} else {
-										return errors.New("could not read submit params"), true
-									}
-								}(); submitError != nil {
-									err = client.encoder.Encode(JsonRpcResult{
-										Id:             msg.Id,
-										JsonRpcVersion: "2.0",
-										Error: map[string]any{
-											"code":    int(-1),
-											"message": submitError.Error(),
-										},
-									})
-									if err != nil || ban {
-										return
-									}
-								} else {
-									if err = client.encoder.Encode(JsonRpcResult{
-										Id:             msg.Id,
-										JsonRpcVersion: "2.0",
-										Error:          nil,
-										Result: map[string]any{
-											"status": "OK",
-										},
-									}); err != nil {
-										return
-									}
-								}
-							case "keepalived":
-								if err = client.encoder.Encode(JsonRpcResult{
-									Id:             msg.Id,
-									JsonRpcVersion: "2.0",
-									Error:          nil,
-									Result: map[string]any{
-										"status": "KEEPALIVED",
-									},
-								}); err != nil {
-									return
-								}
-							default:
-								err = utils.ErrorfNoEscape("unknown command %s", msg.Method)
-								//nolint:errchkjson
-								_ = client.encoder.Encode(JsonRpcResult{
-									Id:             msg.Id,
-									JsonRpcVersion: "2.0",
-									Error: map[string]any{
-										"code":    int(-1),
-										"message": err.Error(),
-									},
-								})
-								return
-							}
+					//TODO: limit cadence
+					return nil, false
+				}(); submitError != nil {
+					err = client.encoder.Encode(JsonRpcResult{
+						Id:             msg.Id,
+						JsonRpcVersion: "2.0",
+						Error: map[string]any{
+							"code":    int(-1),
+							"message": submitError.Error(),
+						},
+					})
+					if err != nil || ban {
+						return
+					}
+				} else if err = s.SendTemplateResponse(client, msg.Id); err != nil {
+					_ = client.encoder.Encode(JsonRpcResult{
+						Id:             msg.Id,
+						JsonRpcVersion: "2.0",
+						Error: map[string]any{
+							"code":    int(-1),
+							"message": err.Error(),
+						},
+					})
+				}
+		*/
+		case "submit":
+			logEntry := newSubmitLogEntry(client)
+			submitError, ban := func() (error, bool) {
+				if err := func() error {
+					client.Lock.RLock()
+					defer client.Lock.RUnlock()
+					if !client.Login {
+						return errors.New("unauthenticated")
+					}
+					return nil
+				}(); err != nil {
+					return err, true
+				}
+				var err error
+				var resultHash types.Hash
+				var nonce uint32
+				if m, ok := msg.Params.(map[string]any); ok {
+					var jobId *Job
+					if str, ok := m["job_id"].(string); ok {
+						logEntry.JobId = str
+						if jobId, err = JobFromString(str); err != nil {
+							return err, true
 						}
-					}()
-				}()
+					} else {
+						return errors.New("no job_id specified"), true
+					}
+					if str, ok := m["nonce"].(string); ok {
+						var nonceBuf []byte
+						if nonceBuf, err = fasthex.DecodeString(str); err != nil {
+							return err, true
+						}
+						if len(nonceBuf) != 4 {
+							return errors.New("invalid nonce size"), true
+						}
+						nonce = binary.LittleEndian.Uint32(nonceBuf)
+						logEntry.Nonce = nonce
+						if !func() bool {
+							client.Lock.RLock()
+							defer client.Lock.RUnlock()
+							return client.ValidNonce(nonce)
+						}() {
+							return errors.New("nonce outside of reserved range"), true
+						}
+					} else {
+						return errors.New("no nonce specified"), true
+					}
+					if str, ok := m["extra_nonce"].(string); ok {
+						if !func() bool {
+							client.Lock.RLock()
+							defer client.Lock.RUnlock()
+							return client.Extensions.Template
+						}() {
+							return errors.New("extra_nonce specified without template extension"), true
+						}
+						var extraNonceBuf []byte
+						if extraNonceBuf, err = fasthex.DecodeString(str); err != nil {
+							return err, true
+						}
+						if len(extraNonceBuf) != 4 {
+							return errors.New("invalid extra_nonce size"), true
+						}
+						// client rolled the extra nonce on its own
+						jobId.ExtraNonce = binary.LittleEndian.Uint32(extraNonceBuf)
+						logEntry.ExtraNonce = &jobId.ExtraNonce
+					}
+					if str, ok := m["result"].(string); ok {
+						if resultHash, err = types.HashFromString(str); err != nil {
+							return err, true
+						}
+						logEntry.Result = resultHash
+					} else {
+						return errors.New("no result specified"), true
+					}
+
+					if err, ban := s.submitJob(client, jobId, nonce, resultHash, &logEntry); err != nil {
+						return err, ban
+					}
+					return nil, false
+				} else {
+					return errors.New("could not read submit params"), true
+				}
+			}()
+			s.logSubmit(&logEntry, submitError)
+			if submitError != nil {
+				err = client.encoder.Encode(JsonRpcResult{
+					Id:             msg.Id,
+					JsonRpcVersion: "2.0",
+					Error: map[string]any{
+						"code":    int(-1),
+						"message": submitError.Error(),
+					},
+				})
+				if err != nil || ban {
+					return
+				}
+			} else {
+				if err = client.encoder.Encode(JsonRpcResult{
+					Id:             msg.Id,
+					JsonRpcVersion: "2.0",
+					Error:          nil,
+					Result: map[string]any{
+						"status": "OK",
+					},
+				}); err != nil {
+					return
+				}
 			}
+		case "keepalived":
+			if err = client.encoder.Encode(JsonRpcResult{
+				Id:             msg.Id,
+				JsonRpcVersion: "2.0",
+				Error:          nil,
+				Result: map[string]any{
+					"status": "KEEPALIVED",
+				},
+			}); err != nil {
+				return
+			}
+		default:
+			err = utils.ErrorfNoEscape("unknown command %s", msg.Method)
+			//nolint:errchkjson
+			_ = client.encoder.Encode(JsonRpcResult{
+				Id:             msg.Id,
+				JsonRpcVersion: "2.0",
+				Error: map[string]any{
+					"code":    int(-1),
+					"message": err.Error(),
+				},
+			})
+			return
+		}
+	}
+}
 
+// submitJob Rebuilds the block from a job and nonce, and submits it depending on difficulty
+// Returns whether the error should cause the client to be banned. Target and outcome are filled in entry
+func (s *Server) submitJob(client *Client, jobId *Job, nonce uint32, resultHash types.Hash, entry *SubmitLogEntry) (error, bool) {
+	if e, ok := func() (*MinerTrackingEntry, bool) {
+		s.minersLock.RLock()
+		defer s.minersLock.RUnlock()
+		e, ok := s.miners[client.InternalId]
+		return e, ok
+	}(); ok {
+		b := &sidechain.PoolBlock{}
+		if blob := e.GetJobBlob(client, s.consensus, jobId, nonce); blob == nil {
+			return errors.New("invalid job id"), true
+		} else if err := b.UnmarshalBinary(s.consensus, s.derivationCache, blob); err != nil {
+			return err, true
+		} else {
+			powDiff := types.DifficultyFromPoW(resultHash)
+			entry.ClaimedDifficulty = powDiff
+			if s.solo != nil {
+				return s.submitSolo(b, resultHash, entry)
+			}
+			entry.Target = b.Side.Difficulty
+			if powDiff.Cmp(b.Side.Difficulty) >= 0 {
+				//passes difficulty
+				if err, ban := s.verifyResult(b, resultHash, entry); err != nil {
+					return err, ban
+				}
+				if err := s.SubmitFunc(b); err != nil {
+					return utils.ErrorfNoEscape("submit error: %w", err), true
+				}
+				entry.Outcome = SubmitOutcomeShare
+			} else {
+				// explicitly allow low diff shares that pass main difficulty but not sidechain one, useful for testnet
+				if s.SubmitMainFunc != nil && powDiff.Cmp64(s.consensus.MinimumDifficulty) < 0 {
+					if mainDiff := func() types.Difficulty {
+						s.lock.RLock()
+						defer s.lock.RUnlock()
+						if s.minerData == nil {
+							return types.ZeroDifficulty
+						}
+						return s.minerData.Difficulty
+					}(); mainDiff != types.ZeroDifficulty && mainDiff.CheckPoW(resultHash) {
+						//passes main difficulty
+						entry.Target = mainDiff
+						if err, ban := s.verifyResult(b, resultHash, entry); err != nil {
+							return err, ban
+						}
+						if err := s.SubmitMainFunc(&b.Main); err != nil {
+							return utils.ErrorfNoEscape("submit main error: %w", err), false
+						}
+						entry.Outcome = SubmitOutcomeMainBlock
+						return nil, false
+					}
+				}
+				return errors.New("low difficulty share"), true
+			}
 		}
+	} else {
+		return errors.New("unknown miner"), true
 	}
+	return nil, false
 }
 
-func (s *Server) SendTemplate(c *Client, supportsTemplate bool) (err error) {
-	c.Lock.Lock()
-	defer c.Lock.Unlock()
+// verifyResult Calculates the proof of work of a pool block and checks it against the result sent by the client
+// The hash is cached in the block, so it is not calculated again when SubmitFunc verifies it. PowHash is filled in entry
+func (s *Server) verifyResult(b *sidechain.PoolBlock, resultHash types.Hash, entry *SubmitLogEntry) (error, bool) {
+	powHash, err := b.PowHashWithError(s.consensus.GetHasher(), s.sidechain.GetSeedByHeight)
+	if err != nil {
+		return utils.ErrorfNoEscape("could not calculate pow: %w", err), false
+	}
+	entry.PowHash = powHash
+	entry.VerifiedDifficulty = types.DifficultyFromPoW(powHash)
+	if powHash != resultHash {
+		return errors.New("invalid result hash"), true
+	}
+	return nil, false
+}
+
+// preparedJob Job data for a client, independent of protocol
+type preparedJob struct {
+	Template         *Template
+	Job              Job
+	MergeMiningExtra sidechain.MergeMiningExtra
+	Algo             string
+	Difficulty       types.Difficulty
+	SeedHash         types.Hash
+}
+
+// prepareJob Builds a new job for the client. Client must be locked
+func (s *Server) prepareJob(c *Client, supportsTemplate bool) (j preparedJob, err error) {
 	tpl, jobCounter, targetDifficulty, seedHash, err := s.BuildTemplate(c.InternalId, c.GetAddress, false)
 
 	if err != nil {
-		return err
+		return j, err
 	}
 
 	bufLen := tpl.HashingBlobBufferLength()
@@ -1672,10 +1884,10 @@ func (s *Server) SendTemplate(c *Client, supportsTemplate bool) (err error) {
 
 	mmExtra := jobId.MergeMiningExtra
 
-	shareVersion := tpl.ShareVersion(s.sidechain.Consensus())
+	shareVersion := tpl.ShareVersion(s.consensus)
 	algo := AlgoForMajorVersion(tpl.MajorVersion())
 	if !c.Extensions.HasAlgo(algo) {
-		return utils.ErrorfNoEscape("missing client algo %s", algo)
+		return j, utils.ErrorfNoEscape("missing client algo %s", algo)
 	}
 
 	if c.Subaddress != nil && tpl.MajorVersion() < monero.HardForkCarrotVersion && shareVersion >= sidechain.ShareVersion_V3 {
@@ -1687,27 +1899,54 @@ func (s *Server) SendTemplate(c *Client, supportsTemplate bool) (err error) {
 	mmExtra = mmExtra.Merge(c.MergeMiningExtra)
 
 	if shareVersion < sidechain.ShareVersion_V3 && len(mmExtra) > 0 {
-		return errors.New("unsupported merge mine extra")
+		return j, errors.New("unsupported merge mine extra")
 	}
 
 	// todo merkle root with merge mine
 	var templateId types.Hash
-	tpl.TemplateId(c.buf, s.sidechain.Consensus(), c.GetAddress(uint8(tpl.MajorVersion())), jobId.SideRandomNumber, jobId.SideExtraNonce, jobId.MerkleProof, mmExtra, p2pooltypes.CurrentSoftwareId, p2pooltypes.CurrentSoftwareVersion, &templateId)
+	tpl.TemplateId(c.buf, s.consensus, c.GetAddress(uint8(tpl.MajorVersion())), jobId.SideRandomNumber, jobId.SideExtraNonce, jobId.MerkleProof, mmExtra, p2pooltypes.CurrentSoftwareId, p2pooltypes.CurrentSoftwareVersion, &templateId)
 	jobId.MerkleRoot = templateId
 
+	return preparedJob{
+		Template:         tpl,
+		Job:              jobId,
+		MergeMiningExtra: mmExtra,
+		Algo:             algo,
+		Difficulty:       targetDifficulty,
+		SeedHash:         seedHash,
+	}, nil
+}
+
+func (s *Server) SendTemplate(c *Client, supportsTemplate bool) (err error) {
+	c.Lock.Lock()
+	defer c.Lock.Unlock()
+	if c.binary != nil {
+		return s.sendBinaryJob(c)
+	}
+	supportsTemplate = supportsTemplate || c.Extensions.Template
+
+	j, err := s.prepareJob(c, supportsTemplate)
+	if err != nil {
+		return err
+	}
+	tpl := j.Template
+
 	job := copyBaseJob()
-	job.Params.Blob = fasthex.EncodeToString(tpl.HashingBlob(c.buf, 0, jobId.ExtraNonce, jobId.MerkleRoot))
+	if supportsTemplate {
+		job.Params.Template = s.jobTemplate(c, tpl, j.Job, j.MergeMiningExtra)
+	}
+	job.Params.Blob = fasthex.EncodeToString(tpl.HashingBlob(c.buf, c.NonceStart(), j.Job.ExtraNonce, j.Job.MerkleRoot))
 	if c.Extensions.Algo {
-		job.Params.Algo = algo
+		job.Params.Algo = j.Algo
 	}
 
-	job.Params.JobId = jobId.Id()
+	job.Params.JobId = j.Job.Id()
 
-	target := targetDifficulty.Target()
+	target := j.Difficulty.Target()
 	job.Params.Target = TargetHex(target)
 	job.Params.Height = tpl.MainHeight
 	if tpl.MajorVersion() >= monero.HardForkRandomX {
-		job.Params.SeedHash = seedHash
+		job.Params.SeedHash = j.SeedHash
 	}
 
 	if err = c.encoder.Encode(job); err != nil {
@@ -1719,74 +1958,40 @@ func (s *Server) SendTemplate(c *Client, supportsTemplate bool) (err error) {
 func (s *Server) SendTemplateResponse(c *Client, id any, supportsTemplate bool) (err error) {
 	c.Lock.Lock()
 	defer c.Lock.Unlock()
-	tpl, jobCounter, targetDifficulty, seedHash, err := s.BuildTemplate(c.InternalId, c.GetAddress, false)
+	supportsTemplate = supportsTemplate || c.Extensions.Template
 
+	j, err := s.prepareJob(c, supportsTemplate)
 	if err != nil {
-		return
+		return err
 	}
+	tpl := j.Template
 
-	bufLen := tpl.HashingBlobBufferLength()
-	if cap(c.buf) < bufLen {
-		c.buf = make([]byte, 0, bufLen)
-	}
 	var hexBuf [4]byte
 	binary.LittleEndian.PutUint32(hexBuf[:], c.RpcId)
 
-	// #nosec G404
-	sideRandomNumber := unsafeRandom.Uint32()
-	// #nosec G404
-	sideExtraNonce := unsafeRandom.Uint32()
-	extraNonce := uint32(0)
-	if !supportsTemplate {
-		extraNonce = sideExtraNonce
-	}
-
-	jobId := Job{
-		TemplateCounter:  jobCounter,
-		ExtraNonce:       extraNonce,
-		SideRandomNumber: sideRandomNumber,
-		SideExtraNonce:   sideExtraNonce,
-	}
-
-	mmExtra := jobId.MergeMiningExtra
-
-	shareVersion := tpl.ShareVersion(s.sidechain.Consensus())
-	algo := AlgoForMajorVersion(tpl.MajorVersion())
-	if !c.Extensions.HasAlgo(algo) {
-		return utils.ErrorfNoEscape("missing client algo %s", algo)
-	}
-
-	if c.Subaddress != nil && tpl.MajorVersion() < monero.HardForkCarrotVersion && shareVersion >= sidechain.ShareVersion_V3 {
-		// explicitly add old subaddress tagging information before hardfork
-		var subaddressViewPubBuf [curve25519.PublicKeySize + 2]byte
-		copy(subaddressViewPubBuf[:], c.Subaddress.ViewPublicKey()[:])
-		mmExtra = mmExtra.Set(sidechain.ExtraChainKeySubaddressViewPub, subaddressViewPubBuf[:])
-	}
-	mmExtra = mmExtra.Merge(c.MergeMiningExtra)
-
-	if shareVersion < sidechain.ShareVersion_V3 && len(mmExtra) > 0 {
-		return errors.New("unsupported merge mine extra")
-	}
-
-	// todo merkle root with merge mine
-	var templateId types.Hash
-	tpl.TemplateId(c.buf, s.sidechain.Consensus(), c.GetAddress(uint8(tpl.MajorVersion())), jobId.SideRandomNumber, jobId.SideExtraNonce, jobId.MerkleProof, mmExtra, p2pooltypes.CurrentSoftwareId, p2pooltypes.CurrentSoftwareVersion, &templateId)
-	jobId.MerkleRoot = templateId
-
 	job := copyBaseResponseJob()
 	job.Id = id
 	job.Result.Id = fasthex.EncodeToString(hexBuf[:])
-	job.Result.Job.Blob = fasthex.EncodeToString(tpl.HashingBlob(c.buf, 0, jobId.ExtraNonce, jobId.MerkleRoot))
+	if supportsTemplate {
+		job.Result.Job.Template = s.jobTemplate(c, tpl, j.Job, j.MergeMiningExtra)
+	}
+	job.Result.Job.Blob = fasthex.EncodeToString(tpl.HashingBlob(c.buf, c.NonceStart(), j.Job.ExtraNonce, j.Job.MerkleRoot))
+	if c.Extensions.NiceHash {
+		job.Result.Extensions = append(slices.Clone(job.Result.Extensions), ExtensionNiceHash)
+	}
+	if c.Extensions.Template {
+		job.Result.Extensions = append(slices.Clone(job.Result.Extensions), ExtensionTemplate)
+	}
 	if c.Extensions.Algo {
-		job.Result.Job.Algo = algo
+		job.Result.Job.Algo = j.Algo
 	}
-	job.Result.Job.JobId = jobId.Id()
+	job.Result.Job.JobId = j.Job.Id()
 
-	target := targetDifficulty.Target()
+	target := j.Difficulty.Target()
 	job.Result.Job.Target = TargetHex(target)
 	job.Result.Job.Height = tpl.MainHeight
 	if tpl.MajorVersion() >= monero.HardForkRandomX {
-		job.Result.Job.SeedHash = seedHash
+		job.Result.Job.SeedHash = j.SeedHash
 	}
 
 	if err = c.encoder.Encode(job); err != nil {
@@ -1795,11 +2000,43 @@ func (s *Server) SendTemplateResponse(c *Client, id any, supportsTemplate bool)
 	return nil
 }
 
+// jobTemplate Creates the full template for template mode clients. Client must be locked
+func (s *Server) jobTemplate(c *Client, tpl *Template, jobId Job, mmExtra sidechain.MergeMiningExtra) *jsonRpcJobTemplate {
+	blob := tpl.Blob(nil, s.consensus, c.GetAddress(uint8(tpl.MajorVersion())), c.NonceStart(), jobId.ExtraNonce, jobId.SideRandomNumber, jobId.SideExtraNonce, jobId.MerkleRoot, jobId.MerkleProof, mmExtra, p2pooltypes.CurrentSoftwareId, p2pooltypes.CurrentSoftwareVersion)
+	if blob == nil {
+		return nil
+	}
+
+	return &jsonRpcJobTemplate{
+		BlockTemplateBlob:  fasthex.EncodeToString(blob[:tpl.TemplateSideDataOffset]),
+		SideData:           fasthex.EncodeToString(blob[tpl.TemplateSideDataOffset:]),
+		NonceOffset:        tpl.NonceOffset,
+		ExtraNonceOffset:   tpl.ExtraNonceOffset,
+		ExtraNonceSize:     4,
+		MerkleRootOffset:   tpl.MerkleRootOffset,
+		CoinbaseOffset:     tpl.CoinbaseOffset,
+		TransactionsOffset: tpl.TransactionsOffset,
+		MerkleBranch:       tpl.MainBranch(),
+	}
+}
+
 func (s *Server) CloseClient(c *Client) {
 	_ = c.Conn.Close()
 
 	//TODO: ban bad clients after n failed attempts
 
+	s.removeClient(c)
+	s.niceHash.Release(c)
+}
+
+func (s *Server) addClient(c *Client) {
+	s.clientsLock.Lock()
+	defer s.clientsLock.Unlock()
+	s.clients = append(s.clients, c)
+}
+
+// removeClient Removes the client from job updates, without closing its connection
+func (s *Server) removeClient(c *Client) {
 	s.clientsLock.Lock()
 	defer s.clientsLock.Unlock()
 	if i := slices.Index(s.clients, c); i != -1 {
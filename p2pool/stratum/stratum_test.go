@@ -18,6 +18,7 @@ import (
 	"git.gammaspectra.live/P2Pool/consensus/v5/monero/address"
 	"git.gammaspectra.live/P2Pool/consensus/v5/monero/block"
 	"git.gammaspectra.live/P2Pool/consensus/v5/monero/client"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/client/fakemonerod"
 	"git.gammaspectra.live/P2Pool/consensus/v5/monero/crypto"
 	"git.gammaspectra.live/P2Pool/consensus/v5/monero/crypto/curve25519"
 	"git.gammaspectra.live/P2Pool/consensus/v5/monero/randomx"
@@ -482,6 +483,61 @@ func testFromGenesis(t *testing.T, consensus *sidechain.Consensus, minerData *p2
 	}
 }
 
+// newFakePoolServer Creates a pool server from genesis on a test consensus backed by a fake monerod
+// Every hash passes side chain difficulty with the test hasher
+func newFakePoolServer(t *testing.T, submitFunc func(block *sidechain.PoolBlock) error) *Server {
+	t.Helper()
+
+	d, err := fakemonerod.New(fakemonerod.Config{Height: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = d.Close()
+	})
+
+	rpcClient, err := client.NewClient(d.RPCAddress(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	minerData, err := MinerDataFromDaemon(rpcClient, types.DonationAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	consensus := sidechain.NewConsensus(sidechain.NetworkMainnet, "test", "", "", 1, sidechain.SmallestMinimumDifficulty, 216, 20)
+	consensus.HardForks = []monero.HardFork{
+		{Version: uint8(sidechain.ShareVersion_V3)},
+	}
+	if err = consensus.InitTestHasher(); err != nil {
+		t.Fatal(err)
+	}
+
+	fakeServer := sidechain.GetFakeTestServerWithRPC(consensus, rpcClient)
+	// preload so it doesn't panic
+	fakeServer.GetDifficultyByHeight(randomx.SeedHeight(minerData.Height))
+
+	stratumServer := NewServer(sidechain.NewSideChain(fakeServer), submitFunc, func(b *block.PoolMainBlock) error {
+		return nil
+	})
+	stratumServer.SubmitLog = NewSubmitLog(16, time.Hour)
+	stratumServer.HandleMinerData(minerData)
+	func() {
+		//Process all incoming changes first
+		for {
+			select {
+			case f := <-stratumServer.incomingChanges:
+				if f() {
+					stratumServer.Update()
+				}
+			default:
+				return
+			}
+		}
+	}()
+	return stratumServer
+}
+
 func TestStratumServer_Genesis(t *testing.T) {
 	const n = 800
 	const window = 216
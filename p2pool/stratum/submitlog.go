@@ -0,0 +1,220 @@
+package stratum
+
+import (
+	"sync"
+	"time"
+
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/address"
+	"git.gammaspectra.live/P2Pool/consensus/v5/types"
+)
+
+type SubmitOutcome uint8
+
+const (
+	// SubmitOutcomeRejected Submit was rejected, see Error
+	SubmitOutcomeRejected = SubmitOutcome(iota)
+	// SubmitOutcomeShare Submit passed side chain difficulty and was added as a share
+	SubmitOutcomeShare
+	// SubmitOutcomeMainBlock Submit passed main difficulty and was submitted as a Monero block
+	SubmitOutcomeMainBlock
+)
+
+func (o SubmitOutcome) String() string {
+	switch o {
+	case SubmitOutcomeRejected:
+		return "rejected"
+	case SubmitOutcomeShare:
+		return "share"
+	case SubmitOutcomeMainBlock:
+		return "main_block"
+	default:
+		return "unknown"
+	}
+}
+
+func (o SubmitOutcome) MarshalText() ([]byte, error) {
+	return []byte(o.String()), nil
+}
+
+// SubmitLogEntry Record of a single submit, accepted or not
+type SubmitLogEntry struct {
+	Time     time.Time `json:"time"`
+	ClientId uint64    `json:"client_id"`
+	// Address Payout address of the client as sent on login. For subaddresses this is the subaddress itself
+	Address address.PackedAddress `json:"address"`
+	RigId   string                `json:"rig_id,omitempty"`
+	JobId   string                `json:"job_id,omitempty"`
+	Nonce   uint32                `json:"nonce"`
+	// ExtraNonce Extra nonce rolled by the client in template mode, nil when the job extra nonce was used
+	ExtraNonce *uint32    `json:"extra_nonce,omitempty"`
+	Result     types.Hash `json:"result"`
+
+	// ClaimedDifficulty Difficulty of the result hash as sent by the client. Not verified, do not use for accounting
+	ClaimedDifficulty types.Difficulty `json:"claimed_difficulty"`
+	// PowHash Proof of work hash calculated by the server, zero when it was not calculated
+	// It is calculated for every submit whose claimed result passes the target, a mismatch with Result means a forged result
+	PowHash types.Hash `json:"pow_hash,omitzero"`
+	// VerifiedDifficulty Difficulty of PowHash, zero when it was not calculated
+	VerifiedDifficulty types.Difficulty `json:"verified_difficulty,omitempty"`
+	// Target Difficulty the result was checked against, zero if rejected before
+	Target types.Difficulty `json:"target"`
+
+	Outcome SubmitOutcome `json:"outcome"`
+	Error   string        `json:"error,omitempty"`
+}
+
+// SubmitLogFilter Query parameters for SubmitLog.Query. Zero fields match everything
+type SubmitLogFilter struct {
+	Address *address.PackedAddress
+	// From Inclusive start time
+	From time.Time
+	// To Exclusive end time
+	To time.Time
+	// Limit Maximum number of entries returned, the most recent are kept
+	Limit int
+}
+
+func (f SubmitLogFilter) Match(e *SubmitLogEntry) bool {
+	if f.Address != nil && *f.Address != e.Address {
+		return false
+	}
+	if !f.From.IsZero() && e.Time.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !e.Time.Before(f.To) {
+		return false
+	}
+	return true
+}
+
+// SubmitLog Append-only in-memory audit log of submits, with bounded retention
+// Entries beyond maxEntries, or older than maxAge, are discarded oldest first
+type SubmitLog struct {
+	lock       sync.RWMutex
+	entries    []SubmitLogEntry
+	start      int
+	count      int
+	maxAge     time.Duration
+	maxEntries int
+}
+
+// NewSubmitLog Creates a log keeping up to maxEntries. If maxAge is non-zero, older entries are also discarded
+func NewSubmitLog(maxEntries int, maxAge time.Duration) *SubmitLog {
+	return &SubmitLog{
+		entries:    make([]SubmitLogEntry, max(maxEntries, 1)),
+		maxAge:     maxAge,
+		maxEntries: max(maxEntries, 1),
+	}
+}
+
+func (l *SubmitLog) Append(e SubmitLogEntry) {
+	if l == nil {
+		return
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.prune(e.Time)
+
+	if l.count == l.maxEntries {
+		// overwrite oldest
+		l.entries[l.start] = e
+		l.start = (l.start + 1) % l.maxEntries
+	} else {
+		l.entries[(l.start+l.count)%l.maxEntries] = e
+		l.count++
+	}
+}
+
+// prune Discards entries older than maxAge relative to now. Must be called with lock held
+func (l *SubmitLog) prune(now time.Time) {
+	if l.maxAge == 0 {
+		return
+	}
+	cutoff := now.Add(-l.maxAge)
+	for l.count > 0 && l.entries[l.start].Time.Before(cutoff) {
+		l.entries[l.start] = SubmitLogEntry{}
+		l.start = (l.start + 1) % l.maxEntries
+		l.count--
+	}
+}
+
+// Prune Discards expired entries. Entries are also pruned on Append
+func (l *SubmitLog) Prune() {
+	if l == nil {
+		return
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.prune(time.Now())
+}
+
+func (l *SubmitLog) Len() int {
+	if l == nil {
+		return 0
+	}
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	return l.count
+}
+
+// Query Returns matching entries, oldest first
+func (l *SubmitLog) Query(filter SubmitLogFilter) (result []SubmitLogEntry) {
+	if l == nil {
+		return nil
+	}
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
+	var cutoff time.Time
+	if l.maxAge != 0 {
+		cutoff = time.Now().Add(-l.maxAge)
+	}
+
+	// iterate newest first to apply limit, then reverse
+	for i := l.count - 1; i >= 0; i-- {
+		e := &l.entries[(l.start+i)%l.maxEntries]
+		if !cutoff.IsZero() && e.Time.Before(cutoff) {
+			break
+		}
+		if !filter.Match(e) {
+			continue
+		}
+		result = append(result, *e)
+		if filter.Limit > 0 && len(result) >= filter.Limit {
+			break
+		}
+	}
+	for i, j := 0, len(result)-1; i < j; i, j = i+1, j-1 {
+		result[i], result[j] = result[j], result[i]
+	}
+	return result
+}
+
+// newSubmitLogEntry Creates an entry with client details filled in
+func newSubmitLogEntry(client *Client) SubmitLogEntry {
+	client.Lock.RLock()
+	defer client.Lock.RUnlock()
+	e := SubmitLogEntry{
+		Time:     time.Now(),
+		ClientId: client.InternalId,
+		Address:  client.Address,
+		RigId:    client.RigId,
+	}
+	if client.Subaddress != nil {
+		e.Address = *client.Subaddress
+	}
+	return e
+}
+
+// logSubmit Records the submit outcome if a SubmitLog is set
+func (s *Server) logSubmit(e *SubmitLogEntry, err error) {
+	if s.SubmitLog == nil {
+		return
+	}
+	if err != nil {
+		e.Outcome = SubmitOutcomeRejected
+		e.Error = err.Error()
+	}
+	s.SubmitLog.Append(*e)
+}
@@ -0,0 +1,115 @@
+package stratum
+
+import (
+	"testing"
+	"time"
+
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/address"
+	"git.gammaspectra.live/P2Pool/consensus/v5/monero/crypto/curve25519"
+	"git.gammaspectra.live/P2Pool/consensus/v5/p2pool/sidechain"
+	"git.gammaspectra.live/P2Pool/consensus/v5/types"
+)
+
+func TestSubmitLog(t *testing.T) {
+	var addrA, addrB address.PackedAddress
+	addrA[0] = curve25519.PublicKeyBytes{1}
+	addrB[0] = curve25519.PublicKeyBytes{2}
+
+	now := time.Now()
+
+	l := NewSubmitLog(4, time.Hour)
+	for i := range 6 {
+		e := SubmitLogEntry{
+			Time:  now.Add(time.Duration(i-6) * time.Minute),
+			Nonce: uint32(i),
+		}
+		if i%2 == 0 {
+			e.Address = addrA
+		} else {
+			e.Address = addrB
+		}
+		l.Append(e)
+	}
+
+	if l.Len() != 4 {
+		t.Fatalf("expected 4 entries, got %d", l.Len())
+	}
+
+	all := l.Query(SubmitLogFilter{})
+	if len(all) != 4 || all[0].Nonce != 2 || all[3].Nonce != 5 {
+		t.Fatalf("unexpected entries %+v", all)
+	}
+
+	if r := l.Query(SubmitLogFilter{Address: &addrA}); len(r) != 2 || r[0].Nonce != 2 || r[1].Nonce != 4 {
+		t.Fatalf("unexpected address entries %+v", r)
+	}
+
+	if r := l.Query(SubmitLogFilter{From: now.Add(-3 * time.Minute), To: now.Add(-time.Minute)}); len(r) != 2 || r[0].Nonce != 3 || r[1].Nonce != 4 {
+		t.Fatalf("unexpected time range entries %+v", r)
+	}
+
+	if r := l.Query(SubmitLogFilter{Limit: 1}); len(r) != 1 || r[0].Nonce != 5 {
+		t.Fatalf("unexpected limited entries %+v", r)
+	}
+
+	// entries older than max age are discarded
+	l.Append(SubmitLogEntry{Time: now.Add(2 * time.Hour), Nonce: 6})
+	if r := l.Query(SubmitLogFilter{}); l.Len() != 1 || len(r) != 1 || r[0].Nonce != 6 {
+		t.Fatalf("unexpected entries after expiry %d %+v", l.Len(), r)
+	}
+}
+
+func TestSubmitLogPowHash(t *testing.T) {
+	var submitted []*sidechain.PoolBlock
+	stratumServer := newFakePoolServer(t, func(block *sidechain.PoolBlock) error {
+		submitted = append(submitted, block)
+		return nil
+	})
+
+	c := &Client{
+		InternalId: 1,
+		Address:    donationAddr.ToPackedAddress(),
+	}
+	c.Lock.Lock()
+	j, err := stratumServer.prepareJob(c, false)
+	c.Lock.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const nonce = 5
+	blob := j.Template.HashingBlob(nil, nonce, j.Job.ExtraNonce, j.Job.MerkleRoot)
+	result, err := stratumServer.consensus.GetHasher().Hash(j.SeedHash[:], blob)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// forged result that passes the target, but is not the proof of work of the block
+	forged := result
+	forged[0] ^= 0xff
+	if types.DifficultyFromPoW(forged).Cmp(j.Difficulty) < 0 {
+		t.Fatal("forged result does not pass target")
+	}
+
+	for _, hash := range []types.Hash{forged, result} {
+		entry := SubmitLogEntry{ClientId: c.InternalId, Nonce: nonce, Result: hash}
+		err, _ := stratumServer.submitJob(c, &j.Job, nonce, hash, &entry)
+		stratumServer.logSubmit(&entry, err)
+	}
+
+	entries := stratumServer.SubmitLog.Query(SubmitLogFilter{})
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+
+	if e := entries[0]; e.Outcome != SubmitOutcomeRejected || e.PowHash != result || e.PowHash == e.Result || e.VerifiedDifficulty != types.DifficultyFromPoW(result) {
+		t.Fatalf("forged result not recorded as mismatch %+v", e)
+	}
+	if e := entries[1]; e.Outcome != SubmitOutcomeShare || e.PowHash != e.Result || e.VerifiedDifficulty != e.ClaimedDifficulty {
+		t.Fatalf("unexpected share entry %+v", e)
+	}
+
+	if len(submitted) != 1 {
+		t.Fatalf("expected 1 submitted share, got %d", len(submitted))
+	}
+}
@@ -376,6 +376,20 @@ func (tpl *Template) HashingBlob(preAllocatedBuffer []byte, nonce, extraNonce ui
 	return buf
 }
 
+// MainBranch Returns the merkle branch used to calculate the merkle root from the coinbase transaction id
+// Root is calculated by hashing keccak(root || branch[i]) in order, starting with the coinbase transaction id
+func (tpl *Template) MainBranch() []types.Hash {
+	if tpl.MajorVersion() < monero.HardForkFCMPPlusPlus {
+		numTransactions, n := utils.CanonicalUvarint(tpl.Buffer[tpl.TransactionsOffset:])
+		if numTransactions < 1 {
+			return nil
+		} else if numTransactions < 2 {
+			return []types.Hash{types.Hash(tpl.Buffer[tpl.TransactionsOffset+n : tpl.TransactionsOffset+n+types.HashSize])}
+		}
+	}
+	return tpl.MerkleTreeMainBranch
+}
+
 func TemplateFromPoolBlock(consensus *sidechain.Consensus, b *sidechain.PoolBlock) (tpl *Template, err error) {
 	version := b.ShareVersion()
 	if version < sidechain.ShareVersion_V1 || version > sidechain.ShareVersion_V3 {
@@ -2,7 +2,13 @@ package stratum
 
 import (
 	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
 	unsafeRandom "math/rand/v2"
+	"net"
+	"net/netip"
 	"testing"
 
 	"git.gammaspectra.live/P2Pool/consensus/v5/monero/address"
@@ -104,6 +110,15 @@ func TestTemplate(t *testing.T) {
 		t.Fatal("different hashing blob buffer length from blob")
 	}
 
+	// root from main branch must match the one in hashing blob
+	mainRoot := coinbaseId
+	for _, h := range tpl.MainBranch() {
+		mainRoot = crypto.Keccak256Var(mainRoot[:], h[:])
+	}
+	if types.Hash(bHashingBlob[tpl.NonceOffset+4:tpl.NonceOffset+4+types.HashSize]) != mainRoot {
+		t.Fatal("different merkle root from main branch")
+	}
+
 }
 
 func BenchmarkTemplate_CoinbaseId(b *testing.B) {
@@ -182,3 +197,181 @@ func BenchmarkTemplate_TemplateId(b *testing.B) {
 	})
 	b.ReportAllocs()
 }
+
+type jsonTestConn struct {
+	t       *testing.T
+	conn    net.Conn
+	encoder *json.Encoder
+	decoder *json.Decoder
+	done    chan struct{}
+}
+
+func newJSONTestConn(t *testing.T, s *Server, addrPort netip.AddrPort) *jsonTestConn {
+	serverConn, clientConn := net.Pipe()
+	c := &jsonTestConn{
+		t:       t,
+		conn:    clientConn,
+		encoder: json.NewEncoder(clientConn),
+		decoder: json.NewDecoder(clientConn),
+		done:    make(chan struct{}),
+	}
+	go func() {
+		defer close(c.done)
+		s.handleConn(serverConn, addrPort)
+	}()
+	return c
+}
+
+func (c *jsonTestConn) Call(id uint64, method string, params map[string]any, result any) {
+	c.t.Helper()
+	if err := c.encoder.Encode(JsonRpcMessage{
+		Id:             id,
+		JsonRpcVersion: "2.0",
+		Method:         method,
+		Params:         params,
+	}); err != nil {
+		c.t.Fatal(err)
+	}
+	if err := c.decoder.Decode(result); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// Closed Waits for the server to close the connection
+func (c *jsonTestConn) Closed() {
+	c.t.Helper()
+	var msg JsonRpcResult
+	if err := c.decoder.Decode(&msg); !errors.Is(err, io.EOF) {
+		c.t.Fatalf("expected closed connection, got %v", err)
+	}
+	<-c.done
+}
+
+func TestTemplateSubmit(t *testing.T) {
+	submitted := make(chan *sidechain.PoolBlock, 1)
+	stratumServer := newFakePoolServer(t, func(block *sidechain.PoolBlock) error {
+		submitted <- block
+		return nil
+	})
+
+	// loopback addresses are never banned
+	addrPort := netip.MustParseAddrPort("192.0.2.1:3333")
+
+	login := func(c *jsonTestConn, extensions ...string) (job jsonRpcJobParams) {
+		t.Helper()
+		var response JsonRpcResponseJob
+		c.Call(1, "login", map[string]any{
+			"login":      types.DonationAddress,
+			"agent":      "test/1.0",
+			"extensions": extensions,
+		}, &response)
+		if response.Result.Status != "OK" {
+			t.Fatalf("login failed %+v", response)
+		}
+		return response.Result.Job
+	}
+
+	t.Run("Template", func(t *testing.T) {
+		c := newJSONTestConn(t, stratumServer, addrPort)
+		defer c.conn.Close()
+
+		job := login(c, ExtensionTemplate)
+		tpl := job.Template
+		if tpl == nil {
+			t.Fatal("no template in job")
+		}
+		if tpl.ExtraNonceSize != 4 {
+			t.Fatalf("unexpected extra nonce size %d", tpl.ExtraNonceSize)
+		}
+
+		blob, err := fasthex.DecodeString(tpl.BlockTemplateBlob + tpl.SideData)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// roll extra nonce and nonce locally, as a miner would
+		const nonce, extraNonce = uint32(7), uint32(0x12345678)
+		binary.LittleEndian.PutUint32(blob[tpl.NonceOffset:], nonce)
+		binary.LittleEndian.PutUint32(blob[tpl.ExtraNonceOffset:], extraNonce)
+
+		local := &sidechain.PoolBlock{}
+		if err = local.UnmarshalBinary(stratumServer.consensus, &sidechain.NilDerivationCache{}, blob); err != nil {
+			t.Fatal(err)
+		}
+		if local.ExtraNonce() != extraNonce || local.Main.Nonce != nonce {
+			t.Fatalf("unexpected local block extra nonce %08x nonce %08x", local.ExtraNonce(), local.Main.Nonce)
+		}
+		hashingBlob := local.Main.HashingBlob(nil)
+
+		// root from the sent merkle branch must match the one in the local hashing blob
+		mainRoot := local.Main.Coinbase.Hash()
+		for _, h := range tpl.MerkleBranch {
+			mainRoot = crypto.Keccak256Var(mainRoot[:], h[:])
+		}
+		if types.Hash(hashingBlob[tpl.NonceOffset+4:tpl.NonceOffset+4+types.HashSize]) != mainRoot {
+			t.Fatal("different merkle root from main branch")
+		}
+
+		result, err := stratumServer.consensus.GetHasher().Hash(job.SeedHash[:], hashingBlob)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var nonceBuf, extraNonceBuf [4]byte
+		binary.LittleEndian.PutUint32(nonceBuf[:], nonce)
+		binary.LittleEndian.PutUint32(extraNonceBuf[:], extraNonce)
+
+		var response JsonRpcResult
+		c.Call(2, "submit", map[string]any{
+			"job_id":      job.JobId,
+			"nonce":       fasthex.EncodeToString(nonceBuf[:]),
+			"extra_nonce": fasthex.EncodeToString(extraNonceBuf[:]),
+			"result":      result.String(),
+		}, &response)
+		if response.Error != nil {
+			t.Fatalf("submit failed %+v", response.Error)
+		}
+
+		b := <-submitted
+		if !bytes.Equal(b.Main.HashingBlob(nil), hashingBlob) {
+			t.Fatal("rebuilt block hashing blob does not match local block")
+		}
+		if b.Main.Coinbase.Hash() != local.Main.Coinbase.Hash() {
+			t.Fatal("rebuilt block coinbase id does not match local block")
+		}
+		if b.ExtraNonce() != extraNonce {
+			t.Fatalf("rebuilt block extra nonce %08x, expected %08x", b.ExtraNonce(), extraNonce)
+		}
+
+		entries := stratumServer.SubmitLog.Query(SubmitLogFilter{Limit: 1})
+		if len(entries) != 1 || entries[0].ExtraNonce == nil || *entries[0].ExtraNonce != extraNonce || entries[0].PowHash != result {
+			t.Fatalf("unexpected log entries %+v", entries)
+		}
+	})
+
+	t.Run("ExtraNonceWithoutTemplate", func(t *testing.T) {
+		c := newJSONTestConn(t, stratumServer, addrPort)
+		defer c.conn.Close()
+
+		job := login(c)
+		if job.Template != nil {
+			t.Fatal("template sent without template extension")
+		}
+
+		var response JsonRpcResult
+		c.Call(2, "submit", map[string]any{
+			"job_id":      job.JobId,
+			"nonce":       "00000000",
+			"extra_nonce": "00000000",
+			"result":      types.ZeroHash.String(),
+		}, &response)
+		if errMap, ok := response.Error.(map[string]any); !ok || errMap["message"] != "extra_nonce specified without template extension" {
+			t.Fatalf("unexpected response %+v", response)
+		}
+		c.Closed()
+
+		if len(submitted) != 0 {
+			t.Fatal("share submitted")
+		}
+	})
+}